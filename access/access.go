@@ -0,0 +1,208 @@
+// Package access decides whether credentials presented at a door open it.
+// The master and door nodes, including nodes deciding offline, share Decide
+// so that they follow the same rules.
+package access
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pakohan/craftdoor/config"
+)
+
+// Policy is what a door requires to open, see config.DoorConfig.Auth.
+type Policy string
+
+const (
+	// PolicyTag admits members presenting one of their tags.
+	PolicyTag Policy = "tag"
+
+	// PolicyTagPIN admits members presenting one of their tags followed by
+	// their PIN.
+	PolicyTagPIN Policy = "tag+pin"
+
+	// PolicyPIN admits members entering their member ID and PIN.
+	PolicyPIN Policy = "pin"
+)
+
+// ParsePolicy parses a config.DoorConfig.Auth value. "" is PolicyTag.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case "":
+		return PolicyTag, nil
+	case PolicyTag, PolicyTagPIN, PolicyPIN:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown auth policy %q", s)
+}
+
+// NeedsPIN returns whether the policy requires a PIN.
+func (p Policy) NeedsPIN() bool {
+	return p == PolicyTagPIN || p == PolicyPIN
+}
+
+func init() {
+	config.RegisterValidator(func(cfg *config.Config) error {
+		p, err := ParsePolicy(cfg.Door.Auth)
+		if err != nil {
+			return fmt.Errorf("door.auth: %s", err)
+		}
+		if p.NeedsPIN() && cfg.Door.Keypad.Type == "none" {
+			return fmt.Errorf("door.auth %q requires a door.keypad", p)
+		}
+		for _, node := range cfg.Nodes {
+			_, err := ParsePolicy(node.Auth)
+			if err != nil {
+				return fmt.Errorf("nodes: auth of %q: %s", node.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Reason explains a decision. Recorded in the access log.
+type Reason string
+
+const (
+	// ReasonGranted means the credentials opened the door.
+	ReasonGranted Reason = "granted"
+
+	// ReasonUnknownTag means the tag doesn't belong to a member.
+	ReasonUnknownTag Reason = "unknown_tag"
+
+	// ReasonInvalidUID means the tag's UID isn't a valid credential ID, e.g.
+	// because it has an unsupported length.
+	ReasonInvalidUID Reason = "invalid_uid"
+
+	// ReasonUnknownMember means the entered member ID doesn't exist.
+	ReasonUnknownMember Reason = "unknown_member"
+
+	// ReasonLockdown means the door is in lockdown and the member isn't
+	// emergency staff.
+	ReasonLockdown Reason = "lockdown"
+
+	// ReasonPINNotSet means the door requires a PIN and the member has none.
+	ReasonPINNotSet Reason = "pin_not_set"
+
+	// ReasonNoPIN means the door requires a PIN and none was entered in
+	// time.
+	ReasonNoPIN Reason = "no_pin"
+
+	// ReasonWrongPIN means the entered PIN isn't the member's.
+	ReasonWrongPIN Reason = "wrong_pin"
+
+	// ReasonLockedOut means the keypad is locked after too many wrong PINs.
+	ReasonLockedOut Reason = "locked_out"
+
+	// ReasonOfflinePolicy means a node that couldn't reach the master let an
+	// unknown tag in, see config.MasterConfig.OfflineUnknownTags.
+	ReasonOfflinePolicy Reason = "offline_policy"
+
+	// ReasonMasterRejected means the master explicitly denied a node's
+	// request, e.g. because the node is no longer configured.
+	ReasonMasterRejected Reason = "master_rejected"
+)
+
+// Member is what decisions need to know about a member.
+type Member struct {
+	// Member ID.
+	ID int64 `json:"id" db:"id"`
+
+	// Whether the member is admitted during a lockdown.
+	EmergencyStaff bool `json:"emergency_staff" db:"emergency_staff"`
+
+	// Whether the member's arrival starts opening windows under a first-in
+	// policy.
+	Keyholder bool `json:"keyholder" db:"keyholder"`
+
+	// Hash of the member's PIN, see HashPIN. Empty if the member has none.
+	PINHash string `json:"pin_hash,omitempty" db:"pin_hash"`
+}
+
+// Credentials are what was presented at a door.
+type Credentials struct {
+	// Hex-encoded UID of the presented tag. Empty under PolicyPIN.
+	UID string
+
+	// Entered member ID. 0 unless under PolicyPIN.
+	MemberID int64
+
+	// Entered PIN. Empty if none was entered.
+	PIN string
+
+	// Whether the door's keypad is locked after too many wrong PINs.
+	LockedOut bool
+}
+
+// ErrMalformedEntry is returned by ParseEntry.
+var ErrMalformedEntry = errors.New(`entry is not "<member ID>*<PIN>"`)
+
+// ParseEntry parses a keypad entry made under PolicyPIN: the member ID, '*'
+// and the PIN, without the final '#'.
+func ParseEntry(entry string) (int64, string, error) {
+	i := strings.IndexRune(entry, '*')
+	if i < 0 {
+		return 0, "", ErrMalformedEntry
+	}
+	id, err := strconv.ParseInt(entry[:i], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, "", ErrMalformedEntry
+	}
+	return id, entry[i+1:], nil
+}
+
+// Result is a decision.
+type Result struct {
+	// Whether the door opens.
+	Granted bool
+
+	// Whether the member is a keyholder, see door.Door.KeyholderIn. Only set
+	// if granted.
+	Keyholder bool
+
+	// ID of the identified member. Nil if none was identified.
+	MemberID *int64
+
+	// Why the door opens or not.
+	Reason Reason
+}
+
+// CountsAsWrongPIN returns whether the result counts towards locking the
+// keypad: a wrong PIN, or a guessed member ID.
+func (r Result) CountsAsWrongPIN() bool {
+	return r.Reason == ReasonWrongPIN || r.Reason == ReasonUnknownMember
+}
+
+// Decide decides whether creds open a door with policy. member is who creds
+// identify, by their UID or member ID, or nil if they identify no one.
+// lockdown is whether the door is in lockdown.
+func Decide(policy Policy, lockdown bool, creds Credentials, member *Member) Result {
+	res := Result{}
+	if member != nil {
+		id := member.ID
+		res.MemberID = &id
+	}
+	switch {
+	case creds.LockedOut:
+		res.Reason = ReasonLockedOut
+	case member == nil && policy == PolicyPIN:
+		res.Reason = ReasonUnknownMember
+	case member == nil:
+		res.Reason = ReasonUnknownTag
+	case lockdown && !member.EmergencyStaff:
+		res.Reason = ReasonLockdown
+	case policy.NeedsPIN() && member.PINHash == "":
+		res.Reason = ReasonPINNotSet
+	case policy.NeedsPIN() && creds.PIN == "":
+		res.Reason = ReasonNoPIN
+	case policy.NeedsPIN() && !VerifyPIN(member.PINHash, creds.PIN):
+		res.Reason = ReasonWrongPIN
+	default:
+		res.Granted = true
+		res.Keyholder = member.Keyholder
+		res.Reason = ReasonGranted
+	}
+	return res
+}
@@ -0,0 +1,57 @@
+package access
+
+import (
+	"context"
+	"time"
+
+	"github.com/pakohan/craftdoor/door"
+)
+
+// ReadEntry waits for an entry of the form "<member ID>*<PIN>#" on pad, for
+// use under PolicyPIN. Returns door.ErrEntryTimeout if no entry was made
+// within timeout. A malformed entry identifies no one.
+func ReadEntry(ctx context.Context, pad *door.PINPad, timeout time.Duration) (Credentials, error) {
+	entry, err := pad.Next(ctx, timeout)
+	if err != nil {
+		return Credentials{}, err
+	}
+	creds := Credentials{}
+	creds.LockedOut, _ = pad.LockedOut()
+	id, pin, err := ParseEntry(entry)
+	if err == nil {
+		creds.MemberID, creds.PIN = id, pin
+	}
+	return creds, nil
+}
+
+// ReadPIN waits for the PIN following tag uid on pad, for use under
+// PolicyTagPIN. Keys pressed before the call are ignored. If no PIN is entered
+// in time, the credentials have none. Returns an error only if reading the
+// keypad failed, e.g. because ctx is done.
+func ReadPIN(ctx context.Context, pad *door.PINPad, uid string) (Credentials, error) {
+	creds := Credentials{UID: uid}
+	creds.LockedOut, _ = pad.LockedOut()
+	if creds.LockedOut {
+		return creds, nil
+	}
+
+	pad.Reset()
+	pin, err := pad.Next(ctx, pad.EntryTimeout())
+	if err == door.ErrEntryTimeout {
+		return creds, nil
+	}
+	creds.PIN = pin
+	return creds, err
+}
+
+// CountAttempt counts res towards locking pad after too many wrong PINs.
+// Returns whether pad was locked.
+func CountAttempt(pad *door.PINPad, res Result) bool {
+	switch {
+	case res.CountsAsWrongPIN():
+		return pad.Failed()
+	case res.Granted:
+		pad.Succeeded()
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package access
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Length of PINs, in digits.
+	minPINLength = 4
+	maxPINLength = 8
+
+	// PBKDF2 parameters of new hashes. Verifying a PIN takes about 100ms on
+	// a Raspberry Pi 3.
+	pinIterations = 100000
+	pinSaltSize   = 16
+	pinHashSize   = 32
+
+	// Prefix of hashes made by HashPIN.
+	pinHashScheme = "pbkdf2-sha256"
+)
+
+// ValidatePIN returns an error unless pin is 4 to 8 digits.
+func ValidatePIN(pin string) error {
+	if len(pin) < minPINLength || len(pin) > maxPINLength {
+		return fmt.Errorf("PIN must have %d to %d digits", minPINLength, maxPINLength)
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("PIN must only have digits")
+		}
+	}
+	return nil
+}
+
+// HashPIN returns a salted PBKDF2-HMAC-SHA256 hash of pin, encoded as
+// "pbkdf2-sha256$<iterations>$<salt>$<hash>" with base64-encoded salt and
+// hash.
+func HashPIN(pin string) (string, error) {
+	err := ValidatePIN(pin)
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, pinSaltSize)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	hash := pbkdf2([]byte(pin), salt, pinIterations, pinHashSize)
+	return fmt.Sprintf("%s$%d$%s$%s", pinHashScheme, pinIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// VerifyPIN returns whether pin matches hash, as returned by HashPIN.
+func VerifyPIN(hash string, pin string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != pinHashScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	got := pbkdf2([]byte(pin), salt, iterations, len(want))
+	return hmac.Equal(got, want)
+}
+
+// pbkdf2 derives a key of size bytes from password and salt with
+// PBKDF2-HMAC-SHA256, as specified by RFC 8018.
+func pbkdf2(password, salt []byte, iterations, size int) []byte {
+	prf := hmac.New(sha256.New, password)
+	result := []byte{}
+	for block := uint32(1); len(result) < size; block++ {
+		// U_1 = PRF(password, salt || INT(block))
+		prf.Reset()
+		prf.Write(salt)
+		index := [4]byte{}
+		binary.BigEndian.PutUint32(index[:], block)
+		prf.Write(index[:])
+		u := prf.Sum(nil)
+
+		// T = U_1 ^ U_2 ^ ... ^ U_iterations
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		result = append(result, t...)
+	}
+	return result[:size]
+}
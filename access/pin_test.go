@@ -0,0 +1,89 @@
+package access
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// TestPBKDF2 checks pbkdf2 against the PBKDF2-HMAC-SHA256 equivalents of the
+// RFC 6070 test vectors, and those of RFC 7914, section 11.
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+		{"pass\x00word", "sa\x00lt", 4096, "89b69d0516f829893c696226650a8687"},
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tt := range tests {
+		got := pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations, len(tt.want)/2)
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("pbkdf2(%q, %q, %d) = %x, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestHashPIN(t *testing.T) {
+	hash, err := HashPIN("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$100000$") {
+		t.Errorf("HashPIN(1234) = %q, want prefix pbkdf2-sha256$100000$", hash)
+	}
+	if !VerifyPIN(hash, "1234") {
+		t.Error("VerifyPIN rejected the hashed PIN")
+	}
+	if VerifyPIN(hash, "1235") {
+		t.Error("VerifyPIN accepted a wrong PIN")
+	}
+
+	other, err := HashPIN("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Error("HashPIN returned the same hash twice, want a random salt")
+	}
+
+	for _, pin := range []string{"", "123", "123456789", "12a4", "１２３４"} {
+		_, err := HashPIN(pin)
+		if err == nil {
+			t.Errorf("HashPIN(%q) succeeded, want error", pin)
+		}
+	}
+}
+
+func TestVerifyPIN(t *testing.T) {
+	// PBKDF2-HMAC-SHA256 of "1234" with salt "salt" and 2 iterations.
+	const hash = "pbkdf2-sha256$2$c2FsdA$Alv4RqSGkwQKLCiemtQPQFUd0g1Qkf/PAx5QrqbbaIY"
+	tests := []struct {
+		hash string
+		pin  string
+		want bool
+	}{
+		{hash, "1234", true},
+		{hash, "4321", false},
+		{strings.Replace(hash, "$2$", "$3$", 1), "1234", false},
+		{strings.Replace(hash, "sha256", "sha1", 1), "1234", false},
+		{"pbkdf2-sha256$0$c2FsdA$Alv4RqSGkwQKLCiemtQPQFUd0g1Qkf/PAx5QrqbbaIY", "1234", false},
+		{"pbkdf2-sha256$2$c2FsdA$", "1234", false},
+		{"pbkdf2-sha256$2$!!$Alv4RqSGkwQKLCiemtQPQFUd0g1Qkf/PAx5QrqbbaIY", "1234", false},
+		{"1234", "1234", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got := VerifyPIN(tt.hash, tt.pin)
+		if got != tt.want {
+			t.Errorf("VerifyPIN(%q, %q) = %t, want %t", tt.hash, tt.pin, got, tt.want)
+		}
+	}
+}
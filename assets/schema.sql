@@ -1,6 +1,9 @@
 CREATE TABLE "main"."member" (
   "id"         INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
-  "name"       TEXT NOT NULL UNIQUE
+  "name"       TEXT NOT NULL UNIQUE,
+  "emergency_staff" BOOLEAN NOT NULL DEFAULT 0,
+  "keyholder"  BOOLEAN NOT NULL DEFAULT 0,
+  "pin_hash"   TEXT NOT NULL DEFAULT ''
 );
 
 --
@@ -8,5 +11,44 @@ CREATE TABLE "main"."member" (
 CREATE TABLE "main"."key" (
   "id"         INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
   "uuid"       TEXT NOT NULL UNIQUE,
-  "member_id"  INTEGER REFERENCES "member"(id) ON DELETE SET NULL
-);
\ No newline at end of file
+  "member_id"  INTEGER REFERENCES "member"(id) ON DELETE SET NULL,
+  "card_type"  TEXT NOT NULL DEFAULT 'unknown'
+);
+
+--
+
+CREATE TABLE "main"."calendar" (
+  "id"         INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
+  "date"       TEXT NOT NULL,
+  "kind"       TEXT NOT NULL,
+  "windows"    TEXT NOT NULL DEFAULT '',
+  "summary"    TEXT NOT NULL DEFAULT '',
+  "uid"        TEXT UNIQUE
+);
+
+--
+
+CREATE TABLE "main"."door_mode" (
+  "door_id"    TEXT NOT NULL PRIMARY KEY,
+  "mode"       TEXT NOT NULL,
+  "until"      DATETIME
+);
+
+--
+
+CREATE TABLE "main"."access_log" (
+  "id"         INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
+  "time"       DATETIME NOT NULL,
+  "door_id"    TEXT NOT NULL,
+  "node_id"    TEXT NOT NULL DEFAULT '',
+  "key_uuid"   TEXT NOT NULL,
+  "granted"    BOOLEAN NOT NULL,
+  "offline"    BOOLEAN NOT NULL DEFAULT 0,
+  "member_id"  INTEGER,
+  "reason"     TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX "access_log_time" ON "access_log" ("time");
+
+--
+
+PRAGMA user_version = 7;
@@ -0,0 +1,60 @@
+// Package clock abstracts the passage of time, so that time-dependent logic
+// such as door schedules can run against a fake clock.
+package clock
+
+import (
+	"time"
+)
+
+// Clock tells the time and creates timers.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer returns a Timer that fires after d.
+	NewTimer(d time.Duration) Timer
+
+	// Sleep blocks for d.
+	Sleep(d time.Duration)
+}
+
+// Timer is a single event, like time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is delivered when the timer
+	// fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing. Returns false if the timer has
+	// already fired or been stopped.
+	Stop() bool
+
+	// Reset changes the timer to fire after d. Returns true if the timer had
+	// been active. Like time.Timer.Reset, it should only be called on stopped
+	// or fired timers with drained channels.
+	Reset(d time.Duration) bool
+}
+
+// Real is the system clock.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
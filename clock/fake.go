@@ -0,0 +1,187 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only changes when Advance or Set is called.
+// Timers fire, in order, as the time passes their deadline.
+//
+// Goroutines react to fired timers asynchronously. Use BlockUntil to wait for
+// them to arm their next timer before advancing further.
+type Fake struct {
+	// Guards all fields below. cond is signalled whenever the set of active
+	// timers changes.
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFake returns a Fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	result := &Fake{now: now}
+	result.cond = sync.NewCond(&result.mu)
+	return result
+}
+
+// Now returns the fake time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// NewTimer returns a Timer that fires once the fake time has advanced by d.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{
+		clock: f,
+		c:     make(chan time.Time, 1),
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.schedule(t, d)
+	return t
+}
+
+// Sleep blocks until the fake time has advanced by d.
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.NewTimer(d).C()
+}
+
+// Advance moves the fake time forward by d, firing all timers due in that
+// period in order. Each timer observes the time it was due at.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advanceTo(f.now.Add(d))
+}
+
+// Set moves the fake time forward to t, like Advance. Does nothing if t is
+// not after the fake time.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advanceTo(t)
+}
+
+// Next returns the deadline of the earliest active timer, and false if there
+// is none.
+func (f *Fake) Next() (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.timers) == 0 {
+		return time.Time{}, false
+	}
+	return f.timers[0].when, true
+}
+
+// BlockUntil waits until at least n timers are active.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.timers) < n {
+		f.cond.Wait()
+	}
+}
+
+// AdvanceWhile calls fn, e.g. to stop goroutines waiting for timers, and
+// fires the earliest timer whenever fn hasn't returned within a millisecond
+// of real time, until it does. Returns fn's error.
+func (f *Fake) AdvanceWhile(fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(time.Millisecond):
+		}
+		next, ok := f.Next()
+		if ok {
+			f.Set(next)
+		}
+	}
+}
+
+// advanceTo fires due timers and sets the time to t. Must be called with mu
+// held.
+func (f *Fake) advanceTo(t time.Time) {
+	for len(f.timers) > 0 && !f.timers[0].when.After(t) {
+		timer := f.timers[0]
+		f.timers = f.timers[1:]
+		if timer.when.After(f.now) {
+			f.now = timer.when
+		}
+		timer.fire(f.now)
+	}
+	if t.After(f.now) {
+		f.now = t
+	}
+	f.cond.Broadcast()
+}
+
+// schedule arms t to fire after d, or fires it right away if d isn't
+// positive. Must be called with mu held.
+func (f *Fake) schedule(t *fakeTimer, d time.Duration) {
+	if d <= 0 {
+		t.fire(f.now)
+		return
+	}
+	t.when = f.now.Add(d)
+	f.timers = append(f.timers, t)
+	sort.SliceStable(f.timers, func(i, j int) bool {
+		return f.timers[i].when.Before(f.timers[j].when)
+	})
+	f.cond.Broadcast()
+}
+
+// remove disarms t. Returns false if t wasn't active. Must be called with mu
+// held.
+func (f *Fake) remove(t *fakeTimer) bool {
+	for i, timer := range f.timers {
+		if timer == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			f.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock *Fake
+	c     chan time.Time
+	when  time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.clock.remove(t)
+	t.clock.schedule(t, d)
+	return active
+}
+
+// fire delivers now without blocking, like a real timer whose channel has a
+// buffer of one.
+func (t *fakeTimer) fire(now time.Time) {
+	select {
+	case t.c <- now:
+	default:
+	}
+}
@@ -11,16 +11,24 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/pakohan/craftdoor/clock"
 	"github.com/pakohan/craftdoor/config"
 	"github.com/pakohan/craftdoor/controller"
 	"github.com/pakohan/craftdoor/door"
 	"github.com/pakohan/craftdoor/lib"
+	"github.com/pakohan/craftdoor/logging"
 	"github.com/pakohan/craftdoor/model"
 	"github.com/pakohan/craftdoor/rfid"
 	"github.com/pakohan/craftdoor/service"
@@ -28,94 +36,264 @@ import (
 	"periph.io/x/periph/host/rpi"
 )
 
-func main() {
-	log.SetFlags(log.Llongfile)
+// shutdownTimeout is how long in-flight HTTP requests may take to complete
+// after a shutdown signal.
+const shutdownTimeout = 10 * time.Second
 
+func main() {
 	// Command line flags.
 	configPath := flag.String("config", "./develop.json", "Path to config file.")
+	checkConfig := flag.Bool("check-config", false, "Validate the config file, print the effective config and exit.")
 	flag.Parse()
 
 	// Read config.
 	cfg, err := config.InitializeConfig(*configPath)
+	if *checkConfig {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("config OK")
+		return
+	}
 	if err != nil {
 		log.Panic(err)
 	}
 
-	db, err := lib.OpenDB(cfg)
+	// Setup logging.
+	logger, logOutput, err := logging.Configure(cfg.LogLevel, cfg.LogFormat, cfg.LogOutput)
 	if err != nil {
 		log.Panic(err)
 	}
+	defer func() {
+		e := logOutput.Close()
+		if e != nil {
+			log.Printf("failed closing log output: %s", e.Error())
+		}
+	}()
+	logging.SetDefault(logger)
 
-	// TODO(duckworthd): Shut down database gracefully.
-
-	err = start(cfg, db)
+	db, err := lib.OpenDB(cfg)
 	if err != nil {
-		// c <- os.Interrupt
 		log.Panic(err)
 	}
 
-}
-
-func start(cfg *config.Config, db *sqlx.DB) error {
-	// Initialize RFID reader, door.
-	var r rfid.Reader
-	var d door.Door
-	var err error
-	if rpi.Present() {
-		log.Printf("Initializing rpi.")
-		_, err = host.Init()
+	// Apply log level changes on config reload.
+	rl := config.NewReloader(*configPath, cfg)
+	rl.Register(config.ApplierFunc(func(cfg *config.Config) error {
+		level, err := logging.ParseLevel(cfg.LogLevel)
 		if err != nil {
 			return err
 		}
+		logging.SetLevel(level)
+		return nil
+	}))
 
-		log.Printf("Initializing rpi reader.")
-		r, err = rfid.NewMFRC522Reader()
-		if err != nil {
-			return err
-		}
+	err = start(shutdownContext(), cfg, db, rl)
 
-		err = r.Initialize()
-		if err != nil {
-			return err
-		}
+	logging.Infof("Closing database.")
+	e := db.Close()
+	if e != nil {
+		logging.Errorf("err closing db: %s", e.Error())
+	}
 
-		log.Printf("Initializing rpi door.")
-		d, err = door.NewRPiDoor()
-		if err != nil {
-			return err
-		}
+	if err != nil {
+		log.Panic(err)
+	}
+}
 
-	} else {
-		log.Printf("Initializing dummy reader")
-		r, err = rfid.NewDummyReader()
-		if err != nil {
-			return err
-		}
+// shutdownContext returns a context that is cancelled on SIGINT or SIGTERM.
+func shutdownContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		logging.Infof("Received %s. Shutting down.", sig)
+		signal.Stop(c)
+		cancel()
+	}()
+	return ctx
+}
+
+// start runs the HTTP server and door access loop until ctx is cancelled.
+//
+// On return, the HTTP server has drained, all latches are locked and the
+// reader is halted.
+func start(ctx context.Context, cfg *config.Config, db *sqlx.DB, rl *config.Reloader) error {
+	// Exceptions to the door's schedule. Loaded from the database by the
+	// service.
+	location, err := time.LoadLocation(cfg.Door.Schedule.Timezone)
+	if err != nil {
+		return err
+	}
+	cal := door.NewCalendar(location)
 
-		log.Printf("Initializing dummy door")
-		d, _ = door.NewDummyDoor()
+	// Initialize RFID reader, door.
+	onPi := rpi.Present()
+	if onPi || cfg.Reader.Type != "simulated" && cfg.Reader.Type != "auto" || cfg.Door.Type == "rpi" {
+		logging.Infof("Initializing rpi.")
+		_, err = host.Init()
 		if err != nil {
 			return err
 		}
 	}
 
+	r, sim, err := lib.NewReader(cfg.Reader, onPi)
+	if err != nil {
+		return err
+	}
+	err = r.Initialize()
+	if err != nil {
+		return err
+	}
+	if sim != nil {
+		rl.Register(sim)
+		go func() {
+			e := sim.ServeControl(ctx, cfg.Reader.Simulated.Control)
+			if e != nil {
+				logging.Errorf("simulated reader control failed: %s", e)
+			}
+		}()
+	}
+
+	d, simDoor, err := lib.NewDoor(cfg.Door, cal, onPi)
+	if err != nil {
+		return haltAfter(err, r)
+	}
+	rl.Register(d)
+
 	// Setup backend database, etc.
 	m := model.New(db)
-	s := service.New(m, r, d)
-	c := controller.New(cfg, m, s)
+	s := service.New(cfg, m, r, d, cal, clock.Real)
+	rl.Register(s)
+	c := controller.New(cfg, m, s, sim, simDoor, rl)
+	go reloadOnSIGHUP(ctx, rl)
 
 	// Start HTTP server.
 	srv := http.Server{
-		Addr:    cfg.ListenHTTP,
-		Handler: c,
+		Addr:     cfg.ListenHTTP,
+		Handler:  c,
+		ErrorLog: logging.Default().StdLogger(logging.WarnLevel),
 	}
 
+	// Tell systemd we're up and keep its watchdog fed while healthy.
+	_, err = lib.SdNotify("READY=1")
+	if err != nil {
+		logging.Warnf("failed to notify systemd: %s", err)
+	}
+	go watchdog(ctx, s)
+
 	// TODO(duckworthd): Figure out how to get outbound IP address when the
 	// network doesn't reach the internet.
-	log.Printf("listening on port: %s", cfg.ListenHTTP)
-	err = srv.ListenAndServe()
+	logging.Infof("listening on port: %s", cfg.ListenHTTP)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		_, e := lib.SdNotify("STOPPING=1")
+		if e != nil {
+			logging.Warnf("failed to notify systemd: %s", e)
+		}
+
+		logging.Infof("Shutting down HTTP server.")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		err = srv.Shutdown(shutdownCtx)
+		cancel()
+		<-errCh
+	}
 	if err == http.ErrServerClosed {
 		err = nil
 	}
+
+	logging.Infof("Stopping door access loop.")
+	e := s.Close()
+	if e != nil {
+		logging.Errorf("err stopping service: %s", e.Error())
+	}
+
+	logging.Infof("Locking door.")
+	e = d.Close()
+	if e != nil {
+		logging.Errorf("err closing door: %s", e.Error())
+	}
+
+	return haltAfter(err, r)
+}
+
+// reloadOnSIGHUP reloads the config file each time SIGHUP is received. Runs
+// until ctx is done.
+func reloadOnSIGHUP(ctx context.Context, rl *config.Reloader) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c:
+			logging.Infof("Received SIGHUP. Reloading config.")
+			_, err := rl.Reload()
+			if err != nil {
+				logging.Errorf("Failed to reload config: %s", err)
+			}
+		}
+	}
+}
+
+// haltAfter halts the reader and returns err, or the error encountered while
+// halting if err is nil.
+func haltAfter(err error, r rfid.Reader) error {
+	logging.Infof("Halting reader.")
+	e := r.Halt()
+	if e != nil {
+		logging.Errorf("err halting reader: %s", e.Error())
+		if err == nil {
+			err = e
+		}
+	}
 	return err
 }
+
+// watchdog periodically notifies systemd's watchdog while the service is
+// ready. If the reader, database or door loop hangs, notifications stop and
+// systemd restarts the process. Runs until ctx is done.
+func watchdog(ctx context.Context, s *service.Service) {
+	interval, err := lib.SdWatchdogInterval()
+	if err != nil {
+		logging.Errorf("invalid systemd watchdog interval: %s", err)
+		return
+	}
+	if interval == 0 {
+		logging.Infof("systemd watchdog disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		report := s.Readiness(checkCtx)
+		cancel()
+		if !report.OK {
+			logging.Warnf("service unhealthy, withholding watchdog notification: %+v", report.Checks)
+			continue
+		}
+
+		_, err := lib.SdNotify("WATCHDOG=1")
+		if err != nil {
+			logging.Warnf("failed to notify systemd watchdog: %s", err)
+		}
+	}
+}
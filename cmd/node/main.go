@@ -0,0 +1,257 @@
+// Craftdoor door node.
+//
+// Launches a binary that drives the RFID reader and door attached to this
+// device and asks the master whether tags may open the door. The node is
+// configured with the same config file format as the master. See
+// config.MasterConfig for how it connects to the master.
+//
+// Example Usage:
+//
+//	$ export CRAFTDOOR_ROOT="$(pwd)/assets"
+//	$ go run cmd/node/main.go --config="${CRAFTDOOR_ROOT}/node.json"
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/lib"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/node"
+	"github.com/pakohan/craftdoor/rfid"
+	"periph.io/x/periph/host"
+	"periph.io/x/periph/host/rpi"
+)
+
+func main() {
+	// Command line flags.
+	configPath := flag.String("config", "./node.json", "Path to config file.")
+	checkConfig := flag.Bool("check-config", false, "Validate the config file, print the effective config and exit.")
+	flag.Parse()
+
+	// Read config.
+	cfg, err := config.InitializeConfig(*configPath)
+	if err == nil && cfg.Master.URL == "" {
+		err = errors.New("master.url is required")
+	}
+	if *checkConfig {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("config OK")
+		return
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// Setup logging.
+	logger, logOutput, err := logging.Configure(cfg.LogLevel, cfg.LogFormat, cfg.LogOutput)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer func() {
+		e := logOutput.Close()
+		if e != nil {
+			log.Printf("failed closing log output: %s", e.Error())
+		}
+	}()
+	logging.SetDefault(logger.With("node", cfg.Master.NodeID))
+
+	// Apply log level changes on config reload.
+	rl := config.NewReloader(*configPath, cfg)
+	rl.Register(config.ApplierFunc(func(cfg *config.Config) error {
+		level, err := logging.ParseLevel(cfg.LogLevel)
+		if err != nil {
+			return err
+		}
+		logging.SetLevel(level)
+		return nil
+	}))
+
+	err = start(shutdownContext(), cfg, rl)
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// shutdownContext returns a context that is cancelled on SIGINT or SIGTERM.
+func shutdownContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		logging.Infof("Received %s. Shutting down.", sig)
+		signal.Stop(c)
+		cancel()
+	}()
+	return ctx
+}
+
+// start runs the node until ctx is cancelled.
+//
+// On return, all latches are locked and the reader is halted.
+func start(ctx context.Context, cfg *config.Config, rl *config.Reloader) error {
+	// Exceptions to the door's schedule. Sent by the master.
+	location, err := time.LoadLocation(cfg.Door.Schedule.Timezone)
+	if err != nil {
+		return err
+	}
+	cal := door.NewCalendar(location)
+
+	// Initialize RFID reader, door.
+	onPi := rpi.Present()
+	if onPi || cfg.Reader.Type != "simulated" && cfg.Reader.Type != "auto" || cfg.Door.Type == "rpi" {
+		logging.Infof("Initializing rpi.")
+		_, err = host.Init()
+		if err != nil {
+			return err
+		}
+	}
+
+	r, sim, err := lib.NewReader(cfg.Reader, onPi)
+	if err != nil {
+		return err
+	}
+	err = r.Initialize()
+	if err != nil {
+		return err
+	}
+	if sim != nil {
+		rl.Register(sim)
+		go func() {
+			e := sim.ServeControl(ctx, cfg.Reader.Simulated.Control)
+			if e != nil {
+				logging.Errorf("simulated reader control failed: %s", e)
+			}
+		}()
+	}
+
+	d, _, err := lib.NewDoor(cfg.Door, cal, onPi)
+	if err != nil {
+		return haltAfter(err, r)
+	}
+	rl.Register(d)
+
+	logging.Infof("Connecting to master at %s.", cfg.Master.URL)
+	n, err := node.New(cfg, node.NewClient(cfg.Master), r, d, cal, clock.Real)
+	if err != nil {
+		e := d.Close()
+		if e != nil {
+			logging.Errorf("err closing door: %s", e.Error())
+		}
+		return haltAfter(err, r)
+	}
+	rl.Register(n)
+	go reloadOnSIGHUP(ctx, rl)
+
+	// Tell systemd we're up and keep its watchdog fed while healthy.
+	_, err = lib.SdNotify("READY=1")
+	if err != nil {
+		logging.Warnf("failed to notify systemd: %s", err)
+	}
+	go watchdog(ctx, n)
+
+	<-ctx.Done()
+	_, e := lib.SdNotify("STOPPING=1")
+	if e != nil {
+		logging.Warnf("failed to notify systemd: %s", e)
+	}
+
+	logging.Infof("Stopping node.")
+	e = n.Close()
+	if e != nil {
+		logging.Errorf("err stopping node: %s", e.Error())
+	}
+
+	logging.Infof("Locking door.")
+	e = d.Close()
+	if e != nil {
+		logging.Errorf("err closing door: %s", e.Error())
+	}
+
+	return haltAfter(nil, r)
+}
+
+// reloadOnSIGHUP reloads the config file each time SIGHUP is received. Runs
+// until ctx is done.
+func reloadOnSIGHUP(ctx context.Context, rl *config.Reloader) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c:
+			logging.Infof("Received SIGHUP. Reloading config.")
+			_, err := rl.Reload()
+			if err != nil {
+				logging.Errorf("Failed to reload config: %s", err)
+			}
+		}
+	}
+}
+
+// haltAfter halts the reader and returns err, or the error encountered while
+// halting if err is nil.
+func haltAfter(err error, r rfid.Reader) error {
+	logging.Infof("Halting reader.")
+	e := r.Halt()
+	if e != nil {
+		logging.Errorf("err halting reader: %s", e.Error())
+		if err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// watchdog periodically notifies systemd's watchdog while the node is
+// healthy. If the door or access loop hangs, notifications stop and systemd
+// restarts the process. Runs until ctx is done.
+func watchdog(ctx context.Context, n *node.Node) {
+	interval, err := lib.SdWatchdogInterval()
+	if err != nil {
+		logging.Errorf("invalid systemd watchdog interval: %s", err)
+		return
+	}
+	if interval == 0 {
+		logging.Infof("systemd watchdog disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := n.Health()
+		if err != nil {
+			logging.Warnf("node unhealthy, withholding watchdog notification: %s", err)
+			continue
+		}
+
+		_, err = lib.SdNotify("WATCHDOG=1")
+		if err != nil {
+			logging.Warnf("failed to notify systemd watchdog: %s", err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Runs the end-to-end scenarios against simulated hardware.
+//
+// Example Usage:
+// $ go run ./cmd/scenario --schema=assets/schema.sql
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/scenario"
+)
+
+func main() {
+	schemaFile := flag.String("schema", "assets/schema.sql", "Path to schema.sql used to initialize each scenario's database.")
+	run := flag.String("run", "", "Only run scenarios whose name matches this regular expression.")
+	logLevel := flag.String("log_level", "error", "Minimum level of log messages.")
+	flag.Parse()
+
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logging.SetLevel(level)
+
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	failed := 0
+	for _, s := range scenario.All {
+		if !filter.MatchString(s.Name) {
+			continue
+		}
+		start := time.Now()
+		err := scenario.Run(s, *schemaFile)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s (%s)\n      %s\n", s.Name, time.Since(start).Round(time.Millisecond), err)
+			continue
+		}
+		fmt.Printf("ok    %s (%s)\n", s.Name, time.Since(start).Round(time.Millisecond))
+	}
+	if failed > 0 {
+		fmt.Printf("%d scenario(s) failed\n", failed)
+		os.Exit(1)
+	}
+}
@@ -1,11 +1,18 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/pakohan/craftdoor/logging"
 )
 
 // CRAFTDOOR_ROOT_VAR is an environment variable containing root directory for craftdoor.
@@ -14,32 +21,585 @@ const CRAFTDOOR_ROOT_VAR = "CRAFTDOOR_ROOT"
 // Config represents the config file's contents.
 //
 // Filepaths may reference environment variable CRAFTDOOR_ROOT when resolving paths.
+//
+// Every field may be overridden by an environment variable named after its
+// JSON path, e.g. CRAFTDOOR_LISTEN_HTTP or CRAFTDOOR_DOOR_UNLOCK_DURATION. List
+// fields are comma-separated. Fields omitted from both take the defaults
+// returned by Default.
+//
+// Fields tagged `reload:"restart"` only take effect after a restart. All other
+// fields are applied live when the config is reloaded. Fields tagged
+// `secret:"true"` are redacted when the config is printed.
 type Config struct {
-	// Path to SQLite database.
-	SQLiteFile string `json:"sqlite_file"`
+	// Path to SQLite database. Not used by door nodes. Default:
+	// ${CRAFTDOOR_ROOT}/develop.db.
+	SQLiteFile string `json:"sqlite_file" reload:"restart"`
+
+	// Path to schema.sql used to initialize SQLite database. Not used by door
+	// nodes. Default: ${CRAFTDOOR_ROOT}/schema.sql.
+	SQLiteSchemaFile string `json:"sqlite_schema_file" reload:"restart"`
+
+	// Path to static assets for web frontend. Default: ${CRAFTDOOR_ROOT}/static.
+	StaticAssetsDir string `json:"static_assets_dir" reload:"restart"`
+
+	// Port for REST API. Default: ":8080".
+	ListenHTTP string `json:"listen_http" reload:"restart"`
+
+	// Origins allowed to make cross-origin requests to the REST API. Default:
+	// http://localhost:8080 and http://localhost:8081.
+	AllowedOrigins []string `json:"allowed_origins"`
+
+	// IP addresses and CIDR ranges allowed to access the REST API. Default:
+	// 192.168.0.0/24, 10.0.1.0/24 and 10.0.0.0/24.
+	AllowedIPs []string `json:"allowed_ips"`
+
+	// Minimum level of log messages: "debug", "info", "warn" or "error".
+	// Default: "info".
+	LogLevel string `json:"log_level"`
+
+	// Encoding of log messages: "text" or "json". Default: "text".
+	LogFormat string `json:"log_format" reload:"restart"`
+
+	// Destination for log messages: "stderr", "stdout" or a file path.
+	// Default: "stderr".
+	LogOutput string `json:"log_output" reload:"restart"`
+
+	// Settings for the door attached to this device.
+	Door DoorConfig `json:"door"`
 
-	// Path to schema.sql used to initialize SQLite database.
-	SQLiteSchemaFile string `json:"sqlite_schema_file"`
+	// Settings for the RFID reader attached to this device.
+	Reader ReaderConfig `json:"reader"`
 
-	// Path to static assets for web frontend.
-	StaticAssetsDir string `json:"static_assets_dir"`
+	// Door nodes allowed to connect to this master. Default: none.
+	Nodes []NodeConfig `json:"nodes"`
 
-	// Port for REST API.
-	ListenHTTP string `json:"listen_http"`
+	// How long door nodes may decide with an access list fetched from this
+	// master while it is unreachable. Afterwards, they treat all tags as
+	// unknown. Default: "168h".
+	AccessListValidity Duration `json:"access_list_validity"`
+
+	// Settings used when this device runs as a door node (cmd/node) instead
+	// of the master.
+	Master MasterConfig `json:"master"`
 }
 
-// InitializeConfig reads a JSON config file and decodes it as type Config.
+// NodeConfig allows a door node to connect to the master.
+type NodeConfig struct {
+	// Identifies the node, e.g. "workshop". Must match the node's
+	// master.node_id.
+	ID string `json:"id"`
+
+	// Shared secret signing the node's requests. Must match the node's
+	// master.secret and be at least 16 characters long.
+	Secret string `json:"secret"`
+
+	// ID of the node's door. Must match the node's door.id. Required.
+	DoorID string `json:"door_id"`
+
+	// Auth policy of the node's door, like door.auth. The master decides on
+	// credentials presented at the node's door under this policy, whatever
+	// the node reports. Must match the node's door.auth. Default: "tag".
+	Auth string `json:"auth"`
+}
+
+// MasterConfig configures how a door node connects to the master.
+type MasterConfig struct {
+	// Base URL of the master's REST API, e.g. "http://10.0.0.2:8080".
+	// Required by cmd/node, and configs setting it are validated as a door
+	// node's. Default: "".
+	URL string `json:"url" reload:"restart"`
+
+	// Identifies this node to the master. Required by cmd/node. Default: "".
+	NodeID string `json:"node_id" reload:"restart"`
+
+	// Shared secret signing requests to the master, as configured in the
+	// master's nodes. Required by cmd/node. Default: "".
+	Secret string `json:"secret" reload:"restart" secret:"true"`
+
+	// How often the node reports to the master. Default: "10s".
+	HeartbeatInterval Duration `json:"heartbeat_interval"`
+
+	// How long a request to the master may take. Default: "3s".
+	Timeout Duration `json:"timeout"`
+
+	// Directory caching the access list and queuing access events while the
+	// master is unreachable. Default: ${CRAFTDOOR_ROOT}/cache.
+	CacheDir string `json:"cache_dir" reload:"restart"`
+
+	// Whether tags missing from the cached access list open the door while
+	// the master is unreachable: "deny" or "allow". Tags are never admitted
+	// during a lockdown. Default: "deny".
+	OfflineUnknownTags string `json:"offline_unknown_tags"`
+}
+
+// ReaderConfig configures the RFID reader attached to this device.
+type ReaderConfig struct {
+	// Reader implementation: "mfrc522", "pn532", "wiegand", "evdev",
+	// "serial", "simulated" or "auto", which uses an MFRC522 on a Raspberry
+	// Pi and the simulated reader elsewhere. Default: "auto".
+	Type string `json:"type" reload:"restart"`
+
+	// Settings for the simulated reader. Ignored by other types.
+	Simulated SimulatedReaderConfig `json:"simulated"`
+
+	// Settings for PN532 readers. Ignored by other types.
+	PN532 PN532ReaderConfig `json:"pn532"`
+
+	// Settings for Wiegand readers. Ignored by other types.
+	Wiegand WiegandReaderConfig `json:"wiegand"`
+
+	// Settings for keyboard wedges. Ignored by other types.
+	Evdev EvdevReaderConfig `json:"evdev"`
+
+	// Settings for serial readers. Ignored by other types.
+	Serial SerialReaderConfig `json:"serial"`
+}
+
+// PN532ReaderConfig configures a PN532 reader.
+type PN532ReaderConfig struct {
+	// Interface the PN532 is connected by: "i2c", "spi" or "uart". The
+	// PN532's mode switches must match. Default: "i2c".
+	Interface string `json:"interface" reload:"restart"`
+
+	// I2C bus or SPI port, e.g. "1" or "SPI0.0", or the serial device for
+	// UART. "" selects the first bus or port, or "/dev/serial0" for UART.
+	// Default: "".
+	Device string `json:"device" reload:"restart"`
+}
+
+// WiegandReaderConfig configures a reader sending Wiegand-26 or Wiegand-34
+// frames.
+type WiegandReaderConfig struct {
+	// GPIO pins connected to the reader's D0 and D1 lines. Default: "GPIO24"
+	// and "GPIO25".
+	D0Pin string `json:"d0_pin" reload:"restart"`
+	D1Pin string `json:"d1_pin" reload:"restart"`
+
+	// Order in which the reader sends a card's UID: "msb" if it sends the
+	// UID's first byte first, like MFRC522 readers read it, or "lsb" if it
+	// sends the UID reversed. Default: "msb".
+	ByteOrder string `json:"byte_order" reload:"restart"`
+}
+
+// EvdevReaderConfig configures a USB reader acting as a keyboard, which types
+// the number of each card followed by Enter.
+type EvdevReaderConfig struct {
+	// Input device of the reader, e.g.
+	// "/dev/input/by-id/usb-IC_Reader-event-kbd". Required.
+	Device string `json:"device" reload:"restart"`
+
+	// How card numbers are typed: "decimal" or "hex". Default: "decimal".
+	Encoding string `json:"encoding" reload:"restart"`
+}
+
+// SerialReaderConfig configures a reader sending the number of each card as
+// a message over a serial port.
+type SerialReaderConfig struct {
+	// Serial device of the reader. Default: "/dev/ttyUSB0".
+	Device string `json:"device" reload:"restart"`
+
+	// Baud rate of the port, 8N1. Default: 9600.
+	Baud int `json:"baud" reload:"restart"`
+
+	// Markers around each message, e.g. "\u0002" and "\u0003". Bytes before
+	// start are skipped; if start is "", messages are only separated by end.
+	// Default: "" and "\n".
+	Start string `json:"start" reload:"restart"`
+	End   string `json:"end" reload:"restart"`
+
+	// How card numbers are written: "hex" or "decimal". Default: "hex".
+	Encoding string `json:"encoding" reload:"restart"`
+
+	// Checksum at the end of each message: "none", or "xor" for a last hex
+	// byte that is the XOR of the preceding bytes. Default: "none".
+	Checksum string `json:"checksum" reload:"restart"`
+}
+
+// SimulatedReaderConfig configures a reader whose tags are presented through
+// a control channel rather than held in front of an antenna.
+type SimulatedReaderConfig struct {
+	// Additional source of control commands besides the REST API: "" for
+	// none, "stdin", or "unix:<path>" for a unix socket. Default: "".
+	Control string `json:"control" reload:"restart"`
+
+	// How long each read takes while a tag is presented. Default: "50ms".
+	Latency Duration `json:"latency"`
+
+	// Fraction of reads, between 0 and 1, that fail with a transient error.
+	// Default: 0.
+	ErrorRate float64 `json:"error_rate"`
+
+	// Memory contents of simulated tags, keyed by hex-encoded UID. Each value
+	// is the hex-encoded contents of the data blocks, starting with sector 0,
+	// and is zero-padded to the size of the tag's memory. Tags not listed
+	// here are all zeros. Default: none.
+	Cards map[string]string `json:"cards"`
+
+	// Types of simulated tags, keyed by hex-encoded UID, e.g. "ultralight"
+	// or "mifare_classic_4k". Tags not listed here are of type "unknown",
+	// whose memory is that of a MIFARE Classic 1K card. Default: none.
+	CardTypes map[string]string `json:"card_types"`
+}
+
+// DoorConfig configures the door attached to this device.
+type DoorConfig struct {
+	// Identifies the door in the REST API, e.g. /api/doors/main/mode.
+	// Default: "main".
+	ID string `json:"id" reload:"restart"`
+
+	// Door implementation: "rpi", "simulated" or "auto", which uses "rpi" on
+	// a Raspberry Pi and "simulated" elsewhere. A simulated door drives
+	// in-memory GPIO pins instead of relays. Default: "auto".
+	Type string `json:"type" reload:"restart"`
+
+	// How long latches remain unlocked after a successful authentication.
+	// Default: "3s".
+	UnlockDuration Duration `json:"unlock_duration"`
+
+	// How long a tag must be away from the reader before it is handled again.
+	// A tag held in front of the reader is only handled once, while a
+	// different tag is handled immediately. "0s" handles every read.
+	// Default: "1s".
+	TagDebounce Duration `json:"tag_debounce"`
+
+	// Times during which the bolt remains unlocked.
+	Schedule ScheduleConfig `json:"schedule"`
+
+	// GPIO pin driving the latch relay. Default: "GPIO22" (P1_15).
+	LatchPin string `json:"latch_pin" reload:"restart"`
+
+	// What the latch does when its relay is de-energized, e.g. on power loss
+	// or shutdown: "secure" (stays locked) or "safe" (unlocks). Default:
+	// "secure".
+	LatchFailMode string `json:"latch_fail_mode" reload:"restart"`
+
+	// GPIO level energizing the latch relay: "active_low" or "active_high".
+	// Default: "active_low".
+	LatchPolarity string `json:"latch_polarity" reload:"restart"`
+
+	// GPIO pin driving the bolt relay. Default: "GPIO27" (P1_13).
+	BoltPin string `json:"bolt_pin" reload:"restart"`
+
+	// Like LatchFailMode, for the bolt. Default: "secure".
+	BoltFailMode string `json:"bolt_fail_mode" reload:"restart"`
+
+	// Like LatchPolarity, for the bolt. Default: "active_low".
+	BoltPolarity string `json:"bolt_polarity" reload:"restart"`
+
+	// GPIO pin signalling failed authentication. Default: "GPIO23" (P1_16).
+	AuthFailPin string `json:"auth_fail_pin" reload:"restart"`
+
+	// Like LatchPolarity, for the auth failure signal, which is off when
+	// de-energized. Default: "active_low".
+	AuthFailPolarity string `json:"auth_fail_polarity" reload:"restart"`
+
+	// What opens the door: "tag", "tag+pin" (a tag followed by its member's
+	// PIN and "#") or "pin" (a member's ID, "*", PIN and "#", e.g.
+	// "42*1234#"). Policies other than "tag" require a keypad. Default:
+	// "tag".
+	Auth string `json:"auth"`
+
+	// Keypad next to the door, used to enter PINs.
+	Keypad KeypadConfig `json:"keypad"`
+}
+
+// KeypadConfig configures a keypad used to enter PINs.
+type KeypadConfig struct {
+	// Keypad implementation: "none", "matrix" (rows and columns wired to GPIO
+	// pins) or "wiegand" (4- or 8-bit key codes on D0 and D1). A simulated
+	// door simulates the keypad on in-memory pins. Default: "none".
+	Type string `json:"type" reload:"restart"`
+
+	// GPIO pins driving the rows of a matrix keypad, top to bottom. Default:
+	// ["GPIO5", "GPIO6", "GPIO13", "GPIO19"].
+	RowPins []string `json:"row_pins" reload:"restart"`
+
+	// GPIO pins reading the columns of a matrix keypad, left to right.
+	// Default: ["GPIO26", "GPIO16", "GPIO20"].
+	ColumnPins []string `json:"column_pins" reload:"restart"`
+
+	// Keys of a matrix keypad, one string per row with one character per
+	// column. Default: ["123", "456", "789", "*0#"].
+	Layout []string `json:"layout" reload:"restart"`
+
+	// GPIO pin connected to a Wiegand keypad's D0 line. Default: "GPIO17".
+	D0Pin string `json:"d0_pin" reload:"restart"`
+
+	// GPIO pin connected to a Wiegand keypad's D1 line. Default: "GPIO18".
+	D1Pin string `json:"d1_pin" reload:"restart"`
+
+	// How long the door waits for a PIN after a tag, and how long after the
+	// last key press a partial entry is discarded. Default: "10s".
+	EntryTimeout Duration `json:"entry_timeout"`
+
+	// Wrong PINs in a row after which the keypad is locked. Default: 3.
+	MaxAttempts int `json:"max_attempts"`
+
+	// How long the keypad stays locked, during which all attempts are
+	// denied. Default: "5m".
+	Lockout Duration `json:"lockout"`
+}
+
+// ScheduleConfig is a weekly schedule of opening windows.
 //
-// If unspecified, sets $CRAFTDOOR_ROOT to the directory of this binary.
-func InitializeConfig(configPath string) (*Config, error) {
-	config, err := ReadConfigFile(configPath)
+// Windows are formatted as "05:00-23:00". A window whose end is not after its
+// start spans midnight, e.g. "22:00-02:00".
+type ScheduleConfig struct {
+	// IANA timezone of all windows. Default: "Europe/Berlin".
+	Timezone string `json:"timezone"`
+
+	// Windows for days not listed in Weekly. Default: ["05:00-23:00"].
+	Default []string `json:"default"`
+
+	// Windows for specific days, keyed by lowercase English weekday name, e.g.
+	// "sunday". An empty list closes the door all day. Default: none.
+	Weekly map[string][]string `json:"weekly"`
+
+	// Dates, as "2006-01-02", on which no windows start. Default: none.
+	Holidays []string `json:"holidays"`
+
+	// If true, an opening window only unlocks the bolt after a member with
+	// the keyholder role has been admitted during that window. Default: false.
+	FirstIn bool `json:"first_in"`
+}
+
+// Default returns the configuration used for fields that are not set in the
+// config file or environment.
+func Default() Config {
+	return Config{
+		SQLiteFile:       "${CRAFTDOOR_ROOT}/develop.db",
+		SQLiteSchemaFile: "${CRAFTDOOR_ROOT}/schema.sql",
+		StaticAssetsDir:  "${CRAFTDOOR_ROOT}/static",
+		ListenHTTP:       ":8080",
+		AllowedOrigins: []string{
+			"http://localhost:8081",
+			"http://localhost:8080",
+		},
+		AllowedIPs: []string{"192.168.0.0/24", "10.0.1.0/24", "10.0.0.0/24"},
+		LogLevel:   "info",
+		LogFormat:  "text",
+		LogOutput:  "stderr",
+		Door: DoorConfig{
+			ID:             "main",
+			Type:           "auto",
+			UnlockDuration: Duration{3 * time.Second},
+			TagDebounce:    Duration{1 * time.Second},
+			Schedule: ScheduleConfig{
+				Timezone: "Europe/Berlin",
+				Default:  []string{"05:00-23:00"},
+			},
+			LatchPin:         "GPIO22",
+			LatchFailMode:    "secure",
+			LatchPolarity:    "active_low",
+			BoltPin:          "GPIO27",
+			BoltFailMode:     "secure",
+			BoltPolarity:     "active_low",
+			AuthFailPin:      "GPIO23",
+			AuthFailPolarity: "active_low",
+			Auth:             "tag",
+			Keypad: KeypadConfig{
+				Type:         "none",
+				RowPins:      []string{"GPIO5", "GPIO6", "GPIO13", "GPIO19"},
+				ColumnPins:   []string{"GPIO26", "GPIO16", "GPIO20"},
+				Layout:       []string{"123", "456", "789", "*0#"},
+				D0Pin:        "GPIO17",
+				D1Pin:        "GPIO18",
+				EntryTimeout: Duration{10 * time.Second},
+				MaxAttempts:  3,
+				Lockout:      Duration{5 * time.Minute},
+			},
+		},
+		Reader: ReaderConfig{
+			Type: "auto",
+			Simulated: SimulatedReaderConfig{
+				Latency: Duration{50 * time.Millisecond},
+			},
+			PN532: PN532ReaderConfig{
+				Interface: "i2c",
+			},
+			Wiegand: WiegandReaderConfig{
+				D0Pin:     "GPIO24",
+				D1Pin:     "GPIO25",
+				ByteOrder: "msb",
+			},
+			Evdev: EvdevReaderConfig{
+				Encoding: "decimal",
+			},
+			Serial: SerialReaderConfig{
+				Device:   "/dev/ttyUSB0",
+				Baud:     9600,
+				End:      "\n",
+				Encoding: "hex",
+				Checksum: "none",
+			},
+		},
+		Nodes:              []NodeConfig{},
+		AccessListValidity: Duration{7 * 24 * time.Hour},
+		Master: MasterConfig{
+			HeartbeatInterval:  Duration{10 * time.Second},
+			Timeout:            Duration{3 * time.Second},
+			CacheDir:           "${CRAFTDOOR_ROOT}/cache",
+			OfflineUnknownTags: "deny",
+		},
+	}
+}
+
+// minSecretLength is the minimum length of secrets shared between the master
+// and door nodes.
+const minSecretLength = 16
+
+// validators are additional checks registered by other packages.
+var validators []func(cfg *Config) error
+
+// RegisterValidator adds a check run by Validate. Packages that interpret
+// parts of the config, such as door schedules, register themselves in init.
+func RegisterValidator(f func(cfg *Config) error) {
+	validators = append(validators, f)
+}
+
+// IsNode returns true if the config is a door node's, which connects to a
+// master instead of using a database.
+func (c *Config) IsNode() bool {
+	return c.Master.URL != ""
+}
+
+// Validate checks that all fields can be used as-is. The database is only
+// checked for the master, see IsNode.
+func (c *Config) Validate() error {
+	var err error
+	if !c.IsNode() {
+		if c.SQLiteFile == "" {
+			return errors.New("sqlite_file is required")
+		}
+		_, err = os.Stat(c.SQLiteSchemaFile)
+		if err != nil {
+			return fmt.Errorf("sqlite_schema_file: %s", err)
+		}
+	}
+	if c.ListenHTTP == "" {
+		return errors.New("listen_http is required")
+	}
+	_, _, err = net.SplitHostPort(c.ListenHTTP)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("listen_http: %s", err)
+	}
+	for _, ip := range c.AllowedIPs {
+		if net.ParseIP(ip) != nil {
+			continue
+		}
+		_, _, err := net.ParseCIDR(ip)
+		if err != nil {
+			return fmt.Errorf("allowed_ips: %s", err)
+		}
+	}
+	_, err = logging.ParseLevel(c.LogLevel)
+	if err != nil {
+		return fmt.Errorf("log_level: %s", err)
+	}
+	_, err = logging.ParseFormat(c.LogFormat)
+	if err != nil {
+		return fmt.Errorf("log_format: %s", err)
+	}
+	if c.Door.UnlockDuration.Duration <= 0 {
+		return errors.New("door.unlock_duration must be positive")
+	}
+	if c.Door.TagDebounce.Duration < 0 {
+		return errors.New("door.tag_debounce must not be negative")
+	}
+	for name, pin := range map[string]string{
+		"door.id":            c.Door.ID,
+		"door.latch_pin":     c.Door.LatchPin,
+		"door.bolt_pin":      c.Door.BoltPin,
+		"door.auth_fail_pin": c.Door.AuthFailPin,
+	} {
+		if pin == "" {
+			return fmt.Errorf("%s is required", name)
+		}
+	}
+	switch c.Door.Type {
+	case "auto", "rpi", "simulated":
+	default:
+		return fmt.Errorf("door.type: unknown door %q", c.Door.Type)
+	}
+	switch c.Reader.Type {
+	case "auto", "mfrc522", "pn532", "wiegand", "evdev", "serial", "simulated":
+	default:
+		return fmt.Errorf("reader.type: unknown reader %q", c.Reader.Type)
+	}
+	if c.Reader.Simulated.Latency.Duration < 0 {
+		return errors.New("reader.simulated.latency must not be negative")
+	}
+	if c.Reader.Simulated.ErrorRate < 0 || c.Reader.Simulated.ErrorRate > 1 {
+		return errors.New("reader.simulated.error_rate must be between 0 and 1")
+	}
+	nodes := map[string]bool{}
+	doors := map[string]string{}
+	for _, node := range c.Nodes {
+		if node.ID == "" {
+			return errors.New("nodes: id is required")
+		}
+		if nodes[node.ID] {
+			return fmt.Errorf("nodes: duplicate id %q", node.ID)
+		}
+		nodes[node.ID] = true
+		if len(node.Secret) < minSecretLength {
+			return fmt.Errorf("nodes: secret of %q must be at least %d characters long", node.ID, minSecretLength)
+		}
+		switch other, ok := doors[node.DoorID]; {
+		case node.DoorID == "":
+			return fmt.Errorf("nodes: door_id of %q is required", node.ID)
+		case node.DoorID == c.Door.ID:
+			return fmt.Errorf("nodes: door %q of %q belongs to the master", node.DoorID, node.ID)
+		case ok:
+			return fmt.Errorf("nodes: door %q of %q belongs to %q", node.DoorID, node.ID, other)
+		}
+		doors[node.DoorID] = node.ID
+	}
+	if c.AccessListValidity.Duration <= 0 {
+		return errors.New("access_list_validity must be positive")
+	}
+	if c.Master.URL != "" {
+		u, err := url.Parse(c.Master.URL)
+		if err != nil {
+			return fmt.Errorf("master.url: %s", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("master.url: unsupported scheme %q", u.Scheme)
+		}
+		if c.Master.NodeID == "" {
+			return errors.New("master.node_id is required")
+		}
+		if len(c.Master.Secret) < minSecretLength {
+			return fmt.Errorf("master.secret must be at least %d characters long", minSecretLength)
+		}
+	}
+	if c.Master.HeartbeatInterval.Duration <= 0 {
+		return errors.New("master.heartbeat_interval must be positive")
+	}
+	if c.Master.Timeout.Duration <= 0 {
+		return errors.New("master.timeout must be positive")
 	}
+	switch c.Master.OfflineUnknownTags {
+	case "deny", "allow":
+	default:
+		return fmt.Errorf("master.offline_unknown_tags: unknown policy %q", c.Master.OfflineUnknownTags)
+	}
+	for _, validate := range validators {
+		err = validate(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// InitializeConfig reads a JSON config file and decodes it as type Config.
+//
+// If unspecified, sets $CRAFTDOOR_ROOT to the directory of this binary.
+func InitializeConfig(configPath string) (*Config, error) {
 	_, isDefined := os.LookupEnv(CRAFTDOOR_ROOT_VAR)
 	if !isDefined {
-		log.Printf("%s not defined. Setting value to path of binary.", CRAFTDOOR_ROOT_VAR)
+		logging.Infof("%s not defined. Setting value to path of binary.", CRAFTDOOR_ROOT_VAR)
 		cwd, err := filepath.Abs(filepath.Dir(os.Args[0]))
 		if err != nil {
 			return nil, err
@@ -47,21 +607,51 @@ func InitializeConfig(configPath string) (*Config, error) {
 		os.Setenv(CRAFTDOOR_ROOT_VAR, cwd)
 	}
 
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Print out final config.
+	fmt.Println(config.String())
+
+	return config, nil
+}
+
+// LoadConfig reads a JSON config file, applies environment variable
+// overrides, expands environment variables in file paths and validates the
+// result.
+func LoadConfig(configPath string) (*Config, error) {
+	config, err := ReadConfigFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyEnvOverrides(&config)
+	if err != nil {
+		return nil, err
+	}
+
 	// Expand environment variables.
 	config.SQLiteFile = os.ExpandEnv(config.SQLiteFile)
 	config.SQLiteSchemaFile = os.ExpandEnv(config.SQLiteSchemaFile)
 	config.StaticAssetsDir = os.ExpandEnv(config.StaticAssetsDir)
+	config.LogOutput = os.ExpandEnv(config.LogOutput)
+	config.Master.CacheDir = os.ExpandEnv(config.Master.CacheDir)
 
-	// Print out final config.
-	marshalledText, _ := json.MarshalIndent(config, "", " ")
-	fmt.Println(string(marshalledText))
-
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %s", configPath, err)
+	}
 	return &config, nil
 }
 
 // ReadConfigFile reads the contents of a JSON file  and decodes it as a Config object.
+//
+// Fields missing from the file take their default values. Unknown fields are
+// an error.
 func ReadConfigFile(filename string) (Config, error) {
-	log.Printf("reading config from '%s'", filename)
+	logging.Infof("reading config from '%s'", filename)
 	// #nosec G304
 	f, err := os.Open(filename)
 	if err != nil {
@@ -70,10 +660,47 @@ func ReadConfigFile(filename string) (Config, error) {
 	defer func() {
 		e := f.Close()
 		if e != nil {
-			log.Printf("failed closing config file: %s", e.Error())
+			logging.Errorf("failed closing config file: %s", e.Error())
 		}
 	}()
 
-	cfg := Config{}
-	return cfg, json.NewDecoder(f).Decode(&cfg)
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&cfg)
+	if err != nil {
+		return Config{}, describeDecodeError(filename, b, err)
+	}
+	return cfg, nil
+}
+
+// describeDecodeError adds the file name and position to JSON decoding errors.
+func describeDecodeError(filename string, b []byte, err error) error {
+	var offset int64 = -1
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+		err = fmt.Errorf("field %q must be of type %s, got JSON %s", e.Field, e.Type, e.Value)
+	}
+	if offset < 0 {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+
+	line, column := 1, 1
+	for _, c := range b[:offset] {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return fmt.Errorf("%s:%d:%d: %s", filename, line, column, err)
 }
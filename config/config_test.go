@@ -0,0 +1,139 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pakohan/craftdoor/logging"
+)
+
+// writeConfig writes content to a config file in a temporary directory and
+// returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "craftdoor-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadConfigFile(t *testing.T) {
+	logging.SetLevel(logging.ErrorLevel)
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+		want    func(cfg *Config)
+	}{
+		{
+			name:    "empty",
+			content: `{}`,
+			want:    func(cfg *Config) {},
+		},
+		{
+			name:    "nested field",
+			content: `{"door": {"unlock_duration": "5s"}}`,
+			want: func(cfg *Config) {
+				cfg.Door.UnlockDuration = Duration{5 * time.Second}
+			},
+		},
+		{
+			name:    "unknown field",
+			content: `{"listen": ":9090"}`,
+			wantErr: `unknown field "listen"`,
+		},
+		{
+			name:    "unknown nested field",
+			content: `{"door": {"unlock": "5s"}}`,
+			wantErr: `unknown field "unlock"`,
+		},
+		{
+			name:    "wrong type",
+			content: "{\n  \"door\": {\"unlock_duration\": 5}\n}",
+			wantErr: ":2:",
+		},
+		{
+			name:    "syntax error",
+			content: `{"log_level": "info",}`,
+			wantErr: ":1:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ReadConfigFile(writeConfig(t, tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ReadConfigFile returned %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Default()
+			tt.want(&want)
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("ReadConfigFile = %s, want %s", cfg, want)
+			}
+		})
+	}
+}
+
+// TestLoadConfig checks the validation --check-config runs.
+func TestLoadConfig(t *testing.T) {
+	logging.SetLevel(logging.ErrorLevel)
+	root, err := ioutil.TempDir("", "craftdoor-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	err = ioutil.WriteFile(filepath.Join(root, "schema.sql"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, CRAFTDOOR_ROOT_VAR, root)
+
+	const node = `"master": {"url": "http://10.0.0.2:8080", "node_id": "workshop", "secret": "test-secret-0123456789"}`
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"master", `{}`, ""},
+		{"master without schema", `{"sqlite_schema_file": "${CRAFTDOOR_ROOT}/missing.sql"}`, "sqlite_schema_file"},
+		{"master without database", `{"sqlite_file": ""}`, "sqlite_file is required"},
+		{"node", `{` + node + `}`, ""},
+		{"node without schema", `{"sqlite_file": "", "sqlite_schema_file": "missing.sql", ` + node + `}`, ""},
+		{"node with a short secret", `{"master": {"url": "http://10.0.0.2:8080", "node_id": "workshop", "secret": "short"}}`, "master.secret"},
+		{"invalid field", `{"door": {"unlock_duration": "0s"}}`, "door.unlock_duration must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(writeConfig(t, tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadConfig returned %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.SQLiteSchemaFile != filepath.Join(root, "schema.sql") && !cfg.IsNode() {
+				t.Errorf("sqlite_schema_file is %q, want %s expanded", cfg.SQLiteSchemaFile, CRAFTDOOR_ROOT_VAR)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// envPrefix is prepended to the environment variable overriding each field.
+const envPrefix = "CRAFTDOOR_"
+
+// redacted replaces the value of secret fields when a config is printed.
+const redacted = "<redacted>"
+
+func envName(path string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(path, ".", "_", -1))
+}
+
+// applyEnvOverrides replaces fields with the values of their environment
+// variables, if set.
+func applyEnvOverrides(cfg *Config) error {
+	return walk(reflect.ValueOf(cfg).Elem(), "", func(path string, field reflect.StructField, v reflect.Value) error {
+		name := envName(path)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil
+		}
+		err := setFromString(v, value)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		return nil
+	})
+}
+
+// setFromString parses value according to v's type and stores it in v.
+func setFromString(v reflect.Value, value string) error {
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(value)
+	case []string:
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	case Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(Duration{d}))
+	default:
+		// Fall back to JSON for numbers and booleans.
+		ptr := reflect.New(v.Type())
+		err := json.Unmarshal([]byte(value), ptr.Interface())
+		if err != nil {
+			return err
+		}
+		v.Set(ptr.Elem())
+	}
+	return nil
+}
+
+// walk calls f for every leaf field of the struct v with the field's JSON
+// path, e.g. "door.unlock_duration".
+func walk(v reflect.Value, prefix string, f func(path string, field reflect.StructField, v reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		path := prefix + strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			err := walk(v.Field(i), path+".", f)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := f(path, field, v.Field(i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redacted returns a copy of the config with secret fields replaced.
+func (c Config) Redacted() Config {
+	result := c
+	result.AllowedOrigins = append([]string(nil), c.AllowedOrigins...)
+	result.AllowedIPs = append([]string(nil), c.AllowedIPs...)
+	result.Nodes = []NodeConfig{}
+	for _, node := range c.Nodes {
+		if node.Secret != "" {
+			node.Secret = redacted
+		}
+		result.Nodes = append(result.Nodes, node)
+	}
+	_ = walk(reflect.ValueOf(&result).Elem(), "", func(path string, field reflect.StructField, v reflect.Value) error {
+		if field.Tag.Get("secret") != "true" || v.Kind() != reflect.String || v.String() == "" {
+			return nil
+		}
+		v.SetString(redacted)
+		return nil
+	})
+	return result
+}
+
+// String returns the config as indented JSON with secrets redacted.
+func (c Config) String() string {
+	b, err := json.MarshalIndent(c.Redacted(), "", " ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setEnv sets an environment variable for the duration of the test.
+func setEnv(t *testing.T, name, value string) {
+	t.Helper()
+	old, ok := os.LookupEnv(name)
+	err := os.Setenv(name, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+		want    func(cfg *Config)
+	}{
+		{
+			name:  "CRAFTDOOR_LISTEN_HTTP",
+			value: ":9090",
+			want:  func(cfg *Config) { cfg.ListenHTTP = ":9090" },
+		},
+		{
+			name:  "CRAFTDOOR_ALLOWED_IPS",
+			value: " 10.0.0.1, ,192.168.1.0/24 ",
+			want:  func(cfg *Config) { cfg.AllowedIPs = []string{"10.0.0.1", "192.168.1.0/24"} },
+		},
+		{
+			name:  "CRAFTDOOR_DOOR_UNLOCK_DURATION",
+			value: "5s",
+			want:  func(cfg *Config) { cfg.Door.UnlockDuration = Duration{5 * time.Second} },
+		},
+		{
+			name:  "CRAFTDOOR_DOOR_SCHEDULE_FIRST_IN",
+			value: "true",
+			want:  func(cfg *Config) { cfg.Door.Schedule.FirstIn = true },
+		},
+		{
+			name:  "CRAFTDOOR_READER_SIMULATED_ERROR_RATE",
+			value: "0.5",
+			want:  func(cfg *Config) { cfg.Reader.Simulated.ErrorRate = 0.5 },
+		},
+		{
+			name:  "CRAFTDOOR_READER_SIMULATED_CARDS",
+			value: `{"alice": "04a1b2c3"}`,
+			want:  func(cfg *Config) { cfg.Reader.Simulated.Cards = map[string]string{"alice": "04a1b2c3"} },
+		},
+		{
+			name:    "CRAFTDOOR_DOOR_UNLOCK_DURATION",
+			value:   "5",
+			wantErr: true,
+		},
+		{
+			name:    "CRAFTDOOR_DOOR_SCHEDULE_FIRST_IN",
+			value:   "yes",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			setEnv(t, tt.name, tt.value)
+			cfg := Default()
+			err := applyEnvOverrides(&cfg)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), tt.name) {
+					t.Errorf("applyEnvOverrides returned %v, want an error naming %s", err, tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Default()
+			tt.want(&want)
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("applyEnvOverrides = %s, want %s", cfg, want)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Master.Secret = "master-secret-0123456789"
+	cfg.Nodes = []NodeConfig{
+		{ID: "workshop", Secret: "node-secret-0123456789", DoorID: "workshop"},
+		{ID: "office", DoorID: "office"},
+	}
+
+	redactedCfg := cfg.Redacted()
+	if redactedCfg.Master.Secret != redacted || redactedCfg.Nodes[0].Secret != redacted {
+		t.Errorf("Redacted has secrets %q and %q, want both %s", redactedCfg.Master.Secret, redactedCfg.Nodes[0].Secret, redacted)
+	}
+	if redactedCfg.Nodes[1].Secret != "" {
+		t.Errorf("Redacted has secret %q for a node without one, want none", redactedCfg.Nodes[1].Secret)
+	}
+	if cfg.Master.Secret != "master-secret-0123456789" || cfg.Nodes[0].Secret != "node-secret-0123456789" {
+		t.Error("Redacted changed the original config")
+	}
+	s := cfg.String()
+	if strings.Contains(s, "master-secret") || strings.Contains(s, "node-secret") {
+		t.Errorf("String = %s, want secrets redacted", s)
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pakohan/craftdoor/logging"
+)
+
+// Applier applies the live-reloadable parts of a configuration.
+type Applier interface {
+	ApplyConfig(cfg *Config) error
+}
+
+// ApplierFunc adapts a function to the Applier interface.
+type ApplierFunc func(cfg *Config) error
+
+// ApplyConfig calls f(cfg).
+func (f ApplierFunc) ApplyConfig(cfg *Config) error {
+	return f(cfg)
+}
+
+// ReloadReport describes the outcome of a reload.
+type ReloadReport struct {
+	// Fields that changed and were applied live.
+	Applied []string `json:"applied"`
+
+	// Fields that changed but only take effect after a restart.
+	RestartRequired []string `json:"restart_required"`
+}
+
+// Reloader re-reads the config file and hands it to registered Appliers.
+type Reloader struct {
+	mu       sync.Mutex
+	path     string
+	current  *Config
+	appliers []Applier
+}
+
+// NewReloader returns a Reloader for the config file at path, which was last
+// loaded as current.
+func NewReloader(path string, current *Config) *Reloader {
+	return &Reloader{
+		path:    path,
+		current: current,
+	}
+}
+
+// Register adds an Applier to be called on every reload.
+func (r *Reloader) Register(a Applier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appliers = append(r.appliers, a)
+}
+
+// Current returns the most recently applied config.
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload re-reads the config file, validates it and applies it.
+//
+// If the new config is invalid, nothing is applied and the current config is
+// kept. If an Applier fails, the current config is applied again to it and to
+// the Appliers that already applied the new config, and kept. Fields that
+// can't be changed live keep their current values until the next restart.
+func (r *Reloader) Reload() (*ReloadReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := LoadConfig(r.path)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReloadReport{Applied: []string{}, RestartRequired: []string{}}
+	diff(reflect.ValueOf(r.current).Elem(), reflect.ValueOf(next).Elem(), "", report)
+	for _, field := range report.RestartRequired {
+		logging.Warnf("config field %s changed but requires a restart to take effect", field)
+	}
+	if len(report.Applied) == 0 {
+		logging.Infof("config reloaded, nothing to apply")
+		r.current = next
+		return report, nil
+	}
+
+	for i, a := range r.appliers {
+		err = a.ApplyConfig(next)
+		if err != nil {
+			r.rollback(r.appliers[:i+1])
+			return report, fmt.Errorf("failed applying config: %s", err)
+		}
+	}
+	logging.Infof("config reloaded, applied changes to: %s", strings.Join(report.Applied, ", "))
+	r.current = next
+	return report, nil
+}
+
+// rollback applies the current config to appliers after applying a new one
+// failed. Must be called with mu held.
+func (r *Reloader) rollback(appliers []Applier) {
+	for _, a := range appliers {
+		err := a.ApplyConfig(r.current)
+		if err != nil {
+			logging.Errorf("failed restoring config after failed reload: %s", err)
+		}
+	}
+	logging.Warnf("config reload failed, restored the current config")
+}
+
+var durationType = reflect.TypeOf(Duration{})
+
+// diff records the JSON names of fields that differ between two structs.
+//
+// Fields that require a restart are reset to their old value in next, so that
+// next reflects the configuration actually in effect.
+func diff(old reflect.Value, next reflect.Value, prefix string, report *ReloadReport) {
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := prefix + strings.Split(field.Tag.Get("json"), ",")[0]
+		o, n := old.Field(i), next.Field(i)
+
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			diff(o, n, name+".", report)
+			continue
+		}
+		if reflect.DeepEqual(o.Interface(), n.Interface()) {
+			continue
+		}
+		if field.Tag.Get("reload") == "restart" {
+			report.RestartRequired = append(report.RestartRequired, name)
+			n.Set(o)
+		} else {
+			report.Applied = append(report.Applied, name)
+		}
+	}
+}
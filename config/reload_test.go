@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pakohan/craftdoor/logging"
+)
+
+// recordingApplier records the unlock durations it is applied with and fails
+// to apply those in fail.
+type recordingApplier struct {
+	applied []time.Duration
+	fail    time.Duration
+}
+
+func (a *recordingApplier) ApplyConfig(cfg *Config) error {
+	a.applied = append(a.applied, cfg.Door.UnlockDuration.Duration)
+	if cfg.Door.UnlockDuration.Duration == a.fail {
+		return errors.New("can't apply")
+	}
+	return nil
+}
+
+func TestReloadRollsBack(t *testing.T) {
+	logging.SetLevel(logging.ErrorLevel)
+	dir, err := ioutil.TempDir("", "craftdoor-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	schema := filepath.Join(dir, "schema.sql")
+	err = ioutil.WriteFile(schema, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	write := func(unlock string) {
+		t.Helper()
+		cfg := fmt.Sprintf(`{"sqlite_file": %q, "sqlite_schema_file": %q, "door": {"unlock_duration": %q}}`,
+			filepath.Join(dir, "test.db"), schema, unlock)
+		err := ioutil.WriteFile(path, []byte(cfg), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("3s")
+	current, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReloader(path, current)
+	first := &recordingApplier{}
+	second := &recordingApplier{fail: 5 * time.Second}
+	third := &recordingApplier{}
+	r.Register(first)
+	r.Register(second)
+	r.Register(third)
+
+	// The second applier fails, so the first and second get the current
+	// config again, and the third never sees the new one.
+	write("5s")
+	_, err = r.Reload()
+	if err == nil {
+		t.Fatal("Reload succeeded although an applier failed")
+	}
+	want := []time.Duration{5 * time.Second, 3 * time.Second}
+	if !reflect.DeepEqual(first.applied, want) || !reflect.DeepEqual(second.applied, want) || len(third.applied) != 0 {
+		t.Errorf("appliers were applied %v, %v and %v, want %v, %v and none", first.applied, second.applied, third.applied, want, want)
+	}
+	if d := r.Current().Door.UnlockDuration.Duration; d != 3*time.Second {
+		t.Errorf("current unlock_duration is %s after failed reload, want 3s", d)
+	}
+
+	write("4s")
+	_, err = r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := r.Current().Door.UnlockDuration.Duration; d != 4*time.Second {
+		t.Errorf("current unlock_duration is %s after reload, want 4s", d)
+	}
+	if got := third.applied; !reflect.DeepEqual(got, []time.Duration{4 * time.Second}) {
+		t.Errorf("third applier was applied %v, want [4s]", got)
+	}
+}
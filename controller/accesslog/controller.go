@@ -0,0 +1,60 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pakohan/craftdoor/model"
+)
+
+const (
+	// defaultLimit is how many entries are listed unless the limit query
+	// parameter is given.
+	defaultLimit = 100
+
+	// maxLimit is the most entries listed at once.
+	maxLimit = 10000
+)
+
+type controller struct {
+	m model.Model
+}
+
+// New initializes a new router
+func New(r *mux.Router, m model.Model) {
+	c := controller{
+		m: m,
+	}
+
+	// GET requests.
+	r.Methods(http.MethodGet).HandlerFunc(c.list)
+}
+
+func (c *controller) list(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err == nil && (limit <= 0 || limit > maxLimit) {
+			err = fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, err := c.m.AccessLogModel.List(r.Context(), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
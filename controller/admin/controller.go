@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pakohan/craftdoor/config"
+)
+
+type controller struct {
+	rl *config.Reloader
+}
+
+// New initializes a new router
+func New(r *mux.Router, rl *config.Reloader) {
+	c := controller{
+		rl: rl,
+	}
+
+	// POST requests.
+	r.Methods(http.MethodPost).Path("/reload").HandlerFunc(c.reload)
+}
+
+// reload re-reads the config file and applies it. Responds with the fields
+// that were applied and those that require a restart.
+func (c *controller) reload(w http.ResponseWriter, r *http.Request) {
+	report, err := c.rl.Reload()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,149 @@
+package calendar
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pakohan/craftdoor/model"
+	"github.com/pakohan/craftdoor/service"
+)
+
+type controller struct {
+	m model.Model
+	s *service.Service
+}
+
+// New initializes a new router
+func New(r *mux.Router, m model.Model, s *service.Service) {
+	c := controller{
+		m: m,
+		s: s,
+	}
+
+	// POST requests.
+	r.Methods(http.MethodPost).Path("/import").HandlerFunc(c.importICal)
+	r.Methods(http.MethodPost).HandlerFunc(c.create)
+
+	// GET requests.
+	r.Methods(http.MethodGet).Path("/{id}").HandlerFunc(c.get)
+	r.Methods(http.MethodGet).HandlerFunc(c.list)
+
+	// PUT requests.
+	r.Methods(http.MethodPut).Path("/{id}").HandlerFunc(c.update)
+
+	// DELETE requests.
+	r.Methods(http.MethodDelete).Path("/{id}").HandlerFunc(c.delete)
+}
+
+func (c *controller) list(w http.ResponseWriter, r *http.Request) {
+	res, err := c.m.CalendarModel.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (c *controller) create(w http.ResponseWriter, r *http.Request) {
+	t := model.CalendarEntry{}
+	err := json.NewDecoder(r.Body).Decode(&t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.s.CreateCalendarEntry(r.Context(), &t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) get(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := c.m.CalendarModel.Get(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) update(w http.ResponseWriter, r *http.Request) {
+	t := model.CalendarEntry{}
+	err := json.NewDecoder(r.Body).Decode(&t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t.ID, err = strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.s.UpdateCalendarEntry(r.Context(), t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.s.DeleteCalendarEntry(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// importICal imports the iCalendar file in the request body. Responds with
+// the number of imported entries and the reasons for skipping events.
+func (c *controller) importICal(w http.ResponseWriter, r *http.Request) {
+	report, err := c.s.ImportCalendar(r.Context(), r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -2,17 +2,28 @@ package controller
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/jpillora/ipfilter"
 	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/controller/accesslog"
+	"github.com/pakohan/craftdoor/controller/admin"
+	"github.com/pakohan/craftdoor/controller/calendar"
+	"github.com/pakohan/craftdoor/controller/doors"
+	"github.com/pakohan/craftdoor/controller/health"
 	"github.com/pakohan/craftdoor/controller/keys"
 	"github.com/pakohan/craftdoor/controller/members"
+	"github.com/pakohan/craftdoor/controller/nodes"
+	"github.com/pakohan/craftdoor/controller/simdoor"
+	"github.com/pakohan/craftdoor/controller/simreader"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/logging"
 	"github.com/pakohan/craftdoor/model"
+	"github.com/pakohan/craftdoor/rfid"
 	"github.com/pakohan/craftdoor/service"
 )
 
@@ -20,19 +31,66 @@ type controller struct {
 	m model.Model
 	s *service.Service
 
-	http.Handler
+	// Routes requests to handlers.
+	router *mux.Router
+
+	// The router wrapped in CORS and IP filters. Replaced by ApplyConfig.
+	handler atomic.Value
 }
 
 // New returns a new http.Handler
-func New(cfg *config.Config, m model.Model, s *service.Service) http.Handler {
+//
+// The handler registers itself with rl so that CORS and IP filters follow
+// config reloads. If simReader or simDoor is not nil, its control API is
+// served under /api/sim/reader or /api/sim/door.
+func New(cfg *config.Config, m model.Model, s *service.Service, simReader *rfid.SimulatedReader, simDoor *door.Simulator, rl *config.Reloader) http.Handler {
 	r := mux.NewRouter()
 
+	c := &controller{
+		m:      m,
+		s:      s,
+		router: r,
+	}
+	err := c.ApplyConfig(cfg)
+	if err != nil {
+		// Config has already been validated.
+		logging.Errorf("Failed to apply config to controller: %s", err)
+	}
+	rl.Register(c)
+
+	r.Path("/api").Methods(http.MethodGet).HandlerFunc(c.ReadNextTag)
+	health.New(r, s)
+	admin.New(r.PathPrefix("/api/admin").Subrouter(), rl)
+	members.New(r.PathPrefix("/api/members").Subrouter(), m)
+	keys.New(r.PathPrefix("/api/keys").Subrouter(), m, s)
+	calendar.New(r.PathPrefix("/api/calendar").Subrouter(), m, s)
+	doors.New(r.PathPrefix("/api/doors").Subrouter(), s)
+	nodes.New(r.PathPrefix("/api/nodes").Subrouter(), s, cfg, rl)
+	accesslog.New(r.PathPrefix("/api/access_log").Subrouter(), m)
+	if simReader != nil {
+		simreader.New(r.PathPrefix("/api/sim/reader").Subrouter(), simReader)
+	}
+	if simDoor != nil {
+		simdoor.New(r.PathPrefix("/api/sim/door").Subrouter(), simDoor)
+	}
+
+	// Assume everything other route is a static asset.
+	//
+	// TODO(duckworthd): The webapp changes the URL when switching between tabs,
+	// but refreshing the page results in a 404. Figure out how to fix this.
+	fileServerPath := cfg.StaticAssetsDir
+	fileServer := http.FileServer(http.Dir(fileServerPath))
+	logging.Infof("Serving static files from %s", fileServerPath)
+	r.PathPrefix("/").Methods(http.MethodGet).Handler(fileServer)
+
+	return c
+}
+
+// ApplyConfig rebuilds the CORS and IP filters in front of the router.
+func (c *controller) ApplyConfig(cfg *config.Config) error {
 	// Filter
 	var handler http.Handler = handlers.CORS(
-		handlers.AllowedOrigins([]string{
-			"http://localhost:8081",
-			"http://localhost:8080",
-		}),
+		handlers.AllowedOrigins(cfg.AllowedOrigins),
 		handlers.AllowedHeaders([]string{
 			"Authorization",
 			"Content-Type",
@@ -53,55 +111,47 @@ func New(cfg *config.Config, m model.Model, s *service.Service) http.Handler {
 			"DELETE",
 			"HEAD",
 		}),
-	)(r)
+	)(c.router)
 
 	// Filter by IP address.
 	handler = ipfilter.Wrap(handler, ipfilter.Options{
-		AllowedIPs:     []string{"192.168.0.0/24", "10.0.1.0/24", "10.0.0.0/24"},
+		AllowedIPs:     cfg.AllowedIPs,
 		BlockByDefault: true,
 	})
 
-	c := &controller{
-		m:       m,
-		s:       s,
-		Handler: handler,
-	}
-	r.Path("/api").Methods(http.MethodGet).HandlerFunc(c.ReadNextTag)
-	members.New(r.PathPrefix("/api/members").Subrouter(), m)
-	keys.New(r.PathPrefix("/api/keys").Subrouter(), m, s)
+	// Log all requests, including those rejected above.
+	handler = accessLog(handler)
 
-	// Assume everything other route is a static asset.
-	//
-	// TODO(duckworthd): The webapp changes the URL when switching between tabs,
-	// but refreshing the page results in a 404. Figure out how to fix this.
-	fileServerPath := cfg.StaticAssetsDir
-	fileServer := http.FileServer(http.Dir(fileServerPath))
-	log.Printf("Serving static files from %s", fileServerPath)
-	r.PathPrefix("/").Methods(http.MethodGet).Handler(fileServer)
+	c.handler.Store(handler)
+	return nil
+}
 
-	return c
+// ServeHTTP passes the request to the current handler.
+func (c *controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.handler.Load().(http.Handler).ServeHTTP(w, r)
 }
 
 // ReadNextTag reads the next available RFID tag and returns its data.
 func (c *controller) ReadNextTag(resp http.ResponseWriter, req *http.Request) {
-	log.Printf("Attempting to read next available tag...")
+	log := logging.FromContext(req.Context())
+	log.Debugf("Attempting to read next available tag...")
 
 	// TODO(duckworthd): Read timeout from query parameter "timeout_sec" if available.
 	var timeout time.Duration = 5 * time.Second
 
 	state, err := c.s.ReadNextTag(timeout)
 	if err != nil {
-		log.Printf("Failed in call to Service.ReadNextTag(): %s", err)
+		log.Errorf("Failed in call to Service.ReadNextTag(): %s", err)
 		http.Error(resp, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	err = json.NewEncoder(resp).Encode(state)
 	if err != nil {
-		log.Printf("Failed to encode JSON: %s", err)
+		log.Errorf("Failed to encode JSON: %s", err)
 		http.Error(resp, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Succesfully return tag: %s", state.UUID)
+	log.Debugf("Succesfully return tag: %s", state.UUID)
 }
@@ -0,0 +1,78 @@
+package doors
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pakohan/craftdoor/model"
+	"github.com/pakohan/craftdoor/service"
+)
+
+type controller struct {
+	s *service.Service
+}
+
+// New initializes a new router
+func New(r *mux.Router, s *service.Service) {
+	c := controller{
+		s: s,
+	}
+
+	// GET requests.
+	r.Methods(http.MethodGet).Path("/{id}").HandlerFunc(c.get)
+	r.Methods(http.MethodGet).Path("/{id}/mode").HandlerFunc(c.getMode)
+
+	// PUT requests.
+	r.Methods(http.MethodPut).Path("/{id}/mode").HandlerFunc(c.setMode)
+}
+
+func (c *controller) get(w http.ResponseWriter, r *http.Request) {
+	res, err := c.s.DoorStatus(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) getMode(w http.ResponseWriter, r *http.Request) {
+	res, err := c.s.DoorMode(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) setMode(w http.ResponseWriter, r *http.Request) {
+	t := model.DoorMode{}
+	err := json.NewDecoder(r.Body).Decode(&t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t.DoorID = mux.Vars(r)["id"]
+
+	err = c.s.SetDoorMode(r.Context(), &t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,46 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pakohan/craftdoor/service"
+)
+
+type controller struct {
+	s *service.Service
+}
+
+// New initializes a new router
+func New(r *mux.Router, s *service.Service) {
+	c := controller{
+		s: s,
+	}
+
+	// GET requests.
+	r.Methods(http.MethodGet).Path("/healthz").HandlerFunc(c.healthz)
+	r.Methods(http.MethodGet).Path("/readyz").HandlerFunc(c.readyz)
+}
+
+func (c *controller) healthz(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, c.s.Liveness())
+}
+
+func (c *controller) readyz(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, c.s.Readiness(r.Context()))
+}
+
+// writeReport encodes a HealthReport. Unhealthy reports are returned with
+// status 503 so that load balancers and probes can act on the status code.
+func writeReport(w http.ResponseWriter, report service.HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if !report.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,139 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/lib"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/model"
+	"github.com/pakohan/craftdoor/rfid"
+	"github.com/pakohan/craftdoor/service"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestRouter returns a router serving the health endpoints of a service
+// with a simulated reader and door, and the service's reader and clock.
+func newTestRouter(t *testing.T) (*mux.Router, *rfid.SimulatedReader, *clock.Fake) {
+	logging.SetLevel(logging.ErrorLevel)
+	dir, err := ioutil.TempDir("", "craftdoor-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cfg := config.Default()
+	cfg.SQLiteFile = filepath.Join(dir, "test.db")
+	cfg.SQLiteSchemaFile = "../../assets/schema.sql"
+	cfg.Reader.Simulated.Latency = config.Duration{Duration: time.Millisecond}
+	err = cfg.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := lib.OpenDB(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	clk := clock.NewFake(time.Date(2026, time.January, 5, 12, 0, 0, 0, time.UTC))
+	reader, err := rfid.NewSimulatedReader(cfg.Reader.Simulated, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := door.NewCalendar(time.UTC)
+	d, _, err := door.NewSimulatedDoor(cfg.Door, cal, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := service.New(&cfg, model.New(db), reader, d, cal, clk)
+	t.Cleanup(func() {
+		clk.AdvanceWhile(s.Close)
+		d.Close()
+	})
+
+	r := mux.NewRouter()
+	New(r, s)
+	return r, reader, clk
+}
+
+// get requests path from r and decodes the report it returns.
+func get(t *testing.T, r *mux.Router, path string) (int, service.HealthReport) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var report service.HealthReport
+	err := json.NewDecoder(rec.Body).Decode(&report)
+	if err != nil {
+		t.Fatalf("GET %s returned an invalid report: %s", path, err)
+	}
+	return rec.Code, report
+}
+
+// check returns the named check of report.
+func check(report service.HealthReport, name string) (service.Check, bool) {
+	for _, c := range report.Checks {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return service.Check{}, false
+}
+
+func TestHealth(t *testing.T) {
+	r, reader, clk := newTestRouter(t)
+
+	// Wait for DoorAccessLoop to start. The reader hasn't completed a read
+	// yet, which doesn't make the service unready.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		code, report := get(t, r, "/readyz")
+		if code == http.StatusOK {
+			if c, ok := check(report, "reader"); !ok || !c.OK {
+				t.Errorf("/readyz has reader check %+v before the first read, want it to pass", c)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET /readyz = %d %+v, want %d", code, report, http.StatusOK)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if code, report := get(t, r, "/healthz"); code != http.StatusOK || !report.OK {
+		t.Errorf("GET /healthz = %d %+v, want %d", code, report, http.StatusOK)
+	}
+
+	// A reader that fails permanently makes the service unready, but not
+	// dead.
+	reader.Inject(errors.New("reader unplugged"), 1)
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		code, report := get(t, r, "/readyz")
+		if code == http.StatusServiceUnavailable {
+			if c, ok := check(report, "reader"); !ok || c.OK || c.Error == "" {
+				t.Errorf("/readyz has reader check %+v after a failed read, want it to fail", c)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET /readyz = %d %+v after a failed read, want %d", code, report, http.StatusServiceUnavailable)
+		}
+		clk.Advance(time.Millisecond)
+		time.Sleep(time.Millisecond)
+	}
+	if code, report := get(t, r, "/healthz"); code != http.StatusOK || !report.OK {
+		t.Errorf("GET /healthz = %d %+v after a failed read, want %d", code, report, http.StatusOK)
+	}
+}
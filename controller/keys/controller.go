@@ -8,6 +8,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/pakohan/craftdoor/model"
+	"github.com/pakohan/craftdoor/rfid"
 	"github.com/pakohan/craftdoor/service"
 )
 
@@ -59,6 +60,12 @@ func (c *controller) create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = checkCardType(&t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	err = c.m.KeyModel.Create(r.Context(), &t)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -109,6 +116,12 @@ func (c *controller) update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = checkCardType(&t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Update database.
 	err = c.m.KeyModel.Update(r.Context(), &t)
 	if err != nil {
@@ -161,7 +174,13 @@ func (c *controller) register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "RFID tag's ID is empty. This is an internal error and should not happen...", http.StatusInternalServerError)
 		return
 	}
-	t.UUID = state.TagInfo.ID
+	t.UUID = rfid.CredentialID(state.TagInfo.ID)
+	t.CardType = state.TagInfo.CardType
+	err = checkCardType(&t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Insert new tag into database.
 	err = c.m.KeyModel.Create(r.Context(), &t)
@@ -177,3 +196,12 @@ func (c *controller) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// checkCardType checks the card type of k, which defaults to unknown.
+func checkCardType(k *model.Key) error {
+	if k.CardType == "" {
+		k.CardType = string(rfid.CardUnknown)
+	}
+	_, err := rfid.ParseCardType(k.CardType)
+	return err
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pakohan/craftdoor/logging"
+)
+
+// requestIDHeader carries the ID used to correlate log lines for a request.
+const requestIDHeader = "X-Request-Id"
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// accessLog logs one line per request and stores a logger carrying the
+// request's ID in the request context.
+//
+// Health checks are polled frequently and are only logged at debug level.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		log := logging.With("request_id", requestID)
+		r = r.WithContext(logging.NewContext(r.Context(), log))
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		log = log.With(
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+			"remote", r.RemoteAddr,
+		)
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			log.Debugf("HTTP request")
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/heartbeat") && rec.status == http.StatusOK {
+			// Door nodes send heartbeats every few seconds.
+			log.Debugf("HTTP request")
+			return
+		}
+		log.Infof("HTTP request")
+	})
+}
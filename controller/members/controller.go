@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/pakohan/craftdoor/access"
 	"github.com/pakohan/craftdoor/model"
 )
 
@@ -26,9 +27,11 @@ func New(r *mux.Router, m model.Model) {
 	r.Methods(http.MethodGet).HandlerFunc(c.list)
 
 	// PUT requests.
+	r.Methods(http.MethodPut).Path("/{id}/pin").HandlerFunc(c.setPIN)
 	r.Methods(http.MethodPut).Path("/{id}").HandlerFunc(c.update)
 
 	// DELETE requests.
+	r.Methods(http.MethodDelete).Path("/{id}/pin").HandlerFunc(c.deletePIN)
 	r.Methods(http.MethodDelete).Path("/{id}").HandlerFunc(c.delete)
 }
 
@@ -128,3 +131,48 @@ func (c *controller) delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// pinRequest sets a member's PIN. Only its hash is stored.
+type pinRequest struct {
+	PIN string `json:"pin"`
+}
+
+func (c *controller) setPIN(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := pinRequest{}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hash, err := access.HashPIN(req.PIN)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.m.MemberModel.SetPINHash(r.Context(), id, hash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+func (c *controller) deletePIN(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.m.MemberModel.SetPINHash(r.Context(), id, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
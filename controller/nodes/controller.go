@@ -0,0 +1,253 @@
+package nodes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/node"
+	"github.com/pakohan/craftdoor/service"
+)
+
+// maxRequestSize limits the size of requests sent by nodes.
+const maxRequestSize = 1 << 20
+
+type controller struct {
+	s *service.Service
+
+	// Shared secrets of the configured nodes, by node ID. Replaced by
+	// ApplyConfig.
+	secrets atomic.Value
+}
+
+// New initializes a new router
+//
+// Requests sent by nodes must be signed with the node's secret, which the
+// responses are signed with, too. The controller registers itself with rl so
+// that changes to the configured nodes apply live.
+func New(r *mux.Router, s *service.Service, cfg *config.Config, rl *config.Reloader) {
+	c := &controller{
+		s: s,
+	}
+	err := c.ApplyConfig(cfg)
+	if err != nil {
+		// Config has already been validated.
+		logging.Errorf("Failed to apply config to nodes controller: %s", err)
+	}
+	rl.Register(c)
+
+	// GET requests.
+	r.Methods(http.MethodGet).Path("/{id}/access_list").Handler(c.authenticate(c.accessList))
+	r.Methods(http.MethodGet).Path("/{id}").HandlerFunc(c.get)
+	r.Methods(http.MethodGet).HandlerFunc(c.list)
+
+	// POST requests, sent by nodes.
+	r.Methods(http.MethodPost).Path("/{id}/heartbeat").Handler(c.authenticate(c.heartbeat))
+	r.Methods(http.MethodPost).Path("/{id}/tags").Handler(c.authenticate(c.tag))
+	r.Methods(http.MethodPost).Path("/{id}/events").Handler(c.authenticate(c.events))
+}
+
+// ApplyConfig replaces the secrets of the configured nodes.
+func (c *controller) ApplyConfig(cfg *config.Config) error {
+	secrets := map[string]string{}
+	for _, n := range cfg.Nodes {
+		secrets[n.ID] = n.Secret
+	}
+	c.secrets.Store(secrets)
+	return nil
+}
+
+// authenticate rejects requests that aren't signed with the secret of the
+// node in the request's path.
+func (c *controller) authenticate(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		secret, ok := c.secrets.Load().(map[string]string)[id]
+		if !ok {
+			http.Error(w, "unknown node", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = node.Verify(secret, r.Method, r.URL.EscapedPath(), r.Header.Get(node.HeaderTimestamp), r.Header.Get(node.HeaderSignature), body, time.Now())
+		if err != nil {
+			logging.FromContext(r.Context()).Warnf("Rejected request of node %s: %s", id, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		res := &signedResponse{header: http.Header{}, status: http.StatusOK}
+		next(res, r)
+
+		for k, v := range res.header {
+			w.Header()[k] = v
+		}
+		signature := node.SignResponse(secret, r.Header.Get(node.HeaderSignature), res.status, res.body.Bytes())
+		w.Header().Set(node.HeaderSignature, signature)
+		w.WriteHeader(res.status)
+		_, err = w.Write(res.body.Bytes())
+		if err != nil {
+			logging.FromContext(r.Context()).Errorf("Failed to respond to node %s: %s", id, err)
+		}
+	})
+}
+
+// signedResponse buffers a response to a node until it can be signed.
+type signedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *signedResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *signedResponse) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *signedResponse) WriteHeader(status int) {
+	r.status = status
+}
+
+func (c *controller) list(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(c.s.Nodes())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) get(w http.ResponseWriter, r *http.Request) {
+	res, err := c.s.Node(mux.Vars(r)["id"])
+	if errors.Is(err, service.ErrUnknownNode) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) heartbeat(w http.ResponseWriter, r *http.Request) {
+	hb := node.Heartbeat{}
+	err := json.NewDecoder(r.Body).Decode(&hb)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := c.s.NodeHeartbeat(r.Context(), mux.Vars(r)["id"], r.RemoteAddr, hb)
+	if err != nil {
+		serviceError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) tag(w http.ResponseWriter, r *http.Request) {
+	event := node.TagEvent{}
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	// The node was authenticated, so its secret is known.
+	err = event.OpenPIN(c.secrets.Load().(map[string]string)[id])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := c.s.NodeTag(r.Context(), id, event)
+	if err != nil {
+		serviceError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) accessList(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	list, err := c.s.NodeAccessList(r.Context(), id)
+	if err != nil {
+		serviceError(w, r, err)
+		return
+	}
+
+	// The node was authenticated, so its secret is known.
+	res, err := node.SealAccessList(c.secrets.Load().(map[string]string)[id], list)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) events(w http.ResponseWriter, r *http.Request) {
+	req := node.AccessEvents{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.s.NodeEvents(r.Context(), mux.Vars(r)["id"], req.Events)
+	if err != nil {
+		serviceError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(struct{}{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// serviceError responds to a node with err. Requests of nodes the master
+// doesn't admit are forbidden, which nodes take as a denial. Other errors are
+// internal, which nodes take as the master being unavailable.
+func serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrUnknownNode) || errors.Is(err, service.ErrWrongDoor) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	logging.FromContext(r.Context()).Errorf("Failed to handle request of node %s: %s", mux.Vars(r)["id"], err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,83 @@
+package simdoor
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pakohan/craftdoor/door"
+)
+
+type controller struct {
+	sim *door.Simulator
+}
+
+// New initializes a new router
+func New(r *mux.Router, sim *door.Simulator) {
+	c := controller{
+		sim: sim,
+	}
+
+	// GET requests.
+	r.Methods(http.MethodGet).Path("/timeline").HandlerFunc(c.timeline)
+	r.Methods(http.MethodGet).HandlerFunc(c.get)
+
+	// POST requests.
+	r.Methods(http.MethodPost).Path("/open").HandlerFunc(c.open)
+	r.Methods(http.MethodPost).Path("/close").HandlerFunc(c.close)
+	r.Methods(http.MethodPost).Path("/keypad").HandlerFunc(c.keypad)
+}
+
+func (c *controller) get(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(c.sim.State())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) timeline(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(c.sim.Timeline().Events())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *controller) open(w http.ResponseWriter, r *http.Request) {
+	err := c.sim.Open()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.get(w, r)
+}
+
+func (c *controller) close(w http.ResponseWriter, r *http.Request) {
+	err := c.sim.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.get(w, r)
+}
+
+// keypadRequest presses keys on the simulated keypad, e.g. "1234#".
+type keypadRequest struct {
+	Keys string `json:"keys"`
+}
+
+func (c *controller) keypad(w http.ResponseWriter, r *http.Request) {
+	req := keypadRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = c.sim.PressKeys(req.Keys)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.get(w, r)
+}
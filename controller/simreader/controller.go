@@ -0,0 +1,56 @@
+package simreader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pakohan/craftdoor/rfid"
+)
+
+type controller struct {
+	r *rfid.SimulatedReader
+}
+
+// New initializes a new router
+func New(r *mux.Router, sim *rfid.SimulatedReader) {
+	c := controller{
+		r: sim,
+	}
+
+	// GET requests.
+	r.Methods(http.MethodGet).HandlerFunc(c.get)
+
+	// POST requests.
+	r.Methods(http.MethodPost).HandlerFunc(c.exec)
+}
+
+func (c *controller) get(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(c.r.State())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// exec runs the commands in the request body, one per line, and stops at the
+// first that fails. See rfid.SimulatedReader.Exec.
+func (c *controller) exec(w http.ResponseWriter, r *http.Request) {
+	scanner := bufio.NewScanner(r.Body)
+	for line := 1; scanner.Scan(); line++ {
+		err := c.r.Exec(r.Context(), scanner.Text())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("line %d: %s", line, err), http.StatusBadRequest)
+			return
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.get(w, r)
+}
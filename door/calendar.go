@@ -0,0 +1,156 @@
+package door
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ExceptionKind describes how an Exception changes a day's opening windows.
+type ExceptionKind string
+
+const (
+	// Closed means no windows start on the date.
+	Closed ExceptionKind = "closed"
+	// Custom means the exception's windows replace the regular windows.
+	Custom ExceptionKind = "custom"
+	// Extended means the exception's windows are added to the regular windows.
+	Extended ExceptionKind = "extended"
+)
+
+// ParseExceptionKind validates an exception kind's name.
+func ParseExceptionKind(name string) (ExceptionKind, error) {
+	switch k := ExceptionKind(name); k {
+	case Closed, Custom, Extended:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown calendar entry kind: %q", name)
+}
+
+// Exception overrides a Schedule's regular windows on a single date.
+type Exception struct {
+	Date    Date
+	Kind    ExceptionKind
+	Windows []Window
+}
+
+// ParseException validates an exception's date, e.g. "2006-01-02", kind and
+// windows, e.g. "10:00-14:00". Windows are required unless the kind is Closed.
+func ParseException(date string, kind string, windows []string) (Exception, error) {
+	d, err := ParseDate(date)
+	if err != nil {
+		return Exception{}, err
+	}
+	k, err := ParseExceptionKind(kind)
+	if err != nil {
+		return Exception{}, err
+	}
+
+	result := Exception{Date: d, Kind: k, Windows: []Window{}}
+	for _, value := range windows {
+		w, err := ParseWindow(value)
+		if err != nil {
+			return Exception{}, err
+		}
+		result.Windows = append(result.Windows, w)
+	}
+	if k != Closed && len(result.Windows) == 0 {
+		return Exception{}, fmt.Errorf("%s calendar entry requires windows", k)
+	}
+	return result, nil
+}
+
+// Calendar holds exceptions to regular opening hours, such as public holidays
+// or events.
+//
+// A Calendar is shared between all schedules of a door. Latches subscribe to
+// it so they can re-evaluate their schedule when the calendar changes.
+//
+// Only the opening hours of the door follow the calendar. Members have no
+// access hours, so their tags are accepted regardless of it.
+type Calendar struct {
+	// Location in which exception dates and windows are interpreted.
+	Location *time.Location
+
+	mu          sync.Mutex
+	exceptions  map[Date][]Exception
+	subscribers []chan struct{}
+}
+
+// NewCalendar returns an empty calendar.
+func NewCalendar(location *time.Location) *Calendar {
+	return &Calendar{
+		Location:   location,
+		exceptions: map[Date][]Exception{},
+	}
+}
+
+// Set replaces all exceptions and notifies subscribers.
+func (c *Calendar) Set(exceptions []Exception) {
+	byDate := map[Date][]Exception{}
+	for _, e := range exceptions {
+		byDate[e.Date] = append(byDate[e.Date], e)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exceptions = byDate
+	for _, ch := range c.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// A notification is already pending.
+		}
+	}
+}
+
+// Lookup returns the exceptions on a date.
+func (c *Calendar) Lookup(date Date) []Exception {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exceptions[date]
+}
+
+// Subscribe returns a channel that receives a value after the calendar
+// changes. Notifications are coalesced.
+func (c *Calendar) Subscribe() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+	ch := make(chan struct{}, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribers = append(c.subscribers, ch)
+	return ch
+}
+
+// windows returns the windows starting on date after applying exceptions to
+// regular.
+//
+// If a date has several exceptions, closed takes precedence over custom, and
+// all custom and extended windows are combined.
+func (c *Calendar) windows(date Date, regular []Window) []Window {
+	exceptions := c.Lookup(date)
+	if len(exceptions) == 0 {
+		return regular
+	}
+
+	custom := false
+	extra := []Window{}
+	for _, e := range exceptions {
+		switch e.Kind {
+		case Closed:
+			return nil
+		case Custom:
+			custom = true
+		}
+		extra = append(extra, e.Windows...)
+	}
+	if custom {
+		return extra
+	}
+	return append(append([]Window{}, regular...), extra...)
+}
@@ -10,6 +10,32 @@ type Door interface {
 	// Authentication failed. Lock door.
 	AuthFail() error
 
+	// A member with the keyholder role was admitted. Under a first-in
+	// policy, this starts the current opening window.
+	KeyholderIn() error
+
+	// Returns an error if the door's background goroutines have stopped.
+	Health() error
+
+	// Returns the door's keypad, or nil if it has none.
+	PINPad() *PINPad
+
+	// Changes the door's mode. See Mode.
+	SetMode(mode ModeState) error
+
+	// Stops background goroutines and drives the relays to their safe state
+	// (unlocked for fail-safe, locked for fail-secure).
+	Close() error
+
+	// Identifies the door in the REST API and database.
+	ID() string
+
+	// Describes how the door's locks are wired.
+	Relays() []RelayInfo
+
+	// Returns the current state of the door's latches.
+	Latches() []LatchState
+
 	String() string
 }
 
@@ -17,4 +43,11 @@ type Door interface {
 type Latch interface {
 	// Temporarily unlock a door. Resumes default state after duration.
 	Unlock(duration time.Duration) error
+
+	// Returns an error if the latch's background goroutine has stopped.
+	Health() error
+
+	// Stops the latch's background goroutine and drives its relay to its
+	// safe state (unlocked for fail-safe, locked for fail-secure).
+	Close() error
 }
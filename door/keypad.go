@@ -0,0 +1,223 @@
+package door
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/wiegand"
+	"periph.io/x/periph/conn/gpio"
+)
+
+// keys are the keys a keypad may have.
+const keys = "0123456789*#"
+
+// Keypad reads keys pressed on a keypad next to the door.
+type Keypad interface {
+	// Delivers pressed keys, '0'-'9', '*' and '#', until the keypad is
+	// closed.
+	Keys() <-chan rune
+
+	// Returns an error if the keypad's background goroutine has stopped.
+	Health() error
+
+	// Stops the keypad's background goroutine.
+	Close() error
+
+	String() string
+}
+
+func init() {
+	config.RegisterValidator(func(cfg *config.Config) error {
+		k := cfg.Door.Keypad
+		switch k.Type {
+		case "none":
+		case "matrix":
+			if len(k.RowPins) == 0 || len(k.ColumnPins) == 0 {
+				return errors.New("door.keypad: a matrix keypad needs row_pins and column_pins")
+			}
+			if len(k.Layout) != len(k.RowPins) {
+				return fmt.Errorf("door.keypad.layout has %d rows, want %d", len(k.Layout), len(k.RowPins))
+			}
+			for _, row := range k.Layout {
+				if len(row) != len(k.ColumnPins) {
+					return fmt.Errorf("door.keypad.layout: row %q has %d keys, want %d", row, len(row), len(k.ColumnPins))
+				}
+				for _, key := range row {
+					if !strings.ContainsRune(keys, key) {
+						return fmt.Errorf("door.keypad.layout: unknown key %q", key)
+					}
+				}
+			}
+		case "wiegand":
+			if k.D0Pin == "" || k.D1Pin == "" {
+				return errors.New("door.keypad: a wiegand keypad needs d0_pin and d1_pin")
+			}
+		default:
+			return fmt.Errorf("door.keypad.type: unknown keypad %q", k.Type)
+		}
+		if k.EntryTimeout.Duration <= 0 {
+			return errors.New("door.keypad.entry_timeout must be positive")
+		}
+		if k.MaxAttempts < 1 {
+			return errors.New("door.keypad.max_attempts must be at least 1")
+		}
+		if k.Lockout.Duration < 0 {
+			return errors.New("door.keypad.lockout must not be negative")
+		}
+		return nil
+	})
+}
+
+// newKeypad returns the keypad selected by cfg.Type, whose pins are looked up
+// with byName, or nil if the door has no keypad.
+func newKeypad(cfg config.KeypadConfig, byName func(string) gpio.PinIO) (Keypad, error) {
+	pin := func(name string) (gpio.PinIO, error) {
+		p := byName(name)
+		if p == nil {
+			return nil, fmt.Errorf("unknown GPIO pin: %q", name)
+		}
+		return p, nil
+	}
+
+	switch cfg.Type {
+	case "none":
+		return nil, nil
+	case "matrix":
+		rows := []gpio.PinIO{}
+		for _, name := range cfg.RowPins {
+			p, err := pin(name)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, p)
+		}
+		columns := []gpio.PinIO{}
+		for _, name := range cfg.ColumnPins {
+			p, err := pin(name)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, p)
+		}
+		return NewMatrixKeypad(rows, columns, cfg.Layout)
+	case "wiegand":
+		d0, err := pin(cfg.D0Pin)
+		if err != nil {
+			return nil, err
+		}
+		d1, err := pin(cfg.D1Pin)
+		if err != nil {
+			return nil, err
+		}
+		return NewWiegandKeypad(d0, d1)
+	default:
+		return nil, fmt.Errorf("unknown keypad %q", cfg.Type)
+	}
+}
+
+// WiegandKeypad is a keypad sending each key as a Wiegand frame. Keypads send
+// either 4-bit frames holding the key, or 8-bit frames whose high nibble is
+// the complement of the low one. 0-9 are digits, 10 is '*' and 11 is '#'.
+type WiegandKeypad struct {
+	receiver *wiegand.Receiver
+	keys     chan rune
+	loop     *loop
+	log      *logging.Logger
+}
+
+// NewWiegandKeypad returns a keypad whose D0 and D1 lines are connected to d0
+// and d1.
+//
+// Call Close to stop receiving.
+func NewWiegandKeypad(d0, d1 gpio.PinIn) (*WiegandKeypad, error) {
+	k := &WiegandKeypad{
+		keys: make(chan rune, 16),
+		loop: newLoop(),
+	}
+	k.log = logging.With("keypad", k.String())
+	receiver, err := wiegand.NewReceiver(k.String(), d0, d1)
+	if err != nil {
+		return nil, err
+	}
+	k.receiver = receiver
+	k.loop.start(k.decodeLoop)
+	return k, nil
+}
+
+// Keys delivers pressed keys.
+func (k *WiegandKeypad) Keys() <-chan rune {
+	return k.keys
+}
+
+// Health returns an error if the decode loop has stopped.
+func (k *WiegandKeypad) Health() error {
+	if !k.loop.isRunning() {
+		return errors.New("keypad decode loop is not running")
+	}
+	return nil
+}
+
+// Close stops receiving.
+func (k *WiegandKeypad) Close() error {
+	k.loop.stop()
+	return k.receiver.Close()
+}
+
+func (k *WiegandKeypad) String() string {
+	return "WiegandKeypad"
+}
+
+// decodeLoop turns frames into keys until Close is called.
+func (k *WiegandKeypad) decodeLoop() {
+	defer k.loop.exit()
+	for {
+		var frame []bool
+		select {
+		case <-k.loop.stopping():
+			return
+		case frame = <-k.receiver.Frames():
+		}
+
+		key, ok := decodeKey(frame)
+		if !ok {
+			k.log.Debugf("Ignoring %d-bit frame %x.", len(frame), wiegand.Value(frame))
+			continue
+		}
+		select {
+		case k.keys <- key:
+		default:
+			k.log.Warnf("Dropping key %q, which wasn't read in time.", key)
+		}
+	}
+}
+
+// decodeKey returns the key sent in a Wiegand keypad frame.
+func decodeKey(frame []bool) (rune, bool) {
+	v := wiegand.Value(frame)
+	switch len(frame) {
+	case 4:
+	case 8:
+		if v>>4 != ^v&0xf {
+			return 0, false
+		}
+		v &= 0xf
+	default:
+		return 0, false
+	}
+	if v >= uint64(len(keys)) {
+		return 0, false
+	}
+	return rune(keys[v]), true
+}
+
+// KeyFrame returns the 4-bit Wiegand frame a keypad sends for key.
+func KeyFrame(key rune) ([]bool, error) {
+	i := strings.IndexRune(keys, key)
+	if i < 0 {
+		return nil, fmt.Errorf("unknown key %q", key)
+	}
+	return wiegand.Bits(uint64(i), 4), nil
+}
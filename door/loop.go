@@ -0,0 +1,52 @@
+package door
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// loop manages the lifetime of a background goroutine.
+type loop struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	running int32
+}
+
+func newLoop() *loop {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &loop{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// start marks the goroutine as running and runs f in it. Marking it before
+// the goroutine is scheduled means Health never reports a loop that was just
+// started as stopped. f must call exit when it returns.
+func (l *loop) start(f func()) {
+	atomic.StoreInt32(&l.running, 1)
+	go f()
+}
+
+// exit marks the goroutine as stopped. Call when the goroutine returns.
+func (l *loop) exit() {
+	atomic.StoreInt32(&l.running, 0)
+	close(l.done)
+}
+
+// stopping is closed when the goroutine has been asked to stop.
+func (l *loop) stopping() <-chan struct{} {
+	return l.ctx.Done()
+}
+
+// stop asks the goroutine to stop and waits until it has.
+func (l *loop) stop() {
+	l.cancel()
+	<-l.done
+}
+
+func (l *loop) isRunning() bool {
+	return atomic.LoadInt32(&l.running) == 1
+}
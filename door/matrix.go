@@ -0,0 +1,144 @@
+package door
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pakohan/craftdoor/logging"
+	"periph.io/x/periph/conn/gpio"
+)
+
+const (
+	// How often a matrix keypad is scanned.
+	scanInterval = 5 * time.Millisecond
+
+	// How many scans in a row must see a key before it counts as pressed,
+	// or see no key before it counts as released.
+	debounceScans = 2
+)
+
+// MatrixKeypad is a keypad whose keys connect a row and a column wire when
+// pressed. Rows are driven low one at a time, and a pressed key pulls its
+// column low while its row is driven.
+type MatrixKeypad struct {
+	rows    []gpio.PinIO
+	columns []gpio.PinIO
+	layout  []string
+	keys    chan rune
+	loop    *loop
+	log     *logging.Logger
+}
+
+// NewMatrixKeypad returns a keypad scanning rows and columns. layout[r][c] is
+// the key connecting rows[r] and columns[c].
+//
+// Call Close to stop scanning.
+func NewMatrixKeypad(rows []gpio.PinIO, columns []gpio.PinIO, layout []string) (*MatrixKeypad, error) {
+	for _, row := range rows {
+		err := row.Out(gpio.High)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", row, err)
+		}
+	}
+	for _, column := range columns {
+		err := column.In(gpio.PullUp, gpio.NoEdge)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", column, err)
+		}
+	}
+
+	k := &MatrixKeypad{
+		rows:    rows,
+		columns: columns,
+		layout:  layout,
+		keys:    make(chan rune, 16),
+		loop:    newLoop(),
+	}
+	k.log = logging.With("keypad", k.String())
+	k.loop.start(k.scanLoop)
+	return k, nil
+}
+
+// Keys delivers pressed keys.
+func (k *MatrixKeypad) Keys() <-chan rune {
+	return k.keys
+}
+
+// Health returns an error if the scan loop has stopped.
+func (k *MatrixKeypad) Health() error {
+	if !k.loop.isRunning() {
+		return errors.New("keypad scan loop is not running")
+	}
+	return nil
+}
+
+// Close stops scanning.
+func (k *MatrixKeypad) Close() error {
+	k.loop.stop()
+	return nil
+}
+
+func (k *MatrixKeypad) String() string {
+	return fmt.Sprintf("MatrixKeypad(%dx%d)", len(k.rows), len(k.columns))
+}
+
+// scanLoop scans the keypad until Close is called, delivering each key once
+// per press.
+func (k *MatrixKeypad) scanLoop() {
+	defer k.loop.exit()
+	ticker := time.NewTicker(scanInterval)
+	defer ticker.Stop()
+
+	// The key seen by the last scans, how many scans in a row saw it, and
+	// whether it was delivered.
+	var last rune
+	seen, delivered := 0, false
+	for {
+		select {
+		case <-k.loop.stopping():
+			return
+		case <-ticker.C:
+		}
+
+		key, err := k.scan()
+		if err != nil {
+			k.log.Errorf("Failed to scan keypad: %s", err)
+			continue
+		}
+		if key != last {
+			last, seen, delivered = key, 0, false
+		}
+		seen++
+		if key == 0 || delivered || seen < debounceScans {
+			continue
+		}
+		delivered = true
+		select {
+		case k.keys <- key:
+		default:
+			k.log.Warnf("Dropping key %q, which wasn't read in time.", key)
+		}
+	}
+}
+
+// scan returns the first pressed key, or 0 if no key is pressed.
+func (k *MatrixKeypad) scan() (rune, error) {
+	pressed := rune(0)
+	for r, row := range k.rows {
+		err := row.Out(gpio.Low)
+		if err != nil {
+			return 0, err
+		}
+		for c, column := range k.columns {
+			if pressed == 0 && column.Read() == gpio.Low {
+				pressed = rune(k.layout[r][c])
+			}
+		}
+		err = row.Out(gpio.High)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return pressed, nil
+}
@@ -0,0 +1,44 @@
+package door
+
+import (
+	"fmt"
+	"time"
+)
+
+// Mode overrides a door's regular behaviour.
+type Mode string
+
+const (
+	// ModeNormal follows the door's schedule and admits all members.
+	ModeNormal Mode = "normal"
+	// ModeHeldOpen keeps the bolt unlocked, as during opening hours, until
+	// ModeState.Until.
+	ModeHeldOpen Mode = "held_open"
+	// ModeLockdown keeps the bolt locked regardless of the schedule. Only
+	// emergency staff are admitted.
+	ModeLockdown Mode = "lockdown"
+)
+
+// ParseMode validates a mode's name.
+func ParseMode(name string) (Mode, error) {
+	switch m := Mode(name); m {
+	case ModeNormal, ModeHeldOpen, ModeLockdown:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown door mode: %q", name)
+}
+
+// ModeState is a door's mode and, for ModeHeldOpen, when it ends.
+type ModeState struct {
+	Mode  Mode
+	Until time.Time
+}
+
+// At returns the mode in effect at t. A held-open door reverts to normal at
+// Until.
+func (m ModeState) At(t time.Time) Mode {
+	if m.Mode == "" || (m.Mode == ModeHeldOpen && !t.Before(m.Until)) {
+		return ModeNormal
+	}
+	return m.Mode
+}
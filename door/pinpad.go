@@ -0,0 +1,175 @@
+package door
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+)
+
+// ErrEntryTimeout is returned by PINPad.Next if no entry was completed in
+// time.
+var ErrEntryTimeout = errors.New("no entry in time")
+
+// PINPad assembles the keys pressed on a keypad into entries and locks the
+// keypad after repeated wrong PINs.
+//
+// An entry is a sequence of keys ended by '#'. A partial entry is discarded
+// when no key follows for the entry timeout. '#' on its own is an empty entry.
+type PINPad struct {
+	keypad Keypad
+	clock  clock.Clock
+
+	// Guards all fields below.
+	mu           sync.Mutex
+	entryTimeout time.Duration
+	maxAttempts  int
+	lockout      time.Duration
+
+	// Wrong PINs since the last correct one or lockout.
+	failures int
+
+	// End of the current lockout. In the past if there is none.
+	lockedUntil time.Time
+
+	// 1 while Next is waiting.
+	waiting int32
+
+	// The partial entry and when its last key was pressed. Only used by Next
+	// and Reset, which must not be called concurrently.
+	entry   []rune
+	lastKey time.Time
+}
+
+// NewPINPad returns a PINPad reading keypad whose timeouts and lockout follow
+// clk.
+func NewPINPad(keypad Keypad, cfg config.KeypadConfig, clk clock.Clock) *PINPad {
+	p := &PINPad{
+		keypad: keypad,
+		clock:  clk,
+	}
+	p.ApplyConfig(cfg)
+	return p
+}
+
+// ApplyConfig changes the entry timeout and lockout.
+func (p *PINPad) ApplyConfig(cfg config.KeypadConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entryTimeout = cfg.EntryTimeout.Duration
+	p.maxAttempts = cfg.MaxAttempts
+	p.lockout = cfg.Lockout.Duration
+}
+
+// EntryTimeout returns how long to wait for a PIN after a tag.
+func (p *PINPad) EntryTimeout() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.entryTimeout
+}
+
+// Reset discards keys pressed before the call, including a partial entry.
+func (p *PINPad) Reset() {
+	p.entry = p.entry[:0]
+	for {
+		select {
+		case <-p.keypad.Keys():
+		default:
+			return
+		}
+	}
+}
+
+// Waiting returns whether Next is waiting for an entry, e.g. to light the
+// keypad.
+func (p *PINPad) Waiting() bool {
+	return atomic.LoadInt32(&p.waiting) == 1
+}
+
+// Next returns the next entry without its '#'. Returns ErrEntryTimeout if no
+// entry was completed within timeout, or waits indefinitely if timeout is 0.
+// A partial entry is kept for the next call until it times out.
+func (p *PINPad) Next(ctx context.Context, timeout time.Duration) (string, error) {
+	atomic.StoreInt32(&p.waiting, 1)
+	defer atomic.StoreInt32(&p.waiting, 0)
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := p.clock.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C()
+	}
+	for {
+		key, err := p.nextKey(ctx, deadline)
+		if err != nil {
+			return "", err
+		}
+		if key == 0 {
+			p.entry = p.entry[:0]
+			continue
+		}
+		p.lastKey = p.clock.Now()
+		if key != '#' {
+			p.entry = append(p.entry, key)
+			continue
+		}
+		entry := string(p.entry)
+		p.entry = p.entry[:0]
+		return entry, nil
+	}
+}
+
+// nextKey waits for the next key. Returns 0 if the partial entry timed out
+// first.
+func (p *PINPad) nextKey(ctx context.Context, deadline <-chan time.Time) (rune, error) {
+	// Fires when the partial entry is discarded.
+	var discard <-chan time.Time
+	if len(p.entry) > 0 {
+		timer := p.clock.NewTimer(p.lastKey.Add(p.EntryTimeout()).Sub(p.clock.Now()))
+		defer timer.Stop()
+		discard = timer.C()
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-deadline:
+		return 0, ErrEntryTimeout
+	case <-discard:
+		return 0, nil
+	case key := <-p.keypad.Keys():
+		return key, nil
+	}
+}
+
+// LockedOut returns whether the keypad is locked, and until when.
+func (p *PINPad) LockedOut() (bool, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.clock.Now().Before(p.lockedUntil), p.lockedUntil
+}
+
+// Failed records a wrong PIN. Locks the keypad after too many in a row, and
+// returns whether it did.
+func (p *PINPad) Failed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures++
+	if p.failures < p.maxAttempts {
+		return false
+	}
+	p.failures = 0
+	p.lockedUntil = p.clock.Now().Add(p.lockout)
+	return true
+}
+
+// Succeeded records a correct PIN.
+func (p *PINPad) Succeeded() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures = 0
+}
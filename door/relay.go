@@ -0,0 +1,159 @@
+package door
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/logging"
+	"periph.io/x/periph/conn/gpio"
+)
+
+// FailMode is what a lock does when its relay is de-energized, e.g. on power
+// loss.
+type FailMode string
+
+const (
+	// FailSecure locks stay locked when de-energized, e.g. electric strikes.
+	FailSecure FailMode = "secure"
+	// FailSafe locks unlock when de-energized, e.g. magnetic locks.
+	FailSafe FailMode = "safe"
+)
+
+// ParseFailMode validates a fail mode's name.
+func ParseFailMode(name string) (FailMode, error) {
+	switch m := FailMode(name); m {
+	case FailSecure, FailSafe:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown fail mode: %q", name)
+}
+
+// Polarity is the GPIO level that energizes a relay.
+type Polarity string
+
+const (
+	// ActiveHigh relays are energized by gpio.High.
+	ActiveHigh Polarity = "active_high"
+	// ActiveLow relays are energized by gpio.Low. Most relay boards sold for
+	// the Raspberry Pi are active-low.
+	ActiveLow Polarity = "active_low"
+)
+
+// ParsePolarity validates a polarity's name.
+func ParsePolarity(name string) (Polarity, error) {
+	switch p := Polarity(name); p {
+	case ActiveHigh, ActiveLow:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown relay polarity: %q", name)
+}
+
+func init() {
+	config.RegisterValidator(func(cfg *config.Config) error {
+		for name, value := range map[string]string{
+			"door.latch_fail_mode": cfg.Door.LatchFailMode,
+			"door.bolt_fail_mode":  cfg.Door.BoltFailMode,
+		} {
+			_, err := ParseFailMode(value)
+			if err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+		}
+		for name, value := range map[string]string{
+			"door.latch_polarity":     cfg.Door.LatchPolarity,
+			"door.bolt_polarity":      cfg.Door.BoltPolarity,
+			"door.auth_fail_polarity": cfg.Door.AuthFailPolarity,
+		} {
+			_, err := ParsePolarity(value)
+			if err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// RelayInfo describes how a lock is wired.
+type RelayInfo struct {
+	Name     string   `json:"name"`
+	Pin      string   `json:"pin"`
+	FailMode FailMode `json:"fail_mode"`
+	Polarity Polarity `json:"polarity"`
+}
+
+// Relay drives a lock through a relay on a GPIO pin.
+//
+// A relay's safe state is de-energized, which leaves the lock as it would be
+// after a power loss: locked if fail-secure, unlocked if fail-safe.
+type Relay struct {
+	name     string
+	pin      gpio.PinOut
+	failMode FailMode
+	polarity Polarity
+}
+
+// NewRelay returns a new Relay and drives it to its safe state.
+func NewRelay(name string, pin gpio.PinOut, failMode FailMode, polarity Polarity) (*Relay, error) {
+	result := &Relay{
+		name:     name,
+		pin:      pin,
+		failMode: failMode,
+		polarity: polarity,
+	}
+	err := result.SafeState()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Level returns the GPIO level that locks or unlocks the lock.
+func (r *Relay) Level(locked bool) gpio.Level {
+	energized := locked == (r.failMode == FailSafe)
+	return gpio.Level(energized == (r.polarity == ActiveHigh))
+}
+
+// Set locks or unlocks the lock.
+func (r *Relay) Set(locked bool) error {
+	return r.pin.Out(r.Level(locked))
+}
+
+// SafeState de-energizes the relay.
+func (r *Relay) SafeState() error {
+	return r.Set(r.failMode == FailSecure)
+}
+
+// Info describes the relay's wiring.
+func (r *Relay) Info() RelayInfo {
+	return RelayInfo{
+		Name:     r.name,
+		Pin:      r.pin.String(),
+		FailMode: r.failMode,
+		Polarity: r.polarity,
+	}
+}
+
+// String returns the relay's name and pin.
+func (r *Relay) String() string {
+	return fmt.Sprintf("%s (%s)", r.name, r.pin)
+}
+
+// recoverToSafeState drives relays to their safe state if the calling
+// goroutine is panicking. The panic is logged and not propagated, so the
+// goroutine stops and Health reports it.
+//
+// Must be deferred directly by the goroutine's function.
+func recoverToSafeState(log *logging.Logger, relays ...*Relay) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	log.Errorf("Recovered from panic: %v\n%s", p, debug.Stack())
+	for _, relay := range relays {
+		err := relay.SafeState()
+		if err != nil {
+			log.Errorf("Failed to drive %s to safe state: %s", relay, err)
+		}
+	}
+}
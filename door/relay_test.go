@@ -0,0 +1,58 @@
+package door
+
+import (
+	"testing"
+
+	"github.com/pakohan/craftdoor/gpiosim"
+	"periph.io/x/periph/conn/gpio"
+)
+
+func TestRelayLevel(t *testing.T) {
+	tests := []struct {
+		failMode   FailMode
+		polarity   Polarity
+		wantLocked gpio.Level
+		wantSafe   gpio.Level
+	}{
+		// Fail-secure locks are energized to unlock, fail-safe locks to lock.
+		{FailSecure, ActiveHigh, gpio.Low, gpio.Low},
+		{FailSecure, ActiveLow, gpio.High, gpio.High},
+		{FailSafe, ActiveHigh, gpio.High, gpio.Low},
+		{FailSafe, ActiveLow, gpio.Low, gpio.High},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.failMode)+"/"+string(tt.polarity), func(t *testing.T) {
+			pin := gpiosim.NewPin("GPIO22", 22, nil)
+			r, err := NewRelay("latch", pin, tt.failMode, tt.polarity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pin.Read(); got != tt.wantSafe {
+				t.Errorf("NewRelay left the pin %s, want %s", got, tt.wantSafe)
+			}
+			if got := r.Level(true); got != tt.wantLocked {
+				t.Errorf("Level(true) = %s, want %s", got, tt.wantLocked)
+			}
+			if got := r.Level(false); got != !tt.wantLocked {
+				t.Errorf("Level(false) = %s, want %s", got, !tt.wantLocked)
+			}
+
+			for _, locked := range []bool{true, false} {
+				err = r.Set(locked)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := pin.Read(); got != r.Level(locked) {
+					t.Errorf("Set(%t) drove the pin %s, want %s", locked, got, r.Level(locked))
+				}
+			}
+			err = r.SafeState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pin.Read(); got != tt.wantSafe {
+				t.Errorf("SafeState drove the pin %s, want %s", got, tt.wantSafe)
+			}
+		})
+	}
+}
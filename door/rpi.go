@@ -2,249 +2,619 @@ package door
 
 import (
 	"errors"
-	"log"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/logging"
 	"periph.io/x/periph/conn/gpio"
-	"periph.io/x/periph/host/rpi"
+	"periph.io/x/periph/conn/gpio/gpioreg"
 )
 
 // RPiDoor is a door connected to a Raspberry Pi's GPIO pins.
 type RPiDoor struct {
+	id            string
+	name          string
 	authOkCh      chan struct{}
 	authOkLatch   Latch
 	authFailCh    chan struct{}
-	authFailLatch Latch
-	timeout       time.Duration
+	authFailLatch *BasicLatch
+	mainLatch     *BasicLatch
+	boltLatch     *TimedEntryLatch
+	relays        []*Relay
+	calendar      *Calendar
+	keypad        Keypad
+	pinPad        *PINPad
+	loop          *loop
+	log           *logging.Logger
+
+	// Guards timeout, which may be changed by ApplyConfig.
+	mu      sync.Mutex
+	timeout time.Duration
 }
 
 // NewRPiDoor returns a new RPiDoor instance.
-func NewRPiDoor() (*RPiDoor, error) {
-	// TODO(dukckworthd): Don't hardcode timezone.
-	timezone, _ := time.LoadLocation("Europe/Berlin")
+//
+// Must be called after periph's host.Init. calendar holds exceptions to the
+// bolt's schedule and may be nil.
+func NewRPiDoor(cfg config.DoorConfig, calendar *Calendar) (*RPiDoor, error) {
+	byName := func(name string) gpio.PinIO {
+		return gpioreg.ByName(name)
+	}
+	return newRPiDoor("RPiDoor", cfg, calendar, byName, clock.Real)
+}
 
-	// TODO(duckworthd): Don't hardcode times.
-	openFrom := time.Date(0, 0, 0, 5, 0, 0, 0, timezone)  // 5AM
-	openTill := time.Date(0, 0, 0, 23, 0, 0, 0, timezone) // 11PM
+// newRPiDoor returns a new RPiDoor whose pins are looked up with byName and
+// whose latches follow clk. byName returns nil for unknown pins.
+func newRPiDoor(name string, cfg config.DoorConfig, calendar *Calendar, byName func(string) gpio.PinIO, clk clock.Clock) (*RPiDoor, error) {
+	schedule, err := NewSchedule(cfg.Schedule, calendar)
+	if err != nil {
+		return nil, err
+	}
 
-	// TODO(duckworthd): Make pins configurable.
-	mainLatch, err := NewBasicLatch(rpi.P1_15)
+	// Relays are driven to their safe state as soon as they are set up.
+	latchRelay, err := newRelay("latch", byName(cfg.LatchPin), cfg.LatchPin, cfg.LatchFailMode, cfg.LatchPolarity)
 	if err != nil {
 		return nil, err
 	}
-	boltLatch, err := NewTimedEntryLatch(openFrom, openTill, rpi.P1_13)
+	boltRelay, err := newRelay("bolt", byName(cfg.BoltPin), cfg.BoltPin, cfg.BoltFailMode, cfg.BoltPolarity)
 	if err != nil {
 		return nil, err
 	}
-	authOkLatch, err := NewMultiLatch([]Latch{mainLatch, boltLatch})
+	// The auth failure signal is off when de-energized.
+	authFailRelay, err := newRelay("auth_fail", byName(cfg.AuthFailPin), cfg.AuthFailPin, string(FailSecure), cfg.AuthFailPolarity)
 	if err != nil {
 		return nil, err
 	}
 
-	authFailLatch, err := NewBasicLatch(rpi.P1_16)
+	mainLatch, err := NewBasicLatch(latchRelay, clk)
 	if err != nil {
 		return nil, err
 	}
+	boltLatch, err := NewTimedEntryLatch(schedule, boltRelay, clk)
+	if err != nil {
+		return nil, closeAfter(err, mainLatch)
+	}
+	authOkLatch, err := NewMultiLatch([]Latch{mainLatch, boltLatch})
+	if err != nil {
+		return nil, closeAfter(err, mainLatch, boltLatch)
+	}
+
+	authFailLatch, err := NewBasicLatch(authFailRelay, clk)
+	if err != nil {
+		return nil, closeAfter(err, authOkLatch)
+	}
+
+	keypad, err := newKeypad(cfg.Keypad, byName)
+	if err != nil {
+		return nil, closeAfter(err, authOkLatch, authFailLatch)
+	}
 
 	result := &RPiDoor{
+		id:            cfg.ID,
+		name:          name,
 		authOkCh:      make(chan struct{}),
 		authOkLatch:   authOkLatch,
 		authFailCh:    make(chan struct{}),
 		authFailLatch: authFailLatch,
-		// TODO(duckworthd): Make timeout configurable.
-		timeout: 3 * time.Second,
+		mainLatch:     mainLatch,
+		boltLatch:     boltLatch,
+		relays:        []*Relay{latchRelay, boltRelay, authFailRelay},
+		calendar:      calendar,
+		keypad:        keypad,
+		timeout:       cfg.UnlockDuration.Duration,
+		loop:          newLoop(),
+		log:           logging.With("door", name),
 	}
-	go result.DoorLoop()
+	if keypad != nil {
+		result.pinPad = NewPINPad(keypad, cfg.Keypad, clk)
+	}
+	result.loop.start(result.DoorLoop)
 	return result, nil
 }
 
-// AuthOK enqueues a successful authentication message.
+// newRelay returns a Relay driving pin, which was looked up by pinName, e.g.
+// "GPIO22". pin is nil if the lookup failed.
+func newRelay(name string, pin gpio.PinOut, pinName, failMode, polarity string) (*Relay, error) {
+	if pin == nil {
+		return nil, fmt.Errorf("unknown GPIO pin: %q", pinName)
+	}
+	m, err := ParseFailMode(failMode)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParsePolarity(polarity)
+	if err != nil {
+		return nil, err
+	}
+	return NewRelay(name, pin, m, p)
+}
+
+// ApplyConfig changes the unlock duration, schedule and keypad timeouts.
+func (r *RPiDoor) ApplyConfig(cfg *config.Config) error {
+	schedule, err := NewSchedule(cfg.Door.Schedule, r.calendar)
+	if err != nil {
+		return err
+	}
+	err = r.boltLatch.SetSchedule(schedule)
+	if err != nil {
+		return err
+	}
+
+	if r.pinPad != nil {
+		r.pinPad.ApplyConfig(cfg.Door.Keypad)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeout = cfg.Door.UnlockDuration.Duration
+	r.log.Infof("Applied config. Unlock duration: %s.", r.timeout)
+	return nil
+}
+
+func (r *RPiDoor) unlockDuration() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.timeout
+}
+
+// AuthOK unlocks the latch and bolt. If they are already unlocked, the
+// unlock is extended.
 func (r *RPiDoor) AuthOK() error {
 	message := struct{}{}
 	select {
 	case r.authOkCh <- message:
-		log.Println("Enqueued AuthOK message.")
-	default:
-		log.Println("Failed to enqueue AuthOK message.")
+		r.log.Debugf("Enqueued AuthOK message.")
+		return nil
+	case <-r.loop.stopping():
+		return fmt.Errorf("%s is closed", r.name)
 	}
-	return nil
 }
 
-// AuthFail enqueues a faild authentication message.
+// AuthFail signals a failed authentication.
 func (r *RPiDoor) AuthFail() error {
 	message := struct{}{}
 	select {
 	case r.authFailCh <- message:
-		log.Println("Enqueued AuthFail message.")
-	default:
-		log.Println("Failed to enqueue AuthOK message.")
+		r.log.Debugf("Enqueued AuthFail message.")
+		return nil
+	case <-r.loop.stopping():
+		return fmt.Errorf("%s is closed", r.name)
+	}
+}
+
+// KeyholderIn starts the bolt's current opening window under a first-in
+// policy.
+func (r *RPiDoor) KeyholderIn() error {
+	return r.boltLatch.KeyholderIn()
+}
+
+// SetMode changes the bolt's mode.
+func (r *RPiDoor) SetMode(mode ModeState) error {
+	return r.boltLatch.SetMode(mode)
+}
+
+// PINPad returns the door's keypad, or nil if it has none.
+func (r *RPiDoor) PINPad() *PINPad {
+	return r.pinPad
+}
+
+// ID returns the door's ID.
+func (r *RPiDoor) ID() string {
+	return r.id
+}
+
+// Relays describes how the door's locks are wired.
+func (r *RPiDoor) Relays() []RelayInfo {
+	result := []RelayInfo{}
+	for _, relay := range r.relays {
+		result = append(result, relay.Info())
+	}
+	return result
+}
+
+// Latches returns the current state of the latch, bolt and auth failure
+// signal.
+func (r *RPiDoor) Latches() []LatchState {
+	return []LatchState{
+		r.mainLatch.State(),
+		r.boltLatch.State(),
+		r.authFailLatch.State(),
 	}
-	return nil
 }
 
 // String returns a string representation of a RPiDoor.
 func (r *RPiDoor) String() string {
-	return "RPiDoor"
+	return r.name
 }
 
-// DoorLoop is an infinite loop monitoring door access.
+// Health returns an error if the door loop, any of its latches or its keypad
+// has stopped.
+func (r *RPiDoor) Health() error {
+	if !r.loop.isRunning() {
+		return errors.New("DoorLoop is not running")
+	}
+	err := r.authOkLatch.Health()
+	if err != nil {
+		return err
+	}
+	err = r.authFailLatch.Health()
+	if err != nil || r.keypad == nil {
+		return err
+	}
+	return r.keypad.Health()
+}
+
+// Close stops DoorLoop and the keypad, and drives all relays to their safe
+// state (unlocked for fail-safe, locked for fail-secure).
+func (r *RPiDoor) Close() error {
+	r.loop.stop()
+	err := closeAfter(nil, r.authOkLatch, r.authFailLatch)
+	if r.keypad != nil {
+		e := r.keypad.Close()
+		if e != nil {
+			logging.Errorf("failed closing keypad: %s", e.Error())
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// DoorLoop is a loop monitoring door access. Runs until Close is called.
 func (r *RPiDoor) DoorLoop() {
+	defer r.loop.exit()
+	defer recoverToSafeState(r.log, r.relays...)
+
 	for {
 		select {
+		case <-r.loop.stopping():
+			r.log.Infof("Stopping RPiDoor.DoorLoop().")
+			return
 		case <-r.authOkCh:
-			log.Println("AuthOK message received.")
-			r.authOkLatch.Unlock(r.timeout)
+			r.log.Debugf("AuthOK message received.")
+			err := r.authOkLatch.Unlock(r.unlockDuration())
+			if err != nil {
+				r.log.Errorf("Failed to unlock: %s", err)
+			}
 		case <-r.authFailCh:
-			log.Println("AuthFail message received.")
-			r.authFailLatch.Unlock(r.timeout)
+			r.log.Debugf("AuthFail message received.")
+			err := r.authFailLatch.Unlock(r.unlockDuration())
+			if err != nil {
+				r.log.Errorf("Failed to signal auth failure: %s", err)
+			}
+		}
+	}
+}
+
+// LatchState is a snapshot of a latch.
+type LatchState struct {
+	// Name of the latch's relay, e.g. "bolt".
+	Name string `json:"name"`
+
+	// Whether the latch is currently locked.
+	Locked bool `json:"locked"`
+
+	// End of the current unlock by a tag, if any.
+	UnlockedUntil *time.Time `json:"unlocked_until"`
+
+	// Next scheduled change of the latch's baseline, if it follows a
+	// schedule.
+	NextTransition *time.Time `json:"next_transition,omitempty"`
+}
+
+// latchState is the part of a latch's state shared by all implementations.
+//
+// Only the latch's loop modifies it. The latest snapshot may be read
+// concurrently.
+type latchState struct {
+	relay *Relay
+	clock clock.Clock
+	log   *logging.Logger
+
+	// End of the current unlock by a tag. In the past if there is none.
+	unlockedUntil time.Time
+
+	// Guards snapshot.
+	mu       sync.Mutex
+	snapshot LatchState
+}
+
+// extend unlocks the latch until at least now+duration. Unlocks never
+// shorten an earlier unlock.
+func (s *latchState) extend(now time.Time, duration time.Duration) {
+	until := now.Add(duration)
+	if until.After(s.unlockedUntil) {
+		s.unlockedUntil = until
+	}
+}
+
+// apply drives the relay and records a snapshot. baselineLocked is the
+// latch's state when not unlocked by a tag, and transition is when
+// baselineLocked changes next, or the zero time if it never does. Returns when
+// the latch needs to be re-evaluated, or the zero time if it doesn't.
+func (s *latchState) apply(now time.Time, baselineLocked bool, transition time.Time) time.Time {
+	unlocked := now.Before(s.unlockedUntil)
+	locked := baselineLocked && !unlocked
+
+	snapshot := LatchState{
+		Name:   s.relay.name,
+		Locked: locked,
+	}
+	next := transition
+	if !transition.IsZero() {
+		snapshot.NextTransition = &transition
+	}
+	if unlocked {
+		until := s.unlockedUntil
+		snapshot.UnlockedUntil = &until
+		if next.IsZero() || until.Before(next) {
+			next = until
 		}
 	}
+
+	s.mu.Lock()
+	changed := locked != s.snapshot.Locked
+	s.snapshot = snapshot
+	s.mu.Unlock()
+
+	if changed {
+		s.log.Infof("Setting locked to: %t.", locked)
+	}
+	err := s.relay.Set(locked)
+	if err != nil {
+		s.log.Errorf("Failed to drive relay: %s", err)
+	}
+	return next
+}
+
+// State returns the latest snapshot.
+func (s *latchState) State() LatchState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot
 }
 
 // BasicLatch is a latch that opens when asked.
 type BasicLatch struct {
-	pin      gpio.PinOut
+	*latchState
 	unlockCh chan time.Duration
+	loop     *loop
 }
 
-// NewBasicLatch creates a new basic latch.
-func NewBasicLatch(pin gpio.PinOut) (*BasicLatch, error) {
+// NewBasicLatch creates a new basic latch whose unlocks are timed by clk.
+func NewBasicLatch(relay *Relay, clk clock.Clock) (*BasicLatch, error) {
 	result := &BasicLatch{
-		pin:      pin,
+		latchState: &latchState{
+			relay:    relay,
+			clock:    clk,
+			log:      logging.With("latch", relay.String()),
+			snapshot: LatchState{Name: relay.name, Locked: true},
+		},
 		unlockCh: make(chan time.Duration),
+		loop:     newLoop(),
 	}
-	go result.LatchLoop()
+	result.loop.start(result.LatchLoop)
 	return result, nil
 }
 
-// Unlock unlocks this latch for a limited time.
+// Unlock unlocks this latch for duration. If the latch is already unlocked,
+// the unlock is extended.
 func (r *BasicLatch) Unlock(duration time.Duration) error {
-	select {
-	case r.unlockCh <- duration:
-		log.Printf("Enqueuing Unlock duration: %s", duration)
-	default:
-		log.Println("Failed to enqueue Unlock duration.")
+	return sendUnlock(r.loop, r.unlockCh, duration)
+}
+
+// Health returns an error if LatchLoop is not running.
+func (r *BasicLatch) Health() error {
+	if !r.loop.isRunning() {
+		return fmt.Errorf("BasicLatch.LatchLoop of %s is not running", r.relay)
 	}
 	return nil
 }
 
-// LatchLoop is an infinite loop monitoring the latch.
+// Close stops LatchLoop and drives the relay to its safe state (unlocked for
+// fail-safe, locked for fail-secure).
+func (r *BasicLatch) Close() error {
+	r.loop.stop()
+	return r.relay.SafeState()
+}
+
+// LatchLoop is a loop monitoring the latch. Runs until Close is called.
 func (r *BasicLatch) LatchLoop() {
-	log.Println("Starting BasicLatch.LatchLoop().")
-	r.pin.Out(gpio.High)
+	r.log.Infof("Starting BasicLatch.LatchLoop().")
+	defer r.loop.exit()
+	defer recoverToSafeState(r.log, r.relay)
 
+	timer := r.clock.NewTimer(0)
+	defer timer.Stop()
 	for {
-		duration := <-r.unlockCh
-		log.Printf("Unlock event received. Holding latch open for: %s", duration)
-		r.pin.Out(gpio.Low)
-		time.Sleep(duration)
-		r.pin.Out(gpio.High)
+		select {
+		case <-r.loop.stopping():
+			r.log.Infof("Stopping BasicLatch.LatchLoop().")
+			return
+		case duration := <-r.unlockCh:
+			r.log.Infof("Unlock event received. Holding latch open for: %s", duration)
+			r.extend(r.clock.Now(), duration)
+		case <-timer.C():
+		}
+
+		now := r.clock.Now()
+		next := r.apply(now, true, time.Time{})
+		resetTimer(timer, r.clock, next)
 	}
 }
 
-// TimedEntryLatch is a latch that remains unlocked between two periods of time.
+// TimedEntryLatch is a latch that remains unlocked during a schedule's opening windows.
 type TimedEntryLatch struct {
-	// TODO(duckworthd): Use a custom TimeOfDay type that ignores date.
-	openFrom time.Time
-	openTill time.Time
-	pin      gpio.PinOut
-	unlockCh chan time.Duration
+	*latchState
+	schedule   *Schedule
+	unlockCh   chan time.Duration
+	scheduleCh chan *Schedule
+	mode       ModeState
+	modeCh     chan ModeState
+
+	// Start of the opening interval in which a keyholder last arrived.
+	firstInAt   time.Time
+	keyholderCh chan struct{}
+
+	calendarCh <-chan struct{}
+	loop       *loop
 }
 
-// NewTimedEntryLatch returns a new TimedEntryLatch.
-func NewTimedEntryLatch(openFrom time.Time, openTill time.Time, pin gpio.PinOut) (*TimedEntryLatch, error) {
-	// TODO(duckworthd): This test will do the wrong thing if openFrom and openTill are on
-	// different dates. Fix it.
-	if !openFrom.Before(openTill) {
-		return nil, errors.New("openFrom < openTill required")
+// NewTimedEntryLatch returns a new TimedEntryLatch whose schedule and unlocks
+// are timed by clk.
+func NewTimedEntryLatch(schedule *Schedule, relay *Relay, clk clock.Clock) (*TimedEntryLatch, error) {
+	if schedule == nil {
+		return nil, errors.New("schedule required")
 	}
 	result := &TimedEntryLatch{
-		openFrom: openFrom,
-		openTill: openTill,
-		pin:      pin,
-		unlockCh: make(chan time.Duration),
+		latchState: &latchState{
+			relay:    relay,
+			clock:    clk,
+			log:      logging.With("latch", relay.String()),
+			snapshot: LatchState{Name: relay.name, Locked: true},
+		},
+		schedule:   schedule,
+		unlockCh:   make(chan time.Duration),
+		scheduleCh: make(chan *Schedule),
+		modeCh:     make(chan ModeState),
+		// Arrivals are coalesced, so a single pending message suffices.
+		keyholderCh: make(chan struct{}, 1),
+		calendarCh:  schedule.Calendar.Subscribe(),
+		loop:        newLoop(),
 	}
-	go result.LatchLoop()
+	result.loop.start(result.LatchLoop)
 	return result, nil
 }
 
-// Unlock unlocks this latch for a limited time.
-func (r *TimedEntryLatch) Unlock(duration time.Duration) error {
+// SetSchedule replaces the latch's schedule.
+//
+// The latch's level and timer are updated immediately. The new schedule must
+// use the same Calendar as the old one.
+func (r *TimedEntryLatch) SetSchedule(schedule *Schedule) error {
+	if schedule == nil {
+		return errors.New("schedule required")
+	}
 	select {
-	case r.unlockCh <- duration:
-		log.Printf("Enqueuing Unlock duration: %s", duration)
+	case r.scheduleCh <- schedule:
+		return nil
+	case <-r.loop.stopping():
+		return errors.New("TimedEntryLatch is closed")
+	}
+}
+
+// SetMode overrides the latch's schedule. Held-open keeps the latch unlocked
+// and lockdown keeps it locked.
+//
+// The latch's level and timer are updated immediately.
+func (r *TimedEntryLatch) SetMode(mode ModeState) error {
+	select {
+	case r.modeCh <- mode:
+		return nil
+	case <-r.loop.stopping():
+		return errors.New("TimedEntryLatch is closed")
+	}
+}
+
+// KeyholderIn records a keyholder's arrival. If the schedule has a first-in
+// policy, the latch unlocks until the end of the current opening window.
+func (r *TimedEntryLatch) KeyholderIn() error {
+	select {
+	case r.keyholderCh <- struct{}{}:
 	default:
-		log.Println("Failed to enqueue Unlock duration.")
+		// An arrival is already pending.
+	}
+	return nil
+}
+
+// Unlock unlocks this latch for duration. If the latch is already unlocked,
+// the unlock is extended. Scheduled transitions still take effect while
+// unlocked.
+func (r *TimedEntryLatch) Unlock(duration time.Duration) error {
+	return sendUnlock(r.loop, r.unlockCh, duration)
+}
+
+// Health returns an error if LatchLoop is not running.
+func (r *TimedEntryLatch) Health() error {
+	if !r.loop.isRunning() {
+		return fmt.Errorf("TimedEntryLatch.LatchLoop of %s is not running", r.relay)
 	}
 	return nil
 }
 
-// LatchLoop is an infinite loop monitoring the latch.
+// Close stops LatchLoop and drives the relay to its safe state (unlocked for
+// fail-safe, locked for fail-secure).
+func (r *TimedEntryLatch) Close() error {
+	r.loop.stop()
+	return r.relay.SafeState()
+}
+
+// LatchLoop is a loop monitoring the latch. Runs until Close is called.
+//
+// Every event updates the latch's state and re-arms a single timer for the
+// next unlock expiry or schedule transition, whichever comes first.
 func (r *TimedEntryLatch) LatchLoop() {
-	log.Println("Starting TimedEntryLatch.LatchLoop().")
-	r.pin.Out(r.BaselineLevel(time.Now()))
-	timer := time.NewTimer(1 * time.Nanosecond)
+	r.log.Infof("Starting TimedEntryLatch.LatchLoop().")
+	defer r.loop.exit()
+	defer recoverToSafeState(r.log, r.relay)
 
+	timer := r.clock.NewTimer(0)
+	defer timer.Stop()
 	for {
 		select {
-		case <-timer.C:
-			log.Println("Timer fired. Setting latch to baseline level.")
-			now := time.Now()
-			level := r.BaselineLevel(now)
-			log.Printf("Current time is now %s. Setting level to: %s.", now, level)
-			r.pin.Out(level)
-			next := r.NextTimedEntryEvent(now)
-			log.Printf("Resetting timer. Next timer event: %s.", next)
-			timer = time.NewTimer(next.Sub(now))
+		case <-r.loop.stopping():
+			r.log.Infof("Stopping TimedEntryLatch.LatchLoop().")
+			return
+		case schedule := <-r.scheduleCh:
+			r.schedule = schedule
+			r.log.Infof("Schedule changed.")
+		case mode := <-r.modeCh:
+			r.mode = mode
+			r.log.Infof("Mode changed to %s.", mode.Mode)
+		case <-r.keyholderCh:
+			start, open := r.schedule.OpenSince(r.clock.Now())
+			if r.schedule.FirstIn && open && !start.Equal(r.firstInAt) {
+				r.log.Infof("Keyholder arrived. Starting opening window of %s.", start)
+				r.firstInAt = start
+			}
+		case <-r.calendarCh:
+			r.log.Infof("Calendar changed.")
 		case duration := <-r.unlockCh:
-			log.Printf("Unlock event received. Holding latch open for: %s", duration)
-			r.pin.Out(gpio.Low)
-			time.Sleep(duration)
-			r.pin.Out(r.BaselineLevel(time.Now()))
+			r.log.Infof("Unlock event received. Holding latch open for: %s", duration)
+			r.extend(r.clock.Now(), duration)
+		case <-timer.C():
+			r.log.Debugf("Timer fired.")
 		}
 
+		now := r.clock.Now()
+		next := r.apply(now, r.BaselineLocked(now), r.NextTimedEntryEvent(now))
+		r.log.Debugf("Next timer event: %s.", next)
+		resetTimer(timer, r.clock, next)
 	}
 }
 
-// BaselineLevel returns the default GPIO level right now.
-func (r *TimedEntryLatch) BaselineLevel(t time.Time) gpio.Level {
-	// TODO(duckworthd): Figure how to reduce complexity around timezones.
-	t = t.In(r.openFrom.Location())
-	s := r.openFrom
-	openFrom := time.Date(t.Year(), t.Month(), t.Day(), s.Hour(), s.Minute(), s.Second(), s.Nanosecond(), t.Location())
-
-	t = t.In(r.openTill.Location())
-	e := r.openTill
-	openTill := time.Date(t.Year(), t.Month(), t.Day(), e.Hour(), e.Minute(), e.Second(), e.Nanosecond(), t.Location())
-
-	if openFrom.Before(t) && t.Before(openTill) {
-		return gpio.Low
+// BaselineLocked returns whether the latch is locked at time t when not
+// unlocked by a tag.
+func (r *TimedEntryLatch) BaselineLocked(t time.Time) bool {
+	switch r.mode.At(t) {
+	case ModeLockdown:
+		return true
+	case ModeHeldOpen:
+		return false
 	}
-	return gpio.High
+	start, open := r.schedule.OpenSince(t)
+	return !open || (r.schedule.FirstIn && !start.Equal(r.firstInAt))
 }
 
-// NextTimedEntryEvent returns the time of the next timed entry event.
+// NextTimedEntryEvent returns the time of the next timed entry event after t.
 func (r *TimedEntryLatch) NextTimedEntryEvent(t time.Time) time.Time {
-	// TODO(duckworthd): Figure how to reduce complexity around timezones.
-	t = t.In(r.openFrom.Location())
-	s := r.openFrom
-	var openFrom time.Time = time.Date(t.Year(), t.Month(), t.Day(), s.Hour(), s.Minute(), s.Second(), s.Nanosecond(), t.Location())
-	for openFrom.Before(t) {
-		openFrom = openFrom.Add(24 * time.Hour)
+	if r.mode.At(t) == ModeHeldOpen {
+		return r.mode.Until
 	}
-
-	t = t.In(r.openTill.Location())
-	e := r.openTill
-	openTill := time.Date(t.Year(), t.Month(), t.Day(), e.Hour(), e.Minute(), e.Second(), e.Nanosecond(), t.Location())
-	for openTill.Before(t) {
-		openTill = openTill.Add(24 * time.Hour)
-	}
-
-	// Return the first of the two events.
-	if openFrom.Before(openTill) {
-		return openFrom
-	}
-	return openTill
+	return r.schedule.NextTransition(t)
 }
 
 // A MultiLatch represents multiple latches.
@@ -260,9 +630,25 @@ func NewMultiLatch(latches []Latch) (*MultiLatch, error) {
 	return result, nil
 }
 
+// Health returns the first error reported by any latch.
+func (l *MultiLatch) Health() error {
+	for _, latch := range l.latches {
+		err := latch.Health()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all latches.
+func (l *MultiLatch) Close() error {
+	return closeAfter(nil, l.latches...)
+}
+
 // Unlock unlocks all latches.
 func (l *MultiLatch) Unlock(duration time.Duration) error {
-	log.Printf("Enqueuing Unlock in all %d latches. Duration: %s", len(l.latches), duration)
+	logging.Debugf("Enqueuing Unlock in all %d latches. Duration: %s", len(l.latches), duration)
 	for _, latch := range l.latches {
 		err := latch.Unlock(duration)
 		if err != nil {
@@ -271,3 +657,44 @@ func (l *MultiLatch) Unlock(duration time.Duration) error {
 	}
 	return nil
 }
+
+// sendUnlock passes an unlock duration to a latch's loop.
+func sendUnlock(l *loop, unlockCh chan<- time.Duration, duration time.Duration) error {
+	select {
+	case unlockCh <- duration:
+		return nil
+	case <-l.stopping():
+		return errors.New("latch is closed")
+	}
+}
+
+// resetTimer re-arms timer to fire at next, discarding a pending expiry. If
+// next is the zero time, the timer is left stopped. The delay is measured
+// from clk's current time rather than from when next was computed, so that
+// the timer fires at next even if the clock moved in between.
+func resetTimer(timer clock.Timer, clk clock.Clock, next time.Time) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C():
+		default:
+		}
+	}
+	if !next.IsZero() {
+		timer.Reset(next.Sub(clk.Now()))
+	}
+}
+
+// closeAfter closes all latches and returns err, or the first error
+// encountered while closing if err is nil.
+func closeAfter(err error, latches ...Latch) error {
+	for _, latch := range latches {
+		e := latch.Close()
+		if e != nil {
+			logging.Errorf("failed closing latch: %s", e.Error())
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package door
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/gpiosim"
+)
+
+var latchStart = time.Date(2026, time.January, 5, 12, 0, 0, 0, time.UTC)
+
+// expectUnlockedUntil waits for l to be unlocked until until, or locked if
+// until is the zero time.
+func expectUnlockedUntil(t *testing.T, l *BasicLatch, until time.Time) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s := l.State()
+		if until.IsZero() && s.Locked && s.UnlockedUntil == nil {
+			return
+		}
+		if !until.IsZero() && !s.Locked && s.UnlockedUntil != nil && s.UnlockedUntil.Equal(until) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("latch is %+v at %s, want unlocked until %s", s, l.clock.Now(), until)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestBasicLatchExtendsUnlock checks that unlocking an unlocked latch extends
+// the unlock instead of being dropped.
+func TestBasicLatchExtendsUnlock(t *testing.T) {
+	clk := clock.NewFake(latchStart)
+	relay, err := NewRelay("latch", gpiosim.NewPin("GPIO22", 22, nil), FailSecure, ActiveLow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewBasicLatch(relay, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	err = l.Unlock(3 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectUnlockedUntil(t, l, latchStart.Add(3*time.Second))
+
+	clk.Advance(2 * time.Second)
+	err = l.Unlock(3 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectUnlockedUntil(t, l, latchStart.Add(5*time.Second))
+
+	// The first unlock would have ended here.
+	clk.Advance(1500 * time.Millisecond)
+	expectUnlockedUntil(t, l, latchStart.Add(5*time.Second))
+
+	clk.Advance(1500 * time.Millisecond)
+	expectUnlockedUntil(t, l, time.Time{})
+	if got := relay.pin.(*gpiosim.Pin).Read(); got != relay.Level(true) {
+		t.Errorf("relay pin is %s after the unlock ended, want %s", got, relay.Level(true))
+	}
+}
+
+// TestLatchStateExtend checks that unlocks extend, and never shorten, earlier
+// unlocks.
+func TestLatchStateExtend(t *testing.T) {
+	s := &latchState{}
+	s.extend(latchStart, 3*time.Second)
+	s.extend(latchStart.Add(2*time.Second), 3*time.Second)
+	if want := latchStart.Add(5 * time.Second); !s.unlockedUntil.Equal(want) {
+		t.Errorf("unlocked until %s after a second unlock, want %s", s.unlockedUntil, want)
+	}
+	s.extend(latchStart.Add(3*time.Second), time.Second)
+	if want := latchStart.Add(5 * time.Second); !s.unlockedUntil.Equal(want) {
+		t.Errorf("unlocked until %s after a shorter unlock, want %s", s.unlockedUntil, want)
+	}
+}
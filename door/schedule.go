@@ -0,0 +1,309 @@
+package door
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pakohan/craftdoor/config"
+)
+
+func init() {
+	config.RegisterValidator(func(cfg *config.Config) error {
+		_, err := NewSchedule(cfg.Door.Schedule, nil)
+		if err != nil {
+			return fmt.Errorf("door.schedule: %s", err)
+		}
+		return nil
+	})
+}
+
+// TimeOfDay is a wall-clock time without a date, e.g. 05:00.
+type TimeOfDay struct {
+	Hour   int
+	Minute int
+}
+
+// ParseTimeOfDay parses a time of day formatted as "15:04". "24:00" denotes
+// the end of the day.
+func ParseTimeOfDay(value string) (TimeOfDay, error) {
+	if value == "24:00" {
+		return TimeOfDay{Hour: 24}, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return TimeOfDay{}, fmt.Errorf("invalid time of day %q: expected HH:MM", value)
+	}
+	return TimeOfDay{Hour: t.Hour(), Minute: t.Minute()}, nil
+}
+
+// String formats a TimeOfDay as "15:04".
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t.Hour, t.Minute)
+}
+
+// On returns the instant this time of day occurs on the given date.
+//
+// Wall-clock times that don't exist because of a DST change are normalized by
+// time.Date, e.g. 02:30 on the day clocks skip from 02:00 to 03:00 becomes
+// 03:30.
+func (t TimeOfDay) On(date Date, location *time.Location) time.Time {
+	return time.Date(date.Year, date.Month, date.Day, t.Hour, t.Minute, 0, 0, location)
+}
+
+func (t TimeOfDay) minutes() int {
+	return 60*t.Hour + t.Minute
+}
+
+// Date is a calendar date without a time of day.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// ParseDate parses a date formatted as "2006-01-02".
+func ParseDate(value string) (Date, error) {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q: expected YYYY-MM-DD", value)
+	}
+	return DateOf(t), nil
+}
+
+// DateOf returns the date of t in t's location.
+func DateOf(t time.Time) Date {
+	year, month, day := t.Date()
+	return Date{Year: year, Month: month, Day: day}
+}
+
+// AddDays returns the date n days after d.
+func (d Date) AddDays(n int) Date {
+	return DateOf(time.Date(d.Year, d.Month, d.Day+n, 12, 0, 0, 0, time.UTC))
+}
+
+// Weekday returns the day of the week of d.
+func (d Date) Weekday() time.Weekday {
+	return time.Date(d.Year, d.Month, d.Day, 12, 0, 0, 0, time.UTC).Weekday()
+}
+
+// On returns midnight at the start of d.
+func (d Date) On(location *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, location)
+}
+
+// String formats a Date as "2006-01-02".
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// Window is a period of the day during which a door is open.
+//
+// If Till is not after From, the window spans midnight and ends on the
+// following day, e.g. 22:00-02:00.
+type Window struct {
+	From TimeOfDay
+	Till TimeOfDay
+}
+
+// ParseWindow parses a window formatted as "05:00-23:00".
+func ParseWindow(value string) (Window, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return Window{}, fmt.Errorf("invalid window %q: expected HH:MM-HH:MM", value)
+	}
+	from, err := ParseTimeOfDay(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return Window{}, err
+	}
+	till, err := ParseTimeOfDay(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return Window{}, err
+	}
+	if from.Hour == 24 {
+		return Window{}, fmt.Errorf("invalid window %q: can't start at 24:00", value)
+	}
+	return Window{From: from, Till: till}, nil
+}
+
+// String formats a Window as "05:00-23:00".
+func (w Window) String() string {
+	return fmt.Sprintf("%s-%s", w.From, w.Till)
+}
+
+// On returns the instants the window opens and closes when it starts on date.
+func (w Window) On(date Date, location *time.Location) (time.Time, time.Time) {
+	start := w.From.On(date, location)
+	endDate := date
+	if w.Till.minutes() <= w.From.minutes() {
+		endDate = date.AddDays(1)
+	}
+	return start, w.Till.On(endDate, location)
+}
+
+// interval is a half-open period of time [start, end).
+type interval struct {
+	start time.Time
+	end   time.Time
+}
+
+// Schedule is a weekly schedule of opening windows with holiday closures.
+//
+// All times of day are interpreted in Location, so transitions follow DST
+// changes. A window belongs to the day it starts on: on a holiday, no windows
+// start, but a window that started the evening before still ends as usual.
+//
+// If Calendar is set, its exceptions override the weekly windows on their
+// dates.
+//
+// If FirstIn is set, the schedule's owner only treats an opening interval as
+// open once a keyholder has arrived. The Schedule itself doesn't track
+// arrivals.
+type Schedule struct {
+	Location *time.Location
+	Weekly   map[time.Weekday][]Window
+	Holidays map[Date]bool
+	Calendar *Calendar
+	FirstIn  bool
+}
+
+// NewSchedule builds a Schedule from its configuration.
+//
+// calendar may be nil.
+func NewSchedule(cfg config.ScheduleConfig, calendar *Calendar) (*Schedule, error) {
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Schedule{
+		Location: location,
+		Weekly:   map[time.Weekday][]Window{},
+		Holidays: map[Date]bool{},
+		Calendar: calendar,
+		FirstIn:  cfg.FirstIn,
+	}
+
+	defaultWindows, err := parseWindows(cfg.Default)
+	if err != nil {
+		return nil, fmt.Errorf("default: %s", err)
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		result.Weekly[day] = defaultWindows
+	}
+
+	for name, values := range cfg.Weekly {
+		day, err := parseWeekday(name)
+		if err != nil {
+			return nil, fmt.Errorf("weekly: %s", err)
+		}
+		windows, err := parseWindows(values)
+		if err != nil {
+			return nil, fmt.Errorf("weekly.%s: %s", name, err)
+		}
+		result.Weekly[day] = windows
+	}
+
+	for _, value := range cfg.Holidays {
+		date, err := ParseDate(value)
+		if err != nil {
+			return nil, fmt.Errorf("holidays: %s", err)
+		}
+		result.Holidays[date] = true
+	}
+	return result, nil
+}
+
+func parseWindows(values []string) ([]Window, error) {
+	result := []Window{}
+	for _, value := range values {
+		w, err := ParseWindow(value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, w)
+	}
+	return result, nil
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), name) {
+			return day, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("unknown weekday: %q", name)
+}
+
+// IsOpen returns true if t falls within an opening window.
+func (s *Schedule) IsOpen(t time.Time) bool {
+	_, open := s.OpenSince(t)
+	return open
+}
+
+// OpenSince returns the start of the opening interval containing t, and
+// false if t isn't within an opening window. Overlapping and adjacent windows
+// form a single interval.
+func (s *Schedule) OpenSince(t time.Time) (time.Time, bool) {
+	for _, i := range s.intervals(t) {
+		if !t.Before(i.start) && t.Before(i.end) {
+			return i.start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// NextTransition returns the first instant after t at which IsOpen changes.
+//
+// If IsOpen doesn't change within the next week, returns midnight a week from
+// now so that callers re-check the schedule.
+func (s *Schedule) NextTransition(t time.Time) time.Time {
+	for _, i := range s.intervals(t) {
+		if i.start.After(t) {
+			return i.start
+		}
+		if i.end.After(t) {
+			return i.end
+		}
+	}
+	return DateOf(t.In(s.Location)).AddDays(7).On(s.Location)
+}
+
+// intervals returns the merged opening intervals for windows starting between
+// the day before t and a week after t, sorted by start time.
+func (s *Schedule) intervals(t time.Time) []interval {
+	today := DateOf(t.In(s.Location))
+	all := []interval{}
+	for offset := -1; offset <= 7; offset++ {
+		date := today.AddDays(offset)
+		if s.Holidays[date] {
+			continue
+		}
+		for _, w := range s.Calendar.windows(date, s.Weekly[date.Weekday()]) {
+			start, end := w.On(date, s.Location)
+			if start.Before(end) {
+				all = append(all, interval{start: start, end: end})
+			}
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].start.Before(all[j].start)
+	})
+
+	// Merge overlapping and adjacent intervals so that every boundary is a
+	// transition.
+	merged := []interval{}
+	for _, i := range all {
+		n := len(merged)
+		if n > 0 && !i.start.After(merged[n-1].end) {
+			if i.end.After(merged[n-1].end) {
+				merged[n-1].end = i.end
+			}
+			continue
+		}
+		merged = append(merged, i)
+	}
+	return merged
+}
@@ -0,0 +1,191 @@
+package door
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// yearSchedule is open 09:00-18:00 on weekdays and 10:00-14:00 on Saturdays,
+// closed on Sundays and on two holidays. Christmas Eve has custom hours and
+// one Friday is extended into the night.
+func yearSchedule(t *testing.T) (config.ScheduleConfig, *Calendar) {
+	t.Helper()
+	cfg := config.ScheduleConfig{
+		Timezone: "Europe/Berlin",
+		Default:  []string{"09:00-18:00"},
+		Weekly: map[string][]string{
+			"saturday": {"10:00-14:00"},
+			"sunday":   {},
+		},
+		Holidays: []string{"2026-01-01", "2026-12-25"},
+	}
+	cal := NewCalendar(mustLoadLocation(t, cfg.Timezone))
+	eve, err := ParseException("2026-12-24", string(Custom), []string{"10:00-12:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	party, err := ParseException("2026-06-19", string(Extended), []string{"20:00-02:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal.Set([]Exception{eve, party})
+	return cfg, cal
+}
+
+// expectedTransitions lists the instants the year schedule opens or closes in
+// 2026, built day by day independently of Schedule.
+func expectedTransitions(loc *time.Location) []time.Time {
+	at := func(d time.Time, days int, hour int) time.Time {
+		return time.Date(d.Year(), d.Month(), d.Day()+days, hour, 0, 0, 0, loc)
+	}
+	result := []time.Time{}
+	for d := time.Date(2026, time.January, 1, 0, 0, 0, 0, loc); d.Year() == 2026; d = d.AddDate(0, 0, 1) {
+		switch {
+		case d.Month() == time.January && d.Day() == 1, d.Month() == time.December && d.Day() == 25:
+		case d.Month() == time.December && d.Day() == 24:
+			result = append(result, at(d, 0, 10), at(d, 0, 12))
+		case d.Month() == time.June && d.Day() == 19:
+			result = append(result, at(d, 0, 9), at(d, 0, 18), at(d, 0, 20), at(d, 1, 2))
+		case d.Weekday() == time.Sunday:
+		case d.Weekday() == time.Saturday:
+			result = append(result, at(d, 0, 10), at(d, 0, 14))
+		default:
+			result = append(result, at(d, 0, 9), at(d, 0, 18))
+		}
+	}
+	return result
+}
+
+func TestScheduleYear(t *testing.T) {
+	cfg, cal := yearSchedule(t)
+	s, err := NewSchedule(cfg, cal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := expectedTransitions(s.Location)
+
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, s.Location)
+	for i, w := range want {
+		next := s.NextTransition(now)
+		if !next.Equal(w) {
+			t.Fatalf("transition %d after %s is at %s, want %s", i, now, next, w)
+		}
+		if open := i%2 == 0; s.IsOpen(next) != open {
+			t.Fatalf("IsOpen(%s) = %t, want %t", next, !open, open)
+		}
+		now = next
+	}
+}
+
+func TestScheduleDST(t *testing.T) {
+	s, err := NewSchedule(config.ScheduleConfig{
+		Timezone: "Europe/Berlin",
+		Default:  []string{"01:00-04:00"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		date string
+		want time.Duration
+	}{
+		{"2026-03-28", 3 * time.Hour},
+		// Clocks skip from 02:00 to 03:00.
+		{"2026-03-29", 2 * time.Hour},
+		{"2026-03-30", 3 * time.Hour},
+		// Clocks go back from 03:00 to 02:00.
+		{"2026-10-25", 4 * time.Hour},
+		{"2026-10-26", 3 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			date, err := ParseDate(tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opens := s.NextTransition(date.On(s.Location))
+			if got := opens.In(s.Location).Format("15:04"); got != "01:00" {
+				t.Errorf("opens at %s, want 01:00", got)
+			}
+			closes := s.NextTransition(opens)
+			if got := closes.In(s.Location).Format("15:04"); got != "04:00" {
+				t.Errorf("closes at %s, want 04:00", got)
+			}
+			if got := closes.Sub(opens); got != tt.want {
+				t.Errorf("open for %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// 02:30 happens twice on 2026-10-25, both times within the window.
+	first := time.Date(2026, time.October, 25, 0, 30, 0, 0, time.UTC)
+	for _, at := range []time.Time{first, first.Add(time.Hour)} {
+		if at.In(s.Location).Format("15:04") != "02:30" || !s.IsOpen(at) {
+			t.Errorf("IsOpen(%s) = false, want true", at.In(s.Location))
+		}
+	}
+}
+
+// TestBoltFollowsScheduleForAYear drives a simulated door's bolt through
+// every transition of a year with a fake clock.
+func TestBoltFollowsScheduleForAYear(t *testing.T) {
+	sched, cal := yearSchedule(t)
+	cfg := config.Default().Door
+	cfg.Schedule = sched
+	want := expectedTransitions(cal.Location)
+
+	clk := clock.NewFake(time.Date(2026, time.January, 1, 0, 0, 0, 0, cal.Location))
+	d, _, err := NewSimulatedDoor(cfg, cal, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := d.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	err = waitForBolt(d, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range want {
+		clk.Set(w)
+		err = waitForBolt(d, i%2 != 0)
+		if err != nil {
+			t.Fatalf("transition %d at %s: %s", i, w, err)
+		}
+	}
+}
+
+// waitForBolt waits for the bolt's latch, which reacts to the clock
+// asynchronously, to be locked or unlocked.
+func waitForBolt(d *RPiDoor, locked bool) error {
+	deadline := time.Now().Add(time.Second)
+	for {
+		for _, latch := range d.Latches() {
+			if latch.Name == "bolt" && latch.Locked == locked {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("bolt isn't locked=%t", locked)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
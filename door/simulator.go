@@ -0,0 +1,261 @@
+package door
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/gpiosim"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/wiegand"
+	"periph.io/x/periph/conn/gpio"
+)
+
+// SensorPin is the name of the simulated door sensor's pin.
+const SensorPin = "door_sensor"
+
+// ErrLocked is returned when opening a simulated door that is locked.
+var ErrLocked = errors.New("door is locked")
+
+// Simulator is the physical side of a door whose relays are wired to
+// simulated GPIO pins. It tracks whether the door is open and reports it on a
+// door sensor, a reed switch pulling SensorPin low while the door is closed.
+type Simulator struct {
+	timeline *gpiosim.Timeline
+	pins     []*gpiosim.Pin
+	sensor   *gpiosim.Pin
+
+	// Relays that hold the door shut while locked.
+	locks []*Relay
+
+	// Serializes Open and Close.
+	mu sync.Mutex
+
+	// The simulated keypad, see PressKeys. Its pins aren't recorded in the
+	// timeline.
+	keypad     config.KeypadConfig
+	keypadPins map[string]*gpiosim.Pin
+
+	// Serializes PressKeys.
+	keysMu sync.Mutex
+
+	// Guards pressed.
+	pressedMu sync.Mutex
+
+	// Row and column of the matrix key being held. Nil if none is.
+	pressed *[2]int
+}
+
+// Pause between keys sent by PressKeys. Longer than a matrix keypad's debounce
+// interval.
+const keyInterval = 50 * time.Millisecond
+
+// NewSimulatedDoor returns an RPiDoor driving simulated GPIO pins named after
+// cfg's pins, and the Simulator controlling them. The door's latches follow
+// clk, e.g. clock.Real.
+func NewSimulatedDoor(cfg config.DoorConfig, calendar *Calendar, clk clock.Clock) (*RPiDoor, *Simulator, error) {
+	sim := &Simulator{
+		timeline: gpiosim.NewTimeline(),
+	}
+	pins := map[string]*gpiosim.Pin{}
+	for _, name := range []string{cfg.LatchPin, cfg.BoltPin, cfg.AuthFailPin, SensorPin} {
+		if pins[name] != nil {
+			return nil, nil, fmt.Errorf("pin %s is used twice", name)
+		}
+		pin := gpiosim.NewPin(name, -1, sim.timeline)
+		pins[name] = pin
+		sim.pins = append(sim.pins, pin)
+	}
+
+	err := sim.addKeypad(cfg.Keypad, pins)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sim.sensor = pins[SensorPin]
+	err = sim.sensor.In(gpio.PullNoChange, gpio.BothEdges)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = sim.sensor.Set(gpio.Low)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byName := func(name string) gpio.PinIO {
+		pin, ok := pins[name]
+		if !ok || name == SensorPin {
+			return nil
+		}
+		return pin
+	}
+	d, err := newRPiDoor("SimulatedDoor", cfg, calendar, byName, clk)
+	if err != nil {
+		return nil, nil, err
+	}
+	sim.locks = []*Relay{d.mainLatch.relay, d.boltLatch.relay}
+	return d, sim, nil
+}
+
+// addKeypad adds the pins of the keypad selected by cfg to pins. A matrix
+// keypad's columns follow its rows while a key is pressed.
+func (s *Simulator) addKeypad(cfg config.KeypadConfig, pins map[string]*gpiosim.Pin) error {
+	s.keypad = cfg
+	s.keypadPins = map[string]*gpiosim.Pin{}
+	names := []string{}
+	switch cfg.Type {
+	case "matrix":
+		names = append(append(names, cfg.RowPins...), cfg.ColumnPins...)
+	case "wiegand":
+		names = append(names, cfg.D0Pin, cfg.D1Pin)
+	}
+	for _, name := range names {
+		if pins[name] != nil {
+			return fmt.Errorf("pin %s is used twice", name)
+		}
+		pin := gpiosim.NewPin(name, -1, nil)
+		pins[name] = pin
+		s.keypadPins[name] = pin
+	}
+
+	if cfg.Type != "matrix" {
+		return nil
+	}
+	for r, name := range cfg.RowPins {
+		r := r
+		pins[name].OnChange(func(l gpio.Level) {
+			s.pressedMu.Lock()
+			defer s.pressedMu.Unlock()
+			if s.pressed == nil || s.pressed[0] != r {
+				return
+			}
+			err := s.column(s.pressed[1]).Set(l)
+			if err != nil {
+				logging.Errorf("failed driving keypad column: %s", err)
+			}
+		})
+	}
+	return nil
+}
+
+func (s *Simulator) column(c int) *gpiosim.Pin {
+	return s.keypadPins[s.keypad.ColumnPins[c]]
+}
+
+// PressKeys presses keys one after the other on the door's keypad and returns
+// once the last key was sent.
+func (s *Simulator) PressKeys(keys string) error {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	for _, key := range keys {
+		var err error
+		switch s.keypad.Type {
+		case "matrix":
+			err = s.pressMatrixKey(key)
+		case "wiegand":
+			var frame []bool
+			frame, err = KeyFrame(key)
+			if err == nil {
+				err = wiegand.Transmit(s.keypadPins[s.keypad.D0Pin], s.keypadPins[s.keypad.D1Pin], frame)
+			}
+		default:
+			return errors.New("door has no keypad")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pressMatrixKey holds key down, then releases it.
+func (s *Simulator) pressMatrixKey(key rune) error {
+	for r, row := range s.keypad.Layout {
+		for c, k := range row {
+			if k != key {
+				continue
+			}
+			s.pressedMu.Lock()
+			s.pressed = &[2]int{r, c}
+			s.pressedMu.Unlock()
+			time.Sleep(keyInterval)
+
+			s.pressedMu.Lock()
+			s.pressed = nil
+			err := s.column(c).Set(gpio.High)
+			s.pressedMu.Unlock()
+			if err != nil {
+				return err
+			}
+			time.Sleep(keyInterval)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key %q", key)
+}
+
+// Timeline returns the recorded levels of all simulated pins.
+func (s *Simulator) Timeline() *gpiosim.Timeline {
+	return s.timeline
+}
+
+// Sensor returns the door sensor's pin.
+func (s *Simulator) Sensor() gpio.PinIn {
+	return s.sensor
+}
+
+// Open opens the door, or returns ErrLocked if any of its locks is locked.
+func (s *Simulator) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, relay := range s.locks {
+		if relay.pin.(gpio.PinIn).Read() == relay.Level(true) {
+			return fmt.Errorf("%w by %s", ErrLocked, relay)
+		}
+	}
+	return s.sensor.Set(gpio.High)
+}
+
+// Close closes the door.
+func (s *Simulator) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sensor.Set(gpio.Low)
+}
+
+// IsOpen returns true if the door sensor reports the door as open.
+func (s *Simulator) IsOpen() bool {
+	return s.sensor.Read() == gpio.High
+}
+
+// PinState is the current level of a simulated pin.
+type PinState struct {
+	Pin      string `json:"pin"`
+	Function string `json:"function"`
+	Level    string `json:"level"`
+}
+
+// SimulatorState is a snapshot of a simulated door.
+type SimulatorState struct {
+	Open bool       `json:"open"`
+	Pins []PinState `json:"pins"`
+}
+
+// State returns the door's sensor reading and the levels of all pins.
+func (s *Simulator) State() SimulatorState {
+	result := SimulatorState{
+		Open: s.IsOpen(),
+		Pins: []PinState{},
+	}
+	for _, pin := range s.pins {
+		result.Pins = append(result.Pins, PinState{
+			Pin:      pin.Name(),
+			Function: pin.Function(),
+			Level:    pin.Read().String(),
+		})
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package door
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/logging"
+	"periph.io/x/periph/conn/gpio"
+)
+
+// expectOpen waits until opening sim succeeds if want is true, or fails with
+// ErrLocked otherwise. The door is closed again before returning.
+func expectOpen(t *testing.T, sim *Simulator, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := sim.Open()
+		if want && err == nil {
+			err = sim.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+		if !want && errors.Is(err, ErrLocked) {
+			return
+		}
+		if err != nil && !errors.Is(err, ErrLocked) {
+			t.Fatal(err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Open returned %v, want the door to open: %t", err, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestSimulatedDoorAuthOK checks that AuthOK drives the latch's and bolt's
+// pins to unlock the door outside opening hours, and that they lock again
+// once the unlock duration passed.
+func TestSimulatedDoorAuthOK(t *testing.T) {
+	logging.SetLevel(logging.ErrorLevel)
+	cfg := config.Default().Door
+	// Outside the default opening hours, so the bolt is locked.
+	clk := clock.NewFake(time.Date(2026, time.January, 5, 1, 0, 0, 0, time.UTC))
+	d, sim, err := NewSimulatedDoor(cfg, NewCalendar(time.UTC), clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	expectOpen(t, sim, false)
+	err = d.AuthOK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOpen(t, sim, true)
+
+	clk.Advance(cfg.UnlockDuration.Duration)
+	expectOpen(t, sim, false)
+
+	// The latch pin was driven to unlock, then to lock again.
+	latch := d.mainLatch.relay
+	levels := []gpio.Level{}
+	for _, e := range sim.Timeline().Events() {
+		if e.Pin == cfg.LatchPin {
+			levels = append(levels, e.Level)
+		}
+	}
+	if len(levels) < 2 || levels[len(levels)-2] != latch.Level(false) || levels[len(levels)-1] != latch.Level(true) {
+		t.Errorf("latch pin levels are %v, want to end with %s, %s", levels, latch.Level(false), latch.Level(true))
+	}
+}
@@ -0,0 +1,237 @@
+// Package gpiosim simulates GPIO pins in memory, so that code driving relays
+// and reading sensors can run without a Raspberry Pi.
+package gpiosim
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/physic"
+	"periph.io/x/periph/conn/pin"
+)
+
+// Pin is an in-memory gpio.PinIO. Its first level and every change, whether
+// driven by Out or by Set while the pin is an input, are recorded in the
+// pin's Timeline.
+type Pin struct {
+	name     string
+	number   int
+	timeline *Timeline
+
+	// Guards all fields below.
+	mu     sync.Mutex
+	output bool
+	level  gpio.Level
+	pull   gpio.Pull
+	edge   gpio.Edge
+
+	// Whether the timeline has a level for this pin yet.
+	recorded bool
+
+	// Called after each change, see OnChange.
+	watchers []func(gpio.Level)
+
+	// Holds a value if an edge occurred since the last WaitForEdge.
+	edges chan struct{}
+}
+
+// NewPin returns a new input Pin reading gpio.Low. number may be -1 if the pin
+// has no logical number.
+func NewPin(name string, number int, timeline *Timeline) *Pin {
+	return &Pin{
+		name:     name,
+		number:   number,
+		timeline: timeline,
+		pull:     gpio.Float,
+		edges:    make(chan struct{}, 1),
+	}
+}
+
+// String returns the pin's name.
+func (p *Pin) String() string {
+	return p.name
+}
+
+// Name returns the pin's name.
+func (p *Pin) Name() string {
+	return p.name
+}
+
+// Number returns the pin's logical number.
+func (p *Pin) Number() int {
+	return p.number
+}
+
+// Function returns "In" or "Out".
+func (p *Pin) Function() string {
+	return string(p.Func())
+}
+
+// Func returns gpio.IN or gpio.OUT.
+func (p *Pin) Func() pin.Func {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.output {
+		return gpio.OUT
+	}
+	return gpio.IN
+}
+
+// SupportedFuncs returns gpio.IN and gpio.OUT.
+func (p *Pin) SupportedFuncs() []pin.Func {
+	return []pin.Func{gpio.IN, gpio.OUT}
+}
+
+// SetFunc makes the pin an input or output.
+func (p *Pin) SetFunc(f pin.Func) error {
+	switch f {
+	case gpio.IN:
+		return p.In(gpio.PullNoChange, gpio.NoEdge)
+	case gpio.OUT:
+		return p.Out(p.Read())
+	}
+	return errors.New("gpiosim: unsupported function " + string(f))
+}
+
+// Halt does nothing.
+func (p *Pin) Halt() error {
+	return nil
+}
+
+// In makes the pin an input. A pull-up or pull-down resistor sets the level
+// until Set is called.
+func (p *Pin) In(pull gpio.Pull, edge gpio.Edge) error {
+	p.mu.Lock()
+	p.output = false
+	p.edge = edge
+	if pull != gpio.PullNoChange {
+		p.pull = pull
+	}
+	level, pulled := p.level, false
+	switch pull {
+	case gpio.PullUp:
+		level, pulled = gpio.High, true
+	case gpio.PullDown:
+		level, pulled = gpio.Low, true
+	}
+	p.mu.Unlock()
+
+	// Discard edges from before the call.
+	select {
+	case <-p.edges:
+	default:
+	}
+	if pulled {
+		p.change(level)
+	}
+	return nil
+}
+
+// Read returns the pin's level.
+func (p *Pin) Read() gpio.Level {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.level
+}
+
+// WaitForEdge waits for an edge selected by In. A negative timeout waits
+// forever.
+func (p *Pin) WaitForEdge(timeout time.Duration) bool {
+	if timeout < 0 {
+		<-p.edges
+		return true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-p.edges:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Pull returns the pull resistor set by In.
+func (p *Pin) Pull() gpio.Pull {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pull
+}
+
+// DefaultPull returns gpio.Float.
+func (p *Pin) DefaultPull() gpio.Pull {
+	return gpio.Float
+}
+
+// Out makes the pin an output driving l.
+func (p *Pin) Out(l gpio.Level) error {
+	p.mu.Lock()
+	p.output = true
+	p.mu.Unlock()
+	p.change(l)
+	return nil
+}
+
+// PWM is not supported.
+func (p *Pin) PWM(duty gpio.Duty, f physic.Frequency) error {
+	return errors.New("gpiosim: PWM is not supported")
+}
+
+// Set drives an input pin to l from outside, like a sensor. Returns an error
+// if the pin is an output.
+func (p *Pin) Set(l gpio.Level) error {
+	p.mu.Lock()
+	output := p.output
+	p.mu.Unlock()
+	if output {
+		return errors.New("gpiosim: can't set output pin " + p.name)
+	}
+	p.change(l)
+	return nil
+}
+
+// OnChange calls f with the pin's new level after each change, e.g. to wire
+// an output to another pin's input. f is called synchronously by whoever
+// changed the level, so it must not block.
+func (p *Pin) OnChange(f func(gpio.Level)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.watchers = append(p.watchers, f)
+}
+
+// change sets the pin's level, records it if it changed, notifies watchers
+// and signals the edge if it is one the pin waits for.
+func (p *Pin) change(l gpio.Level) {
+	p.mu.Lock()
+	changed := p.level != l || !p.recorded
+	p.level = l
+	p.recorded = true
+	edge := p.edge
+	output := p.output
+	watchers := p.watchers
+	p.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if p.timeline != nil {
+		p.timeline.record(p.name, l)
+	}
+	for _, f := range watchers {
+		f(l)
+	}
+	if output {
+		return
+	}
+	if edge == gpio.BothEdges || (edge == gpio.RisingEdge && l == gpio.High) || (edge == gpio.FallingEdge && l == gpio.Low) {
+		select {
+		case p.edges <- struct{}{}:
+		default:
+		}
+	}
+}
+
+var _ gpio.PinIO = &Pin{}
+var _ pin.PinFunc = &Pin{}
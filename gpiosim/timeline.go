@@ -0,0 +1,74 @@
+package gpiosim
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// maxEvents is the number of events a Timeline retains. Older events are
+// dropped.
+const maxEvents = 10000
+
+// Event is a change of a pin's level.
+type Event struct {
+	Time  time.Time
+	Pin   string
+	Level gpio.Level
+}
+
+// MarshalJSON encodes an Event with its level as "High" or "Low".
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time  time.Time `json:"time"`
+		Pin   string    `json:"pin"`
+		Level string    `json:"level"`
+	}{e.Time, e.Pin, e.Level.String()})
+}
+
+// Timeline records the levels of a set of pins over time.
+type Timeline struct {
+	// Guards events.
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewTimeline returns an empty Timeline.
+func NewTimeline() *Timeline {
+	return &Timeline{}
+}
+
+func (t *Timeline) record(pin string, level gpio.Level) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.events) >= maxEvents {
+		t.events = append(t.events[:0], t.events[len(t.events)-maxEvents+1:]...)
+	}
+	t.events = append(t.events, Event{Time: time.Now(), Pin: pin, Level: level})
+}
+
+// Events returns all recorded events in the order they occurred.
+func (t *Timeline) Events() []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Event(nil), t.events...)
+}
+
+// LevelAt returns the level of pin at time at, and false if the pin had no
+// recorded level then.
+func (t *Timeline) LevelAt(pin string, at time.Time) (gpio.Level, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	level, ok := gpio.Low, false
+	for _, e := range t.events {
+		if e.Time.After(at) {
+			break
+		}
+		if e.Pin == pin {
+			level, ok = e.Level, true
+		}
+	}
+	return level, ok
+}
@@ -2,11 +2,11 @@ package lib
 
 import (
 	"io/ioutil"
-	"log"
 	"os"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/logging"
 )
 
 // OpenDB opens the database.
@@ -17,10 +17,13 @@ func OpenDB(cfg *config.Config) (*sqlx.DB, error) {
 	}
 
 	err = InitDBSchema(db, cfg.SQLiteSchemaFile)
+	if err == nil {
+		err = MigrateDBSchema(db)
+	}
 	if err != nil {
 		e := db.Close()
 		if e != nil {
-			log.Printf("err closing db after initializing schema failed: %s", e.Error())
+			logging.Errorf("err closing db after initializing schema failed: %s", e.Error())
 		}
 		return nil, err
 	}
@@ -40,7 +43,7 @@ func InitDBSchema(db *sqlx.DB, schemaFile string) error {
 		return nil
 	}
 
-	log.Printf("didn't find any tables, will init db schema")
+	logging.Infof("didn't find any tables, will init db schema")
 
 	f, err := os.Open(schemaFile)
 	if err != nil {
@@ -49,7 +52,7 @@ func InitDBSchema(db *sqlx.DB, schemaFile string) error {
 	defer func() {
 		e := f.Close()
 		if e != nil {
-			log.Printf("failed closing schema file: %s", e.Error())
+			logging.Errorf("failed closing schema file: %s", e.Error())
 		}
 	}()
 
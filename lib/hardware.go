@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/rfid"
+	"periph.io/x/periph/conn/gpio/gpioreg"
+)
+
+// NewReader returns the reader selected by cfg.Type. If the reader is
+// simulated, it is also returned as sim.
+func NewReader(cfg config.ReaderConfig, onPi bool) (r rfid.Reader, sim *rfid.SimulatedReader, err error) {
+	typ := cfg.Type
+	if typ == "auto" {
+		typ = "simulated"
+		if onPi {
+			typ = "mfrc522"
+		}
+	}
+
+	switch typ {
+	case "mfrc522":
+		logging.Infof("Initializing rpi reader.")
+		r, err = rfid.NewMFRC522Reader()
+		return r, nil, err
+	case "pn532":
+		logging.Infof("Initializing PN532 reader.")
+		return rfid.NewPN532Reader(rfid.OpenPN532(cfg.PN532)), nil, nil
+	case "wiegand":
+		logging.Infof("Initializing Wiegand reader.")
+		d0 := gpioreg.ByName(cfg.Wiegand.D0Pin)
+		if d0 == nil {
+			return nil, nil, fmt.Errorf("unknown GPIO pin: %q", cfg.Wiegand.D0Pin)
+		}
+		d1 := gpioreg.ByName(cfg.Wiegand.D1Pin)
+		if d1 == nil {
+			return nil, nil, fmt.Errorf("unknown GPIO pin: %q", cfg.Wiegand.D1Pin)
+		}
+		r, err = rfid.NewWiegandReader(cfg.Wiegand, d0, d1, clock.Real)
+		return r, nil, err
+	case "evdev":
+		logging.Infof("Initializing keyboard wedge.")
+		return rfid.NewEvdevReader(cfg.Evdev, rfid.OpenEvdev(cfg.Evdev), clock.Real), nil, nil
+	case "serial":
+		logging.Infof("Initializing serial reader.")
+		return rfid.NewSerialReader(cfg.Serial, rfid.OpenSerial(cfg.Serial), clock.Real), nil, nil
+	case "simulated":
+		logging.Infof("Initializing simulated reader.")
+		sim, err = rfid.NewSimulatedReader(cfg.Simulated, clock.Real)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sim, sim, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown reader %q", typ)
+	}
+}
+
+// NewDoor returns the door selected by cfg.Type. If the door is simulated,
+// its Simulator is also returned.
+func NewDoor(cfg config.DoorConfig, cal *door.Calendar, onPi bool) (d *door.RPiDoor, sim *door.Simulator, err error) {
+	typ := cfg.Type
+	if typ == "auto" {
+		typ = "simulated"
+		if onPi {
+			typ = "rpi"
+		}
+	}
+
+	switch typ {
+	case "rpi":
+		logging.Infof("Initializing rpi door.")
+		d, err = door.NewRPiDoor(cfg, cal)
+		return d, nil, err
+	case "simulated":
+		logging.Infof("Initializing simulated door.")
+		return door.NewSimulatedDoor(cfg, cal, clock.Real)
+	default:
+		return nil, nil, fmt.Errorf("unknown door %q", typ)
+	}
+}
@@ -0,0 +1,178 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ICalEvent is a VEVENT read from an iCalendar (RFC 5545) file.
+type ICalEvent struct {
+	// Unique identifier of the event.
+	UID string
+
+	// Short description of the event.
+	Summary string
+
+	// Values of the CATEGORIES property.
+	Categories []string
+
+	// Extension properties (X-*), keyed by upper case name.
+	Extensions map[string]string
+
+	// Start and end of the event. End is exclusive.
+	Start, End time.Time
+
+	// If true, Start and End are dates without a time of day.
+	AllDay bool
+
+	// If true, the event has RRULE or RDATE properties, which are not
+	// expanded.
+	Recurring bool
+}
+
+// ParseICal reads all VEVENTs from an iCalendar file.
+//
+// Only the properties in ICalEvent are interpreted. Times without a TZID or
+// UTC designator are interpreted in loc. An event without DTEND lasts one day
+// if it is all-day and is instantaneous otherwise. DURATION is not supported.
+func ParseICal(r io.Reader, loc *time.Location) ([]ICalEvent, error) {
+	lines, err := unfoldICalLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []ICalEvent{}
+	var event *ICalEvent
+	for i, line := range lines {
+		name, params, value, err := parseICalLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = &ICalEvent{Extensions: map[string]string{}}
+		case name == "END" && value == "VEVENT":
+			if event == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN:VEVENT", i+1)
+			}
+			if event.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: VEVENT %q has no DTSTART", i+1, event.UID)
+			}
+			if event.End.IsZero() {
+				event.End = event.Start
+				if event.AllDay {
+					event.End = event.Start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, *event)
+			event = nil
+		case event == nil:
+			// Property of the calendar or of another component.
+		case name == "UID":
+			event.UID = value
+		case name == "SUMMARY":
+			event.Summary = unescapeICalText(value)
+		case name == "CATEGORIES":
+			for _, c := range strings.Split(value, ",") {
+				event.Categories = append(event.Categories, unescapeICalText(c))
+			}
+		case name == "DTSTART" || name == "DTEND":
+			t, allDay, err := parseICalTime(params, value, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %s", i+1, name, err)
+			}
+			if name == "DTSTART" {
+				event.Start, event.AllDay = t, allDay
+			} else {
+				event.End = t
+			}
+		case name == "RRULE" || name == "RDATE":
+			event.Recurring = true
+		case strings.HasPrefix(name, "X-"):
+			event.Extensions[name] = unescapeICalText(value)
+		}
+	}
+	if event != nil {
+		return nil, fmt.Errorf("VEVENT %q is not terminated", event.UID)
+	}
+	return events, nil
+}
+
+// unfoldICalLines splits r into content lines, joining folded lines.
+func unfoldICalLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseICalLine splits a content line such as
+// "DTSTART;TZID=Europe/Berlin:20261224T100000" into its parts.
+func parseICalLine(line string) (string, map[string]string, string, error) {
+	// The value starts at the first colon outside a quoted parameter value.
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", fmt.Errorf("missing ':' in %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	params := map[string]string{}
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 {
+			return "", nil, "", fmt.Errorf("invalid parameter %q", p)
+		}
+		params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:], nil
+}
+
+// parseICalTime parses a DATE or DATE-TIME value.
+func parseICalTime(params map[string]string, value string, loc *time.Location) (time.Time, bool, error) {
+	if tzid, ok := params["TZID"]; ok {
+		var err error
+		loc, err = time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+	}
+
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// unescapeICalText decodes backslash escapes in TEXT values.
+func unescapeICalText(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, `;`, `\,`, `,`, `\n`, "\n", `\N`, "\n").Replace(s)
+}
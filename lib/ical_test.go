@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testICal = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//craftdoor//test//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:christmas@example.com\r\n" +
+	"SUMMARY:Christmas\\, closed\r\n" +
+	"CATEGORIES:HOLIDAY,CLOSED\r\n" +
+	"DTSTART;VALUE=DATE:20261225\r\n" +
+	"DTEND;VALUE=DATE:20261227\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:eve@example.com\r\n" +
+	"SUMMARY:Christmas Eve opening with a summary that is folded over two\r\n" +
+	"  lines\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20261224T100000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20261224T120000\r\n" +
+	"X-CRAFTDOOR-KIND:custom\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:utc@example.com\r\n" +
+	"DTSTART:20260329T003000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:weekly@example.com\r\n" +
+	"DTSTART:20260105T180000\r\n" +
+	"DTEND:20260105T200000\r\n" +
+	"RRULE:FREQ=WEEKLY\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICal(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := ParseICal(strings.NewReader(testICal), berlin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ICalEvent{
+		{
+			UID:        "christmas@example.com",
+			Summary:    "Christmas, closed",
+			Categories: []string{"HOLIDAY", "CLOSED"},
+			Extensions: map[string]string{},
+			Start:      time.Date(2026, time.December, 25, 0, 0, 0, 0, berlin),
+			End:        time.Date(2026, time.December, 27, 0, 0, 0, 0, berlin),
+			AllDay:     true,
+		},
+		{
+			UID:        "eve@example.com",
+			Summary:    "Christmas Eve opening with a summary that is folded over two lines",
+			Extensions: map[string]string{"X-CRAFTDOOR-KIND": "custom"},
+			Start:      time.Date(2026, time.December, 24, 10, 0, 0, 0, berlin),
+			End:        time.Date(2026, time.December, 24, 12, 0, 0, 0, berlin),
+		},
+		{
+			UID:        "utc@example.com",
+			Extensions: map[string]string{},
+			Start:      time.Date(2026, time.March, 29, 0, 30, 0, 0, time.UTC),
+			End:        time.Date(2026, time.March, 29, 0, 30, 0, 0, time.UTC),
+		},
+		{
+			UID:        "weekly@example.com",
+			Extensions: map[string]string{},
+			Start:      time.Date(2026, time.January, 5, 18, 0, 0, 0, berlin),
+			End:        time.Date(2026, time.January, 5, 20, 0, 0, 0, berlin),
+			Recurring:  true,
+		},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i := range want {
+		got := events[i]
+		if !got.Start.Equal(want[i].Start) || !got.End.Equal(want[i].End) {
+			t.Errorf("event %d lasts %s-%s, want %s-%s", i, got.Start, got.End, want[i].Start, want[i].End)
+		}
+		got.Start, got.End = want[i].Start, want[i].End
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("event %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestParseICalAllDayWithoutEnd(t *testing.T) {
+	events, err := ParseICal(strings.NewReader("BEGIN:VEVENT\nUID:a\nDTSTART;VALUE=DATE:20260101\nEND:VEVENT\n"), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].End.Sub(events[0].Start) != 24*time.Hour {
+		t.Errorf("got %+v, want one all-day event lasting a day", events)
+	}
+}
+
+func TestParseICalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ical string
+	}{
+		{"missing colon", "BEGIN:VEVENT\nUID a\nEND:VEVENT\n"},
+		{"no DTSTART", "BEGIN:VEVENT\nUID:a\nEND:VEVENT\n"},
+		{"unterminated", "BEGIN:VEVENT\nUID:a\nDTSTART:20260101T100000\n"},
+		{"END without BEGIN", "END:VEVENT\n"},
+		{"invalid time", "BEGIN:VEVENT\nUID:a\nDTSTART:2026-01-01\nEND:VEVENT\n"},
+		{"unknown TZID", "BEGIN:VEVENT\nUID:a\nDTSTART;TZID=Mars/Olympus:20260101T100000\nEND:VEVENT\n"},
+		{"invalid parameter", "BEGIN:VEVENT\nUID:a\nDTSTART;VALUE:20260101\nEND:VEVENT\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseICal(strings.NewReader(tt.ical), time.UTC)
+			if err == nil {
+				t.Error("ParseICal() succeeded, want error")
+			}
+		})
+	}
+}
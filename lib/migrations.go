@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pakohan/craftdoor/logging"
+)
+
+// migrations upgrade databases created by older versions of schema.sql.
+//
+// migrations[i] upgrades a database from version i to version i+1, where the
+// version is stored in SQLite's user_version pragma. schema.sql always
+// creates the latest version, so when adding a migration, apply the same
+// change to schema.sql and bump the user_version it sets.
+var migrations = []string{
+	// Version 1: holiday and special-opening calendar.
+	`
+CREATE TABLE "main"."calendar" (
+  "id"         INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
+  "date"       TEXT NOT NULL,
+  "kind"       TEXT NOT NULL,
+  "windows"    TEXT NOT NULL DEFAULT '',
+  "summary"    TEXT NOT NULL DEFAULT '',
+  "uid"        TEXT UNIQUE
+);`,
+
+	// Version 2: door modes and emergency staff.
+	`
+CREATE TABLE "main"."door_mode" (
+  "door_id"    TEXT NOT NULL PRIMARY KEY,
+  "mode"       TEXT NOT NULL,
+  "until"      DATETIME
+);
+ALTER TABLE "main"."member" ADD COLUMN "emergency_staff" BOOLEAN NOT NULL DEFAULT 0;`,
+
+	// Version 3: keyholders for first-in opening.
+	`
+ALTER TABLE "main"."member" ADD COLUMN "keyholder" BOOLEAN NOT NULL DEFAULT 0;`,
+
+	// Version 4: access log.
+	`
+CREATE TABLE "main"."access_log" (
+  "id"         INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT UNIQUE,
+  "time"       DATETIME NOT NULL,
+  "door_id"    TEXT NOT NULL,
+  "node_id"    TEXT NOT NULL DEFAULT '',
+  "key_uuid"   TEXT NOT NULL,
+  "granted"    BOOLEAN NOT NULL,
+  "offline"    BOOLEAN NOT NULL DEFAULT 0
+);
+CREATE INDEX "access_log_time" ON "access_log" ("time");`,
+
+	// Version 5: PINs and the reasons of access decisions.
+	`
+ALTER TABLE "main"."member" ADD COLUMN "pin_hash" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "main"."access_log" ADD COLUMN "member_id" INTEGER;
+ALTER TABLE "main"."access_log" ADD COLUMN "reason" TEXT NOT NULL DEFAULT '';`,
+
+	// Version 6: card types of keys.
+	`
+ALTER TABLE "main"."key" ADD COLUMN "card_type" TEXT NOT NULL DEFAULT 'unknown';`,
+
+	// Version 7: UUIDs of keys as credential IDs, see rfid.CredentialID.
+	// Keys whose normalized UUID is taken by another key keep theirs.
+	`
+UPDATE OR IGNORE "main"."key"
+SET "uuid" = lower(replace(replace(replace(trim("uuid"), ':', ''), '-', ''), ' ', ''));
+UPDATE OR IGNORE "main"."key"
+SET "uuid" = substr("uuid", 3)
+WHERE "uuid" LIKE '0x%';
+UPDATE "main"."access_log"
+SET "key_uuid" = lower(replace(replace(replace(trim("key_uuid"), ':', ''), '-', ''), ' ', ''));
+UPDATE "main"."access_log"
+SET "key_uuid" = substr("key_uuid", 3)
+WHERE "key_uuid" LIKE '0x%';`,
+}
+
+// MigrateDBSchema applies all migrations newer than the database's version.
+func MigrateDBSchema(db *sqlx.DB) error {
+	var version int
+	err := db.Get(&version, "PRAGMA user_version")
+	if err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		logging.Infof("migrating db schema from version %d to %d", version, version+1)
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(migrations[version])
+		if err == nil {
+			// PRAGMA doesn't support placeholders.
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+		}
+		if err != nil {
+			e := tx.Rollback()
+			if e != nil {
+				logging.Errorf("failed rolling back migration: %s", e.Error())
+			}
+			return fmt.Errorf("migrating db schema to version %d: %s", version+1, err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
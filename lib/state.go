@@ -19,6 +19,9 @@ type TagInfo struct {
 	// ID of the tag.
 	ID string `json:"id"`
 
+	// Type of the tag, e.g. "mifare_classic_1k", see rfid.CardType.
+	CardType string `json:"card_type"`
+
 	// Additional data stored in the tag's data blocks.
 	Data string `json:"data"`
 }
@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pakohan/craftdoor/logging"
+)
+
+// notifySocketVar is an environment variable set by systemd for services
+// with Type=notify or WatchdogSec= set.
+const notifySocketVar = "NOTIFY_SOCKET"
+
+// watchdogUSecVar is an environment variable set by systemd containing the
+// watchdog timeout in microseconds.
+const watchdogUSecVar = "WATCHDOG_USEC"
+
+// SdNotify sends a state string such as "READY=1" or "WATCHDOG=1" to systemd.
+//
+// Returns false without error if the process was not started by systemd.
+func SdNotify(state string) (bool, error) {
+	socketPath := os.Getenv(notifySocketVar)
+	if socketPath == "" {
+		return false, nil
+	}
+
+	addr := &net.UnixAddr{Name: socketPath, Net: "unixgram"}
+	conn, err := net.DialUnix(addr.Net, nil, addr)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		e := conn.Close()
+		if e != nil {
+			logging.Errorf("failed closing notify socket: %s", e.Error())
+		}
+	}()
+
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SdWatchdogInterval returns the interval at which WATCHDOG=1 should be sent.
+//
+// This is half of the watchdog timeout configured in systemd, or 0 if the
+// watchdog is disabled.
+func SdWatchdogInterval() (time.Duration, error) {
+	value := os.Getenv(watchdogUSecVar)
+	if value == "" {
+		return 0, nil
+	}
+
+	usec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(usec) * time.Microsecond / 2, nil
+}
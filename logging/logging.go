@@ -0,0 +1,377 @@
+// Package logging provides a levelled, structured logger.
+//
+// Log lines carry a level, a message and a list of key=value fields such as
+// the door, key, member or HTTP request ID they relate to. Output is either
+// human-readable text or one JSON object per line.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log message.
+type Level int32
+
+const (
+	// DebugLevel is for verbose messages, such as one per reader poll.
+	DebugLevel Level = iota
+	// InfoLevel is for routine events, such as access decisions.
+	InfoLevel
+	// WarnLevel is for unexpected events the program recovers from.
+	WarnLevel
+	// ErrorLevel is for failures that need attention.
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+// String returns the lowercase name of a level.
+func (l Level) String() string {
+	name, ok := levelNames[l]
+	if !ok {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return name
+}
+
+// ParseLevel converts a level name such as "info" to a Level.
+func ParseLevel(name string) (Level, error) {
+	for level, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return level, nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level: %q", name)
+}
+
+// Format is the encoding used for log lines.
+type Format string
+
+const (
+	// TextFormat writes lines like `2006-01-02T15:04:05Z INFO message key=value`.
+	TextFormat Format = "text"
+	// JSONFormat writes one JSON object per line.
+	JSONFormat Format = "json"
+)
+
+// ParseFormat validates a format name.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case TextFormat, JSONFormat:
+		return f, nil
+	}
+	return TextFormat, fmt.Errorf("unknown log format: %q", name)
+}
+
+// output is shared by a Logger and all loggers derived from it with With.
+type output struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format Format
+	level  int32
+}
+
+// Logger writes levelled log lines with a fixed set of fields.
+type Logger struct {
+	out    *output
+	fields []field
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// New returns a Logger writing lines of at least the given level to w.
+func New(w io.Writer, format Format, level Level) *Logger {
+	return &Logger{
+		out: &output{
+			w:      w,
+			format: format,
+			level:  int32(level),
+		},
+	}
+}
+
+// With returns a Logger that adds the given fields to every line.
+//
+// Arguments alternate between string keys and arbitrary values.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+len(keysAndValues)/2)
+	copy(fields, l.fields)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		var value interface{} = "(missing)"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		fields = append(fields, field{key: key, value: value})
+	}
+	return &Logger{out: l.out, fields: fields}
+}
+
+// SetLevel changes the minimum level written by this Logger and all loggers
+// sharing its output.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.out.level, int32(level))
+}
+
+// Level returns the minimum level written by this Logger.
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.out.level))
+}
+
+// Enabled returns true if messages at level will be written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+// Debugf logs a message at DebugLevel.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.log(2, DebugLevel, format, args...)
+}
+
+// Infof logs a message at InfoLevel.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.log(2, InfoLevel, format, args...)
+}
+
+// Warnf logs a message at WarnLevel.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.log(2, WarnLevel, format, args...)
+}
+
+// Errorf logs a message at ErrorLevel.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(2, ErrorLevel, format, args...)
+}
+
+// StdLogger returns a *log.Logger that writes each line at the given level.
+//
+// Use it for libraries that only accept the standard library's logger, such
+// as http.Server.ErrorLog.
+func (l *Logger) StdLogger(level Level) *log.Logger {
+	return log.New(&stdWriter{l: l, level: level}, "", 0)
+}
+
+func (l *Logger) log(skip int, level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	caller := "???"
+	_, file, line, ok := runtime.Caller(skip)
+	if ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Join(filepath.Base(filepath.Dir(file)), filepath.Base(file)), line)
+	}
+	l.write(time.Now(), level, caller, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) write(now time.Time, level Level, caller string, msg string) {
+	var buf bytes.Buffer
+	switch l.out.format {
+	case JSONFormat:
+		entry := map[string]interface{}{}
+		for _, f := range l.fields {
+			entry[f.key] = jsonValue(f.value)
+		}
+		entry["time"] = now.Format(time.RFC3339Nano)
+		entry["level"] = level.String()
+		entry["caller"] = caller
+		entry["msg"] = msg
+		b, err := json.Marshal(entry)
+		if err != nil {
+			b, _ = json.Marshal(map[string]string{"level": level.String(), "msg": msg, "error": err.Error()})
+		}
+		buf.Write(b)
+	default:
+		buf.WriteString(now.Format(time.RFC3339))
+		buf.WriteString(" ")
+		buf.WriteString(strings.ToUpper(level.String()))
+		buf.WriteString(" ")
+		buf.WriteString(msg)
+		for _, f := range l.fields {
+			buf.WriteString(" ")
+			buf.WriteString(f.key)
+			buf.WriteString("=")
+			buf.WriteString(textValue(f.value))
+		}
+		buf.WriteString(" caller=")
+		buf.WriteString(caller)
+	}
+	buf.WriteString("\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = l.out.w.Write(buf.Bytes())
+}
+
+// jsonValue converts values that don't marshal usefully, such as errors, to
+// strings.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+// textValue formats a field value, quoting it if it contains spaces.
+func textValue(v interface{}) string {
+	s := fmt.Sprint(jsonValue(v))
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+// stdWriter adapts a Logger to io.Writer for use with *log.Logger.
+type stdWriter struct {
+	l     *Logger
+	level Level
+}
+
+func (w *stdWriter) Write(p []byte) (int, error) {
+	if w.l.Enabled(w.level) {
+		w.l.write(time.Now(), w.level, "stdlog", strings.TrimRight(string(p), "\n"))
+	}
+	return len(p), nil
+}
+
+// OpenOutput opens the destination for log lines. name is "stderr", "stdout"
+// or the path of a file to append to.
+func OpenOutput(name string) (io.WriteCloser, error) {
+	switch name {
+	case "", "stderr":
+		return nopCloser{os.Stderr}, nil
+	case "stdout":
+		return nopCloser{os.Stdout}, nil
+	}
+	// #nosec G302 G304
+	return os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+}
+
+// nopCloser prevents os.Stderr and os.Stdout from being closed.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the Logger stored in ctx, or the default Logger.
+func FromContext(ctx context.Context) *Logger {
+	l, ok := ctx.Value(contextKey{}).(*Logger)
+	if !ok {
+		return Default()
+	}
+	return l
+}
+
+var std atomic.Value
+
+func init() {
+	std.Store(New(os.Stderr, TextFormat, InfoLevel))
+}
+
+// Default returns the process-wide Logger.
+func Default() *Logger {
+	return std.Load().(*Logger)
+}
+
+// SetDefault replaces the process-wide Logger.
+//
+// Output of the standard library's log package is redirected to l at
+// InfoLevel.
+func SetDefault(l *Logger) {
+	std.Store(l)
+	log.SetFlags(0)
+	log.SetOutput(&stdWriter{l: l, level: InfoLevel})
+}
+
+// With returns a Logger derived from the default Logger with extra fields.
+func With(keysAndValues ...interface{}) *Logger {
+	return Default().With(keysAndValues...)
+}
+
+// SetLevel changes the level of the default Logger.
+func SetLevel(level Level) {
+	Default().SetLevel(level)
+}
+
+// Debugf logs a message at DebugLevel with the default Logger.
+func Debugf(format string, args ...interface{}) {
+	Default().log(2, DebugLevel, format, args...)
+}
+
+// Infof logs a message at InfoLevel with the default Logger.
+func Infof(format string, args ...interface{}) {
+	Default().log(2, InfoLevel, format, args...)
+}
+
+// Warnf logs a message at WarnLevel with the default Logger.
+func Warnf(format string, args ...interface{}) {
+	Default().log(2, WarnLevel, format, args...)
+}
+
+// Errorf logs a message at ErrorLevel with the default Logger.
+func Errorf(format string, args ...interface{}) {
+	Default().log(2, ErrorLevel, format, args...)
+}
+
+// Configure builds a Logger from configuration strings. Empty strings select
+// InfoLevel, TextFormat and stderr respectively.
+//
+// The returned io.Closer closes the log file, if any.
+func Configure(level string, format string, output string) (*Logger, io.Closer, error) {
+	lvl := InfoLevel
+	if level != "" {
+		var err error
+		lvl, err = ParseLevel(level)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	f := TextFormat
+	if format != "" {
+		var err error
+		f, err = ParseFormat(format)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	w, err := OpenOutput(output)
+	if err != nil {
+		return nil, nil, err
+	}
+	return New(w, f, lvl), w, nil
+}
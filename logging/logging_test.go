@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, TextFormat, WarnLevel)
+	derived := l.With("door", "main")
+
+	l.Infof("info")
+	derived.Debugf("debug")
+	l.Warnf("warn")
+	derived.Errorf("error")
+	// Loggers derived with With share their parent's level.
+	l.SetLevel(DebugLevel)
+	derived.Debugf("debug after SetLevel")
+
+	got := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		fields := strings.Fields(line)
+		got = append(got, fields[1]+" "+fields[2])
+	}
+	want := []string{"WARN warn", "ERROR error", "DEBUG debug"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrote lines %q, want %q", got, want)
+	}
+}
+
+func TestTextFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, TextFormat, InfoLevel).With("door", "main", "err", errors.New("no tag"), "empty", "")
+	l.With("member", 7, "dangling").Infof("Granted access.")
+
+	line := strings.TrimSpace(buf.String())
+	want := ` INFO Granted access. door=main err="no tag" empty="" member=7 dangling=(missing) caller=logging/logging_test.go:`
+	if !strings.Contains(line, want) {
+		t.Errorf("wrote %q, want it to contain %q", line, want)
+	}
+}
+
+func TestJSONFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, JSONFormat, InfoLevel).With("door", "main", "err", errors.New("no tag"))
+	l.With("member", 7).Infof("Granted %s.", "access")
+
+	entry := map[string]interface{}{}
+	err := json.Unmarshal(buf.Bytes(), &entry)
+	if err != nil {
+		t.Fatalf("wrote %q, which isn't JSON: %s", buf.String(), err)
+	}
+	want := map[string]interface{}{
+		"level":  "info",
+		"msg":    "Granted access.",
+		"door":   "main",
+		"err":    "no tag",
+		"member": float64(7),
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s is %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["time"]; !ok {
+		t.Error("entry has no time")
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "craftdoor-logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "craftdoor.log")
+
+	// Log files are appended to.
+	for _, msg := range []string{"first", "second"} {
+		l, c, err := Configure("warn", "json", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Infof("filtered")
+		l.Warnf(msg)
+		err = c.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"msg":"first"`) || !strings.Contains(lines[1], `"msg":"second"`) {
+		t.Errorf("log file contains %q, want the two warnings", lines)
+	}
+
+	for _, tt := range []struct {
+		output string
+		want   *os.File
+	}{
+		{"", os.Stderr},
+		{"stderr", os.Stderr},
+		{"stdout", os.Stdout},
+	} {
+		l, c, err := Configure("", "", tt.output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w, ok := l.out.w.(nopCloser); !ok || w.Writer != tt.want {
+			t.Errorf("Configure(%q) writes to %v, want %s", tt.output, l.out.w, tt.want.Name())
+		}
+		if l.Level() != InfoLevel || l.out.format != TextFormat {
+			t.Errorf("Configure(%q) has level %s and format %s, want %s and %s", tt.output, l.Level(), l.out.format, InfoLevel, TextFormat)
+		}
+		// Closing must not close the standard streams.
+		err = c.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tt.want.Write(nil)
+		if err != nil {
+			t.Errorf("Configure(%q) closed %s: %s", tt.output, tt.want.Name(), err)
+		}
+	}
+
+	for _, args := range [][3]string{
+		{"verbose", "", ""},
+		{"", "xml", ""},
+		{"", "", filepath.Join(dir, "missing", "craftdoor.log")},
+	} {
+		_, _, err := Configure(args[0], args[1], args[2])
+		if err == nil {
+			t.Errorf("Configure(%q, %q, %q) succeeded, want an error", args[0], args[1], args[2])
+		}
+	}
+}
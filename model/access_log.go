@@ -0,0 +1,111 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pakohan/craftdoor/logging"
+)
+
+// AccessLogModel accesses the access_log table.
+type AccessLogModel struct {
+	db *sqlx.DB
+}
+
+// NewAccessLogModel returns a new model.
+func NewAccessLogModel(db *sqlx.DB) *AccessLogModel {
+	return &AccessLogModel{db: db}
+}
+
+// AccessLogEntry represents a single row: credentials presented at a door and
+// whether they opened it.
+type AccessLogEntry struct {
+	// Integer ID. Auto incremented.
+	ID int64 `json:"id" db:"id"`
+
+	// When the credentials were presented.
+	Time time.Time `json:"time" db:"time"`
+
+	// ID of the door the credentials were presented at.
+	DoorID string `json:"door_id" db:"door_id"`
+
+	// ID of the node that decided. Empty if the master decided.
+	NodeID string `json:"node_id" db:"node_id"`
+
+	// UUID of the tag. Empty if only a PIN was entered.
+	KeyUUID string `json:"key_uuid" db:"key_uuid"`
+
+	// ID of the member the credentials identified. Nil if they identified
+	// no one.
+	MemberID *int64 `json:"member_id" db:"member_id"`
+
+	// Whether the door was unlocked.
+	Granted bool `json:"granted" db:"granted"`
+
+	// Why the door was unlocked or not, see access.Reason. Empty for
+	// entries recorded before reasons were.
+	Reason string `json:"reason" db:"reason"`
+
+	// Whether the node decided on its own while the master was unreachable.
+	Offline bool `json:"offline" db:"offline"`
+}
+
+// Create inserts a new row into the table and sets e.ID.
+func (m *AccessLogModel) Create(ctx context.Context, e *AccessLogEntry) error {
+	res, err := m.db.NamedExecContext(ctx, queryCreateAccessLogEntry, e)
+	if err != nil {
+		return err
+	}
+
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+// CreateAll inserts rows into the table in a single transaction, so either
+// all or none are inserted.
+func (m *AccessLogModel) CreateAll(ctx context.Context, entries []AccessLogEntry) error {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		_, err = tx.NamedExecContext(ctx, queryCreateAccessLogEntry, entry)
+		if err != nil {
+			e := tx.Rollback()
+			if e != nil {
+				logging.Errorf("failed rolling back access log entries: %s", e.Error())
+			}
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// List returns the newest limit rows, newest first.
+func (m *AccessLogModel) List(ctx context.Context, limit int) ([]AccessLogEntry, error) {
+	res := []AccessLogEntry{}
+	err := m.db.SelectContext(ctx, &res, queryListAccessLog, limit)
+	return res, err
+}
+
+const (
+	queryCreateAccessLogEntry = `
+INSERT INTO "main"."access_log"
+( "time",  "door_id",  "node_id",  "key_uuid",  "member_id",  "granted",  "reason",  "offline")
+VALUES
+(:time, :door_id, :node_id, :key_uuid, :member_id, :granted, :reason, :offline)`
+	queryListAccessLog = `
+SELECT "id"
+	, "time"
+	, "door_id"
+	, "node_id"
+	, "key_uuid"
+	, "member_id"
+	, "granted"
+	, "reason"
+	, "offline"
+FROM "access_log"
+ORDER BY "time" DESC, "id" DESC
+LIMIT ?`
+)
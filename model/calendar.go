@@ -0,0 +1,174 @@
+package model
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CalendarModel accesses the calendar table.
+type CalendarModel struct {
+	db *sqlx.DB
+}
+
+// NewCalendarModel returns a new model.
+func NewCalendarModel(db *sqlx.DB) *CalendarModel {
+	return &CalendarModel{db: db}
+}
+
+// CalendarEntry represents a single row: an exception to the door's regular
+// opening hours on one date.
+type CalendarEntry struct {
+	// Integer ID. Auto incremented.
+	ID int64 `json:"id" db:"id"`
+
+	// Date in the door's timezone, formatted as "2006-01-02".
+	Date string `json:"date" db:"date"`
+
+	// "closed", "custom" or "extended".
+	Kind string `json:"kind" db:"kind"`
+
+	// Opening windows such as "10:00-14:00". Ignored for closed entries.
+	Windows StringList `json:"windows" db:"windows"`
+
+	// Human readable description, e.g. "Christmas".
+	Summary string `json:"summary" db:"summary"`
+
+	// UID of the iCalendar event this entry was imported from, if any.
+	UID *string `json:"uid" db:"uid"`
+}
+
+// StringList is a list of strings stored as a comma-separated column.
+type StringList []string
+
+// Scan implements sql.Scanner.
+func (l *StringList) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+	*l = StringList{}
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// List returns all entries from the table, ordered by date.
+func (m *CalendarModel) List(ctx context.Context) ([]CalendarEntry, error) {
+	res := []CalendarEntry{}
+	err := m.db.SelectContext(ctx, &res, queryListCalendarEntries)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Get a single row by id.
+func (m *CalendarModel) Get(ctx context.Context, id int64) (*CalendarEntry, error) {
+	res := CalendarEntry{}
+	err := m.db.GetContext(ctx, &res, queryGetCalendarEntry, id)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Create inserts a new row into the table
+func (m *CalendarModel) Create(ctx context.Context, e *CalendarEntry) error {
+	res, err := m.db.NamedExecContext(ctx, queryCreateCalendarEntry, e)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+// Update updates a single entry in the table
+func (m *CalendarModel) Update(ctx context.Context, e CalendarEntry) error {
+	_, err := m.db.NamedExecContext(ctx, queryUpdateCalendarEntry, e)
+	return err
+}
+
+// Delete deletes a single entry from the table
+func (m *CalendarModel) Delete(ctx context.Context, id int64) error {
+	_, err := m.db.ExecContext(ctx, queryDeleteCalendarEntry, id)
+	return err
+}
+
+// UpsertByUID inserts an entry, or replaces the entry with the same UID.
+// Re-importing a calendar thus updates events instead of duplicating them.
+func (m *CalendarModel) UpsertByUID(ctx context.Context, e *CalendarEntry) error {
+	if e.UID == nil {
+		return m.Create(ctx, e)
+	}
+	_, err := m.db.NamedExecContext(ctx, queryUpsertCalendarEntry, e)
+	if err != nil {
+		return err
+	}
+	return m.db.GetContext(ctx, &e.ID, queryCalendarEntryIDByUID, *e.UID)
+}
+
+const (
+	queryCreateCalendarEntry = `
+INSERT INTO "calendar"
+( "date",  "kind",  "windows",  "summary",  "uid")
+VALUES
+(:date, :kind, :windows, :summary, :uid)`
+	queryUpsertCalendarEntry = `
+INSERT INTO "calendar"
+( "date",  "kind",  "windows",  "summary",  "uid")
+VALUES
+(:date, :kind, :windows, :summary, :uid)
+ON CONFLICT("uid") DO UPDATE
+SET   "date"    = excluded."date"
+	, "kind"    = excluded."kind"
+	, "windows" = excluded."windows"
+	, "summary" = excluded."summary"`
+	queryCalendarEntryIDByUID = `
+SELECT "id"
+FROM "calendar"
+WHERE uid = ?`
+	queryListCalendarEntries = `
+SELECT "id"
+	, "date"
+	, "kind"
+	, "windows"
+	, "summary"
+	, "uid"
+FROM "calendar"
+ORDER BY "date", "id"`
+	queryGetCalendarEntry = `
+SELECT "id"
+	, "date"
+	, "kind"
+	, "windows"
+	, "summary"
+	, "uid"
+FROM "calendar"
+WHERE id = ?`
+	queryUpdateCalendarEntry = `
+UPDATE "calendar"
+SET   "date"    = :date
+	, "kind"    = :kind
+	, "windows" = :windows
+	, "summary" = :summary
+WHERE "id" = :id`
+	queryDeleteCalendarEntry = `
+DELETE FROM "calendar"
+WHERE id = ?`
+)
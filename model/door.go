@@ -0,0 +1,65 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DoorModel accesses the door_mode table.
+type DoorModel struct {
+	db *sqlx.DB
+}
+
+// NewDoorModel returns a new model.
+func NewDoorModel(db *sqlx.DB) *DoorModel {
+	return &DoorModel{db: db}
+}
+
+// DoorMode represents a single row: the mode a door was last set to.
+type DoorMode struct {
+	// ID of the door, as configured in door.id.
+	DoorID string `json:"door_id" db:"door_id"`
+
+	// "normal", "held_open" or "lockdown".
+	Mode string `json:"mode" db:"mode"`
+
+	// When a held-open door reverts to normal. Null for other modes.
+	Until *time.Time `json:"until" db:"until"`
+}
+
+// GetMode returns a door's mode. Doors whose mode was never set are in normal
+// mode.
+func (m *DoorModel) GetMode(ctx context.Context, doorID string) (*DoorMode, error) {
+	res := DoorMode{}
+	err := m.db.GetContext(ctx, &res, queryGetDoorMode, doorID)
+	if err == sql.ErrNoRows {
+		return &DoorMode{DoorID: doorID, Mode: "normal"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SetMode inserts or replaces a door's mode.
+func (m *DoorModel) SetMode(ctx context.Context, mode DoorMode) error {
+	_, err := m.db.NamedExecContext(ctx, querySetDoorMode, mode)
+	return err
+}
+
+const (
+	queryGetDoorMode = `
+SELECT "door_id"
+	, "mode"
+	, "until"
+FROM "door_mode"
+WHERE door_id = ?`
+	querySetDoorMode = `
+INSERT OR REPLACE INTO "door_mode"
+( "door_id",  "mode",  "until")
+VALUES
+(:door_id, :mode, :until)`
+)
@@ -2,9 +2,12 @@ package model
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/pakohan/craftdoor/access"
+	"github.com/pakohan/craftdoor/rfid"
 )
 
 // KeyModel accesses the key table.
@@ -22,11 +25,14 @@ type Key struct {
 	// Integer ID. Auto incremented.
 	ID int64 `json:"id" db:"id"`
 
-	// UUID stored on the key.
-	UUID string `json:"uuid" db:"uuid"`
+	// Credential ID of the key, its UID or card number.
+	UUID rfid.CredentialID `json:"uuid" db:"uuid"`
 
 	// ID of member associated with this key.
 	MemberID *int64 `json:"member_id" db:"member_id"`
+
+	// Type of the card, e.g. "mifare_classic_1k", see rfid.CardType.
+	CardType string `json:"card_type" db:"card_type"`
 }
 
 // KeyInfo contains all details about a key.
@@ -35,6 +41,15 @@ type KeyInfo struct {
 	Member *Member `json:"member"`
 }
 
+// Access describes who a key with access belongs to.
+type Access struct {
+	// UUID stored on the key.
+	UUID string `json:"uuid" db:"uuid"`
+
+	// ID of the key's member.
+	MemberID int64 `json:"member_id" db:"member_id"`
+}
+
 // List returns all entries from the table
 func (m *KeyModel) List(ctx context.Context) ([]Key, error) {
 	res := []Key{}
@@ -82,8 +97,13 @@ func (m *KeyModel) Get(ctx context.Context, id int64) (*KeyInfo, error) {
 	return &res, nil
 }
 
-// Create inserts a new row into the table
+// Create inserts a new row into the table. The key's UUID must be a valid
+// credential ID.
 func (m *KeyModel) Create(ctx context.Context, k *Key) error {
+	err := k.UUID.Validate()
+	if err != nil {
+		return err
+	}
 	res, err := m.db.NamedExecContext(ctx, queryCreateKey, k)
 	if err != nil {
 		return err
@@ -92,8 +112,13 @@ func (m *KeyModel) Create(ctx context.Context, k *Key) error {
 	return err
 }
 
-// Update updates a single row's fields.
+// Update updates a single row's fields. The key's UUID must be a valid
+// credential ID.
 func (m *KeyModel) Update(ctx context.Context, k *Key) error {
+	err := k.UUID.Validate()
+	if err != nil {
+		return err
+	}
 	res, err := m.db.NamedExecContext(ctx, queryUpdateKey, k)
 	if err != nil {
 		return err
@@ -108,46 +133,77 @@ func (m *KeyModel) Delete(ctx context.Context, id int64) error {
 	return err
 }
 
-// IsAccessAllowed returns whether the key has access.
-func (m *KeyModel) IsAccessAllowed(ctx context.Context, keyID string) (bool, error) {
-	var res bool
-	err := m.db.GetContext(ctx, &res, accessAllowed, keyID)
+// ListAccess returns all keys that have access, ordered by UUID. Keys that
+// are not listed have no access.
+func (m *KeyModel) ListAccess(ctx context.Context) ([]Access, error) {
+	res := []Access{}
+	err := m.db.SelectContext(ctx, &res, queryListAccess)
 	return res, err
 }
 
+// MemberAccess returns the member the key belongs to, or nil if the key is
+// unknown or belongs to no one.
+func (m *KeyModel) MemberAccess(ctx context.Context, keyID string) (*access.Member, error) {
+	res := &access.Member{}
+	err := m.db.GetContext(ctx, res, queryMemberAccessByKey, keyID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 const (
 	queryCreateKey = `
 INSERT INTO "main"."key"
-( uuid,  member_id)
+( uuid,  member_id,  card_type)
 VALUES
-(:uuid, :member_id)`
+(:uuid, :member_id, :card_type)`
 	queryListKeys = `
 SELECT "id"
     , "uuid"
 	, "member_id"
+	, "card_type"
 FROM "key"
 ORDER BY "id"`
 	queryGetKey = `
 SELECT "id"
     , "uuid"
 	, "member_id"
+	, "card_type"
 FROM "key"
 WHERE id = ?`
 	queryGetMemberByID = `
 SELECT "id"
 	, "name"
+	, "emergency_staff"
+	, "keyholder"
+	, "pin_hash" != '' AS "has_pin"
 FROM "member"
 WHERE id = ?`
 	queryUpdateKey = `
 UPDATE "key"
 SET   "uuid"      = :uuid
 	, "member_id" = :member_id
+	, "card_type" = :card_type
 WHERE "id" = :id`
 	queryDeleteKey = `
 DELETE FROM "key"
 WHERE id = ?`
-	accessAllowed = `
-SELECT COUNT(*) > 0
+	queryListAccess = `
+SELECT key.uuid
+	, key.member_id
+FROM key
+JOIN  member
+	ON (key.member_id = member.id)
+ORDER BY key.uuid`
+	queryMemberAccessByKey = `
+SELECT member.id
+	, member.emergency_staff
+	, member.keyholder
+	, member.pin_hash
 FROM key
 JOIN  member
 	ON (key.member_id = member.id)
@@ -2,8 +2,10 @@ package model
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/pakohan/craftdoor/access"
 )
 
 // MemberModel accesses the db
@@ -23,6 +25,17 @@ type Member struct {
 
 	// Member's name.
 	Name string `json:"name" db:"name"`
+
+	// If true, the member is admitted while the door is in lockdown.
+	EmergencyStaff bool `json:"emergency_staff" db:"emergency_staff"`
+
+	// If true, the member's arrival starts opening windows under a first-in
+	// policy.
+	Keyholder bool `json:"keyholder" db:"keyholder"`
+
+	// Whether the member has a PIN, see SetPINHash. Ignored by Create and
+	// Update.
+	HasPIN bool `json:"has_pin" db:"has_pin"`
 }
 
 // MemberInfo contains all details about a member.
@@ -87,6 +100,46 @@ func (m *MemberModel) Update(ctx context.Context, t Member) error {
 	return err
 }
 
+// SetPINHash replaces the hash of the member's PIN, see access.HashPIN. An
+// empty hash removes the PIN. Returns sql.ErrNoRows if there is no such
+// member.
+func (m *MemberModel) SetPINHash(ctx context.Context, id int64, hash string) error {
+	res, err := m.db.ExecContext(ctx, querySetPINHash, hash, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MemberAccess returns the member with the given ID, or nil if there is
+// none.
+func (m *MemberModel) MemberAccess(ctx context.Context, id int64) (*access.Member, error) {
+	res := &access.Member{}
+	err := m.db.GetContext(ctx, res, queryMemberAccess, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ListAccess returns all members who may be admitted, having a key or a PIN,
+// ordered by ID.
+func (m *MemberModel) ListAccess(ctx context.Context) ([]access.Member, error) {
+	res := []access.Member{}
+	err := m.db.SelectContext(ctx, &res, queryListMemberAccess)
+	return res, err
+}
+
 // Delete deletes a single entry from the table
 func (m *MemberModel) Delete(ctx context.Context, id int64) error {
 	_, err := m.db.ExecContext(ctx, queryDeleteMember, id)
@@ -96,17 +149,23 @@ func (m *MemberModel) Delete(ctx context.Context, id int64) error {
 const (
 	queryCreateMember = `
 INSERT INTO "member"
-("name")
+( "name",  "emergency_staff",  "keyholder")
 VALUES
-(:name)`
+(:name, :emergency_staff, :keyholder)`
 	queryListMembers = `
 SELECT "id"
 	, "name"
+	, "emergency_staff"
+	, "keyholder"
+	, "pin_hash" != '' AS "has_pin"
 FROM "member"
 ORDER BY "id"`
 	queryGetMember = `
 SELECT "id"
 	, "name"
+	, "emergency_staff"
+	, "keyholder"
+	, "pin_hash" != '' AS "has_pin"
 FROM "member"
 WHERE id = ?`
 	queryKeysByMemberID = `
@@ -117,8 +176,30 @@ FROM "key"
 WHERE member_id = ?`
 	queryUpdateMember = `
 UPDATE "member"
-SET "name" = :name
+SET   "name"            = :name
+	, "emergency_staff" = :emergency_staff
+	, "keyholder"       = :keyholder
 WHERE "id" = :id`
+	querySetPINHash = `
+UPDATE "member"
+SET "pin_hash" = ?
+WHERE "id" = ?`
+	queryMemberAccess = `
+SELECT "id"
+	, "emergency_staff"
+	, "keyholder"
+	, "pin_hash"
+FROM "member"
+WHERE id = ?`
+	queryListMemberAccess = `
+SELECT "id"
+	, "emergency_staff"
+	, "keyholder"
+	, "pin_hash"
+FROM "member"
+WHERE "pin_hash" != ''
+	OR "id" IN (SELECT "member_id" FROM "key")
+ORDER BY "id"`
 	queryDeleteMember = `
 DELETE FROM "member"
 WHERE id = ?`
@@ -1,19 +1,35 @@
 package model
 
 import (
+	"context"
+
 	"github.com/jmoiron/sqlx"
 )
 
 // Model holds all models
 type Model struct {
-	KeyModel    *KeyModel
-	MemberModel *MemberModel
+	KeyModel       *KeyModel
+	MemberModel    *MemberModel
+	CalendarModel  *CalendarModel
+	DoorModel      *DoorModel
+	AccessLogModel *AccessLogModel
+
+	db *sqlx.DB
 }
 
 // New returns all models initialized
 func New(db *sqlx.DB) Model {
 	return Model{
-		KeyModel:    NewKeyModel(db),
-		MemberModel: NewMemberModel(db),
+		KeyModel:       NewKeyModel(db),
+		MemberModel:    NewMemberModel(db),
+		CalendarModel:  NewCalendarModel(db),
+		DoorModel:      NewDoorModel(db),
+		AccessLogModel: NewAccessLogModel(db),
+		db:             db,
 	}
 }
+
+// Ping verifies that the database is reachable.
+func (m Model) Ping(ctx context.Context) error {
+	return m.db.PingContext(ctx)
+}
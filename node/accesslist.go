@@ -0,0 +1,223 @@
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pakohan/craftdoor/access"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/model"
+)
+
+// AccessList is the master's snapshot of who may open a node's door. Nodes
+// cache it on disk and decide on their own with it while the master is
+// unreachable.
+type AccessList struct {
+	// Digest of the list's contents, see Digest. Changes whenever the door's
+	// mode, the calendar, the keys with access or their members change.
+	Version string `json:"version"`
+
+	// ID of the door the list was generated for.
+	DoorID string `json:"door_id"`
+
+	// When the master generated the list. Nodes never replace a cached list
+	// with an older one.
+	GeneratedAt time.Time `json:"generated_at"`
+
+	// When nodes stop relying on the list's keys, see
+	// config.Config.AccessListValidity.
+	ValidUntil time.Time `json:"valid_until"`
+
+	// Mode of the door.
+	Mode door.Mode `json:"mode"`
+
+	// When a held-open door reverts to normal. Nil for other modes.
+	Until *time.Time `json:"until,omitempty"`
+
+	// Exceptions to the door's opening hours.
+	Calendar []model.CalendarEntry `json:"calendar"`
+
+	// Keys with access and their members. Keys that aren't listed have no
+	// access.
+	Keys []model.Access `json:"keys"`
+
+	// Members who may be admitted. Only lists of doors that require a PIN
+	// include the hashes of their PINs.
+	Members []access.Member `json:"members"`
+}
+
+// Digest returns the hex-encoded SHA-256 of the list's door, mode, calendar,
+// keys and members. The master uses it as the list's version.
+func (l *AccessList) Digest() (string, error) {
+	b, err := json.Marshal(struct {
+		DoorID   string
+		Mode     door.Mode
+		Until    *time.Time
+		Calendar []model.CalendarEntry
+		Keys     []model.Access
+		Members  []access.Member
+	}{l.DoorID, l.Mode, l.Until, l.Calendar, l.Keys, l.Members})
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(b)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// ModeState returns the door mode of the list.
+func (l *AccessList) ModeState() (door.ModeState, error) {
+	mode, err := door.ParseMode(string(l.Mode))
+	if err != nil {
+		return door.ModeState{}, err
+	}
+	state := door.ModeState{Mode: mode}
+	if mode == door.ModeHeldOpen {
+		if l.Until == nil {
+			return door.ModeState{}, fmt.Errorf("held_open mode requires an until time")
+		}
+		state.Until = *l.Until
+	}
+	return state, nil
+}
+
+// SealedAccessList is an AccessList as sent by the master and cached by
+// nodes. The list is encrypted, since it includes the hashes of members'
+// PINs, and kept in its encrypted form so that its signature can be
+// verified.
+type SealedAccessList struct {
+	// The JSON-encoded AccessList, encrypted with AES-256-GCM keyed with a key
+	// derived from the node's secret and base64-encoded, with the nonce
+	// prepended.
+	AccessList string `json:"access_list"`
+
+	// Hex-encoded HMAC-SHA256 of AccessList, keyed with the node's secret.
+	Signature string `json:"signature"`
+}
+
+// SealAccessList encodes, encrypts and signs l with the node's secret.
+func SealAccessList(secret string, l *AccessList) (*SealedAccessList, error) {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := derivedCipher(secret, "access-list")
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	sealed := base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, b, nil))
+	return &SealedAccessList{
+		AccessList: sealed,
+		Signature:  accessListSignature(secret, sealed),
+	}, nil
+}
+
+// Open checks the list's signature against the node's secret, decrypts and
+// decodes the list.
+func (s *SealedAccessList) Open(secret string) (*AccessList, error) {
+	want := accessListSignature(secret, s.AccessList)
+	if !hmac.Equal([]byte(want), []byte(s.Signature)) {
+		return nil, ErrBadSignature
+	}
+	sealed, err := base64.StdEncoding.DecodeString(s.AccessList)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted access list: %s", err)
+	}
+	aead, err := derivedCipher(secret, "access-list")
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid encrypted access list: too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	b, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("invalid encrypted access list: can't decrypt")
+	}
+	l := &AccessList{}
+	err = json.Unmarshal(b, l)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// accessListSignature returns the signature of an encrypted access list. The
+// prefix keeps it from being mistaken for the signature of a request.
+func accessListSignature(secret string, sealed string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "access-list\n%s", sealed)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// loadAccessList reads and verifies the access list cached at path. Returns
+// nil if nothing is cached.
+func loadAccessList(path string, secret string) (*SealedAccessList, *AccessList, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sealed := &SealedAccessList{}
+	err = json.Unmarshal(b, sealed)
+	if err != nil {
+		return nil, nil, err
+	}
+	l, err := sealed.Open(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sealed, l, nil
+}
+
+// writeFile replaces the file at path with the JSON encoding of v. The file
+// is replaced atomically, so a crash leaves either the old or the new
+// contents.
+func writeFile(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	e := tmp.Close()
+	if err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		e = os.Remove(tmp.Name())
+		if e != nil {
+			logging.Errorf("failed removing %s: %s", tmp.Name(), e)
+		}
+		return err
+	}
+	return nil
+}
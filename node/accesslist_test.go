@@ -0,0 +1,78 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pakohan/craftdoor/access"
+	"github.com/pakohan/craftdoor/door"
+)
+
+func TestSealAccessList(t *testing.T) {
+	const secret = "test-secret-0123456789"
+	const hash = "pbkdf2-sha256$2$c2FsdA$Alv4RqSGkwQKLCiemtQPQFUd0g1Qkf/PAx5QrqbbaIY"
+	at := time.Date(2026, time.March, 2, 8, 0, 0, 0, time.UTC)
+	list := &AccessList{
+		Version:     "v1",
+		DoorID:      "workshop",
+		GeneratedAt: at,
+		ValidUntil:  at.Add(7 * 24 * time.Hour),
+		Mode:        door.ModeNormal,
+		Members:     []access.Member{{ID: 1, PINHash: hash}},
+	}
+	sealed, err := SealAccessList(secret, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "pbkdf2") || strings.Contains(string(b), "workshop") {
+		t.Fatalf("sent %s, want the list only encrypted", b)
+	}
+
+	received := &SealedAccessList{}
+	err = json.Unmarshal(b, received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := received.Open(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.DoorID != "workshop" || len(opened.Members) != 1 || opened.Members[0].PINHash != hash {
+		t.Errorf("Open = %+v, want the sealed list", opened)
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		modify  func(s *SealedAccessList)
+		wantErr error
+	}{
+		{"wrong secret", "other-secret-0123456789", func(s *SealedAccessList) {}, ErrBadSignature},
+		{"tampered", secret, func(s *SealedAccessList) { s.AccessList = "A" + s.AccessList[1:] }, ErrBadSignature},
+		{"tampered and signed", secret, func(s *SealedAccessList) {
+			s.AccessList = "A" + s.AccessList[1:]
+			s.Signature = accessListSignature(secret, s.AccessList)
+		}, nil},
+		{"truncated", secret, func(s *SealedAccessList) {
+			s.AccessList = s.AccessList[:8]
+			s.Signature = accessListSignature(secret, s.AccessList)
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := *sealed
+			tt.modify(&s)
+			l, err := s.Open(tt.secret)
+			if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("Open = %+v, %v, want error %v", l, err, tt.wantErr)
+			}
+		})
+	}
+}
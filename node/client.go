@@ -0,0 +1,160 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/logging"
+)
+
+// maxResponseSize limits how much of a response the client reads. Access
+// lists are the largest responses.
+const maxResponseSize = 16 << 20
+
+// StatusError is returned by Client when the master responds with an error.
+type StatusError struct {
+	// HTTP status code of the response.
+	Code int
+
+	// Body of the response.
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("master responded with %d %s: %s", e.Code, http.StatusText(e.Code), e.Message)
+}
+
+// Rejected returns whether err means the master explicitly denied a request,
+// because it doesn't admit the node or the request's signature, or the
+// response wasn't signed by the master. Other errors, including other client
+// errors and internal errors of the master, mean the master couldn't decide.
+func Rejected(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == http.StatusUnauthorized || statusErr.Code == http.StatusForbidden
+	}
+	return errors.Is(err, ErrBadSignature)
+}
+
+// Client sends signed requests to the master and checks the signatures of
+// its responses.
+type Client struct {
+	base   string
+	id     string
+	secret string
+	http   *http.Client
+}
+
+// NewClient returns a client for the master configured in cfg.
+func NewClient(cfg config.MasterConfig) *Client {
+	return &Client{
+		base:   strings.TrimSuffix(cfg.URL, "/"),
+		id:     cfg.NodeID,
+		secret: cfg.Secret,
+		http:   &http.Client{},
+	}
+}
+
+// ID returns the node's ID.
+func (c *Client) ID() string {
+	return c.id
+}
+
+// Heartbeat reports the node's state and returns how to run its door.
+func (c *Client) Heartbeat(ctx context.Context, hb Heartbeat) (*HeartbeatResponse, error) {
+	res := &HeartbeatResponse{}
+	err := c.do(ctx, http.MethodPost, "heartbeat", hb, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Tag asks the master whether a tag may open the node's door. The event's PIN
+// is encrypted, see TagEvent.SealPIN.
+func (c *Client) Tag(ctx context.Context, event TagEvent) (*Decision, error) {
+	err := event.SealPIN(c.secret)
+	if err != nil {
+		return nil, err
+	}
+	res := &Decision{}
+	err = c.do(ctx, http.MethodPost, "tags", event, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// AccessList fetches the node's current access list. The caller must open
+// it.
+func (c *Client) AccessList(ctx context.Context) (*SealedAccessList, error) {
+	res := &SealedAccessList{}
+	err := c.do(ctx, http.MethodGet, "access_list", nil, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Events uploads decisions the node made while the master was unreachable.
+func (c *Client) Events(ctx context.Context, events []AccessEvent) error {
+	return c.do(ctx, http.MethodPost, "events", AccessEvents{Events: events}, &struct{}{})
+}
+
+// do sends req to /api/nodes/<id>/<endpoint> and decodes the response into
+// res. A nil req is sent as an empty body.
+func (c *Client) do(ctx context.Context, method string, endpoint string, req interface{}, res interface{}) error {
+	body := []byte{}
+	if req != nil {
+		var err error
+		body, err = json.Marshal(req)
+		if err != nil {
+			return err
+		}
+	}
+	path := fmt.Sprintf("/api/nodes/%s/%s", url.PathEscape(c.id), endpoint)
+	r, err := http.NewRequest(method, c.base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	now := time.Now()
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(HeaderTimestamp, fmt.Sprint(now.Unix()))
+	signature := Sign(c.secret, method, r.URL.EscapedPath(), now, body)
+	r.Header.Set(HeaderSignature, signature)
+
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		e := resp.Body.Close()
+		if e != nil {
+			logging.Errorf("failed closing response body: %s", e)
+		}
+	}()
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Code: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+	err = VerifyResponse(c.secret, signature, resp.Header.Get(HeaderSignature), resp.StatusCode, b)
+	if err != nil {
+		return fmt.Errorf("master's response: %w", err)
+	}
+	return json.Unmarshal(b, res)
+}
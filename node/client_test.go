@@ -0,0 +1,89 @@
+package node
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pakohan/craftdoor/config"
+)
+
+func TestClientRejected(t *testing.T) {
+	const secret = "test-secret-0123456789"
+	tests := []struct {
+		name         string
+		handler      http.HandlerFunc
+		wantRejected bool
+	}{
+		{"unknown node", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unknown node", http.StatusUnauthorized)
+		}, true},
+		{"unconfigured node", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unknown node", http.StatusForbidden)
+		}, true},
+		{"bad request", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unexpected EOF", http.StatusBadRequest)
+		}, false},
+		{"not found", http.NotFound, false},
+		{"internal error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "database is locked", http.StatusInternalServerError)
+		}, false},
+		{"unsigned decision", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"granted":true}`))
+		}, true},
+		{"forged decision", func(w http.ResponseWriter, r *http.Request) {
+			body := []byte(`{"granted":true}`)
+			w.Header().Set(HeaderSignature, SignResponse("other-secret-0123456789", r.Header.Get(HeaderSignature), http.StatusOK, body))
+			_, _ = w.Write(body)
+		}, true},
+		{"unavailable", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			c := NewClient(config.MasterConfig{URL: server.URL, NodeID: "workshop", Secret: secret})
+
+			_, err := c.Tag(context.Background(), TagEvent{UID: "04a1b2c3"})
+			if err == nil {
+				t.Fatal("Tag() succeeded, want error")
+			}
+			if got := Rejected(err); got != tt.wantRejected {
+				t.Errorf("Rejected(%q) = %t, want %t", err, got, tt.wantRejected)
+			}
+		})
+	}
+}
+
+func TestClientSignedDecision(t *testing.T) {
+	const secret = "test-secret-0123456789"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := []byte(`{"granted":true,"reason":"granted"}`)
+		w.Header().Set(HeaderSignature, SignResponse(secret, r.Header.Get(HeaderSignature), http.StatusOK, body))
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	c := NewClient(config.MasterConfig{URL: server.URL, NodeID: "workshop", Secret: secret})
+
+	decision, err := c.Tag(context.Background(), TagEvent{UID: "04a1b2c3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decision.Granted {
+		t.Errorf("Tag() = %+v, want granted", decision)
+	}
+}
+
+func TestClientUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	c := NewClient(config.MasterConfig{URL: server.URL, NodeID: "workshop", Secret: "test-secret-0123456789"})
+
+	_, err := c.Tag(context.Background(), TagEvent{UID: "04a1b2c3"})
+	if err == nil || Rejected(err) {
+		t.Errorf("Tag() = %v, want unreachable error", err)
+	}
+}
@@ -0,0 +1,641 @@
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/pakohan/craftdoor/access"
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/model"
+	"github.com/pakohan/craftdoor/rfid"
+)
+
+// errNotContacted is reported by MasterError until the master is first
+// contacted.
+var errNotContacted = errors.New("master has not been contacted yet")
+
+const (
+	// How long the access loop waits for a tag before checking for
+	// cancellation.
+	readTimeout = 3 * time.Second
+
+	// maxLoopAge is the longest the access loop may go without completing an
+	// iteration before it is considered hung.
+	maxLoopAge = 30 * time.Second
+
+	// maxUploadBatch is how many queued events are uploaded per request.
+	maxUploadBatch = 500
+
+	// Files in master.cache_dir.
+	accessListFile = "access_list.json"
+	eventsFile     = "events.json"
+)
+
+// Node drives a door and reader, asking the master whether tags may open
+// the door and reporting to it with heartbeats.
+//
+// While the master is unreachable, the node decides with its cached access
+// list and queues the decisions until they can be uploaded.
+type Node struct {
+	client   *Client
+	secret   string
+	reader   *rfid.Poller
+	d        door.Door
+	cal      *door.Calendar
+	clock    clock.Clock
+	debounce *rfid.Debouncer
+
+	// Where the access list is cached.
+	cachePath string
+
+	// Decisions made while the master was unreachable.
+	queue *queue
+
+	// Stops the loops. done is closed once both have returned.
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Guards the fields below.
+	mu             sync.Mutex
+	interval       time.Duration
+	timeout        time.Duration
+	offlineUnknown string
+	policy         access.Policy
+	loopBeat       time.Time
+	mode           door.ModeState
+	calendar       []model.CalendarEntry
+	list           *AccessList
+	masterErr      error
+
+	// Member IDs of the list's keys, by UUID, and the list's members, by
+	// ID.
+	keys    map[string]int64
+	members map[int64]access.Member
+}
+
+// New starts a node driving r and d. The master's calendar is loaded into
+// cal, which should be the calendar used by d's schedules. Time is told by
+// clk, e.g. clock.Real.
+//
+// The door mode and calendar of the access list cached in master.cache_dir
+// apply until the master is reached.
+//
+// Call Close to stop the node. Register the node with a config.Reloader to
+// apply config changes.
+func New(cfg *config.Config, client *Client, r rfid.Reader, d door.Door, cal *door.Calendar, clk clock.Clock) (*Node, error) {
+	err := os.MkdirAll(cfg.Master.CacheDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Node{
+		client:    client,
+		secret:    cfg.Master.Secret,
+		reader:    rfid.NewPoller(r, clk),
+		d:         d,
+		cal:       cal,
+		clock:     clk,
+		debounce:  rfid.NewDebouncer(cfg.Door.TagDebounce.Duration),
+		cachePath: filepath.Join(cfg.Master.CacheDir, accessListFile),
+		queue:     openQueue(filepath.Join(cfg.Master.CacheDir, eventsFile)),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		interval:  cfg.Master.HeartbeatInterval.Duration,
+		timeout:   cfg.Master.Timeout.Duration,
+
+		offlineUnknown: cfg.Master.OfflineUnknownTags,
+		policy:         access.Policy(cfg.Door.Auth),
+		masterErr:      errNotContacted,
+	}
+	n.loadCache()
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		n.accessLoop(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		n.heartbeatLoop(ctx)
+	}()
+	go func() {
+		wg.Wait()
+		close(n.done)
+	}()
+	return n, nil
+}
+
+// ApplyConfig changes the tag debounce window, the door's auth policy, the
+// heartbeat interval, request timeout and the policy for unknown tags while
+// offline.
+func (n *Node) ApplyConfig(cfg *config.Config) error {
+	n.debounce.SetWindow(cfg.Door.TagDebounce.Duration)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.interval = cfg.Master.HeartbeatInterval.Duration
+	n.timeout = cfg.Master.Timeout.Duration
+	n.offlineUnknown = cfg.Master.OfflineUnknownTags
+	n.policy = access.Policy(cfg.Door.Auth)
+	return nil
+}
+
+// Close stops the node's loops and waits for them to return.
+//
+// The reader and door are owned by the caller and are not closed.
+func (n *Node) Close() error {
+	n.cancel()
+	<-n.done
+	return nil
+}
+
+// Health returns an error if the door or the access loop has stopped. An
+// unreachable master is not an error, since restarting the node wouldn't
+// help.
+func (n *Node) Health() error {
+	err := n.d.Health()
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.loopBeat.IsZero() {
+		return fmt.Errorf("access loop has not started")
+	}
+	if age := n.clock.Now().Sub(n.loopBeat); age > maxLoopAge {
+		return fmt.Errorf("access loop last completed an iteration %s ago", age)
+	}
+	return nil
+}
+
+// MasterError returns the error of the last request to the master, or nil if
+// it succeeded.
+func (n *Node) MasterError() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.masterErr
+}
+
+// AccessListVersion returns the version of the cached access list, or "" if
+// none is cached.
+func (n *Node) AccessListVersion() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.list == nil {
+		return ""
+	}
+	return n.list.Version
+}
+
+// QueuedEvents returns the number of access events waiting to be uploaded.
+func (n *Node) QueuedEvents() int {
+	return n.queue.len()
+}
+
+// accessLoop handles credentials presented at the door until ctx is done. A
+// tag held in front of the reader is only handled once.
+func (n *Node) accessLoop(ctx context.Context) {
+	log := logging.With("door", n.d.String())
+	log.Infof("Starting access loop of node %s...", n.client.ID())
+	defer n.recoverPanic(log)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("Stopping access loop.")
+			return
+		default:
+		}
+
+		n.mu.Lock()
+		n.loopBeat = n.clock.Now()
+		policy := n.policy
+		n.mu.Unlock()
+
+		if policy == access.PolicyPIN {
+			creds, err := access.ReadEntry(ctx, n.d.PINPad(), readTimeout)
+			if err == nil {
+				n.handle(ctx, log.With("member", creds.MemberID), policy, creds)
+			} else if err != door.ErrEntryTimeout && ctx.Err() == nil {
+				log.Errorf("Failed to read keypad: %s", err)
+			}
+			continue
+		}
+
+		uid, err := n.reader.ReadUID(n.clock.Now().Add(readTimeout))
+		if err != nil {
+			log.Errorf("Failed to read tag: %s", err)
+			// Errors of the card, such as ErrAuth, don't need a pause. The
+			// poller already retried transient errors, so other errors are
+			// permanent and would otherwise make this a busy loop.
+			if !errors.Is(err, rfid.ErrAuth) {
+				n.wait(ctx, rfid.MaxBackoff)
+			}
+			continue
+		}
+		if uid == nil {
+			continue
+		}
+		id := hex.EncodeToString(uid)
+		if !n.debounce.Seen(id, n.clock.Now()) {
+			log.Debugf("Ignoring tag %s, which is still in front of the reader.", id)
+			continue
+		}
+
+		keyLog := log.With("key", id)
+		_, err = rfid.NewCredentialID(uid)
+		if err != nil {
+			keyLog.Warnf("Denying tag: %s", err)
+			err = n.d.AuthFail()
+			if err != nil {
+				keyLog.Errorf("Failed to signal access decision to door: %s", err)
+			}
+			continue
+		}
+		creds := access.Credentials{UID: id}
+		if policy == access.PolicyTagPIN {
+			keyLog.Infof("Waiting for PIN.")
+			creds, err = access.ReadPIN(ctx, n.d.PINPad(), id)
+			if ctx.Err() != nil {
+				continue
+			}
+			if err != nil {
+				keyLog.Errorf("Failed to read keypad: %s", err)
+			}
+		}
+		n.handle(ctx, keyLog, policy, creds)
+	}
+}
+
+// handle asks the master whether creds may open the door and signals the
+// decision to the door. If the master is unreachable, the node decides on
+// its own and queues the decision. If the master rejects the request, the
+// door stays locked.
+func (n *Node) handle(ctx context.Context, log *logging.Logger, policy access.Policy, creds access.Credentials) {
+	n.mu.Lock()
+	timeout := n.timeout
+	n.mu.Unlock()
+
+	event := TagEvent{
+		UID:       creds.UID,
+		At:        n.clock.Now(),
+		Policy:    policy,
+		MemberID:  creds.MemberID,
+		PIN:       creds.PIN,
+		LockedOut: creds.LockedOut,
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	decision, err := n.client.Tag(reqCtx, event)
+	cancel()
+	n.setMasterErr(err)
+	if Rejected(err) {
+		log.Errorf("Master rejected the request: %s", err)
+		decision = &Decision{Granted: false, Reason: access.ReasonMasterRejected}
+	} else if err != nil {
+		log.Warnf("Master unreachable, deciding offline: %s", err)
+		decision = n.decideOffline(log, policy, creds)
+		err = n.queue.push(AccessEvent{
+			UID:      creds.UID,
+			At:       event.At,
+			Granted:  decision.Granted,
+			MemberID: decision.MemberID,
+			Reason:   decision.Reason,
+		})
+		if err != nil {
+			log.Errorf("Failed to queue access event: %s", err)
+		}
+	}
+
+	pad := n.d.PINPad()
+	res := access.Result{Granted: decision.Granted, Reason: decision.Reason}
+	if pad != nil && policy.NeedsPIN() && access.CountAttempt(pad, res) {
+		_, until := pad.LockedOut()
+		log.Warnf("Too many wrong PINs. Keypad locked until %s.", until)
+	}
+
+	if decision.Granted {
+		log.Infof("Access granted.")
+		err = n.d.AuthOK()
+		if err == nil && decision.Keyholder {
+			err = n.d.KeyholderIn()
+		}
+	} else {
+		log.Infof("Access NOT granted: %s.", decision.Reason)
+		err = n.d.AuthFail()
+	}
+	if err != nil {
+		log.Errorf("Failed to signal access decision to door: %s", err)
+	}
+}
+
+// decideOffline decides whether creds may open the door with the cached
+// access list, following the same rules as the master. Once the list
+// expired, it identifies no one.
+//
+// Under access.PolicyTag, unknown tags are handled according to
+// master.offline_unknown_tags, except during a lockdown. Doors requiring a
+// PIN never admit unknown credentials.
+func (n *Node) decideOffline(log *logging.Logger, policy access.Policy, creds access.Credentials) *Decision {
+	now := n.clock.Now()
+	n.mu.Lock()
+	lockdown := n.mode.At(now) == door.ModeLockdown
+	list, valid := n.list, n.list != nil && now.Before(n.list.ValidUntil)
+	var member *access.Member
+	if valid {
+		id, ok := n.keys[creds.UID]
+		if creds.UID == "" {
+			id, ok = creds.MemberID, true
+		}
+		if m, known := n.members[id]; ok && known {
+			member = &m
+		}
+	}
+	unknownTags := n.offlineUnknown
+	n.mu.Unlock()
+
+	if list == nil {
+		log.Warnf("No access list cached.")
+	} else if !valid {
+		log.Warnf("Cached access list expired at %s.", list.ValidUntil)
+	}
+	res := access.Decide(policy, lockdown, creds, member)
+	if res.Reason == access.ReasonUnknownTag && policy == access.PolicyTag && unknownTags == "allow" && !lockdown {
+		log.Warnf("Admitting unknown tag, see master.offline_unknown_tags.")
+		res = access.Result{Granted: true, Reason: access.ReasonOfflinePolicy}
+	}
+	return &Decision{
+		Granted:   res.Granted,
+		Keyholder: res.Keyholder,
+		MemberID:  res.MemberID,
+		Reason:    res.Reason,
+	}
+}
+
+// heartbeatLoop reports to the master every heartbeat interval until ctx is
+// done, keeping the access list up to date and uploading queued events.
+func (n *Node) heartbeatLoop(ctx context.Context) {
+	for {
+		n.sendHeartbeat(ctx)
+
+		n.mu.Lock()
+		interval := n.interval
+		n.mu.Unlock()
+		if !n.wait(ctx, interval) {
+			return
+		}
+	}
+}
+
+func (n *Node) sendHeartbeat(ctx context.Context) {
+	n.mu.Lock()
+	interval, timeout := n.interval, n.timeout
+	n.mu.Unlock()
+
+	hb := Heartbeat{
+		DoorID:            n.d.ID(),
+		Interval:          config.Duration{Duration: interval},
+		Relays:            n.d.Relays(),
+		Latches:           n.d.Latches(),
+		AccessListVersion: n.AccessListVersion(),
+		QueuedEvents:      n.queue.len(),
+	}
+	err := n.Health()
+	if err != nil {
+		hb.Error = err.Error()
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	res, err := n.client.Heartbeat(reqCtx, hb)
+	cancel()
+	n.setMasterErr(err)
+	if err != nil {
+		return
+	}
+
+	if n.needsAccessList(res.AccessListVersion) {
+		err = n.fetchAccessList(ctx)
+		if err != nil {
+			logging.Errorf("Failed to update access list: %s", err)
+		}
+	}
+	n.uploadEvents(ctx)
+}
+
+// needsAccessList returns whether the node should fetch its access list: if
+// the master has a different version or the cached list is past half its
+// validity.
+func (n *Node) needsAccessList(version string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.list == nil || n.list.Version != version {
+		return true
+	}
+	validity := n.list.ValidUntil.Sub(n.list.GeneratedAt)
+	return !n.clock.Now().Before(n.list.GeneratedAt.Add(validity / 2))
+}
+
+// fetchAccessList fetches, verifies, caches and applies the node's access
+// list.
+func (n *Node) fetchAccessList(ctx context.Context) error {
+	n.mu.Lock()
+	timeout, current := n.timeout, n.list
+	n.mu.Unlock()
+
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	sealed, err := n.client.AccessList(reqCtx)
+	cancel()
+	n.setMasterErr(err)
+	if err != nil {
+		return err
+	}
+	list, err := sealed.Open(n.secret)
+	if err != nil {
+		return err
+	}
+	if list.DoorID != n.d.ID() {
+		return fmt.Errorf("access list is for door %q", list.DoorID)
+	}
+	if current != nil && list.GeneratedAt.Before(current.GeneratedAt) {
+		return fmt.Errorf("access list generated at %s is older than the cached one", list.GeneratedAt)
+	}
+
+	err = writeFile(n.cachePath, sealed)
+	if err != nil {
+		logging.Errorf("Failed to cache access list: %s", err)
+	}
+	err = n.apply(list)
+	if err != nil {
+		return err
+	}
+	logging.Infof("Updated access list to version %s with %d keys and %d members.", list.Version, len(list.Keys), len(list.Members))
+	return nil
+}
+
+// loadCache applies the cached access list, if there is a valid one.
+func (n *Node) loadCache() {
+	_, list, err := loadAccessList(n.cachePath, n.secret)
+	if err != nil {
+		logging.Errorf("Ignoring cached access list %s: %s", n.cachePath, err)
+		return
+	}
+	if list == nil {
+		logging.Infof("No access list cached.")
+		return
+	}
+	if list.DoorID != n.d.ID() {
+		logging.Warnf("Ignoring cached access list of door %q.", list.DoorID)
+		return
+	}
+
+	err = n.apply(list)
+	if err != nil {
+		logging.Errorf("Failed to apply cached access list: %s", err)
+		return
+	}
+	logging.Infof("Loaded access list generated at %s from cache.", list.GeneratedAt)
+	if count := n.queue.len(); count > 0 {
+		logging.Infof("%d access events are waiting to be uploaded.", count)
+	}
+}
+
+// uploadEvents uploads queued access events in batches until the queue is
+// empty or a request fails.
+func (n *Node) uploadEvents(ctx context.Context) {
+	n.mu.Lock()
+	timeout := n.timeout
+	n.mu.Unlock()
+
+	uploaded := 0
+	for {
+		events := n.queue.peek(maxUploadBatch)
+		if len(events) == 0 {
+			break
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := n.client.Events(reqCtx, events)
+		cancel()
+		n.setMasterErr(err)
+		if err != nil {
+			logging.Errorf("Failed to upload access events: %s", err)
+			break
+		}
+		err = n.queue.drop(len(events))
+		if err != nil {
+			logging.Errorf("Failed to remove uploaded access events from queue: %s", err)
+			break
+		}
+		uploaded += len(events)
+	}
+	if uploaded > 0 {
+		logging.Infof("Uploaded %d queued access events.", uploaded)
+	}
+}
+
+// apply passes the mode and calendar of the access list to the door, if they
+// changed, and keeps the list's keys and members for offline decisions.
+func (n *Node) apply(list *AccessList) error {
+	state, err := list.ModeState()
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	modeChanged := state != n.mode
+	calendarChanged := !reflect.DeepEqual(list.Calendar, n.calendar)
+	n.mu.Unlock()
+
+	if modeChanged {
+		err = n.d.SetMode(state)
+		if err != nil {
+			return err
+		}
+		logging.Infof("Door %s is in %s mode.", n.d.ID(), state.At(n.clock.Now()))
+	}
+	if calendarChanged {
+		exceptions := []door.Exception{}
+		for _, entry := range list.Calendar {
+			exception, err := door.ParseException(entry.Date, entry.Kind, entry.Windows)
+			if err != nil {
+				logging.Warnf("Skipping invalid calendar entry %d: %s", entry.ID, err)
+				continue
+			}
+			exceptions = append(exceptions, exception)
+		}
+		n.cal.Set(exceptions)
+		logging.Infof("Loaded %d calendar entries from master.", len(exceptions))
+	}
+
+	keys := map[string]int64{}
+	for _, key := range list.Keys {
+		keys[key.UUID] = key.MemberID
+	}
+	members := map[int64]access.Member{}
+	for _, member := range list.Members {
+		members[member.ID] = member
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.mode = state
+	n.calendar = list.Calendar
+	n.list = list
+	n.keys = keys
+	n.members = members
+	return nil
+}
+
+// setMasterErr records the outcome of a request to the master and logs
+// changes of the master's reachability.
+func (n *Node) setMasterErr(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch {
+	case err == nil && n.masterErr != nil:
+		logging.Infof("Connected to master.")
+	case err != nil && (n.masterErr == nil || n.masterErr == errNotContacted):
+		logging.Warnf("Master unreachable: %s", err)
+	}
+	n.masterErr = err
+}
+
+// wait sleeps for d and returns true, or returns false once ctx is done.
+func (n *Node) wait(ctx context.Context, d time.Duration) bool {
+	timer := n.clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C():
+		return true
+	}
+}
+
+// recoverPanic stops the door if the access loop panics, which drives its
+// latches to their safe state. The panic is logged and not propagated, so
+// Health reports the stopped loop.
+//
+// Must be deferred directly by accessLoop.
+func (n *Node) recoverPanic(log *logging.Logger) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	log.Errorf("Access loop panicked: %v\n%s", p, debug.Stack())
+	err := n.d.Close()
+	if err != nil {
+		log.Errorf("Failed to close door: %s", err)
+	}
+}
@@ -0,0 +1,271 @@
+// Package node runs a door node: a device with its own reader and door that
+// leaves access decisions to the master.
+//
+// Nodes talk to the master's REST API under /api/nodes/<id>. Each request is
+// signed with a secret shared between the node and the master, see Sign, and
+// so is the master's response to it, see SignResponse. PINs and access lists
+// are encrypted with keys derived from the secret, see TagEvent.SealPIN and
+// SealAccessList.
+//
+// While the master is unreachable, a node decides with the last AccessList
+// it fetched and queues its decisions until it can upload them.
+package node
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pakohan/craftdoor/access"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/door"
+)
+
+const (
+	// HeaderTimestamp carries the time a request was signed, in seconds since
+	// the Unix epoch.
+	HeaderTimestamp = "X-Craftdoor-Timestamp"
+
+	// HeaderSignature carries the hex-encoded signature of a request or
+	// response.
+	HeaderSignature = "X-Craftdoor-Signature"
+
+	// MaxClockSkew is how far a request's timestamp may be from the master's
+	// clock. Older requests are rejected, which limits replays.
+	MaxClockSkew = 5 * time.Minute
+)
+
+// ErrBadSignature is returned by Verify and VerifyResponse if a request or
+// response isn't signed with the node's secret.
+var ErrBadSignature = errors.New("bad signature")
+
+// Sign returns the signature of a request: the hex-encoded HMAC-SHA256, keyed
+// with secret, of its method, path, timestamp and the SHA-256 of its body.
+func Sign(secret string, method string, path string, timestamp time.Time, body []byte) string {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%x", method, path, timestamp.Unix(), digest)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a request's timestamp and signature, as found in its
+// HeaderTimestamp and HeaderSignature headers, against the node's secret.
+func Verify(secret string, method string, path string, timestamp string, signature string, body []byte, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	t := time.Unix(seconds, 0)
+	if skew := now.Sub(t); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return fmt.Errorf("timestamp is %s off", skew)
+	}
+
+	want := Sign(secret, method, path, t, body)
+	if !hmac.Equal([]byte(want), []byte(signature)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// SignResponse returns the signature of the master's response to the request
+// signed with requestSignature: the hex-encoded HMAC-SHA256, keyed with
+// secret, of the request's signature, the response's status code and the
+// SHA-256 of its body. Binding it to the request keeps responses from being
+// replayed to other requests.
+func SignResponse(secret string, requestSignature string, status int, body []byte) string {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "response\n%s\n%d\n%x", requestSignature, status, digest)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyResponse checks the signature of the master's response to the
+// request signed with requestSignature, as found in its HeaderSignature
+// header.
+func VerifyResponse(secret string, requestSignature string, signature string, status int, body []byte) error {
+	want := SignResponse(secret, requestSignature, status, body)
+	if !hmac.Equal([]byte(want), []byte(signature)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Heartbeat is sent by a node every master.heartbeat_interval. The first
+// heartbeat registers the node with the master.
+type Heartbeat struct {
+	// ID of the node's door, its door.id.
+	DoorID string `json:"door_id"`
+
+	// How often the node sends heartbeats.
+	Interval config.Duration `json:"interval"`
+
+	// How the door's locks are wired.
+	Relays []door.RelayInfo `json:"relays"`
+
+	// Current state of the door's latches.
+	Latches []door.LatchState `json:"latches"`
+
+	// Why the node is unhealthy. Empty if healthy.
+	Error string `json:"error,omitempty"`
+
+	// Version of the access list the node has cached. Empty if none.
+	AccessListVersion string `json:"access_list_version"`
+
+	// Number of access events waiting to be uploaded.
+	QueuedEvents int `json:"queued_events"`
+}
+
+// HeartbeatResponse tells a node which access list to run its door with.
+type HeartbeatResponse struct {
+	// Version of the node's current access list. The node fetches the list
+	// when it doesn't have this version cached.
+	AccessListVersion string `json:"access_list_version"`
+}
+
+// TagEvent is sent by a node when credentials are presented at its door: a
+// tag, possibly followed by a PIN, or a member ID and PIN.
+type TagEvent struct {
+	// Hex-encoded UID of the tag. Empty under access.PolicyPIN.
+	UID string `json:"uid"`
+
+	// When the credentials were presented.
+	At time.Time `json:"at"`
+
+	// Auth policy of the node's door. Empty means access.PolicyTag.
+	Policy access.Policy `json:"policy,omitempty"`
+
+	// Member ID entered under access.PolicyPIN.
+	MemberID int64 `json:"member_id,omitempty"`
+
+	// Entered PIN, encrypted by SealPIN. Empty if none was entered.
+	EncryptedPIN string `json:"encrypted_pin,omitempty"`
+
+	// Entered PIN in plain text. Never sent, see SealPIN and OpenPIN.
+	PIN string `json:"-"`
+
+	// Whether the node's keypad is locked after too many wrong PINs.
+	LockedOut bool `json:"locked_out,omitempty"`
+}
+
+// Credentials returns the credentials presented at the node's door.
+func (e *TagEvent) Credentials() access.Credentials {
+	return access.Credentials{
+		UID:       e.UID,
+		MemberID:  e.MemberID,
+		PIN:       e.PIN,
+		LockedOut: e.LockedOut,
+	}
+}
+
+// SealPIN encrypts the event's PIN into EncryptedPIN with AES-256-GCM, keyed
+// with a key derived from the node's secret. The ciphertext is bound to the
+// event's UID, member ID and time, so it can't be moved to another event.
+func (e *TagEvent) SealPIN(secret string) error {
+	e.EncryptedPIN = ""
+	if e.PIN == "" {
+		return nil
+	}
+	aead, err := derivedCipher(secret, "pin")
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(e.PIN), e.pinData())
+	e.EncryptedPIN = base64.StdEncoding.EncodeToString(sealed)
+	return nil
+}
+
+// OpenPIN decrypts EncryptedPIN, as encrypted by SealPIN, into PIN.
+func (e *TagEvent) OpenPIN(secret string) error {
+	e.PIN = ""
+	if e.EncryptedPIN == "" {
+		return nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(e.EncryptedPIN)
+	if err != nil {
+		return fmt.Errorf("invalid encrypted PIN: %s", err)
+	}
+	aead, err := derivedCipher(secret, "pin")
+	if err != nil {
+		return err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return errors.New("invalid encrypted PIN: too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	pin, err := aead.Open(nil, nonce, ciphertext, e.pinData())
+	if err != nil {
+		return errors.New("invalid encrypted PIN: can't decrypt")
+	}
+	e.PIN = string(pin)
+	return nil
+}
+
+// derivedCipher returns the cipher encrypting data of the node with secret.
+// Each purpose, e.g. "pin", gets its own key.
+func derivedCipher(secret string, purpose string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pinData returns the data the event's encrypted PIN is bound to.
+func (e *TagEvent) pinData() []byte {
+	return []byte(fmt.Sprintf("%s\n%d\n%d", e.UID, e.MemberID, e.At.UnixNano()))
+}
+
+// Decision is the master's response to a TagEvent.
+type Decision struct {
+	// Whether the node should unlock its door.
+	Granted bool `json:"granted"`
+
+	// Whether the tag belongs to a keyholder, see door.Door.KeyholderIn.
+	Keyholder bool `json:"keyholder"`
+
+	// ID of the member the credentials identified. Nil if none.
+	MemberID *int64 `json:"member_id"`
+
+	// Why the door opens or not.
+	Reason access.Reason `json:"reason"`
+}
+
+// AccessEvent records a decision a node made on its own while the master was
+// unreachable.
+type AccessEvent struct {
+	// Hex-encoded UID of the tag. Empty under access.PolicyPIN.
+	UID string `json:"uid"`
+
+	// When the credentials were presented.
+	At time.Time `json:"at"`
+
+	// Whether the node unlocked its door.
+	Granted bool `json:"granted"`
+
+	// ID of the member the credentials identified. Nil if none.
+	MemberID *int64 `json:"member_id,omitempty"`
+
+	// Why the node unlocked its door or not. Empty for events queued by
+	// older nodes.
+	Reason access.Reason `json:"reason,omitempty"`
+}
+
+// AccessEvents is uploaded by a node once the master is reachable again.
+type AccessEvents struct {
+	Events []AccessEvent `json:"events"`
+}
@@ -0,0 +1,113 @@
+package node
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyResponse(t *testing.T) {
+	const secret = "test-secret-0123456789"
+	request := Sign(secret, "POST", "/api/nodes/workshop/tags", time.Unix(1600000000, 0), []byte(`{"uid":"04a1b2c3"}`))
+	body := []byte(`{"granted":true}`)
+	signature := SignResponse(secret, request, 200, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		request   string
+		signature string
+		status    int
+		body      string
+		wantErr   bool
+	}{
+		{"valid", secret, request, signature, 200, `{"granted":true}`, false},
+		{"unsigned", secret, request, "", 200, `{"granted":true}`, true},
+		{"other secret", "other-secret-0123456789", request, signature, 200, `{"granted":true}`, true},
+		{"other request", secret, Sign(secret, "POST", "/api/nodes/workshop/tags", time.Unix(1600000001, 0), nil), signature, 200, `{"granted":true}`, true},
+		{"other status", secret, request, signature, 400, `{"granted":true}`, true},
+		{"tampered body", secret, request, SignResponse(secret, request, 200, []byte(`{"granted":false}`)), 200, `{"granted":true}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyResponse(tt.secret, tt.request, tt.signature, tt.status, []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyResponse() = %v, want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSealPIN(t *testing.T) {
+	const secret = "test-secret-0123456789"
+	at := time.Date(2026, time.March, 2, 8, 0, 0, 123456789, time.UTC)
+	event := TagEvent{UID: "04a1b2c3", At: at, Policy: "tag+pin", PIN: "1234"}
+	err := event.SealPIN(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), `"pin"`) || strings.Contains(string(b), `"1234"`) || !strings.Contains(string(b), `"encrypted_pin"`) {
+		t.Fatalf("sent %s, want the PIN only encrypted", b)
+	}
+
+	received := TagEvent{}
+	err = json.Unmarshal(b, &received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = received.OpenPIN(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.PIN != "1234" {
+		t.Errorf("OpenPIN = %q, want 1234", received.PIN)
+	}
+
+	other := event
+	err = other.SealPIN(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.EncryptedPIN == event.EncryptedPIN {
+		t.Error("SealPIN returned the same ciphertext twice, want a random nonce")
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		modify func(e *TagEvent)
+	}{
+		{"wrong secret", "other-secret-0123456789", func(e *TagEvent) {}},
+		{"other UID", secret, func(e *TagEvent) { e.UID = "04a1b2c4" }},
+		{"other member", secret, func(e *TagEvent) { e.MemberID = 42 }},
+		{"other time", secret, func(e *TagEvent) { e.At = e.At.Add(time.Nanosecond) }},
+		{"tampered", secret, func(e *TagEvent) { e.EncryptedPIN = "A" + e.EncryptedPIN[1:] }},
+		{"truncated", secret, func(e *TagEvent) { e.EncryptedPIN = e.EncryptedPIN[:8] }},
+		{"not base64", secret, func(e *TagEvent) { e.EncryptedPIN = "!!" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := event
+			tt.modify(&e)
+			err := e.OpenPIN(tt.secret)
+			if err == nil || e.PIN != "" {
+				t.Errorf("OpenPIN = %q, %v, want error", e.PIN, err)
+			}
+		})
+	}
+
+	empty := TagEvent{UID: "04a1b2c3", At: at}
+	err = empty.SealPIN(secret)
+	if err != nil || empty.EncryptedPIN != "" {
+		t.Errorf("SealPIN without PIN = %q, %v, want empty", empty.EncryptedPIN, err)
+	}
+	err = empty.OpenPIN(secret)
+	if err != nil || empty.PIN != "" {
+		t.Errorf("OpenPIN without PIN = %q, %v, want empty", empty.PIN, err)
+	}
+}
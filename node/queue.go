@@ -0,0 +1,78 @@
+package node
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pakohan/craftdoor/logging"
+)
+
+// maxQueuedEvents limits how many events a node keeps while the master is
+// unreachable. The oldest events are dropped first.
+const maxQueuedEvents = 10000
+
+// queue holds access events until they are uploaded to the master. The
+// events are persisted in a file, so they survive restarts.
+type queue struct {
+	path string
+
+	mu     sync.Mutex
+	events []AccessEvent
+}
+
+// openQueue returns the queue persisted at path. A missing or unreadable
+// file yields an empty queue.
+func openQueue(path string) *queue {
+	q := &queue{path: path, events: []AccessEvent{}}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q
+	}
+	if err == nil {
+		err = json.Unmarshal(b, &q.events)
+	}
+	if err != nil {
+		logging.Errorf("Discarding unreadable event queue %s: %s", path, err)
+		q.events = []AccessEvent{}
+	}
+	return q
+}
+
+// push appends e to the queue.
+func (q *queue) push(e AccessEvent) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events = append(q.events, e)
+	if dropped := len(q.events) - maxQueuedEvents; dropped > 0 {
+		logging.Warnf("Event queue is full. Dropping %d oldest events.", dropped)
+		q.events = q.events[dropped:]
+	}
+	return writeFile(q.path, q.events)
+}
+
+// peek returns up to n of the oldest events.
+func (q *queue) peek(n int) []AccessEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n > len(q.events) {
+		n = len(q.events)
+	}
+	return append([]AccessEvent(nil), q.events[:n]...)
+}
+
+// drop removes the n oldest events, which must have been returned by peek.
+func (q *queue) drop(n int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events = q.events[n:]
+	return writeFile(q.path, q.events)
+}
+
+// len returns the number of queued events.
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events)
+}
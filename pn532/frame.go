@@ -0,0 +1,129 @@
+package pn532
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Frame identifiers, the first byte of a frame's body.
+const (
+	hostToPN532 = 0xD4
+	pn532ToHost = 0xD5
+)
+
+// maxFrameLen is the length of the longest frame read over I2C and SPI, whose
+// reads must have a fixed length. Longer responses are rejected.
+const maxFrameLen = 64
+
+// startCode starts every frame, after an optional preamble of 0x00.
+var startCode = []byte{0x00, 0xFF}
+
+// Errors returned by Dev. Test for them with errors.Is.
+var (
+	// ErrTimeout means the PN532 didn't answer in time.
+	ErrTimeout = errors.New("pn532: timeout waiting for response")
+
+	// ErrFrame means a frame was malformed or unexpected, e.g. because its
+	// checksum doesn't match.
+	ErrFrame = errors.New("pn532: malformed frame")
+
+	// ErrSyntax means the PN532 rejected a command as malformed.
+	ErrSyntax = errors.New("pn532: command rejected")
+)
+
+// Status codes of StatusError.
+const (
+	// StatusTimeout means the card didn't answer.
+	StatusTimeout = 0x01
+
+	// StatusAuth means a MIFARE card rejected the key for a sector.
+	StatusAuth = 0x14
+)
+
+// StatusError is returned when a command sent to a card failed.
+type StatusError struct {
+	// Error code reported by the PN532, e.g. StatusAuth.
+	Code byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("pn532: card error 0x%02x", e.Code)
+}
+
+// encodeFrame returns the normal information frame sending data, a command
+// and its parameters, to the PN532:
+//
+//	00 00 FF LEN LCS D4 data... DCS 00
+func encodeFrame(data []byte) ([]byte, error) {
+	body := append([]byte{hostToPN532}, data...)
+	if len(body) > 0xFF {
+		return nil, fmt.Errorf("pn532: %d-byte command doesn't fit in a frame", len(data))
+	}
+	frame := []byte{0x00, 0x00, 0xFF, byte(len(body)), -byte(len(body))}
+	frame = append(frame, body...)
+	return append(frame, checksum(body), 0x00), nil
+}
+
+// checksum returns the byte that makes b sum up to 0.
+func checksum(b []byte) byte {
+	var sum byte
+	for _, c := range b {
+		sum += c
+	}
+	return -sum
+}
+
+// decodeFrame returns the data, a response code and its parameters, of a
+// frame sent by the PN532, or ack if it is an ACK frame.
+func decodeFrame(frame []byte) (data []byte, ack bool, err error) {
+	i := bytes.Index(frame, startCode)
+	if i < 0 {
+		return nil, false, fmt.Errorf("%w: no start code in % x", ErrFrame, frame)
+	}
+	rest := frame[i+len(startCode):]
+	if len(rest) < 2 {
+		return nil, false, fmt.Errorf("%w: truncated frame % x", ErrFrame, frame)
+	}
+	length, lcs := rest[0], rest[1]
+	switch {
+	case length == 0x00 && lcs == 0xFF:
+		return nil, true, nil
+	case length == 0xFF && lcs == 0x00:
+		return nil, false, fmt.Errorf("%w: NACK", ErrFrame)
+	case length == 0xFF && lcs == 0xFF:
+		return nil, false, fmt.Errorf("%w: extended frames are not supported", ErrFrame)
+	case length+lcs != 0:
+		return nil, false, fmt.Errorf("%w: length checksum mismatch in % x", ErrFrame, frame)
+	}
+	rest = rest[2:]
+	if len(rest) < int(length)+1 {
+		return nil, false, fmt.Errorf("%w: truncated frame % x", ErrFrame, frame)
+	}
+	body := rest[:length]
+	if len(body) == 0 {
+		return nil, false, fmt.Errorf("%w: empty frame", ErrFrame)
+	}
+	if checksum(body) != rest[length] {
+		return nil, false, fmt.Errorf("%w: data checksum mismatch in % x", ErrFrame, frame)
+	}
+	if len(body) == 1 && body[0] == 0x7F {
+		return nil, false, ErrSyntax
+	}
+	if body[0] != pn532ToHost {
+		return nil, false, fmt.Errorf("%w: unexpected frame identifier 0x%02x", ErrFrame, body[0])
+	}
+	return body[1:], false, nil
+}
+
+// frameLen returns the length of the frame starting with header, its start
+// code, LEN and LCS.
+func frameLen(header []byte) int {
+	length, lcs := header[2], header[3]
+	if length == 0x00 && lcs == 0xFF || length == 0xFF && lcs == 0x00 {
+		// ACK or NACK, followed by the postamble.
+		return 5
+	}
+	// Body, DCS and postamble.
+	return 4 + int(length) + 2
+}
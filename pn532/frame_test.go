@@ -0,0 +1,122 @@
+package pn532
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestEncodeFrame(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		// SAMConfiguration, normal mode, 1s timeout, IRQ.
+		{"14011401", "0000ff05fbd4140114010200"},
+		// GetFirmwareVersion.
+		{"02", "0000ff02fed4022a00"},
+		// InListPassiveTarget, one target at 106 kbps type A.
+		{"4a0100", "0000ff04fcd44a0100e100"},
+		// Only the frame identifier.
+		{"", "0000ff01ffd42c00"},
+	}
+	for _, tt := range tests {
+		got, err := encodeFrame(mustDecodeHex(tt.data))
+		if err != nil {
+			t.Errorf("encodeFrame(%s) returned %s", tt.data, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("encodeFrame(%s) = %x, want %s", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeFrameTooLong(t *testing.T) {
+	frame, err := encodeFrame(make([]byte, 254))
+	if err != nil {
+		t.Fatalf("encodeFrame(254 bytes) returned %s", err)
+	}
+	if frame[3] != 0xFF || frame[4] != 0x01 {
+		t.Errorf("encodeFrame(254 bytes) has LEN %02x and LCS %02x, want ff and 01", frame[3], frame[4])
+	}
+
+	_, err = encodeFrame(make([]byte, 255))
+	if err == nil {
+		t.Error("encodeFrame(255 bytes) succeeded, want error")
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   string
+		data    string
+		ack     bool
+		wantErr error
+	}{
+		{name: "ack", frame: "0000ff00ff00", ack: true},
+		{name: "ack after I2C status", frame: "010000ff00ff00", ack: true},
+		{name: "ack after SPI padding", frame: "000000ff00ff00", ack: true},
+		{name: "response", frame: "0000ff06fad50332010607e800", data: "0332010607"},
+		{name: "response after I2C status", frame: "010000ff02fed5151600", data: "15"},
+		{name: "response with padding", frame: "0000ff02fed533f800000000", data: "33"},
+
+		{name: "nack", frame: "0000ffff0000", wantErr: ErrFrame},
+		{name: "extended frame", frame: "0000ffffff0006fad50332010607e800", wantErr: ErrFrame},
+		{name: "length checksum mismatch", frame: "0000ff06fbd50332010607e800", wantErr: ErrFrame},
+		{name: "data checksum mismatch", frame: "0000ff06fad50332010607e900", wantErr: ErrFrame},
+		{name: "data checksum missing", frame: "0000ff06fad50332010607", wantErr: ErrFrame},
+		{name: "truncated body", frame: "0000ff06fad50332", wantErr: ErrFrame},
+		{name: "truncated header", frame: "0000ff06", wantErr: ErrFrame},
+		{name: "no start code", frame: "000000000000", wantErr: ErrFrame},
+		{name: "empty", frame: "", wantErr: ErrFrame},
+		{name: "empty body", frame: "0000ff000000", wantErr: ErrFrame},
+		{name: "syntax error", frame: "0000ff01ff7f8100", wantErr: ErrSyntax},
+		{name: "frame sent by host", frame: "0000ff02fed4022a00", wantErr: ErrFrame},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, ack, err := decodeFrame(mustDecodeHex(tt.frame))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("decodeFrame(%s) returned %v, want %s", tt.frame, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeFrame(%s) returned %s", tt.frame, err)
+			}
+			if ack != tt.ack || !bytes.Equal(data, mustDecodeHex(tt.data)) {
+				t.Errorf("decodeFrame(%s) = %x, ack %t, want %s, ack %t", tt.frame, data, ack, tt.data, tt.ack)
+			}
+		})
+	}
+}
+
+func TestFrameLen(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"00ff00ff", 5},
+		{"00ffff00", 5},
+		{"00ff06fa", 12},
+		{"00ff01ff", 7},
+	}
+	for _, tt := range tests {
+		got := frameLen(mustDecodeHex(tt.header))
+		if got != tt.want {
+			t.Errorf("frameLen(%s) = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,252 @@
+// Package pn532 drives NXP PN532 NFC controllers over I2C, SPI or UART.
+//
+// The host sends each command in a frame, which the PN532 acknowledges with
+// an ACK frame before it sends the response in another frame. See the PN532
+// user manual, UM0701-02, for the frame formats and commands.
+package pn532
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Commands sent to the PN532.
+const (
+	cmdGetFirmwareVersion  = 0x02
+	cmdSAMConfiguration    = 0x14
+	cmdRFConfiguration     = 0x32
+	cmdInDataExchange      = 0x40
+	cmdInListPassiveTarget = 0x4A
+	cmdInRelease           = 0x52
+)
+
+// MIFARE Classic commands sent to cards with InDataExchange.
+const (
+	// MifareAuthA and MifareAuthB authenticate with key A or B of a sector.
+	MifareAuthA = 0x60
+	MifareAuthB = 0x61
+
+	mifareRead = 0x30
+)
+
+const (
+	// ackTimeout is how long the PN532 may take to acknowledge a command.
+	ackTimeout = 100 * time.Millisecond
+
+	// commandTimeout is how long the PN532 may take to answer commands that
+	// don't talk to cards.
+	commandTimeout = time.Second
+)
+
+// Dev is a PN532 connected by a Transport.
+type Dev struct {
+	t Transport
+
+	// Serializes commands.
+	mu sync.Mutex
+}
+
+// New returns a PN532 connected by t. Call SAMConfiguration before anything
+// else to wake it up.
+func New(t Transport) *Dev {
+	return &Dev{t: t}
+}
+
+// String returns a human-readable string describing the device.
+func (d *Dev) String() string {
+	return fmt.Sprintf("PN532 on %s", d.t)
+}
+
+// Close closes the transport.
+func (d *Dev) Close() error {
+	return d.t.Close()
+}
+
+// command sends cmd with params and returns the response's parameters.
+func (d *Dev) command(timeout time.Duration, cmd byte, params ...byte) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	frame, err := encodeFrame(append([]byte{cmd}, params...))
+	if err != nil {
+		return nil, err
+	}
+	err = d.t.WriteFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := d.t.ReadFrame(ackTimeout)
+	if err != nil {
+		return nil, err
+	}
+	_, ack, err := decodeFrame(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !ack {
+		return nil, fmt.Errorf("%w: expected ACK for command 0x%02x", ErrFrame, cmd)
+	}
+
+	raw, err = d.t.ReadFrame(timeout)
+	if err != nil {
+		return nil, err
+	}
+	data, ack, err := decodeFrame(raw)
+	if err != nil {
+		return nil, err
+	}
+	if ack || len(data) == 0 || data[0] != cmd+1 {
+		return nil, fmt.Errorf("%w: unexpected response to command 0x%02x: % x", ErrFrame, cmd, data)
+	}
+	return data[1:], nil
+}
+
+// SAMConfiguration wakes the PN532 up and makes it act as a reader.
+func (d *Dev) SAMConfiguration() error {
+	// Normal mode, a virtual card timeout of 1s and the IRQ pin in use.
+	_, err := d.command(commandTimeout, cmdSAMConfiguration, 0x01, 0x14, 0x01)
+	return err
+}
+
+// Firmware describes the PN532's firmware.
+type Firmware struct {
+	// IC is 0x32 for a PN532.
+	IC       byte
+	Version  byte
+	Revision byte
+
+	// Bit field of the supported card types.
+	Support byte
+}
+
+// String returns e.g. "PN532 v1.6".
+func (f Firmware) String() string {
+	return fmt.Sprintf("PN5%02x v%d.%d", f.IC, f.Version, f.Revision)
+}
+
+// FirmwareVersion returns the PN532's firmware version.
+func (d *Dev) FirmwareVersion() (Firmware, error) {
+	resp, err := d.command(commandTimeout, cmdGetFirmwareVersion)
+	if err != nil {
+		return Firmware{}, err
+	}
+	if len(resp) != 4 {
+		return Firmware{}, fmt.Errorf("%w: firmware version % x", ErrFrame, resp)
+	}
+	return Firmware{IC: resp[0], Version: resp[1], Revision: resp[2], Support: resp[3]}, nil
+}
+
+// SetPassiveRetries sets how often ListTarget retries to activate a card
+// before it reports none. 0xFF retries forever.
+func (d *Dev) SetPassiveRetries(retries byte) error {
+	// Item MaxRetries: ATR_REQ retries, PSL_REQ retries, passive activation
+	// retries.
+	_, err := d.command(commandTimeout, cmdRFConfiguration, 0x05, 0xFF, 0x01, retries)
+	return err
+}
+
+// Target is an ISO14443A card activated by ListTarget.
+type Target struct {
+	// Logical number the PN532 assigned to the card.
+	Number byte
+
+	// Answer to request (SENS_RES) and select acknowledge (SEL_RES), which
+	// identify the card's type.
+	ATQA uint16
+	SAK  byte
+
+	// The card's UID, 4, 7 or 10 bytes.
+	UID []byte
+
+	// Answer to select of ISO14443-4 cards, e.g. DESFire. Nil for others.
+	ATS []byte
+}
+
+// ListTarget activates an ISO14443A card at 106 kbps. Returns nil if there is
+// none, after the retries set by SetPassiveRetries.
+func (d *Dev) ListTarget(timeout time.Duration) (*Target, error) {
+	// One target at 106 kbps type A.
+	resp, err := d.command(timeout, cmdInListPassiveTarget, 0x01, 0x00)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("%w: empty target list", ErrFrame)
+	}
+	if resp[0] == 0 {
+		return nil, nil
+	}
+	// NbTg, Tg, SENS_RES (2), SEL_RES, NFCIDLength, NFCID, ATS.
+	if len(resp) < 6 || len(resp) < 6+int(resp[5]) {
+		return nil, fmt.Errorf("%w: truncated target % x", ErrFrame, resp)
+	}
+	t := &Target{
+		Number: resp[1],
+		ATQA:   uint16(resp[2])<<8 | uint16(resp[3]),
+		SAK:    resp[4],
+		UID:    append([]byte(nil), resp[6:6+resp[5]]...),
+	}
+	if ats := resp[6+resp[5]:]; len(ats) > 0 {
+		t.ATS = append([]byte(nil), ats...)
+	}
+	return t, nil
+}
+
+// DataExchange sends data to the card tg and returns its answer. Returns a
+// *StatusError if the card didn't answer properly.
+func (d *Dev) DataExchange(tg byte, data []byte, timeout time.Duration) ([]byte, error) {
+	resp, err := d.command(timeout, cmdInDataExchange, append([]byte{tg}, data...)...)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("%w: missing status", ErrFrame)
+	}
+	if status := resp[0] & 0x3F; status != 0 {
+		return nil, &StatusError{Code: status}
+	}
+	return resp[1:], nil
+}
+
+// MifareAuth authenticates block of MIFARE Classic card t with key, using key
+// A or B as selected by keyType.
+func (d *Dev) MifareAuth(t *Target, keyType byte, block byte, key [6]byte, timeout time.Duration) error {
+	if len(t.UID) < 4 {
+		return fmt.Errorf("pn532: %d-byte UID is too short for MIFARE Classic", len(t.UID))
+	}
+	data := append([]byte{keyType, block}, key[:]...)
+	// Cards with 7-byte UIDs authenticate with the last 4 bytes.
+	data = append(data, t.UID[len(t.UID)-4:]...)
+	_, err := d.DataExchange(t.Number, data, timeout)
+	return err
+}
+
+// MifareRead reads a 16-byte block of MIFARE Classic card t, which must have
+// been authenticated.
+func (d *Dev) MifareRead(t *Target, block byte, timeout time.Duration) ([]byte, error) {
+	data, err := d.DataExchange(t.Number, []byte{mifareRead, block}, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 16 {
+		return nil, fmt.Errorf("%w: read %d bytes of block %d, want 16", ErrFrame, len(data), block)
+	}
+	return data, nil
+}
+
+// Release deactivates card t.
+func (d *Dev) Release(t *Target) error {
+	resp, err := d.command(commandTimeout, cmdInRelease, t.Number)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 1 {
+		return fmt.Errorf("%w: release status % x", ErrFrame, resp)
+	}
+	if status := resp[0] & 0x3F; status != 0 {
+		return &StatusError{Code: status}
+	}
+	return nil
+}
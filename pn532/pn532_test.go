@@ -0,0 +1,305 @@
+package pn532
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Transcripts of sessions with a PN532 v1.6 and a MIFARE Classic 1K card
+// whose UID is 922e5832, byte for byte as they appear on each bus. The frames
+// follow the PN532 user manual, UM0701-02: the host writes a command, polls
+// the status until the PN532 is ready, reads the ACK, polls again and reads
+// the response. Reads over I2C and SPI have a fixed length and are padded.
+//
+// Each session configures the PN532, reads its firmware version, sets the
+// passive retries and lists and releases the card. The I2C session then reads
+// block 4, the trailer of sector 1 at block 7 and fails to authenticate block
+// 8.
+var (
+	// Reads a frame over SPI: the data read operation, reversed, and padding
+	// clocking out the frame.
+	spiRead = "c0" + strings.Repeat("00", 64)
+
+	i2cSession = []Exchange{
+		exchange("0000ff05fbd4140114010200", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff02fed5151600"),
+		exchange("0000ff02fed4022a00", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff06fad50332010607e800"),
+		exchange("0000ff06fad43205ff0101f400", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff02fed533f800"),
+		exchange("0000ff04fcd44a0100e100", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff0cf4d54b010100040804922e58328400"),
+		exchange("0000ff03fdd45201d900", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff03fdd55300d800"),
+		exchange("0000ff04fcd44a0100e100", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff0cf4d54b010100040804922e58328400"),
+		exchange("0000ff0ff1d440016104ffffffffffff922e58324200", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff03fdd54100ea00"),
+		exchange("0000ff05fbd440013004b700", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff13edd54100101112131415161718191a1b1c1d1e1f7200"),
+		exchange("0000ff03fdd45201d900", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff03fdd55300d800"),
+		exchange("0000ff04fcd44a0100e100", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff0cf4d54b010100040804922e58328400"),
+		exchange("0000ff0ff1d440016107ffffffffffff922e58323f00", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff03fdd54100ea00"),
+		exchange("0000ff05fbd440013007b400", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff13edd54100000000000000ff078069ffffffffffff0100"),
+		exchange("0000ff03fdd45201d900", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff03fdd55300d800"),
+		exchange("0000ff04fcd44a0100e100", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff0cf4d54b010100040804922e58328400"),
+		exchange("0000ff0ff1d440016108ffffffffffff922e58323e00", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff03fdd54114d600"),
+		exchange("0000ff03fdd45201d900", ""),
+		exchange("", "01"),
+		exchange("", "010000ff00ff00"),
+		exchange("", "01"),
+		exchange("", "010000ff03fdd55300d800"),
+	}
+
+	spiSession = []Exchange{
+		exchange("800000ffa0df2b288028804000", ""),
+		exchange("4000", "0080"),
+		exchange(spiRead, "000000ff00ff00"),
+		exchange("4000", "0080"),
+		exchange(spiRead, "000000ff407faba86800"),
+		exchange("800000ff407f2b405400", ""),
+		exchange("4000", "0080"),
+		exchange(spiRead, "000000ff00ff00"),
+		exchange("4000", "0080"),
+		exchange(spiRead, "000000ff605fabc04c8060e01700"),
+		exchange("800000ff605f2b4ca0ff80802f00", ""),
+		exchange("4000", "0080"),
+		exchange(spiRead, "000000ff00ff00"),
+		exchange("4000", "0080"),
+		exchange(spiRead, "000000ff407fabcc1f00"),
+		exchange("800000ff203f2b5280008700", ""),
+		exchange("4000", "0080"),
+		exchange(spiRead, "000000ff00ff00"),
+		exchange("4000", "0080"),
+		exchange(spiRead, "000000ff302fabd280800020102049741a4c2100"),
+		exchange("800000ffc0bf2b4a809b00", ""),
+		exchange("4000", "0080"),
+		exchange(spiRead, "000000ff00ff00"),
+		exchange("4000", "0080"),
+		exchange(spiRead, "000000ffc0bfabca001b00"),
+	}
+
+	uartSession = []Exchange{
+		exchange("555500000000000000000000000000000000ff05fbd4140114010200", "0000ff00ff000000ff02fed5151600"),
+		exchange("0000ff02fed4022a00", "0000ff00ff000000ff06fad50332010607e800"),
+		exchange("0000ff06fad43205ff0101f400", "0000ff00ff000000ff02fed533f800"),
+		exchange("0000ff04fcd44a0100e100", "0000ff00ff000000ff0cf4d54b010100040804922e58328400"),
+		exchange("0000ff03fdd45201d900", "0000ff00ff000000ff03fdd55300d800"),
+	}
+)
+
+// exchange decodes the hex-encoded bytes of a transcript.
+func exchange(write, read string) Exchange {
+	return Exchange{Write: mustDecodeHex(write), Read: mustDecodeHex(read)}
+}
+
+var (
+	testUID     = mustDecodeHex("922e5832")
+	testBlock   = mustDecodeHex("101112131415161718191a1b1c1d1e1f")
+	testTrailer = mustDecodeHex("000000000000ff078069ffffffffffff")
+	testKey     = [6]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+)
+
+func TestTranscripts(t *testing.T) {
+	tests := []struct {
+		name       string
+		transcript []Exchange
+		transport  func(bus *Replay) Transport
+		run        func(t *testing.T, d *Dev)
+	}{
+		{"i2c", i2cSession, func(bus *Replay) Transport { return NewI2C(bus) }, readBlocks},
+		{"spi", spiSession, func(bus *Replay) Transport { return NewSPI(bus) }, listTarget},
+		{"uart", uartSession, func(bus *Replay) Transport { return NewUART(bus) }, listTarget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewReplay(tt.name, tt.transcript)
+			d := New(tt.transport(bus))
+			initialize(t, d)
+			tt.run(t, d)
+			err := d.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = bus.Done()
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// initialize configures d and checks its firmware version.
+func initialize(t *testing.T, d *Dev) {
+	err := d.SAMConfiguration()
+	if err != nil {
+		t.Fatalf("SAMConfiguration: %s", err)
+	}
+	fw, err := d.FirmwareVersion()
+	if err != nil {
+		t.Fatalf("FirmwareVersion: %s", err)
+	}
+	if fw.String() != "PN532 v1.6" || fw.Support != 0x07 {
+		t.Errorf("FirmwareVersion = %s supporting 0x%02x, want PN532 v1.6 supporting 0x07", fw, fw.Support)
+	}
+	err = d.SetPassiveRetries(0x01)
+	if err != nil {
+		t.Fatalf("SetPassiveRetries: %s", err)
+	}
+}
+
+// listTarget lists the transcripts' card and releases it.
+func listTarget(t *testing.T, d *Dev) {
+	tg := mustListTarget(t, d)
+	mustRelease(t, d, tg)
+}
+
+// readBlocks reads block 4 and the trailer of sector 1 of the transcripts'
+// card and fails to authenticate block 8.
+func readBlocks(t *testing.T, d *Dev) {
+	listTarget(t, d)
+
+	for _, want := range []struct {
+		block byte
+		data  []byte
+	}{{4, testBlock}, {7, testTrailer}} {
+		tg := mustListTarget(t, d)
+		err := d.MifareAuth(tg, MifareAuthB, want.block, testKey, time.Second)
+		if err != nil {
+			t.Fatalf("MifareAuth(%d): %s", want.block, err)
+		}
+		data, err := d.MifareRead(tg, want.block, time.Second)
+		if err != nil {
+			t.Fatalf("MifareRead(%d): %s", want.block, err)
+		}
+		if !bytes.Equal(data, want.data) {
+			t.Errorf("MifareRead(%d) = %x, want %x", want.block, data, want.data)
+		}
+		mustRelease(t, d, tg)
+	}
+
+	tg := mustListTarget(t, d)
+	err := d.MifareAuth(tg, MifareAuthB, 8, testKey, time.Second)
+	var status *StatusError
+	if !errors.As(err, &status) || status.Code != StatusAuth {
+		t.Errorf("MifareAuth(8) returned %v, want status 0x%02x", err, StatusAuth)
+	}
+	mustRelease(t, d, tg)
+}
+
+func mustListTarget(t *testing.T, d *Dev) *Target {
+	tg, err := d.ListTarget(time.Second)
+	if err != nil {
+		t.Fatalf("ListTarget: %s", err)
+	}
+	if tg == nil {
+		t.Fatal("ListTarget found no card")
+	}
+	if tg.Number != 1 || tg.ATQA != 0x0004 || tg.SAK != 0x08 || !bytes.Equal(tg.UID, testUID) || tg.ATS != nil {
+		t.Fatalf("ListTarget = %+v, want card 1 with ATQA 0004, SAK 08 and UID %x", tg, testUID)
+	}
+	return tg
+}
+
+func mustRelease(t *testing.T, d *Dev, tg *Target) {
+	err := d.Release(tg)
+	if err != nil {
+		t.Fatalf("Release: %s", err)
+	}
+}
+
+// TestCommandErrors checks that GetFirmwareVersion fails if the PN532 doesn't
+// acknowledge it or sends a malformed response.
+func TestCommandErrors(t *testing.T) {
+	const (
+		ack      = "0000ff00ff00"
+		response = "0000ff06fad50332010607e800"
+	)
+	write := hex.EncodeToString(uartWakeup) + "0000ff02fed4022a00"
+	tests := []struct {
+		name    string
+		read    string
+		wantErr error
+	}{
+		{"nack", "0000ffff0000", ErrFrame},
+		{"response without ack", response, ErrFrame},
+		{"syntax error instead of ack", "0000ff01ff7f8100", ErrSyntax},
+		{"length checksum mismatch", ack + "0000ff06fbd50332010607e800", ErrFrame},
+		{"data checksum mismatch", ack + "0000ff06fad50332010607e900", ErrFrame},
+		{"syntax error", ack + "0000ff01ff7f8100", ErrSyntax},
+		{"ack instead of response", ack + ack, ErrFrame},
+		{"response to another command", ack + "0000ff02fed533f800", ErrFrame},
+		{"frame sent by host", ack + "0000ff02fed4022a00", ErrFrame},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewReplay("uart", []Exchange{exchange(write, tt.read)})
+			_, err := New(NewUART(bus)).FirmwareVersion()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("FirmwareVersion returned %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	bus := NewReplay("uart", []Exchange{exchange(write, ack+response)})
+	_, err := New(NewUART(bus)).FirmwareVersion()
+	if err != nil {
+		t.Errorf("FirmwareVersion returned %s", err)
+	}
+}
@@ -0,0 +1,146 @@
+package pn532
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"periph.io/x/periph/conn"
+)
+
+// Exchange is one step of a transcript: the bytes the host writes, and the
+// bytes the PN532 answers with.
+type Exchange struct {
+	Write []byte
+	Read  []byte
+}
+
+// Replay is a bus playing back a transcript of the exchanges with a PN532,
+// to check a transport's framing without hardware. It is a conn.Conn for
+// NewI2C and NewSPI, and a Port for NewUART.
+//
+// For conn.Conn, each transaction is an exchange. Reads may be longer than
+// the recorded bytes, which are padded with zeros. For Port, each write is an
+// exchange, whose bytes are then read from the port.
+type Replay struct {
+	name string
+
+	// Guards all fields below.
+	mu        sync.Mutex
+	exchanges []Exchange
+
+	// Bytes yet to be read from the port.
+	pending []byte
+
+	// First deviation from the transcript.
+	err error
+}
+
+// NewReplay returns a bus playing back exchanges. name describes the bus.
+func NewReplay(name string, exchanges []Exchange) *Replay {
+	return &Replay{name: name, exchanges: exchanges}
+}
+
+// next returns the next exchange if w matches it.
+//
+// Must be called with mu held.
+func (r *Replay) next(w []byte) (Exchange, error) {
+	if r.err != nil {
+		return Exchange{}, r.err
+	}
+	if len(r.exchanges) == 0 {
+		r.err = fmt.Errorf("replay %s: unexpected write past transcript: % x", r.name, w)
+		return Exchange{}, r.err
+	}
+	e := r.exchanges[0]
+	if !bytes.Equal(w, e.Write) {
+		r.err = fmt.Errorf("replay %s: wrote % x, want % x", r.name, w, e.Write)
+		return Exchange{}, r.err
+	}
+	r.exchanges = r.exchanges[1:]
+	return e, nil
+}
+
+// Tx plays back a transaction.
+func (r *Replay) Tx(w, read []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, err := r.next(w)
+	if err != nil {
+		return err
+	}
+	if len(read) < len(e.Read) {
+		r.err = fmt.Errorf("replay %s: read %d bytes, want at least %d", r.name, len(read), len(e.Read))
+		return r.err
+	}
+	n := copy(read, e.Read)
+	for i := n; i < len(read); i++ {
+		read[i] = 0
+	}
+	return nil
+}
+
+// Duplex returns conn.DuplexUnknown.
+func (r *Replay) Duplex() conn.Duplex {
+	return conn.DuplexUnknown
+}
+
+// Write plays back a write to the port.
+func (r *Replay) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, err := r.next(p)
+	if err != nil {
+		return 0, err
+	}
+	r.pending = append(r.pending, e.Read...)
+	return len(p), nil
+}
+
+// Read reads the answers to earlier writes to the port.
+func (r *Replay) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return 0, r.err
+	}
+	if len(r.pending) == 0 {
+		r.err = fmt.Errorf("replay %s: unexpected read past transcript", r.name)
+		return 0, r.err
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// SetReadDeadline does nothing. Answers are available immediately.
+func (r *Replay) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// Close does nothing.
+func (r *Replay) Close() error {
+	return nil
+}
+
+// String returns the name of the bus.
+func (r *Replay) String() string {
+	return r.name
+}
+
+// Done returns the first deviation from the transcript, or an error if parts
+// of it were not played back.
+func (r *Replay) Done() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.err != nil:
+		return r.err
+	case len(r.exchanges) > 0:
+		return fmt.Errorf("replay %s: %d exchanges left, next writes % x", r.name, len(r.exchanges), r.exchanges[0].Write)
+	case len(r.pending) > 0:
+		return fmt.Errorf("replay %s: % x left unread", r.name, r.pending)
+	}
+	return nil
+}
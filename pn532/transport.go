@@ -0,0 +1,306 @@
+package pn532
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pakohan/craftdoor/serial"
+	"periph.io/x/periph/conn"
+	"periph.io/x/periph/conn/i2c"
+	"periph.io/x/periph/conn/i2c/i2creg"
+	"periph.io/x/periph/conn/physic"
+	"periph.io/x/periph/conn/spi"
+	"periph.io/x/periph/conn/spi/spireg"
+)
+
+// I2CAddr is the PN532's address on the I2C bus.
+const I2CAddr = 0x24
+
+// pollInterval is how often the I2C and SPI transports poll the PN532's
+// status while waiting for a frame.
+const pollInterval = 2 * time.Millisecond
+
+// SPI operations, the first byte of each transaction.
+const (
+	spiDataWrite  = 0x01
+	spiStatusRead = 0x02
+	spiDataRead   = 0x03
+)
+
+// uartWakeup wakes up a PN532 connected by UART before the first frame.
+var uartWakeup = []byte{0x55, 0x55, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+// Transport exchanges frames with a PN532 over one of its interfaces.
+type Transport interface {
+	// Sends a frame.
+	WriteFrame(frame []byte) error
+
+	// Returns the next frame sent by the PN532. Returns ErrTimeout if none
+	// arrived within timeout. The frame may be followed by padding.
+	ReadFrame(timeout time.Duration) ([]byte, error)
+
+	// Closes the underlying bus or port, if the transport opened it.
+	Close() error
+
+	String() string
+}
+
+// i2cTransport reads a status byte before each frame. Reads have a fixed
+// length, so frames are followed by padding.
+type i2cTransport struct {
+	c      conn.Conn
+	closer io.Closer
+}
+
+// NewI2C returns a transport for a PN532 at I2CAddr on c, such as an i2c.Dev.
+func NewI2C(c conn.Conn) Transport {
+	return &i2cTransport{c: c}
+}
+
+// OpenI2C opens the I2C bus name, or the first bus if name is "", and returns
+// a transport for a PN532 on it.
+func OpenI2C(name string) (Transport, error) {
+	bus, err := i2creg.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &i2cTransport{c: &i2c.Dev{Bus: bus, Addr: I2CAddr}, closer: bus}, nil
+}
+
+func (t *i2cTransport) WriteFrame(frame []byte) error {
+	return t.c.Tx(frame, nil)
+}
+
+func (t *i2cTransport) ReadFrame(timeout time.Duration) ([]byte, error) {
+	err := waitReady(timeout, func() (bool, error) {
+		status := make([]byte, 1)
+		err := t.c.Tx(nil, status)
+		return status[0]&0x01 != 0, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The frame follows another status byte.
+	buf := make([]byte, 1+maxFrameLen)
+	err = t.c.Tx(nil, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[1:], nil
+}
+
+func (t *i2cTransport) Close() error {
+	if t.closer == nil {
+		return nil
+	}
+	return t.closer.Close()
+}
+
+func (t *i2cTransport) String() string {
+	return t.c.String()
+}
+
+// spiTransport prefixes each transaction with the operation. The PN532 sends
+// and expects the least significant bit first, which the SPI controllers of
+// most hosts don't support, so bytes are reversed in software. Reads have a
+// fixed length, so frames are followed by padding.
+type spiTransport struct {
+	c      conn.Conn
+	closer io.Closer
+}
+
+// NewSPI returns a transport for a PN532 on c, an SPI connection in mode 0
+// with 8 bits per word.
+func NewSPI(c conn.Conn) Transport {
+	return &spiTransport{c: c}
+}
+
+// OpenSPI opens the SPI port name, or the first port if name is "", and
+// returns a transport for a PN532 on it.
+func OpenSPI(name string) (Transport, error) {
+	port, err := spireg.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := port.Connect(physic.MegaHertz, spi.Mode0, 8)
+	if err != nil {
+		e := port.Close()
+		if e != nil {
+			err = fmt.Errorf("%s, and closing port: %s", err, e)
+		}
+		return nil, err
+	}
+	return &spiTransport{c: c, closer: port}, nil
+}
+
+// tx sends op followed by w and returns the bytes read after op.
+func (t *spiTransport) tx(op byte, w []byte) ([]byte, error) {
+	buf := append([]byte{op}, w...)
+	reverseBits(buf)
+	r := make([]byte, len(buf))
+	err := t.c.Tx(buf, r)
+	if err != nil {
+		return nil, err
+	}
+	reverseBits(r)
+	return r[1:], nil
+}
+
+func (t *spiTransport) WriteFrame(frame []byte) error {
+	_, err := t.tx(spiDataWrite, frame)
+	return err
+}
+
+func (t *spiTransport) ReadFrame(timeout time.Duration) ([]byte, error) {
+	err := waitReady(timeout, func() (bool, error) {
+		status, err := t.tx(spiStatusRead, []byte{0x00})
+		if err != nil {
+			return false, err
+		}
+		return status[0]&0x01 != 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.tx(spiDataRead, make([]byte, maxFrameLen))
+}
+
+func (t *spiTransport) Close() error {
+	if t.closer == nil {
+		return nil
+	}
+	return t.closer.Close()
+}
+
+func (t *spiTransport) String() string {
+	return t.c.String()
+}
+
+// reverseBits reverses the order of the bits in each byte of b.
+func reverseBits(b []byte) {
+	for i, c := range b {
+		var r byte
+		for j := 0; j < 8; j++ {
+			r = r<<1 | c>>uint(j)&0x01
+		}
+		b[i] = r
+	}
+}
+
+// waitReady polls ready until it returns true or timeout passes.
+func waitReady(timeout time.Duration, ready func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := ready()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrTimeout
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Port is a serial port, such as the *os.File returned by OpenUART.
+type Port interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+}
+
+// uartTransport sends a wakeup sequence before the first frame and reads
+// frames from the stream as they arrive.
+type uartTransport struct {
+	p     Port
+	awake bool
+}
+
+// NewUART returns a transport for a PN532 on p, a serial port set to 115200
+// baud, 8N1.
+func NewUART(p Port) Transport {
+	return &uartTransport{p: p}
+}
+
+// OpenUART opens the serial device path, e.g. "/dev/serial0", and returns a
+// transport for a PN532 on it.
+func OpenUART(path string) (Transport, error) {
+	f, err := serial.Open(path, 115200)
+	if err != nil {
+		return nil, err
+	}
+	return &uartTransport{p: f}, nil
+}
+
+func (t *uartTransport) WriteFrame(frame []byte) error {
+	if !t.awake {
+		frame = append(append([]byte(nil), uartWakeup...), frame...)
+	}
+	_, err := t.p.Write(frame)
+	if err != nil {
+		return err
+	}
+	t.awake = true
+	return nil
+}
+
+func (t *uartTransport) ReadFrame(timeout time.Duration) ([]byte, error) {
+	err := t.p.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip the preamble and anything else before the start code.
+	b := make([]byte, 1)
+	var last byte = 0xFF
+	for {
+		_, err = io.ReadFull(t.p, b)
+		if err != nil {
+			return nil, uartError(err)
+		}
+		if last == startCode[0] && b[0] == startCode[1] {
+			break
+		}
+		last = b[0]
+	}
+
+	header := append([]byte(nil), startCode...)
+	header = append(header, 0, 0)
+	_, err = io.ReadFull(t.p, header[len(startCode):])
+	if err != nil {
+		return nil, uartError(err)
+	}
+	frame := make([]byte, frameLen(header))
+	copy(frame, header)
+	_, err = io.ReadFull(t.p, frame[len(header):])
+	if err != nil {
+		return nil, uartError(err)
+	}
+	return frame, nil
+}
+
+// uartError returns ErrTimeout if err is the read deadline passing.
+func uartError(err error) error {
+	if os.IsTimeout(err) {
+		return ErrTimeout
+	}
+	return err
+}
+
+func (t *uartTransport) Close() error {
+	return t.p.Close()
+}
+
+func (t *uartTransport) String() string {
+	if s, ok := t.p.(fmt.Stringer); ok {
+		return s.String()
+	}
+	if f, ok := t.p.(*os.File); ok {
+		return f.Name()
+	}
+	return "UART"
+}
@@ -0,0 +1,186 @@
+package rfid
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CardType is the type of a card, which determines how its memory is laid
+// out. The values are stored with keys.
+type CardType string
+
+// Card types detected by readers.
+const (
+	// CardUnknown is reported by readers that can't tell card types apart,
+	// and for cards of other types. Its memory is read like a MIFARE Classic
+	// 1K's, the only type supported by older versions.
+	CardUnknown CardType = "unknown"
+
+	// CardClassic1K and CardClassic4K are MIFARE Classic cards with 1 KB
+	// and 4 KB of memory, whose sectors are protected by keys.
+	CardClassic1K CardType = "mifare_classic_1k"
+	CardClassic4K CardType = "mifare_classic_4k"
+
+	// CardUltralight is a MIFARE Ultralight or NTAG21x card, such as most
+	// NFC stickers. Their memory is read in 4-byte pages without keys.
+	CardUltralight CardType = "ultralight"
+
+	// CardDESFire is a MIFARE DESFire card, or a phone emulating one. Their
+	// memory holds files protected by keys the door doesn't have, so only
+	// the UID is read.
+	CardDESFire CardType = "desfire"
+)
+
+// cardTypes lists the supported card types.
+var cardTypes = []CardType{CardUnknown, CardClassic1K, CardClassic4K, CardUltralight, CardDESFire}
+
+// ParseCardType returns the card type named s.
+func ParseCardType(s string) (CardType, error) {
+	for _, t := range cardTypes {
+		if CardType(s) == t {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown card type %q", s)
+}
+
+// DetectCardType returns the type of an ISO14443A card from its answer to
+// request (ATQA) and select acknowledge (SAK), following NXP's AN10833.
+func DetectCardType(atqa uint16, sak byte) CardType {
+	switch {
+	// Bit 4 of the SAK is set for 4K cards, bit 3 for all MIFARE Classic
+	// cards, even if they also support ISO14443-4 like SmartMX cards.
+	case sak&0x18 == 0x18:
+		return CardClassic4K
+	case sak&0x08 != 0:
+		return CardClassic1K
+	// Bit 5 means the card speaks ISO14443-4. Phones emulating cards use
+	// different ATQAs than DESFire cards.
+	case sak&0x20 != 0:
+		return CardDESFire
+	case sak == 0x00 && atqa == 0x0044:
+		return CardUltralight
+	default:
+		return CardUnknown
+	}
+}
+
+// Card is a card in front of a reader.
+type Card struct {
+	UID  []byte
+	Type CardType
+}
+
+// Layout describes the memory of a card type as sectors of blocks. Readers
+// address blocks by sector and block within the sector, as laid out here.
+type Layout struct {
+	// Number of data blocks in each sector, not counting trailers.
+	Sectors []int
+
+	// Size of a block in bytes.
+	BlockSize int
+
+	// Whether each sector ends with a trailer holding its keys and access
+	// bits, see ReadAuthBlock.
+	Trailers bool
+}
+
+// errNoBlocks is returned when reading the memory of cards without blocks.
+var errNoBlocks = errors.New("card has no memory readable as blocks")
+
+// Layout returns the layout of the card type's memory.
+func (t CardType) Layout() Layout {
+	switch t {
+	case CardClassic4K:
+		// 32 sectors of 4 blocks, then 8 sectors of 16 blocks.
+		sectors := make([]int, 40)
+		for i := range sectors {
+			sectors[i] = 3
+			if i >= 32 {
+				sectors[i] = 15
+			}
+		}
+		return Layout{Sectors: sectors, BlockSize: 16, Trailers: true}
+	case CardUltralight:
+		// The first 16 pages, which all Ultralight and NTAG21x cards have:
+		// the UID, lock and capability bytes, and the first user pages. Each
+		// sector is the 4 pages returned by one read command.
+		return Layout{Sectors: []int{4, 4, 4, 4}, BlockSize: 4}
+	case CardDESFire:
+		return Layout{}
+	default:
+		sectors := make([]int, NumSectors)
+		for i := range sectors {
+			sectors[i] = NumDataBlocksPerSector
+		}
+		return Layout{Sectors: sectors, BlockSize: NumBytesPerBlock, Trailers: true}
+	}
+}
+
+// DataBlocks returns the number of data blocks in sector.
+func (l Layout) DataBlocks(sector int) int {
+	return l.Sectors[sector]
+}
+
+// Size returns the number of bytes in all data blocks.
+func (l Layout) Size() int {
+	return l.Offset(len(l.Sectors))
+}
+
+// Offset returns the offset of the first data block of sector in the
+// concatenated data blocks of all sectors.
+func (l Layout) Offset(sector int) int {
+	offset := 0
+	for _, blocks := range l.Sectors[:sector] {
+		offset += blocks * l.BlockSize
+	}
+	return offset
+}
+
+// Address returns the address of block in sector on the card, counting
+// trailers. The trailer of a sector is its block DataBlocks(sector).
+func (l Layout) Address(sector int, block int) int {
+	address := 0
+	for _, blocks := range l.Sectors[:sector] {
+		address += blocks
+		if l.Trailers {
+			address++
+		}
+	}
+	return address + block
+}
+
+// CheckSector returns an error unless sector is on the card.
+func (l Layout) CheckSector(sector int) error {
+	if len(l.Sectors) == 0 {
+		return errNoBlocks
+	}
+	if sector < 0 || sector >= len(l.Sectors) {
+		return fmt.Errorf("invalid sector: %d", sector)
+	}
+	return nil
+}
+
+// CheckBlock returns an error unless block is a data block of sector.
+func (l Layout) CheckBlock(sector int, block int) error {
+	err := l.CheckSector(sector)
+	if err != nil {
+		return err
+	}
+	if block < 0 || block >= l.Sectors[sector] {
+		return fmt.Errorf("invalid block: %d", block)
+	}
+	return nil
+}
+
+// CheckTrailer returns an error unless sector has a trailer.
+func (l Layout) CheckTrailer(sector int) error {
+	err := l.CheckSector(sector)
+	if err != nil {
+		return err
+	}
+	if !l.Trailers {
+		return errors.New("card has no sector trailers")
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package rfid
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// credentialIDLengths lists the lengths of credential IDs in bytes:
+// Wiegand-26 card numbers have 3 bytes, EM4100 card numbers 5, and ISO14443A
+// UIDs 4, 7 or 10, which also covers Wiegand-34 card numbers.
+var credentialIDLengths = map[int]bool{3: true, 4: true, 5: true, 7: true, 10: true}
+
+// CredentialID identifies a key by its UID or card number, as lowercase hex.
+// Keys are stored and looked up by their CredentialID, so all readers and the
+// API must agree on it.
+//
+// When decoded from JSON, a CredentialID is parsed with ParseCredentialID.
+type CredentialID string
+
+// NewCredentialID returns the credential ID of a card read by a reader.
+func NewCredentialID(uid []byte) (CredentialID, error) {
+	if !credentialIDLengths[len(uid)] {
+		return "", fmt.Errorf("UID %x has %d bytes, want 3, 4, 5, 7 or 10", uid, len(uid))
+	}
+	return CredentialID(hex.EncodeToString(uid)), nil
+}
+
+// ParseCredentialID returns the credential ID written as s. Besides hex,
+// optionally prefixed by "0x" and with bytes separated by ":", "-" or
+// spaces, the formats printed on cards are accepted:
+//
+//	dec:0012345678  the card number in decimal, as sent by keyboard wedges
+//	188,24910       the facility code and card number of Wiegand-26 cards
+func ParseCredentialID(s string) (CredentialID, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "dec:"):
+		uid, err := decodeCardNumber("decimal", strings.TrimPrefix(s, "dec:"))
+		if err != nil {
+			return "", fmt.Errorf("invalid card number %q: %s", s, err)
+		}
+		return NewCredentialID(uid)
+	case strings.Contains(s, ","):
+		return parseWiegand26(s)
+	}
+
+	digits := strings.NewReplacer(":", "", "-", "", " ", "").Replace(s)
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		digits = digits[2:]
+	}
+	uid, err := hex.DecodeString(digits)
+	if err != nil {
+		return "", fmt.Errorf("invalid UID %q: %s", s, err)
+	}
+	return NewCredentialID(uid)
+}
+
+// parseWiegand26 parses the "<facility>,<card>" numbers printed on
+// Wiegand-26 cards into the 3 bytes read by WiegandReader.
+func parseWiegand26(s string) (CredentialID, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid card number %q: want <facility>,<card>", s)
+	}
+	facility, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid facility code %q: %s", parts[0], err)
+	}
+	card, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid card number %q: %s", parts[1], err)
+	}
+	return NewCredentialID([]byte{byte(facility), byte(card >> 8), byte(card)})
+}
+
+// String returns the ID as lowercase hex.
+func (id CredentialID) String() string {
+	return string(id)
+}
+
+// Validate returns an error unless id is a credential ID in its canonical
+// form, as returned by NewCredentialID.
+func (id CredentialID) Validate() error {
+	parsed, err := ParseCredentialID(string(id))
+	if err != nil {
+		return err
+	}
+	if parsed != id {
+		return fmt.Errorf("credential ID %q isn't normalized, want %q", string(id), parsed)
+	}
+	return nil
+}
+
+// UnmarshalJSON parses a credential ID from a JSON string in any of the
+// formats accepted by ParseCredentialID.
+func (id *CredentialID) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	*id, err = ParseCredentialID(s)
+	return err
+}
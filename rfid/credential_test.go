@@ -0,0 +1,118 @@
+package rfid
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewCredentialID(t *testing.T) {
+	for n := 0; n <= 16; n++ {
+		uid := make([]byte, n)
+		for i := range uid {
+			uid[i] = byte(0xa0 + i)
+		}
+		id, err := NewCredentialID(uid)
+		valid := n == 3 || n == 4 || n == 5 || n == 7 || n == 10
+		if valid != (err == nil) {
+			t.Errorf("NewCredentialID(%d bytes) = %q, %v, want valid: %t", n, id, err, valid)
+		}
+	}
+}
+
+func TestParseCredentialID(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    CredentialID
+		wantErr bool
+	}{
+		// Wiegand-26, ISO14443A single, double and triple size, EM4100.
+		{in: "c0ffee", want: "c0ffee"},
+		{in: "04a1b2c3", want: "04a1b2c3"},
+		{in: "04a1b2c3d4e5f6", want: "04a1b2c3d4e5f6"},
+		{in: "04a1b2c3d4e5f6a7b8c9", want: "04a1b2c3d4e5f6a7b8c9"},
+		{in: "35c17053d7", want: "35c17053d7"},
+
+		// Other spellings of hex.
+		{in: "04:A1:B2:C3", want: "04a1b2c3"},
+		{in: "04-a1-b2-c3", want: "04a1b2c3"},
+		{in: " 04 a1 b2 c3 ", want: "04a1b2c3"},
+		{in: "0x04A1B2C3", want: "04a1b2c3"},
+		{in: "0X04a1b2c3", want: "04a1b2c3"},
+
+		// Numbers printed on cards.
+		{in: "dec:0012345678", want: "00bc614e"},
+		{in: "dec:4294967295", want: "ffffffff"},
+		{in: "188,24910", want: "bc614e"},
+		{in: "192, 65518", want: "c0ffee"},
+		{in: "0,0", want: "000000"},
+
+		// Unsupported lengths.
+		{in: "", wantErr: true},
+		{in: "0102", wantErr: true},
+		{in: "010203040506", wantErr: true},
+		{in: "0102030405060708", wantErr: true},
+		{in: "010203040506070809", wantErr: true},
+		{in: "0102030405060708090a0b", wantErr: true},
+		{in: "00000000000000000000000000000000", wantErr: true},
+		{in: "dec:1099511627776", wantErr: true},
+
+		// Malformed.
+		{in: "04a1b2c", wantErr: true},
+		{in: "04a1b2cg", wantErr: true},
+		{in: "dec:", wantErr: true},
+		{in: "dec:12x4", wantErr: true},
+		{in: "dec:-1", wantErr: true},
+		{in: "256,1", wantErr: true},
+		{in: "1,65536", wantErr: true},
+		{in: "1,2,3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseCredentialID(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCredentialID(%q) = %q, %v, want error: %t", tt.in, got, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCredentialID(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialIDValidate(t *testing.T) {
+	tests := []struct {
+		id      CredentialID
+		wantErr bool
+	}{
+		{"04a1b2c3", false},
+		{"04A1B2C3", true},
+		{"04:a1:b2:c3", true},
+		{"dec:0012345678", true},
+		{"0102", true},
+	}
+	for _, tt := range tests {
+		err := tt.id.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q.Validate() = %v, want error: %t", tt.id, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCredentialIDUnmarshalJSON(t *testing.T) {
+	var key struct {
+		UUID CredentialID `json:"uuid"`
+	}
+	err := json.NewDecoder(strings.NewReader(`{"uuid": "04:A1:B2:C3"}`)).Decode(&key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.UUID != "04a1b2c3" {
+		t.Errorf("decoded %q, want 04a1b2c3", key.UUID)
+	}
+
+	err = json.Unmarshal([]byte(`{"uuid": "0102"}`), &key)
+	if err == nil {
+		t.Error("decoding a 2-byte UID succeeded, want error")
+	}
+}
@@ -0,0 +1,49 @@
+package rfid
+
+import (
+	"sync"
+	"time"
+)
+
+// Debouncer suppresses repeated reads of a tag held in front of the reader.
+//
+// A tag is handled if it hasn't been seen for longer than the window. Every
+// read, handled or not, restarts the tag's window, so a tag held in front of
+// the reader is handled once until it is removed.
+type Debouncer struct {
+	mu       sync.Mutex
+	window   time.Duration
+	lastSeen map[string]time.Time
+}
+
+// NewDebouncer returns a Debouncer with the given window.
+func NewDebouncer(window time.Duration) *Debouncer {
+	return &Debouncer{
+		window:   window,
+		lastSeen: map[string]time.Time{},
+	}
+}
+
+// SetWindow changes the debounce window.
+func (d *Debouncer) SetWindow(window time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.window = window
+}
+
+// Seen records a read of uid at now and returns true if it should be handled.
+func (d *Debouncer) Seen(uid string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Forget tags that have been removed.
+	for other, t := range d.lastSeen {
+		if now.Sub(t) > d.window {
+			delete(d.lastSeen, other)
+		}
+	}
+
+	_, held := d.lastSeen[uid]
+	d.lastSeen[uid] = now
+	return !held
+}
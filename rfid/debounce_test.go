@@ -0,0 +1,49 @@
+package rfid
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDebouncer(t *testing.T) {
+	start := time.Date(2026, time.January, 5, 12, 0, 0, 0, time.UTC)
+	reads := []struct {
+		uid  string
+		at   time.Duration
+		want bool
+	}{
+		{"04a1b2c3", 0, true},
+		// Held in front of the reader.
+		{"04a1b2c3", 500 * time.Millisecond, false},
+		{"04a1b2c3", 1200 * time.Millisecond, false},
+		// A different tag is handled at once.
+		{"04d4d4d4", 1300 * time.Millisecond, true},
+		{"04d4d4d4", 1400 * time.Millisecond, false},
+		// Not read for exactly the window.
+		{"04a1b2c3", 2200 * time.Millisecond, false},
+		// Not read for longer than the window.
+		{"04a1b2c3", 3300 * time.Millisecond, true},
+		{"04d4d4d4", 3300 * time.Millisecond, true},
+	}
+	d := NewDebouncer(time.Second)
+	for _, r := range reads {
+		if got := d.Seen(r.uid, start.Add(r.at)); got != r.want {
+			t.Errorf("Seen(%s) after %s = %t, want %t", r.uid, r.at, got, r.want)
+		}
+	}
+}
+
+// TestDebouncerForgetsTags checks that tags are forgotten once their window
+// passed, so that reads of many different tags don't grow its memory.
+func TestDebouncerForgetsTags(t *testing.T) {
+	start := time.Date(2026, time.January, 5, 12, 0, 0, 0, time.UTC)
+	d := NewDebouncer(time.Second)
+	for i := 0; i < 1000; i++ {
+		d.Seen(fmt.Sprintf("%08x", i), start.Add(time.Duration(i)*100*time.Millisecond))
+	}
+	// Tags read within the last second: 10 plus the current one.
+	if n := len(d.lastSeen); n > 11 {
+		t.Errorf("Debouncer remembers %d tags, want at most 11", n)
+	}
+}
@@ -0,0 +1,47 @@
+package rfid
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of errors returned by Readers. Test for them with errors.Is.
+var (
+	// ErrTimeout means no card was presented before the timeout.
+	ErrTimeout = errors.New("rfid: timeout waiting for card")
+
+	// ErrTransient means communication with the reader failed in a way that
+	// may succeed if retried, possibly after re-initializing the reader.
+	ErrTransient = errors.New("rfid: transient reader error")
+
+	// ErrNoCard means a card was detected but didn't answer properly, e.g.
+	// because it was removed while being read.
+	ErrNoCard = errors.New("rfid: card did not respond")
+
+	// ErrAuth means the card rejected the key for a sector.
+	ErrAuth = errors.New("rfid: card authentication failed")
+)
+
+// Error is an error from a reader's driver, classified as one of the kinds
+// above.
+type Error struct {
+	// One of ErrTimeout, ErrTransient, ErrNoCard or ErrAuth.
+	Kind error
+
+	// Error returned by the driver.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+// Unwrap returns the driver's error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the error's kind.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
@@ -0,0 +1,229 @@
+package rfid
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+)
+
+func init() {
+	config.RegisterValidator(func(cfg *config.Config) error {
+		if cfg.Reader.Type != "evdev" {
+			return nil
+		}
+		if cfg.Reader.Evdev.Device == "" {
+			return errors.New("reader.evdev.device is required")
+		}
+		err := validateEncoding(cfg.Reader.Evdev.Encoding)
+		if err != nil {
+			return fmt.Errorf("reader.evdev.encoding: %s", err)
+		}
+		return nil
+	})
+}
+
+// Event types and key codes of Linux input events, see
+// linux/input-event-codes.h.
+const (
+	evKey = 0x01
+
+	keyEnter   = 28
+	keyKPEnter = 96
+)
+
+// keyChars maps the codes of the keys typed by keyboard wedges to their
+// characters.
+var keyChars = map[uint16]byte{
+	2: '1', 3: '2', 4: '3', 5: '4', 6: '5', 7: '6', 8: '7', 9: '8', 10: '9', 11: '0',
+	79: '1', 80: '2', 81: '3', 75: '4', 76: '5', 77: '6', 71: '7', 72: '8', 73: '9', 82: '0',
+	30: 'a', 48: 'b', 46: 'c', 32: 'd', 18: 'e', 33: 'f',
+}
+
+// ignoredKeys are typed along with the characters but don't change them,
+// such as shift for upper case hex digits.
+var ignoredKeys = map[uint16]bool{
+	42: true, // KEY_LEFTSHIFT
+	54: true, // KEY_RIGHTSHIFT
+}
+
+// inputEventSize is the size of struct input_event: a timestamp, the type,
+// the code and the value.
+const inputEventSize = int(unsafe.Sizeof(syscall.Timeval{})) + 8
+
+// EvdevReader is a Reader for USB readers acting as a keyboard, also known
+// as keyboard wedges, which type the number of each card followed by Enter.
+// Most of them read 125 kHz EM4100 cards.
+//
+// It reads the key presses from a Linux input device, which it grabs so that
+// they don't reach the console.
+type EvdevReader struct {
+	stream streamReader
+	device string
+}
+
+// NewEvdevReader returns a reader for the input device opened by open. Call
+// Initialize to start reading.
+func NewEvdevReader(cfg config.EvdevReaderConfig, open func() (io.ReadCloser, error), clk clock.Clock) *EvdevReader {
+	r := &EvdevReader{device: cfg.Device}
+	r.stream = streamReader{
+		name:  r.String(),
+		open:  open,
+		clock: clk,
+		split: splitKeys,
+		decode: func(msg string) ([]byte, error) {
+			return decodeCardNumber(cfg.Encoding, msg)
+		},
+	}
+	return r
+}
+
+// OpenEvdev returns a function opening and grabbing the input device selected
+// by cfg, for NewEvdevReader. Files that aren't devices, such as FIFOs used
+// for testing, aren't grabbed.
+func OpenEvdev(cfg config.EvdevReaderConfig) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		f, err := os.Open(cfg.Device)
+		if err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return nil, closeAfter(f, err)
+		}
+		if info.Mode()&os.ModeCharDevice == 0 {
+			return f, nil
+		}
+		err = grab(f)
+		if err != nil {
+			return nil, closeAfter(f, fmt.Errorf("grabbing %s: %s", cfg.Device, err))
+		}
+		return f, nil
+	}
+}
+
+// closeAfter closes f and returns err.
+func closeAfter(f *os.File, err error) error {
+	e := f.Close()
+	if e != nil {
+		return fmt.Errorf("%s, and closing %s: %s", err, f.Name(), e)
+	}
+	return err
+}
+
+// splitKeys returns a function returning the characters typed on the input
+// device r up to the next Enter. Unknown keys are returned as '?', so that
+// the message fails to decode.
+func splitKeys(r io.Reader) func() (string, error) {
+	br := bufio.NewReader(r)
+	event := make([]byte, inputEventSize)
+	return func() (string, error) {
+		var msg strings.Builder
+		for {
+			_, err := io.ReadFull(br, event)
+			if err != nil {
+				return "", err
+			}
+			data := event[inputEventSize-8:]
+			typ := binary.LittleEndian.Uint16(data[0:])
+			code := binary.LittleEndian.Uint16(data[2:])
+			value := int32(binary.LittleEndian.Uint32(data[4:]))
+			// Only key presses, not releases or repeats.
+			if typ != evKey || value != 1 || ignoredKeys[code] {
+				continue
+			}
+			if code == keyEnter || code == keyKPEnter {
+				return msg.String(), nil
+			}
+			c, ok := keyChars[code]
+			if !ok {
+				c = '?'
+			}
+			msg.WriteByte(c)
+		}
+	}
+}
+
+// KeyEvents returns the input events a keyboard wedge sends when typing text
+// followed by Enter. text may contain digits and lower case hex digits. Used
+// to simulate readers.
+func KeyEvents(text string) ([]byte, error) {
+	codes := map[byte]uint16{}
+	for code, c := range keyChars {
+		// Prefer the number row over the keypad.
+		if other, ok := codes[c]; !ok || code < other {
+			codes[c] = code
+		}
+	}
+	var events []byte
+	press := func(code uint16) {
+		for _, value := range []uint32{1, 0} {
+			event := make([]byte, inputEventSize)
+			data := event[inputEventSize-8:]
+			binary.LittleEndian.PutUint16(data[0:], evKey)
+			binary.LittleEndian.PutUint16(data[2:], code)
+			binary.LittleEndian.PutUint32(data[4:], value)
+			events = append(events, event...)
+		}
+	}
+	for i := 0; i < len(text); i++ {
+		code, ok := codes[text[i]]
+		if !ok {
+			return nil, fmt.Errorf("no key for %q", text[i])
+		}
+		press(code)
+	}
+	press(keyEnter)
+	return events, nil
+}
+
+// Initialize opens the input device, unless the reader already reads it.
+func (r *EvdevReader) Initialize() error {
+	return r.stream.initialize()
+}
+
+// Halt closes the input device.
+func (r *EvdevReader) Halt() error {
+	return r.stream.halt()
+}
+
+// ReadUID waits for the next card number. Numbers that can't be decoded are
+// logged and skipped.
+func (r *EvdevReader) ReadUID(timeout time.Duration) ([]byte, error) {
+	return r.stream.readUID(timeout)
+}
+
+// ReadCard reads the UID of the next card. Keyboard wedges don't report the
+// type, so it is unknown.
+func (r *EvdevReader) ReadCard(timeout time.Duration) (*Card, error) {
+	return readUnknownCard(r, timeout)
+}
+
+// ReadDataBlocks returns an error. Keyboard wedges don't read card memory.
+func (r *EvdevReader) ReadDataBlocks(timeout time.Duration, sector int) ([]byte, error) {
+	return nil, errNoMemory
+}
+
+// ReadDataBlock returns an error. Keyboard wedges don't read card memory.
+func (r *EvdevReader) ReadDataBlock(timeout time.Duration, sector int, block int) ([]byte, error) {
+	return nil, errNoMemory
+}
+
+// ReadAuthBlock returns an error. Keyboard wedges don't read card memory.
+func (r *EvdevReader) ReadAuthBlock(timeout time.Duration, sector int) (*AuthBlock, error) {
+	return nil, errNoMemory
+}
+
+// String returns a human-readable string describing this Reader.
+func (r *EvdevReader) String() string {
+	return fmt.Sprintf("keyboard wedge on %s", r.device)
+}
@@ -0,0 +1,28 @@
+package rfid
+
+import (
+	"os"
+	"syscall"
+)
+
+// eviocgrab is the EVIOCGRAB ioctl, which grabs an input device exclusively.
+const eviocgrab = 0x40044590
+
+// grab grabs the input device f, so that its events are only delivered to f.
+func grab(f *os.File) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, eviocgrab, 1)
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
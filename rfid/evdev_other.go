@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package rfid
+
+import (
+	"errors"
+	"os"
+)
+
+// grab returns an error. Input devices are only supported on Linux.
+func grab(f *os.File) error {
+	return errors.New("input devices are only supported on Linux")
+}
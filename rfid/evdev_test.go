@@ -0,0 +1,199 @@
+package rfid
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+)
+
+// Event types, key codes and values of Linux input events recorded from
+// keyboard wedges, besides those in evdev.go.
+const (
+	evSyn = 0x00
+	evMsc = 0x04
+
+	mscScan = 0x04
+
+	keyX         = 45
+	keyKP0       = 82
+	keyKP1       = 79
+	keyKP2       = 80
+	keyKP5       = 76
+	keyLeftShift = 42
+
+	valueRelease = 0
+	valuePress   = 1
+	valueRepeat  = 2
+)
+
+// recording builds input events the way a keyboard wedge sends them, with
+// timestamps and scan codes and a SYN_REPORT after each key event.
+type recording struct {
+	events []byte
+	t      time.Time
+}
+
+// event appends an input_event.
+func (r *recording) event(typ, code uint16, value int32) {
+	event := make([]byte, inputEventSize)
+	// struct timeval, two native longs.
+	half := (inputEventSize - 8) / 2
+	if half == 8 {
+		binary.LittleEndian.PutUint64(event[0:], uint64(r.t.Unix()))
+		binary.LittleEndian.PutUint64(event[8:], uint64(r.t.Nanosecond()/1000))
+	} else {
+		binary.LittleEndian.PutUint32(event[0:], uint32(r.t.Unix()))
+		binary.LittleEndian.PutUint32(event[4:], uint32(r.t.Nanosecond()/1000))
+	}
+	data := event[inputEventSize-8:]
+	binary.LittleEndian.PutUint16(data[0:], typ)
+	binary.LittleEndian.PutUint16(data[2:], code)
+	binary.LittleEndian.PutUint32(data[4:], uint32(value))
+	r.events = append(r.events, event...)
+	r.t = r.t.Add(time.Millisecond)
+}
+
+// key appends a key event preceded by an MSC_SCAN event and followed by a
+// SYN_REPORT.
+func (r *recording) key(code uint16, value int32) {
+	r.event(evMsc, mscScan, 0x70000+int32(code))
+	r.event(evKey, code, value)
+	r.event(evSyn, 0, 0)
+}
+
+// press appends a press and release of each key.
+func (r *recording) press(codes ...uint16) {
+	for _, code := range codes {
+		r.key(code, valuePress)
+		r.key(code, valueRelease)
+	}
+}
+
+// pipeReader returns a function opening the read end of a pipe, for
+// NewEvdevReader and NewSerialReader, and its write end.
+func pipeReader(t *testing.T) (func() (io.ReadCloser, error), *os.File) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pr.Close()
+		pw.Close()
+	})
+	return func() (io.ReadCloser, error) { return pr, nil }, pw
+}
+
+// expectUIDs expects r to read uids, then to time out.
+func expectUIDs(t *testing.T, r Reader, uids ...string) {
+	for _, want := range uids {
+		uid, err := r.ReadUID(time.Second)
+		if err != nil {
+			t.Fatalf("ReadUID returned %s, want %s", err, want)
+		}
+		if hex.EncodeToString(uid) != want {
+			t.Errorf("ReadUID = %x, want %s", uid, want)
+		}
+	}
+	_, err := r.ReadUID(50 * time.Millisecond)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("ReadUID returned %v, want %s", err, ErrTimeout)
+	}
+}
+
+// expectClosed closes w and expects r to report the failed stream.
+func expectClosed(t *testing.T, r Reader, w io.Closer) {
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.ReadUID(time.Second)
+	if !errors.Is(err, ErrTransient) || !errors.Is(err, io.EOF) {
+		t.Errorf("ReadUID returned %v after the device was closed, want %s wrapping EOF", err, ErrTransient)
+	}
+}
+
+func TestEvdevReaderDecimal(t *testing.T) {
+	open, w := pipeReader(t)
+	r := NewEvdevReader(config.EvdevReaderConfig{Device: "pipe", Encoding: "decimal"}, open, clock.Real)
+	err := r.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Halt()
+
+	rec := recording{t: time.Date(2026, time.March, 2, 8, 0, 0, 0, time.UTC)}
+	// 0012345678 on the number row.
+	rec.press(11, 11, 2, 3, 4, 5, 6, 7, 8, 9, keyEnter)
+	// 4294967295 with a key repeat of the first 2, which is ignored.
+	rec.key(5, valuePress)
+	rec.key(5, valueRelease)
+	rec.key(3, valuePress)
+	rec.key(3, valueRepeat)
+	rec.key(3, valueRelease)
+	rec.press(10, 5, 10, 7, 8, 3, 10, 6, keyEnter)
+	// An unknown key, which makes the number fail to decode.
+	rec.press(2, keyX, 3, keyEnter)
+	// 0000000125 on the keypad.
+	rec.press(keyKP0, keyKP0, keyKP0, keyKP0, keyKP0, keyKP0, keyKP0, keyKP1, keyKP2, keyKP5, keyKPEnter)
+
+	_, err = w.Write(rec.events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectUIDs(t, r, "00bc614e", "ffffffff", "0000007d")
+	expectClosed(t, r, w)
+}
+
+func TestEvdevReaderHex(t *testing.T) {
+	open, w := pipeReader(t)
+	r := NewEvdevReader(config.EvdevReaderConfig{Device: "pipe", Encoding: "hex"}, open, clock.Real)
+	err := r.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Halt()
+
+	rec := recording{t: time.Date(2026, time.March, 2, 8, 0, 0, 0, time.UTC)}
+	// 04A1B2C3, with shift held for the letters.
+	rec.press(11, 5)
+	for _, keys := range [][2]uint16{{30, 2}, {48, 3}, {46, 4}} {
+		rec.key(keyLeftShift, valuePress)
+		rec.press(keys[0])
+		rec.key(keyLeftShift, valueRelease)
+		rec.press(keys[1])
+	}
+	rec.press(keyEnter)
+	_, err = w.Write(rec.events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Events as simulated by KeyEvents, split across writes.
+	events, err := KeyEvents("35c17053d7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range [][]byte{events[:5], events[5 : inputEventSize*3+1], events[inputEventSize*3+1:]} {
+		_, err = w.Write(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectUIDs(t, r, "04a1b2c3", "35c17053d7")
+	expectClosed(t, r, w)
+}
+
+func TestKeyEvents(t *testing.T) {
+	_, err := KeyEvents("04A1")
+	if err == nil {
+		t.Error("KeyEvents(04A1) succeeded, want error for upper case")
+	}
+}
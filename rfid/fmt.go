@@ -3,31 +3,70 @@ package rfid
 import (
 	"encoding/hex"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"periph.io/x/periph/experimental/devices/mfrc522"
 )
 
-// FmtSector creates a string representation of a single sector.
-func FmtSector(sector int, data []byte, auth *AuthBlock) string {
+// FmtCard reads all sectors of the card in front of r and creates a string
+// representation of them, preceded by the card's UID and type. Sector
+// trailers are only read from cards that have them.
+func FmtCard(r Reader, timeout time.Duration) (string, error) {
+	card, err := r.ReadCard(timeout)
+	if err != nil {
+		return "", err
+	}
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("UID=%s Type=%s\n\n", hex.EncodeToString(card.UID), card.Type))
+
+	layout := card.Type.Layout()
+	for sector := range layout.Sectors {
+		data, err := r.ReadDataBlocks(timeout, sector)
+		if err != nil {
+			return "", err
+		}
+		var auth *AuthBlock
+		if layout.Trailers {
+			auth, err = r.ReadAuthBlock(timeout, sector)
+			if err != nil {
+				return "", err
+			}
+		}
+		builder.WriteString(FmtSector(layout, sector, data, auth))
+		builder.WriteString("\n")
+	}
+	return builder.String(), nil
+}
+
+// FmtSector creates a string representation of a single sector of a card
+// laid out as l. auth is nil if the card has no sector trailers.
+func FmtSector(l Layout, sector int, data []byte, auth *AuthBlock) string {
 	var builder strings.Builder
-	for i := 0; i < NumDataBlocksPerSector; i++ {
-		start := i * NumBytesPerBlock
-		end := (i + 1) * NumBytesPerBlock
-		line := fmt.Sprintf("%02d.%d | %s\n", sector, i, FmtBlock(data[start:end]))
+	// Align blocks of sectors with more than 10 blocks.
+	width := len(strconv.Itoa(l.DataBlocks(sector) - 1))
+	var prefix string
+	for i := 0; i < l.DataBlocks(sector); i++ {
+		start := i * l.BlockSize
+		end := (i + 1) * l.BlockSize
+		prefix = fmt.Sprintf("%02d.%0*d", sector, width, i)
+		line := fmt.Sprintf("%s | %s\n", prefix, FmtBlock(data[start:end]))
+		builder.WriteString(line)
+	}
+	if auth != nil {
+		line := fmt.Sprintf("%s | %s", strings.Repeat(" ", len(prefix)), FmtAuthBlock(auth))
 		builder.WriteString(line)
 	}
-	line := fmt.Sprintf("     | %s\n", FmtAuthBlock(auth))
-	builder.WriteString(line)
 	return builder.String()
 }
 
-// FmtBlock creates a string representation for a single 16-byte block of data.
+// FmtBlock creates a string representation for a single block of data.
 func FmtBlock(data []byte) string {
 	var builder strings.Builder
-	for i := 0; i < NumBytesPerBlock; i++ {
+	for i := 0; i < len(data); i++ {
 		builder.WriteString(fmt.Sprintf("%s", hex.EncodeToString(data[i:i+1])))
-		if i != NumBytesPerBlock-1 {
+		if i != len(data)-1 {
 			builder.WriteString(" ")
 		}
 	}
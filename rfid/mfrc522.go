@@ -7,10 +7,12 @@
 package rfid
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
+	"github.com/pakohan/craftdoor/logging"
 	"periph.io/x/periph/conn/spi"
 	"periph.io/x/periph/conn/spi/spireg"
 	"periph.io/x/periph/experimental/devices/mfrc522"
@@ -45,38 +47,38 @@ func NewMFRC522Reader() (*MFRC522Reader, error) {
 func (r *MFRC522Reader) Initialize() error {
 	r.Halt()
 
-	log.Println("Initializing Reader.")
+	logging.Debugf("Initializing Reader.")
 	var err error
 	r.port, err = spireg.Open("")
 	if err != nil {
-		log.Println("Failed to open SPI port.")
+		logging.Errorf("Failed to open SPI port: %s", err)
 		return err
 	}
 
 	r.device, err = mfrc522.NewSPI(r.port, rpi.P1_22, rpi.P1_18, mfrc522.WithSync())
 	if err != nil {
-		log.Println("Failed to start mfrc522.Dev.")
+		logging.Errorf("Failed to start mfrc522.Dev: %s", err)
 		return err
 	}
 
 	err = r.device.SetAntennaGain(7)
 	if err != nil {
-		log.Println("Failed to set antenna gain.")
+		logging.Errorf("Failed to set antenna gain: %s", err)
 		return err
 	}
 
-	log.Println("Successfully initialized Reader.")
+	logging.Debugf("Successfully initialized Reader.")
 	return nil
 }
 
 // Halt stops the Reader.
 func (r *MFRC522Reader) Halt() error {
-	log.Println("Halting Reader.")
+	logging.Debugf("Halting Reader.")
 	var err error
 	if r.device != nil {
 		err := r.device.Halt()
 		if err != nil {
-			log.Println("Failed to Halt mfrc522.Dev.")
+			logging.Errorf("Failed to Halt mfrc522.Dev: %s", err)
 			return err
 		}
 	}
@@ -84,46 +86,152 @@ func (r *MFRC522Reader) Halt() error {
 	if r.port != nil {
 		err := r.port.Close()
 		if err != nil {
-			log.Println("Failed to close spi.PortCloser.")
+			logging.Errorf("Failed to close spi.PortCloser: %s", err)
 			return err
 		}
 	}
 
-	log.Println("Successfully halted Reader.")
+	logging.Debugf("Successfully halted Reader.")
 	return err
 }
 
 // ReadUID reads the UID of the RFID tag.
 func (r *MFRC522Reader) ReadUID(timeout time.Duration) ([]byte, error) {
-	return r.device.ReadUID(timeout)
+	if r.device == nil {
+		return nil, &Error{Kind: ErrTransient, Err: errors.New("reader is not initialized")}
+	}
+	uid, err := r.device.ReadUID(timeout)
+	if err != nil {
+		return nil, classifyMFRC522Error(err)
+	}
+	if len(uid) == 0 {
+		return nil, &Error{Kind: ErrNoCard, Err: errors.New("empty UID")}
+	}
+	return uid, nil
 }
 
-// ReadDataBlocks reads all data blocks from a given sector.
+// ReadCard reads the UID and type of the next card.
 //
-// Returns a total of 16 bytes/block * 3 blocks = 48 bytes.
-func (r *MFRC522Reader) ReadDataBlocks(timeout time.Duration, sector int) (data []byte, err error) {
-	b0, err := r.ReadDataBlock(timeout, sector, 0)
+// The mfrc522 driver doesn't report the ATQA and SAK the type is detected
+// from, so the card is selected through the driver's low-level interface.
+func (r *MFRC522Reader) ReadCard(timeout time.Duration) (*Card, error) {
+	if r.device == nil {
+		return nil, &Error{Kind: ErrTransient, Err: errors.New("reader is not initialized")}
+	}
+	ll := r.device.LowLevel
+	err := ll.WaitForEdge(timeout)
 	if err != nil {
-		log.Printf("Failed to read sector=%d block=%d: %s", sector, 0, err)
-		return nil, err
+		return nil, classifyMFRC522Error(err)
+	}
+	err = ll.Init()
+	if err != nil {
+		return nil, classifyMFRC522Error(err)
+	}
+	card, err := selectMFRC522Card(ll)
+	if err != nil {
+		return nil, classifyMFRC522Error(err)
+	}
+	err = ll.StopCrypto()
+	if err != nil {
+		return nil, classifyMFRC522Error(err)
 	}
+	return card, nil
+}
+
+// piccTransceiver exchanges frames with a card, see commands.LowLevel.
+type piccTransceiver interface {
+	DevWrite(address int, data byte) error
+	CardWrite(command byte, data []byte) ([]byte, int, error)
+	CRC(data []byte) ([]byte, error)
+}
+
+// Cascade levels of ISO14443A anticollision and selection, and the cascade
+// tag starting incomplete UIDs.
+var (
+	cascadeLevels = []byte{0x93, 0x95, 0x97}
+	cascadeTag    = byte(0x88)
+)
 
-	b1, err := r.ReadDataBlock(timeout, sector, 1)
+// selectMFRC522Card requests the card in front of the reader and selects it
+// through all cascade levels of its UID. Its type is detected from the ATQA
+// and the SAK of the last level.
+//
+// Errors use the messages of the mfrc522 driver, see mfrc522Errors.
+func selectMFRC522Card(t piccTransceiver) (*Card, error) {
+	// REQA is a short frame of 7 bits.
+	err := t.DevWrite(commands.BitFramingReg, 0x07)
 	if err != nil {
-		log.Printf("Failed to read sector=%d block=%d: %s", sector, 1, err)
 		return nil, err
 	}
-
-	b2, err := r.ReadDataBlock(timeout, sector, 2)
+	atqa, bits, err := t.CardWrite(commands.PCD_TRANSCEIVE, []byte{commands.PICC_REQIDL})
 	if err != nil {
-		log.Printf("Failed to read sector=%d block=%d: %s", sector, 2, err)
 		return nil, err
 	}
+	if bits != 16 || len(atqa) < 2 {
+		return nil, fmt.Errorf("mfrc522: wrong number of bits %d", bits)
+	}
+	err = t.DevWrite(commands.BitFramingReg, 0x00)
+	if err != nil {
+		return nil, err
+	}
+
+	uid := []byte{}
+	for _, level := range cascadeLevels {
+		// Anticollision returns 4 bytes of the UID and their XOR.
+		data, _, err := t.CardWrite(commands.PCD_TRANSCEIVE, []byte{level, 0x20})
+		if err != nil {
+			return nil, err
+		}
+		if len(data) != 5 {
+			return nil, fmt.Errorf("mfrc522: back data expected 5, actual %d", len(data))
+		}
+		if data[0]^data[1]^data[2]^data[3] != data[4] {
+			return nil, fmt.Errorf("mfrc522: CRC mismatch, expected %02x actual %02x", data[0]^data[1]^data[2]^data[3], data[4])
+		}
+
+		frame := append([]byte{level, 0x70}, data...)
+		crc, err := t.CRC(frame)
+		if err != nil {
+			return nil, err
+		}
+		sak, bits, err := t.CardWrite(commands.PCD_TRANSCEIVE, append(frame, crc[0], crc[1]))
+		if err != nil {
+			return nil, err
+		}
+		// The SAK is followed by its CRC.
+		if bits != 24 || len(sak) < 1 {
+			return nil, fmt.Errorf("mfrc522: wrong number of bits %d", bits)
+		}
+
+		// Bit 2 of the SAK means the UID isn't complete yet.
+		if data[0] == cascadeTag && sak[0]&0x04 != 0 {
+			uid = append(uid, data[1:4]...)
+			continue
+		}
+		uid = append(uid, data[:4]...)
+		return &Card{UID: uid, Type: DetectCardType(uint16(atqa[1])<<8|uint16(atqa[0]), sak[0])}, nil
+	}
+	return nil, fmt.Errorf("mfrc522: Anticoll error, UID longer than %d levels", len(cascadeLevels))
+}
+
+// ReadDataBlocks reads all data blocks from a given sector.
+//
+// Returns a total of 16 bytes/block * 3 blocks = 48 bytes.
+func (r *MFRC522Reader) ReadDataBlocks(timeout time.Duration, sector int) (data []byte, err error) {
+	return readDataBlocks(r, timeout, sector)
+}
 
+// readDataBlocks reads all data blocks from a given sector, one by one.
+func readDataBlocks(r Reader, timeout time.Duration, sector int) ([]byte, error) {
 	result := []byte{}
-	result = append(result, b0...)
-	result = append(result, b1...)
-	result = append(result, b2...)
+	for block := 0; block < NumDataBlocksPerSector; block++ {
+		data, err := r.ReadDataBlock(timeout, sector, block)
+		if err != nil {
+			logging.Warnf("Failed to read sector=%d block=%d: %s", sector, block, err)
+			return nil, err
+		}
+		result = append(result, data...)
+	}
 	return result, nil
 }
 
@@ -139,7 +247,11 @@ func (r *MFRC522Reader) ReadDataBlock(timeout time.Duration, sector int, block i
 	}
 
 	var auth byte = commands.PICC_AUTHENT1B
-	return r.device.ReadCard(timeout, auth, sector, block, key)
+	data, err = r.device.ReadCard(timeout, auth, sector, block, key)
+	if err != nil {
+		return nil, classifyMFRC522Error(err)
+	}
+	return data, nil
 }
 
 // ReadAuthBlock reads the keys and permissions bits for a given sector (aka the "sector trailer").
@@ -147,10 +259,14 @@ func (r *MFRC522Reader) ReadAuthBlock(timeout time.Duration, sector int) (authBl
 	var auth byte = commands.PICC_AUTHENT1B
 	data, err := r.device.ReadAuth(timeout, auth, sector, key)
 	if err != nil {
-		log.Printf("Failed to read authentication block.")
-		return nil, err
+		logging.Warnf("Failed to read authentication block: %s", err)
+		return nil, classifyMFRC522Error(err)
 	}
+	return parseAuthBlock(data), nil
+}
 
+// parseAuthBlock parses the contents of a sector trailer.
+func parseAuthBlock(data []byte) *AuthBlock {
 	var keyA [6]byte
 	copy(keyA[0:6], data[0:6])
 
@@ -160,7 +276,31 @@ func (r *MFRC522Reader) ReadAuthBlock(timeout time.Duration, sector int) (authBl
 	var permissions mfrc522.BlocksAccess = mfrc522.BlocksAccess{}
 	permissions.Init(data)
 
-	return &AuthBlock{KeyA: keyA, KeyB: keyB, Permissions: permissions}, nil
+	return &AuthBlock{KeyA: keyA, KeyB: keyB, Permissions: permissions}
+}
+
+// mfrc522Errors maps messages of the mfrc522 driver's errors to kinds. The
+// driver doesn't export its errors, so this is the only place where they are
+// matched by message. Errors not listed here are treated as ErrTransient.
+var mfrc522Errors = []struct {
+	message string
+	kind    error
+}{
+	{"timeout waiting for IRQ edge", ErrTimeout},
+	{"authenticat", ErrAuth},
+	{"wrong number of bits", ErrNoCard},
+	{"back data expected", ErrNoCard},
+	{"Anticoll", ErrNoCard},
+}
+
+// classifyMFRC522Error wraps an error of the mfrc522 driver in an Error.
+func classifyMFRC522Error(err error) error {
+	for _, e := range mfrc522Errors {
+		if strings.Contains(err.Error(), e.message) {
+			return &Error{Kind: e.kind, Err: err}
+		}
+	}
+	return &Error{Kind: ErrTransient, Err: err}
 }
 
 // String returns a human-readable string describing this Reader.
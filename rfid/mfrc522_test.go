@@ -0,0 +1,120 @@
+package rfid
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestClassifyMFRC522Error(t *testing.T) {
+	// Messages of the mfrc522 driver, see mfrc522Errors.
+	tests := []struct {
+		message string
+		want    error
+	}{
+		{"mfrc522 lowlevel: timeout waiting for IRQ edge: 3s", ErrTimeout},
+		{"mfrc522: can not authenticate", ErrAuth},
+		{"mfrc522: authentication failed", ErrAuth},
+		{"mfrc522: failed to authenticate", ErrAuth},
+		{"mfrc522: wrong number of bits 3", ErrNoCard},
+		{"mfrc522: back data expected 5, actual 2", ErrNoCard},
+		{"mfrc522: Anticoll2 error, check failed", ErrNoCard},
+		{"mfrc522: CRC mismatch, expected 12 actual 34", ErrTransient},
+		{"mfrc522 lowlevel: IRQ error", ErrTransient},
+		{"spi: bus closed", ErrTransient},
+	}
+	for _, tt := range tests {
+		driverErr := errors.New(tt.message)
+		err := classifyMFRC522Error(driverErr)
+		if !errors.Is(err, tt.want) || !errors.Is(err, driverErr) {
+			t.Errorf("classifyMFRC522Error(%q) = %v, want kind %s wrapping the driver's error", tt.message, err, tt.want)
+		}
+	}
+}
+
+// fakePICC answers the frames of selectMFRC522Card like an ISO14443A card.
+type fakePICC struct {
+	atqa []byte
+	uid  []byte
+	sak  byte
+
+	// Breaks the XOR of the first anticollision response.
+	badBCC bool
+}
+
+func (c *fakePICC) DevWrite(address int, data byte) error {
+	return nil
+}
+
+func (c *fakePICC) CRC(data []byte) ([]byte, error) {
+	return []byte{0xa5, 0x5a}, nil
+}
+
+// level returns the UID bytes of a cascade level and whether more follow.
+func (c *fakePICC) level(sel byte) ([]byte, bool) {
+	i := 0
+	for cascadeLevels[i] != sel {
+		i++
+	}
+	rest := c.uid[3*i:]
+	if len(rest) > 4 {
+		return append([]byte{cascadeTag}, rest[:3]...), true
+	}
+	return rest, false
+}
+
+func (c *fakePICC) CardWrite(command byte, data []byte) ([]byte, int, error) {
+	switch {
+	case len(data) == 1:
+		return c.atqa, 16, nil
+	case len(data) == 2:
+		uid, _ := c.level(data[0])
+		bcc := uid[0] ^ uid[1] ^ uid[2] ^ uid[3]
+		if c.badBCC {
+			bcc++
+		}
+		return append(append([]byte{}, uid...), bcc), 40, nil
+	default:
+		_, more := c.level(data[0])
+		if more {
+			return []byte{0x04, 0xda, 0x17}, 24, nil
+		}
+		return []byte{c.sak, 0x12, 0x34}, 24, nil
+	}
+}
+
+func TestSelectMFRC522Card(t *testing.T) {
+	tests := []struct {
+		name     string
+		card     fakePICC
+		wantUID  string
+		wantType CardType
+		wantErr  error
+	}{
+		{"classic 1k", fakePICC{atqa: []byte{0x04, 0x00}, uid: []byte{0x92, 0x2e, 0x58, 0x32}, sak: 0x08}, "922e5832", CardClassic1K, nil},
+		{"classic 4k", fakePICC{atqa: []byte{0x02, 0x00}, uid: []byte{0x92, 0x2e, 0x58, 0x32}, sak: 0x18}, "922e5832", CardClassic4K, nil},
+		{"ultralight", fakePICC{atqa: []byte{0x44, 0x00}, uid: []byte{0x04, 0xa1, 0xb2, 0xc3, 0xd4, 0xe5, 0xf6}, sak: 0x00}, "04a1b2c3d4e5f6", CardUltralight, nil},
+		{"desfire", fakePICC{atqa: []byte{0x44, 0x03}, uid: []byte{0x04, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66}, sak: 0x20}, "04112233445566", CardDESFire, nil},
+		{"triple size", fakePICC{atqa: []byte{0x84, 0x00}, uid: []byte{0x04, 0xa1, 0xb2, 0xc3, 0xd4, 0xe5, 0xf6, 0xa7, 0xb8, 0xc9}, sak: 0x00}, "04a1b2c3d4e5f6a7b8c9", CardUnknown, nil},
+		{"corrupted", fakePICC{atqa: []byte{0x04, 0x00}, uid: []byte{0x92, 0x2e, 0x58, 0x32}, sak: 0x08, badBCC: true}, "", "", ErrTransient},
+		{"no answer", fakePICC{atqa: []byte{0x04}, uid: []byte{0x92, 0x2e, 0x58, 0x32}, sak: 0x08}, "", "", ErrNoCard},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card, err := selectMFRC522Card(&tt.card)
+			if tt.wantErr != nil {
+				err = classifyMFRC522Error(err)
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("selectMFRC522Card = %v, %v, want %s", card, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(card.UID) != tt.wantUID || card.Type != tt.wantType {
+				t.Errorf("selectMFRC522Card = %x of type %s, want %s of type %s", card.UID, card.Type, tt.wantUID, tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package rfid
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/pn532"
+)
+
+func init() {
+	config.RegisterValidator(func(cfg *config.Config) error {
+		if cfg.Reader.Type != "pn532" {
+			return nil
+		}
+		switch cfg.Reader.PN532.Interface {
+		case "i2c", "spi", "uart":
+		default:
+			return fmt.Errorf("reader.pn532.interface: unknown interface %q", cfg.Reader.PN532.Interface)
+		}
+		return nil
+	})
+}
+
+const (
+	// pn532PollInterval is how often ReadUID looks for a card.
+	pn532PollInterval = 50 * time.Millisecond
+
+	// pn532ListTimeout is how long the PN532 may take to look for a card.
+	pn532ListTimeout = time.Second
+)
+
+// PN532Reader is a Reader for ISO14443A cards on a PN532. It reads the memory
+// of MIFARE Classic, Ultralight and NTAG21x cards.
+type PN532Reader struct {
+	open func() (pn532.Transport, error)
+	dev  *pn532.Dev
+}
+
+// NewPN532Reader returns a reader for the PN532 connected by the transport
+// open returns. Call Initialize to connect.
+func NewPN532Reader(open func() (pn532.Transport, error)) *PN532Reader {
+	return &PN532Reader{open: open}
+}
+
+// OpenPN532 returns a function opening the transport selected by cfg, for
+// NewPN532Reader.
+func OpenPN532(cfg config.PN532ReaderConfig) func() (pn532.Transport, error) {
+	return func() (pn532.Transport, error) {
+		switch cfg.Interface {
+		case "i2c":
+			return pn532.OpenI2C(cfg.Device)
+		case "spi":
+			return pn532.OpenSPI(cfg.Device)
+		case "uart":
+			device := cfg.Device
+			if device == "" {
+				device = "/dev/serial0"
+			}
+			return pn532.OpenUART(device)
+		default:
+			return nil, fmt.Errorf("unknown PN532 interface %q", cfg.Interface)
+		}
+	}
+}
+
+// Initialize connects to the PN532 and wakes it up, which verifies that it
+// responds.
+func (r *PN532Reader) Initialize() error {
+	r.Halt()
+
+	logging.Debugf("Initializing Reader.")
+	t, err := r.open()
+	if err != nil {
+		logging.Errorf("Failed to open PN532: %s", err)
+		return err
+	}
+	r.dev = pn532.New(t)
+
+	err = r.dev.SAMConfiguration()
+	if err != nil {
+		logging.Errorf("Failed to configure PN532: %s", err)
+		return classifyPN532Error(err)
+	}
+	fw, err := r.dev.FirmwareVersion()
+	if err != nil {
+		logging.Errorf("Failed to read PN532 firmware version: %s", err)
+		return classifyPN532Error(err)
+	}
+	// Look for cards once per ListTarget, so that ReadUID respects its
+	// timeout.
+	err = r.dev.SetPassiveRetries(0x01)
+	if err != nil {
+		logging.Errorf("Failed to configure PN532 retries: %s", err)
+		return classifyPN532Error(err)
+	}
+
+	logging.Debugf("Successfully initialized Reader with firmware %s.", fw)
+	return nil
+}
+
+// Halt disconnects from the PN532.
+func (r *PN532Reader) Halt() error {
+	if r.dev == nil {
+		return nil
+	}
+	logging.Debugf("Halting Reader.")
+	err := r.dev.Close()
+	r.dev = nil
+	if err != nil {
+		logging.Errorf("Failed to close PN532: %s", err)
+		return err
+	}
+	logging.Debugf("Successfully halted Reader.")
+	return nil
+}
+
+// ReadUID reads the UID of the RFID tag.
+func (r *PN532Reader) ReadUID(timeout time.Duration) ([]byte, error) {
+	card, err := r.ReadCard(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return card.UID, nil
+}
+
+// ReadCard reads the UID of the RFID tag and detects its type from its ATQA
+// and SAK.
+func (r *PN532Reader) ReadCard(timeout time.Duration) (*Card, error) {
+	var card *Card
+	err := r.withCard(timeout, func(t *pn532.Target, l Layout) error {
+		card = &Card{UID: t.UID, Type: DetectCardType(t.ATQA, t.SAK)}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// withCard activates the next card presented before timeout, calls f with it
+// and the layout of its type, and releases it.
+func (r *PN532Reader) withCard(timeout time.Duration, f func(t *pn532.Target, l Layout) error) error {
+	if r.dev == nil {
+		return &Error{Kind: ErrTransient, Err: errors.New("reader is not initialized")}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		t, err := r.dev.ListTarget(pn532ListTimeout)
+		if err != nil {
+			return classifyPN532Error(err)
+		}
+		if t != nil {
+			err = f(t, DetectCardType(t.ATQA, t.SAK).Layout())
+			e := r.dev.Release(t)
+			if e != nil {
+				logging.Warnf("Failed to release card: %s", e)
+			}
+			return err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return &Error{Kind: ErrTimeout, Err: fmt.Errorf("no card within %s", timeout)}
+		}
+		if remaining > pn532PollInterval {
+			remaining = pn532PollInterval
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// readBlock reads the block at address of card t. MIFARE Classic blocks are
+// authenticated with key first, unless authenticated is set because an
+// earlier block of the same sector was. Other cards return the 4 pages
+// starting at address.
+func (r *PN532Reader) readBlock(t *pn532.Target, l Layout, address int, authenticated bool) ([]byte, error) {
+	if l.Trailers && !authenticated {
+		err := r.dev.MifareAuth(t, pn532.MifareAuthB, byte(address), [6]byte(key), pn532ListTimeout)
+		if err != nil {
+			return nil, classifyPN532Error(err)
+		}
+	}
+	data, err := r.dev.MifareRead(t, byte(address), pn532ListTimeout)
+	if err != nil {
+		return nil, classifyPN532Error(err)
+	}
+	return data, nil
+}
+
+// ReadDataBlocks reads all data blocks from a given sector.
+//
+// Returns 16 bytes/block * 3 blocks = 48 bytes for MIFARE Classic 1K cards.
+func (r *PN532Reader) ReadDataBlocks(timeout time.Duration, sector int) ([]byte, error) {
+	var data []byte
+	err := r.withCard(timeout, func(t *pn532.Target, l Layout) error {
+		err := l.CheckSector(sector)
+		if err != nil {
+			return err
+		}
+		if !l.Trailers {
+			// One read returns all 4 pages of the sector.
+			data, err = r.readBlock(t, l, l.Address(sector, 0), false)
+			return err
+		}
+		for block := 0; block < l.DataBlocks(sector); block++ {
+			b, err := r.readBlock(t, l, l.Address(sector, block), block > 0)
+			if err != nil {
+				logging.Warnf("Failed to read sector=%d block=%d: %s", sector, block, err)
+				return err
+			}
+			data = append(data, b...)
+		}
+		return nil
+	})
+	return data, err
+}
+
+// ReadDataBlock reads a single block from a single sector.
+func (r *PN532Reader) ReadDataBlock(timeout time.Duration, sector int, block int) ([]byte, error) {
+	var data []byte
+	err := r.withCard(timeout, func(t *pn532.Target, l Layout) error {
+		err := l.CheckBlock(sector, block)
+		if err != nil {
+			return err
+		}
+		data, err = r.readBlock(t, l, l.Address(sector, block), false)
+		if err != nil {
+			return err
+		}
+		data = data[:l.BlockSize]
+		return nil
+	})
+	return data, err
+}
+
+// ReadAuthBlock reads the keys and permissions bits for a given sector (aka the "sector trailer").
+func (r *PN532Reader) ReadAuthBlock(timeout time.Duration, sector int) (*AuthBlock, error) {
+	var data []byte
+	err := r.withCard(timeout, func(t *pn532.Target, l Layout) error {
+		err := l.CheckTrailer(sector)
+		if err != nil {
+			return err
+		}
+		data, err = r.readBlock(t, l, l.Address(sector, l.DataBlocks(sector)), false)
+		return err
+	})
+	if err != nil {
+		logging.Warnf("Failed to read authentication block: %s", err)
+		return nil, err
+	}
+	return parseAuthBlock(data), nil
+}
+
+// classifyPN532Error wraps an error of the PN532 in an Error.
+func classifyPN532Error(err error) error {
+	var status *pn532.StatusError
+	switch {
+	case errors.As(err, &status) && status.Code == pn532.StatusAuth:
+		return &Error{Kind: ErrAuth, Err: err}
+	case errors.As(err, &status):
+		return &Error{Kind: ErrNoCard, Err: err}
+	default:
+		return &Error{Kind: ErrTransient, Err: err}
+	}
+}
+
+// String returns a human-readable string describing this Reader.
+func (r *PN532Reader) String() string {
+	if r.dev == nil {
+		return "PN532"
+	}
+	return r.dev.String()
+}
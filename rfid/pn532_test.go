@@ -0,0 +1,160 @@
+package rfid
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pakohan/craftdoor/pn532"
+)
+
+// Transcripts of sessions with a PN532 v1.6 over UART, see the transcripts of
+// package pn532 for the framing on each interface. Each session initializes
+// the reader.
+var (
+	pn532Init = []pn532.Exchange{
+		exchange("555500000000000000000000000000000000ff05fbd4140114010200", "0000ff00ff000000ff02fed5151600"),
+		exchange("0000ff02fed4022a00", "0000ff00ff000000ff06fad50332010607e800"),
+		exchange("0000ff06fad43205ff0101f400", "0000ff00ff000000ff02fed533f800"),
+	}
+
+	// Reads the UID, block 1.0 and the trailer of sector 1 of a MIFARE
+	// Classic 1K card whose UID is 922e5832, and fails to authenticate block
+	// 2.0.
+	pn532MifareSession = append(pn532Init[:3:3],
+		exchange("0000ff04fcd44a0100e100", "0000ff00ff000000ff0cf4d54b010100040804922e58328400"),
+		exchange("0000ff03fdd45201d900", "0000ff00ff000000ff03fdd55300d800"),
+		exchange("0000ff04fcd44a0100e100", "0000ff00ff000000ff0cf4d54b010100040804922e58328400"),
+		exchange("0000ff0ff1d440016104ffffffffffff922e58324200", "0000ff00ff000000ff03fdd54100ea00"),
+		exchange("0000ff05fbd440013004b700", "0000ff00ff000000ff13edd54100101112131415161718191a1b1c1d1e1f7200"),
+		exchange("0000ff03fdd45201d900", "0000ff00ff000000ff03fdd55300d800"),
+		exchange("0000ff04fcd44a0100e100", "0000ff00ff000000ff0cf4d54b010100040804922e58328400"),
+		exchange("0000ff0ff1d440016107ffffffffffff922e58323f00", "0000ff00ff000000ff03fdd54100ea00"),
+		exchange("0000ff05fbd440013007b400", "0000ff00ff000000ff13edd54100000000000000ff078069ffffffffffff0100"),
+		exchange("0000ff03fdd45201d900", "0000ff00ff000000ff03fdd55300d800"),
+		exchange("0000ff04fcd44a0100e100", "0000ff00ff000000ff0cf4d54b010100040804922e58328400"),
+		exchange("0000ff0ff1d440016108ffffffffffff922e58323e00", "0000ff00ff000000ff03fdd54114d600"),
+		exchange("0000ff03fdd45201d900", "0000ff00ff000000ff03fdd55300d800"),
+	)
+
+	// Reads the UID and sector 1, pages 4 to 7, of an NTAG213 whose UID is
+	// 04a1b2c3d4e5f6 and fails to read its sector trailer. Then reads the UID
+	// of a DESFire EV1 card, 04112233445566, and fails to read its sector 0.
+	pn532CardTypesSession = append(pn532Init[:3:3],
+		exchange("0000ff04fcd44a0100e100", "0000ff00ff000000ff0ff1d54b01010044000704a1b2c3d4e5f6ca00"),
+		exchange("0000ff03fdd45201d900", "0000ff00ff000000ff03fdd55300d800"),
+		exchange("0000ff04fcd44a0100e100", "0000ff00ff000000ff0ff1d54b01010044000704a1b2c3d4e5f6ca00"),
+		exchange("0000ff05fbd440013004b700", "0000ff00ff000000ff13edd541000103a00c340311d1010d55046578616d0f00"),
+		exchange("0000ff03fdd45201d900", "0000ff00ff000000ff03fdd55300d800"),
+		exchange("0000ff04fcd44a0100e100", "0000ff00ff000000ff0ff1d54b01010044000704a1b2c3d4e5f6ca00"),
+		exchange("0000ff03fdd45201d900", "0000ff00ff000000ff03fdd55300d800"),
+		exchange("0000ff04fcd44a0100e100", "0000ff00ff000000ff15ebd54b010103442007041122334455660675778102801200"),
+		exchange("0000ff03fdd45201d900", "0000ff00ff000000ff03fdd55300d800"),
+		exchange("0000ff04fcd44a0100e100", "0000ff00ff000000ff15ebd54b010103442007041122334455660675778102801200"),
+		exchange("0000ff03fdd45201d900", "0000ff00ff000000ff03fdd55300d800"),
+	)
+)
+
+// exchange decodes the hex-encoded bytes of a transcript.
+func exchange(write, read string) pn532.Exchange {
+	return pn532.Exchange{Write: mustDecodeHex(write), Read: mustDecodeHex(read)}
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// replayPN532 initializes a PN532Reader on a UART playing back transcript,
+// runs check and expects the reader to follow the transcript to its end.
+func replayPN532(t *testing.T, transcript []pn532.Exchange, check func(t *testing.T, r *PN532Reader)) {
+	bus := pn532.NewReplay("uart", transcript)
+	r := NewPN532Reader(func() (pn532.Transport, error) {
+		return pn532.NewUART(bus), nil
+	})
+	err := r.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, r)
+	err = r.Halt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bus.Done()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPN532ReaderMifare(t *testing.T) {
+	replayPN532(t, pn532MifareSession, func(t *testing.T, r *PN532Reader) {
+		uid, err := r.ReadUID(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(uid) != "922e5832" {
+			t.Errorf("ReadUID = %x, want 922e5832", uid)
+		}
+
+		data, err := r.ReadDataBlock(time.Second, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(data) != "101112131415161718191a1b1c1d1e1f" {
+			t.Errorf("ReadDataBlock(1, 0) = %x, want 101112131415161718191a1b1c1d1e1f", data)
+		}
+
+		auth, err := r.ReadAuthBlock(time.Second, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(auth.KeyB[:], bytes.Repeat([]byte{0xFF}, 6)) {
+			t.Errorf("ReadAuthBlock(1) has key B %x, want ffffffffffff", auth.KeyB)
+		}
+
+		_, err = r.ReadDataBlock(time.Second, 2, 0)
+		if !errors.Is(err, ErrAuth) {
+			t.Errorf("ReadDataBlock(2, 0) returned %v, want %s", err, ErrAuth)
+		}
+	})
+}
+
+func TestPN532ReaderCardTypes(t *testing.T) {
+	replayPN532(t, pn532CardTypesSession, func(t *testing.T, r *PN532Reader) {
+		expectPN532Card(t, r, "04a1b2c3d4e5f6", CardUltralight)
+		data, err := r.ReadDataBlocks(time.Second, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(data) != "0103a00c340311d1010d55046578616d" {
+			t.Errorf("ReadDataBlocks(1) = %x, want pages 4 to 7 0103a00c340311d1010d55046578616d", data)
+		}
+		_, err = r.ReadAuthBlock(time.Second, 0)
+		if err == nil {
+			t.Error("read a sector trailer of an NTAG")
+		}
+
+		expectPN532Card(t, r, "04112233445566", CardDESFire)
+		_, err = r.ReadDataBlocks(time.Second, 0)
+		if err == nil {
+			t.Error("read blocks of a DESFire card")
+		}
+	})
+}
+
+// expectPN532Card expects r to read a card with the given UID and type.
+func expectPN532Card(t *testing.T, r *PN532Reader, uid string, typ CardType) {
+	card, err := r.ReadCard(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(card.UID) != uid || card.Type != typ {
+		t.Errorf("ReadCard = %s card %x, want %s card %s", card.Type, card.UID, typ, uid)
+	}
+}
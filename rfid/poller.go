@@ -0,0 +1,192 @@
+package rfid
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/logging"
+)
+
+const (
+	// Delay before retrying after the first transient reader error. Doubles
+	// with each consecutive error up to MaxBackoff.
+	minBackoff = 100 * time.Millisecond
+
+	// MaxBackoff is the longest delay between retries after transient reader
+	// errors.
+	MaxBackoff = 5 * time.Second
+
+	// Minimum time between re-initializations of the reader, including
+	// self-tests.
+	minReinitInterval = 30 * time.Second
+
+	// Delay before retrying when a card didn't respond, so that a card
+	// hovering at the edge of the reader's range doesn't cause a busy loop.
+	noCardRetryDelay = 50 * time.Millisecond
+)
+
+// Poller serializes access to a Reader and recovers from its errors.
+type Poller struct {
+	r     Reader
+	clock clock.Clock
+
+	// Serializes access to the reader and guards the fields below.
+	mu sync.Mutex
+
+	// Number of consecutive transient errors.
+	failures int
+
+	// When the reader was last initialized.
+	initAt time.Time
+
+	// Guards the fields below, which are read while a read holds mu.
+	statusMu sync.Mutex
+
+	// When the reader last responded, and the error it failed with since.
+	respondedAt time.Time
+	err         error
+}
+
+// NewPoller returns a Poller for r. Time is told by clk, e.g. clock.Real.
+func NewPoller(r Reader, clk clock.Clock) *Poller {
+	return &Poller{
+		r:     r,
+		clock: clk,
+	}
+}
+
+// Reader returns the polled reader.
+func (p *Poller) Reader() Reader {
+	return p.r
+}
+
+// ReadUID reads a UID before deadline, handling reader errors as follows:
+//
+//   - ErrTimeout: no tag is available. Returns nil, nil.
+//   - ErrNoCard: retries after noCardRetryDelay.
+//   - ErrTransient: retries after an exponential backoff, re-initializing
+//     the reader at most every minReinitInterval.
+//   - ErrAuth and unclassified errors: returned.
+func (p *Poller) ReadUID(deadline time.Time) ([]byte, error) {
+	card, err := p.ReadCard(deadline)
+	if card == nil || err != nil {
+		return nil, err
+	}
+	return card.UID, nil
+}
+
+// ReadCard reads a card's UID and type before deadline, handling reader
+// errors like ReadUID. Returns nil, nil if no card is available.
+func (p *Poller) ReadCard(deadline time.Time) (*Card, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	log := logging.With("reader", p.r.String())
+	for {
+		remaining := deadline.Sub(p.clock.Now())
+		if remaining <= 0 {
+			return nil, nil
+		}
+
+		card, err := p.r.ReadCard(remaining)
+		switch {
+		case err == nil:
+			p.failures = 0
+			p.record(nil)
+			return card, nil
+		case errors.Is(err, ErrTimeout):
+			p.failures = 0
+			p.record(nil)
+			return nil, nil
+		case errors.Is(err, ErrNoCard):
+			p.record(nil)
+			log.Debugf("Card did not respond. Retrying: %s", err)
+			p.sleepUntil(noCardRetryDelay, deadline)
+		case errors.Is(err, ErrTransient):
+			p.record(err)
+			p.recover(log, err, deadline)
+		case errors.Is(err, ErrAuth):
+			p.record(nil)
+			return nil, err
+		default:
+			p.record(err)
+			return nil, err
+		}
+	}
+}
+
+// Initialize initializes the reader, which verifies that it responds.
+func (p *Poller) Initialize() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.initialize()
+}
+
+// recover waits out a backoff after a transient error and re-initializes the
+// reader unless it was initialized recently.
+//
+// Must be called with mu held.
+func (p *Poller) recover(log *logging.Logger, err error, deadline time.Time) {
+	p.failures++
+	backoff := minBackoff
+	for i := 1; i < p.failures && backoff < MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > MaxBackoff {
+		backoff = MaxBackoff
+	}
+	log.Warnf("Transient reader error #%d. Retrying in %s: %s", p.failures, backoff, err)
+	p.sleepUntil(backoff, deadline)
+
+	if p.clock.Now().Sub(p.initAt) < minReinitInterval {
+		return
+	}
+	log.Warnf("Re-initializing reader.")
+	e := p.initialize()
+	if e != nil {
+		log.Errorf("Failed to re-initialize reader: %s", e)
+	}
+}
+
+// initialize initializes the reader and records when it did.
+//
+// Must be called with mu held.
+func (p *Poller) initialize() error {
+	p.initAt = p.clock.Now()
+	err := p.r.Initialize()
+	p.record(err)
+	return err
+}
+
+// record records the outcome of an operation on the reader. Card errors such
+// as ErrAuth count as responses.
+func (p *Poller) record(err error) {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	if err == nil {
+		p.respondedAt = p.clock.Now()
+	}
+	p.err = err
+}
+
+// Status returns when the reader last responded, or the zero time if it
+// never did, and the error its last operation failed with, or nil if it
+// succeeded or none has completed yet.
+func (p *Poller) Status() (time.Time, error) {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	return p.respondedAt, p.err
+}
+
+// sleepUntil sleeps for d, but not past deadline.
+func (p *Poller) sleepUntil(d time.Duration, deadline time.Time) {
+	remaining := deadline.Sub(p.clock.Now())
+	if remaining < d {
+		d = remaining
+	}
+	if d > 0 {
+		p.clock.Sleep(d)
+	}
+}
@@ -0,0 +1,222 @@
+package rfid
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+)
+
+var pollerStart = time.Date(2026, time.January, 5, 12, 0, 0, 0, time.UTC)
+
+// sleepClock is a fake clock whose Sleep advances the time at once and
+// records the duration.
+type sleepClock struct {
+	*clock.Fake
+	slept []time.Duration
+}
+
+func (c *sleepClock) Sleep(d time.Duration) {
+	c.slept = append(c.slept, d)
+	c.Advance(d)
+}
+
+// scriptedReader returns the errors of a script from ReadCard, one per read,
+// and a card once the script is done.
+type scriptedReader struct {
+	script []error
+	inits  []time.Time
+	clock  clock.Clock
+}
+
+func (r *scriptedReader) Initialize() error {
+	r.inits = append(r.inits, r.clock.Now())
+	return nil
+}
+
+func (r *scriptedReader) Halt() error {
+	return nil
+}
+
+func (r *scriptedReader) ReadUID(timeout time.Duration) ([]byte, error) {
+	card, err := r.ReadCard(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return card.UID, nil
+}
+
+func (r *scriptedReader) ReadCard(timeout time.Duration) (*Card, error) {
+	if len(r.script) == 0 {
+		return &Card{UID: []byte{0x04, 0xa1, 0xb2, 0xc3}, Type: CardUnknown}, nil
+	}
+	err := r.script[0]
+	r.script = r.script[1:]
+	return nil, &Error{Kind: err, Err: errors.New("scripted")}
+}
+
+func (r *scriptedReader) ReadDataBlocks(timeout time.Duration, sector int) ([]byte, error) {
+	return nil, errors.New("not supported")
+}
+
+func (r *scriptedReader) ReadDataBlock(timeout time.Duration, sector int, block int) ([]byte, error) {
+	return nil, errors.New("not supported")
+}
+
+func (r *scriptedReader) ReadAuthBlock(timeout time.Duration, sector int) (*AuthBlock, error) {
+	return nil, errors.New("not supported")
+}
+
+func (r *scriptedReader) String() string {
+	return "scriptedReader"
+}
+
+func newScriptedPoller(script ...error) (*Poller, *scriptedReader, *sleepClock) {
+	clk := &sleepClock{Fake: clock.NewFake(pollerStart)}
+	r := &scriptedReader{script: script, clock: clk}
+	return NewPoller(r, clk), r, clk
+}
+
+func repeat(err error, n int) []error {
+	result := make([]error, n)
+	for i := range result {
+		result[i] = err
+	}
+	return result
+}
+
+func TestPollerReadCard(t *testing.T) {
+	tests := []struct {
+		name      string
+		script    []error
+		wantCard  bool
+		wantErr   error
+		wantSleep []time.Duration
+	}{
+		{"card", nil, true, nil, nil},
+		{"timeout", []error{ErrTimeout}, false, nil, nil},
+		{"no card", []error{ErrNoCard, ErrNoCard}, true, nil, []time.Duration{noCardRetryDelay, noCardRetryDelay}},
+		{"auth", []error{ErrAuth}, false, ErrAuth, nil},
+		{"transient", []error{ErrTransient, ErrTransient}, true, nil, []time.Duration{minBackoff, 2 * minBackoff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _, clk := newScriptedPoller(tt.script...)
+			card, err := p.ReadCard(pollerStart.Add(time.Minute))
+			if (card != nil) != tt.wantCard || !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("ReadCard = %v, %v, want card: %t, error %v", card, err, tt.wantCard, tt.wantErr)
+			}
+			if !reflect.DeepEqual(clk.slept, tt.wantSleep) {
+				t.Errorf("ReadCard slept %v, want %v", clk.slept, tt.wantSleep)
+			}
+		})
+	}
+}
+
+// TestPollerBackoff checks that the delay after consecutive transient errors
+// doubles up to MaxBackoff, is reset by a successful read, and is cut short
+// by the deadline.
+func TestPollerBackoff(t *testing.T) {
+	p, r, clk := newScriptedPoller(repeat(ErrTransient, 8)...)
+	card, err := p.ReadCard(pollerStart.Add(time.Minute))
+	if card == nil || err != nil {
+		t.Fatalf("ReadCard = %v, %v, want a card", card, err)
+	}
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		1600 * time.Millisecond,
+		3200 * time.Millisecond,
+		MaxBackoff,
+		MaxBackoff,
+	}
+	if !reflect.DeepEqual(clk.slept, want) {
+		t.Errorf("ReadCard slept %v, want %v", clk.slept, want)
+	}
+
+	clk.slept = nil
+	r.script = []error{ErrTransient}
+	card, err = p.ReadCard(clk.Now().Add(time.Minute))
+	if card == nil || err != nil {
+		t.Fatalf("ReadCard = %v, %v, want a card", card, err)
+	}
+	if !reflect.DeepEqual(clk.slept, []time.Duration{minBackoff}) {
+		t.Errorf("ReadCard after a successful read slept %v, want %v", clk.slept, []time.Duration{minBackoff})
+	}
+
+	clk.slept = nil
+	r.script = repeat(ErrTransient, 8)
+	card, err = p.ReadCard(clk.Now().Add(time.Second))
+	if card != nil || err != nil {
+		t.Errorf("ReadCard = %v, %v, want nil, nil after the deadline", card, err)
+	}
+	var total time.Duration
+	for _, d := range clk.slept {
+		total += d
+	}
+	if total != time.Second {
+		t.Errorf("ReadCard slept %v, want %s until the deadline", clk.slept, time.Second)
+	}
+}
+
+// TestPollerReinitialize checks that transient errors re-initialize the
+// reader at most every minReinitInterval.
+func TestPollerReinitialize(t *testing.T) {
+	p, r, clk := newScriptedPoller()
+	err := p.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Backoffs add up to 31.3s after 11 errors, so only the last one
+	// re-initializes the reader.
+	r.script = repeat(ErrTransient, 11)
+	card, err := p.ReadCard(pollerStart.Add(time.Hour))
+	if card == nil || err != nil {
+		t.Fatalf("ReadCard = %v, %v, want a card", card, err)
+	}
+	want := []time.Time{pollerStart, pollerStart.Add(31300 * time.Millisecond)}
+	if !reflect.DeepEqual(r.inits, want) {
+		t.Errorf("reader was initialized at %v, want %v", r.inits, want)
+	}
+
+	// The reader was just re-initialized.
+	r.script = repeat(ErrTransient, 5)
+	card, err = p.ReadCard(clk.Now().Add(time.Hour))
+	if card == nil || err != nil {
+		t.Fatalf("ReadCard = %v, %v, want a card", card, err)
+	}
+	if len(r.inits) != 2 {
+		t.Errorf("reader was initialized at %v, want no re-initialization within %s", r.inits, minReinitInterval)
+	}
+}
+
+// TestPollerStatus checks that Status reports the last time the reader
+// responded and the error of its last failed read.
+func TestPollerStatus(t *testing.T) {
+	unplugged := errors.New("unplugged")
+	p, _, _ := newScriptedPoller(ErrAuth, unplugged)
+	if respondedAt, err := p.Status(); !respondedAt.IsZero() || err != nil {
+		t.Errorf("Status = %s, %v before the first read, want the zero time and no error", respondedAt, err)
+	}
+
+	// Card errors count as responses.
+	p.ReadCard(pollerStart.Add(time.Minute))
+	if respondedAt, err := p.Status(); !respondedAt.Equal(pollerStart) || err != nil {
+		t.Errorf("Status = %s, %v after a card error, want %s and no error", respondedAt, err, pollerStart)
+	}
+
+	p.ReadCard(pollerStart.Add(time.Minute))
+	if respondedAt, err := p.Status(); !respondedAt.Equal(pollerStart) || !errors.Is(err, unplugged) {
+		t.Errorf("Status = %s, %v after a failed read, want %s and %v", respondedAt, err, pollerStart, unplugged)
+	}
+
+	p.ReadCard(pollerStart.Add(time.Minute))
+	if respondedAt, err := p.Status(); !respondedAt.Equal(pollerStart) || err != nil {
+		t.Errorf("Status = %s, %v after a read, want %s and no error", respondedAt, err, pollerStart)
+	}
+}
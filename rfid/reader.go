@@ -4,7 +4,8 @@ import (
 	"time"
 )
 
-// NumSectors is the number of sectors on a MIFARE Classic 1K card.
+// NumSectors is the number of sectors on a MIFARE Classic 1K card. See
+// CardType.Layout for other cards.
 var NumSectors = 16
 
 // NumDataBlocksPerSector is the number of data blocks per sector on a MIFARE Classic 1K card.
@@ -14,12 +15,30 @@ var NumDataBlocksPerSector = 3
 var NumBytesPerBlock = 16
 
 // Reader accesses a RFID reader
+//
+// Errors returned while reading are *Error values whose kind is one of
+// ErrTimeout, ErrTransient, ErrNoCard or ErrAuth.
+//
+// Sectors and blocks are numbered as laid out by the type of the card in
+// front of the reader, see CardType.Layout. Readers that can't detect the
+// type treat cards as CardUnknown.
 type Reader interface {
 	Initialize() error
 	Halt() error
 	ReadUID(timeout time.Duration) ([]byte, error)
+	ReadCard(timeout time.Duration) (*Card, error)
 	ReadDataBlocks(timeout time.Duration, sector int) (data []byte, err error)
 	ReadDataBlock(timeout time.Duration, sector int, block int) (data []byte, err error)
 	ReadAuthBlock(timeout time.Duration, sector int) (authBlock *AuthBlock, err error)
 	String() string
 }
+
+// readUnknownCard reads a card with r.ReadUID, for readers that can't detect
+// card types.
+func readUnknownCard(r Reader, timeout time.Duration) (*Card, error) {
+	uid, err := r.ReadUID(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Card{UID: uid, Type: CardUnknown}, nil
+}
@@ -0,0 +1,178 @@
+package rfid
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/serial"
+)
+
+func init() {
+	config.RegisterValidator(func(cfg *config.Config) error {
+		if cfg.Reader.Type != "serial" {
+			return nil
+		}
+		s := cfg.Reader.Serial
+		if s.Device == "" {
+			return errors.New("reader.serial.device is required")
+		}
+		if s.Baud <= 0 {
+			return errors.New("reader.serial.baud must be positive")
+		}
+		if s.End == "" {
+			return errors.New("reader.serial.end is required")
+		}
+		err := validateEncoding(s.Encoding)
+		if err != nil {
+			return fmt.Errorf("reader.serial.encoding: %s", err)
+		}
+		switch s.Checksum {
+		case "none":
+		case "xor":
+			if s.Encoding != "hex" {
+				return errors.New(`reader.serial.checksum: "xor" requires encoding "hex"`)
+			}
+		default:
+			return fmt.Errorf("reader.serial.checksum: unknown checksum %q", s.Checksum)
+		}
+		return nil
+	})
+}
+
+// SerialReader is a Reader for readers sending the number of each card as a
+// message over a serial port, such as RDM6300 125 kHz readers. Messages
+// start and end with configurable markers and may carry a checksum.
+type SerialReader struct {
+	stream streamReader
+	device string
+}
+
+// NewSerialReader returns a reader for the serial port opened by open, framed
+// as configured by cfg. Call Initialize to start reading.
+func NewSerialReader(cfg config.SerialReaderConfig, open func() (io.ReadCloser, error), clk clock.Clock) *SerialReader {
+	r := &SerialReader{device: cfg.Device}
+	r.stream = streamReader{
+		name:  r.String(),
+		open:  open,
+		clock: clk,
+		split: splitFrames([]byte(cfg.Start), []byte(cfg.End)),
+		decode: func(msg string) ([]byte, error) {
+			if cfg.Checksum == "xor" {
+				var err error
+				msg, err = checkXOR(msg)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return decodeCardNumber(cfg.Encoding, msg)
+		},
+	}
+	return r
+}
+
+// OpenSerial returns a function opening the serial port selected by cfg, for
+// NewSerialReader.
+func OpenSerial(cfg config.SerialReaderConfig) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return serial.Open(cfg.Device, cfg.Baud)
+	}
+}
+
+// splitFrames returns a function returning a function that returns the next
+// message between start and end read from a stream. Bytes before start are
+// skipped. If start is empty, messages are separated by end.
+func splitFrames(start, end []byte) func(r io.Reader) func() (string, error) {
+	return func(r io.Reader) func() (string, error) {
+		br := bufio.NewReader(r)
+		return func() (string, error) {
+			var buf []byte
+			inFrame := len(start) == 0
+			for {
+				c, err := br.ReadByte()
+				if err != nil {
+					return "", err
+				}
+				buf = append(buf, c)
+				if !inFrame {
+					if bytes.HasSuffix(buf, start) {
+						inFrame = true
+						buf = buf[:0]
+					}
+					continue
+				}
+				if bytes.HasSuffix(buf, end) {
+					return string(buf[:len(buf)-len(end)]), nil
+				}
+			}
+		}
+	}
+}
+
+// checkXOR checks that the last byte of msg, a hex string, is the XOR of the
+// preceding bytes and returns msg without it.
+func checkXOR(msg string) (string, error) {
+	b, err := hex.DecodeString(msg)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < 2 {
+		return "", fmt.Errorf("message %q is too short for a checksum", msg)
+	}
+	var sum byte
+	for _, c := range b[:len(b)-1] {
+		sum ^= c
+	}
+	if sum != b[len(b)-1] {
+		return "", fmt.Errorf("checksum mismatch: got %02x, want %02x", b[len(b)-1], sum)
+	}
+	return msg[:len(msg)-2], nil
+}
+
+// Initialize opens the serial port, unless the reader already reads it.
+func (r *SerialReader) Initialize() error {
+	return r.stream.initialize()
+}
+
+// Halt closes the serial port.
+func (r *SerialReader) Halt() error {
+	return r.stream.halt()
+}
+
+// ReadUID waits for the next card number. Messages that can't be decoded or
+// whose checksum doesn't match are logged and skipped.
+func (r *SerialReader) ReadUID(timeout time.Duration) ([]byte, error) {
+	return r.stream.readUID(timeout)
+}
+
+// ReadCard reads the UID of the next card. Serial readers don't report the
+// type, so it is unknown.
+func (r *SerialReader) ReadCard(timeout time.Duration) (*Card, error) {
+	return readUnknownCard(r, timeout)
+}
+
+// ReadDataBlocks returns an error. Serial readers don't read card memory.
+func (r *SerialReader) ReadDataBlocks(timeout time.Duration, sector int) ([]byte, error) {
+	return nil, errNoMemory
+}
+
+// ReadDataBlock returns an error. Serial readers don't read card memory.
+func (r *SerialReader) ReadDataBlock(timeout time.Duration, sector int, block int) ([]byte, error) {
+	return nil, errNoMemory
+}
+
+// ReadAuthBlock returns an error. Serial readers don't read card memory.
+func (r *SerialReader) ReadAuthBlock(timeout time.Duration, sector int) (*AuthBlock, error) {
+	return nil, errNoMemory
+}
+
+// String returns a human-readable string describing this Reader.
+func (r *SerialReader) String() string {
+	return fmt.Sprintf("serial reader on %s", r.device)
+}
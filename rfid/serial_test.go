@@ -0,0 +1,91 @@
+package rfid
+
+import (
+	"testing"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+)
+
+func TestSerialReaderRDM6300(t *testing.T) {
+	open, w := pipeReader(t)
+	r := NewSerialReader(config.SerialReaderConfig{
+		Device:   "pipe",
+		Start:    "\x02",
+		End:      "\x03",
+		Encoding: "hex",
+		Checksum: "xor",
+	}, open, clock.Real)
+	err := r.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Halt()
+
+	// Frames of an RDM6300: STX, 10 hex digits of the card, the hex XOR of
+	// its 5 bytes and ETX. The first is preceded by noise of the port being
+	// opened, the second has a wrong checksum and is skipped, and the third
+	// is split across writes.
+	for _, s := range []string{
+		"\x00\xff\x0262E3086CED08\x03",
+		"\x020F0000A1B2C4\x03",
+		"\x020F0000", "A1B2",
+		"1C\x03",
+	} {
+		_, err = w.Write([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectUIDs(t, r, "62e3086ced", "0f0000a1b2")
+	expectClosed(t, r, w)
+}
+
+func TestSerialReaderLines(t *testing.T) {
+	open, w := pipeReader(t)
+	r := NewSerialReader(config.SerialReaderConfig{
+		Device:   "pipe",
+		End:      "\r\n",
+		Encoding: "decimal",
+		Checksum: "none",
+	}, open, clock.Real)
+	err := r.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Halt()
+
+	// Card numbers, one per line, with an empty line and a garbled one, which
+	// are skipped.
+	_, err = w.Write([]byte("0012345678\r\n\r\n12x4\r\n 0000000125 \r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectUIDs(t, r, "00bc614e", "0000007d")
+	expectClosed(t, r, w)
+}
+
+func TestCheckXOR(t *testing.T) {
+	tests := []struct {
+		msg     string
+		want    string
+		wantErr bool
+	}{
+		{msg: "62E3086CED08", want: "62E3086CED"},
+		{msg: "0f0000a1b21c", want: "0f0000a1b2"},
+		{msg: "0101", want: "01"},
+		{msg: "62E3086CED09", wantErr: true},
+		{msg: "01", wantErr: true},
+		{msg: "", wantErr: true},
+		{msg: "62E3086CED0", wantErr: true},
+		{msg: "zz00", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := checkXOR(tt.msg)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("checkXOR(%q) = %q, %v, want %q, error: %t", tt.msg, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package rfid
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pakohan/craftdoor/logging"
+)
+
+// defaultHold is how long "present" holds a tag in front of the reader if no
+// duration is given, roughly the length of a tap.
+const defaultHold = 500 * time.Millisecond
+
+// errorKinds maps the names accepted by the "error" command to error kinds.
+var errorKinds = map[string]error{
+	"timeout":   ErrTimeout,
+	"transient": ErrTransient,
+	"no_card":   ErrNoCard,
+	"auth":      ErrAuth,
+}
+
+// Exec runs a single control command. Blank lines and lines starting with "#"
+// are ignored. The commands are:
+//
+//	present <uid> [hold]  present a tag for hold (default 500ms, 0 = until removed)
+//	remove                remove the presented tag
+//	error <kind> [count]  fail the next count reads (default 1) with timeout,
+//	                      transient, no_card or auth
+//	latency <duration>    change how long each read takes
+//	card <uid> <data>     set the hex-encoded memory contents of a tag
+//	type <uid> <type>     set the type of a tag, e.g. ultralight
+//	sleep <duration>      wait before running the next command
+//
+// UIDs are hex-encoded and durations are formatted like "1.5s".
+func (r *SimulatedReader) Exec(ctx context.Context, line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return nil
+	}
+	command, args := fields[0], fields[1:]
+
+	switch command {
+	case "present":
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("usage: present <uid> [hold]")
+		}
+		uid, err := ParseUID(args[0])
+		if err != nil {
+			return err
+		}
+		hold := defaultHold
+		if len(args) == 2 {
+			hold, err = parseDuration(args[1])
+			if err != nil {
+				return err
+			}
+		}
+		r.Present(uid, hold)
+	case "remove":
+		if len(args) != 0 {
+			return errors.New("usage: remove")
+		}
+		r.Remove()
+	case "error":
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("usage: error <kind> [count]")
+		}
+		kind, ok := errorKinds[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown error kind %q", args[0])
+		}
+		count := 1
+		if len(args) == 2 {
+			var err error
+			count, err = strconv.Atoi(args[1])
+			if err != nil || count < 1 {
+				return fmt.Errorf("invalid count %q", args[1])
+			}
+		}
+		r.Inject(kind, count)
+	case "latency":
+		if len(args) != 1 {
+			return errors.New("usage: latency <duration>")
+		}
+		latency, err := parseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		r.SetLatency(latency)
+	case "card":
+		if len(args) != 2 {
+			return errors.New("usage: card <uid> <data>")
+		}
+		uid, err := ParseUID(args[0])
+		if err != nil {
+			return err
+		}
+		data, err := hex.DecodeString(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid data: %s", err)
+		}
+		return r.SetCard(uid, data)
+	case "type":
+		if len(args) != 2 {
+			return errors.New("usage: type <uid> <type>")
+		}
+		uid, err := ParseUID(args[0])
+		if err != nil {
+			return err
+		}
+		t, err := ParseCardType(args[1])
+		if err != nil {
+			return err
+		}
+		return r.SetCardType(uid, t)
+	case "sleep":
+		if len(args) != 1 {
+			return errors.New("usage: sleep <duration>")
+		}
+		d, err := parseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		timer := r.clock.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C():
+		}
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+	return nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	if value == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration %q must not be negative", value)
+	}
+	return d, nil
+}
+
+// RunScript runs the commands read from in, one per line, until in is
+// exhausted or ctx is done. If out is not nil, "ok" or the error is written
+// to out after each command. Failed commands don't stop the script.
+func (r *SimulatedReader) RunScript(ctx context.Context, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := r.Exec(ctx, scanner.Text())
+		if err != nil {
+			logging.Warnf("Simulated reader command %q failed: %s", scanner.Text(), err)
+		}
+		if out == nil {
+			continue
+		}
+		reply := "ok\n"
+		if err != nil {
+			reply = fmt.Sprintf("error: %s\n", err)
+		}
+		_, err = io.WriteString(out, reply)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ParseControl parses config.SimulatedReaderConfig.Control into its kind, ""
+// "stdin" or "unix", and the socket path for "unix".
+func ParseControl(value string) (kind string, path string, err error) {
+	switch {
+	case value == "" || value == "stdin":
+		return value, "", nil
+	case strings.HasPrefix(value, "unix:") && len(value) > len("unix:"):
+		return "unix", strings.TrimPrefix(value, "unix:"), nil
+	default:
+		return "", "", fmt.Errorf("expected \"stdin\" or \"unix:<path>\", got %q", value)
+	}
+}
+
+// ServeControl runs commands from the control channel given by
+// config.SimulatedReaderConfig.Control until ctx is done. A unix socket
+// accepts any number of connections, each of which receives a reply per
+// command.
+func (r *SimulatedReader) ServeControl(ctx context.Context, control string) error {
+	kind, path, err := ParseControl(control)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case "stdin":
+		return r.RunScript(ctx, os.Stdin, nil)
+	case "unix":
+		return r.serveUnix(ctx, path)
+	default:
+		return nil
+	}
+}
+
+func (r *SimulatedReader) serveUnix(ctx context.Context, path string) error {
+	// Remove the socket left behind by a previous run, if any.
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	logging.Infof("Accepting simulated reader commands on %s", path)
+	go func() {
+		<-ctx.Done()
+		e := listener.Close()
+		if e != nil {
+			logging.Errorf("failed closing simulated reader socket: %s", e)
+		}
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer func() {
+				e := conn.Close()
+				if e != nil {
+					logging.Errorf("failed closing simulated reader connection: %s", e)
+				}
+			}()
+			e := r.RunScript(ctx, conn, conn)
+			if e != nil && ctx.Err() == nil {
+				logging.Warnf("Simulated reader connection failed: %s", e)
+			}
+		}()
+	}
+}
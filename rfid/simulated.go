@@ -0,0 +1,446 @@
+package rfid
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"periph.io/x/periph/experimental/devices/mfrc522"
+)
+
+func init() {
+	config.RegisterValidator(func(cfg *config.Config) error {
+		types, err := parseSimulatedCardTypes(cfg.Reader.Simulated.CardTypes)
+		if err != nil {
+			return fmt.Errorf("reader.simulated.card_types: %s", err)
+		}
+		_, err = parseSimulatedCards(cfg.Reader.Simulated.Cards, types)
+		if err != nil {
+			return fmt.Errorf("reader.simulated.cards: %s", err)
+		}
+		_, _, err = ParseControl(cfg.Reader.Simulated.Control)
+		if err != nil {
+			return fmt.Errorf("reader.simulated.control: %s", err)
+		}
+		return nil
+	})
+}
+
+// SimulatedReader is a Reader whose tags are presented by commands rather
+// than held in front of an antenna. See Exec for the commands.
+//
+// While no tag is presented, ReadUID blocks until one is or the timeout is
+// reached, like a real reader. Timeouts, latencies and how long tags are
+// held follow the reader's clock.
+type SimulatedReader struct {
+	clock clock.Clock
+
+	// Guards all fields below.
+	mu sync.Mutex
+
+	// Closed and replaced whenever the presented tag or the queued errors
+	// change, waking up blocked reads.
+	changed chan struct{}
+
+	// The presented tag, or nil. Removed once until has passed, unless until
+	// is zero.
+	uid   []byte
+	until time.Time
+
+	// Kinds of errors returned by the next reads, in order.
+	injected []error
+
+	// Number of reads waiting for a tag to be presented.
+	waiting int
+
+	latency   time.Duration
+	errorRate float64
+	rand      *rand.Rand
+
+	// Memory contents and types of tags, keyed by hex-encoded UID. Memory
+	// contents are padded when read.
+	cards map[string][]byte
+	types map[string]CardType
+}
+
+// NewSimulatedReader returns a new SimulatedReader with no tag presented.
+// Time is told by clk, e.g. clock.Real.
+func NewSimulatedReader(cfg config.SimulatedReaderConfig, clk clock.Clock) (*SimulatedReader, error) {
+	result := &SimulatedReader{
+		clock:   clk,
+		changed: make(chan struct{}),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	err := result.configure(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ApplyConfig changes the latency, error rate, card contents and types.
+func (r *SimulatedReader) ApplyConfig(cfg *config.Config) error {
+	return r.configure(cfg.Reader.Simulated)
+}
+
+func (r *SimulatedReader) configure(cfg config.SimulatedReaderConfig) error {
+	types, err := parseSimulatedCardTypes(cfg.CardTypes)
+	if err != nil {
+		return err
+	}
+	cards, err := parseSimulatedCards(cfg.Cards, types)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latency = cfg.Latency.Duration
+	r.errorRate = cfg.ErrorRate
+	r.cards = cards
+	r.types = types
+	return nil
+}
+
+// parseSimulatedCardTypes parses config.SimulatedReaderConfig.CardTypes. Keys
+// of the result are lowercase.
+func parseSimulatedCardTypes(types map[string]string) (map[string]CardType, error) {
+	result := map[string]CardType{}
+	for uid, value := range types {
+		_, err := ParseUID(uid)
+		if err != nil {
+			return nil, err
+		}
+		t, err := ParseCardType(value)
+		if err != nil {
+			return nil, fmt.Errorf("card %s: %s", uid, err)
+		}
+		result[strings.ToLower(uid)] = t
+	}
+	return result, nil
+}
+
+// parseSimulatedCards decodes the hex-encoded UIDs and memory contents of
+// config.SimulatedReaderConfig.Cards, which must fit in the memory of the
+// cards' types. Keys of the result are lowercase.
+func parseSimulatedCards(cards map[string]string, types map[string]CardType) (map[string][]byte, error) {
+	result := map[string][]byte{}
+	for uid, contents := range cards {
+		_, err := ParseUID(uid)
+		if err != nil {
+			return nil, err
+		}
+		uid = strings.ToLower(uid)
+		data, err := hex.DecodeString(contents)
+		if err != nil {
+			return nil, fmt.Errorf("card %s: %s", uid, err)
+		}
+		err = checkFits(data, cardType(types, uid))
+		if err != nil {
+			return nil, fmt.Errorf("card %s: %s", uid, err)
+		}
+		result[uid] = data
+	}
+	return result, nil
+}
+
+// cardType returns the type of the tag uid, CardUnknown if it has none.
+func cardType(types map[string]CardType, uid string) CardType {
+	t, ok := types[uid]
+	if !ok {
+		return CardUnknown
+	}
+	return t
+}
+
+// checkFits returns an error unless data fits in the memory of a card of
+// type t.
+func checkFits(data []byte, t CardType) error {
+	if size := t.Layout().Size(); len(data) > size {
+		return fmt.Errorf("%d bytes don't fit in %d bytes of %s memory", len(data), size, t)
+	}
+	return nil
+}
+
+// ParseUID decodes a hex-encoded UID.
+func ParseUID(value string) ([]byte, error) {
+	uid, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UID %q: %s", value, err)
+	}
+	if len(uid) == 0 {
+		return nil, errors.New("UID is empty")
+	}
+	return uid, nil
+}
+
+// Present presents the tag uid until hold has passed. If hold is 0, the tag
+// stays until Remove is called. Replaces any tag already presented.
+func (r *SimulatedReader) Present(uid []byte, hold time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.uid = append([]byte(nil), uid...)
+	r.until = time.Time{}
+	if hold > 0 {
+		r.until = r.clock.Now().Add(hold)
+	}
+	r.notify()
+}
+
+// Remove removes the presented tag, if any.
+func (r *SimulatedReader) Remove() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.uid = nil
+	r.notify()
+}
+
+// Inject makes the next count reads fail with an error of the given kind,
+// e.g. ErrTransient.
+func (r *SimulatedReader) Inject(kind error, count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := 0; i < count; i++ {
+		r.injected = append(r.injected, kind)
+	}
+	r.notify()
+}
+
+// SetLatency changes how long each read takes until the config is reloaded.
+func (r *SimulatedReader) SetLatency(latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latency = latency
+}
+
+// SetCard changes the memory contents of the tag uid until the config is
+// reloaded. data is zero-padded.
+func (r *SimulatedReader) SetCard(uid []byte, data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := hex.EncodeToString(uid)
+	err := checkFits(data, cardType(r.types, key))
+	if err != nil {
+		return err
+	}
+	r.cards[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// SetCardType changes the type of the tag uid until the config is reloaded.
+// Its memory contents must fit in the new type's memory.
+func (r *SimulatedReader) SetCardType(uid []byte, t CardType) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := hex.EncodeToString(uid)
+	err := checkFits(r.cards[key], t)
+	if err != nil {
+		return err
+	}
+	r.types[key] = t
+	return nil
+}
+
+// SimulatedReaderState describes the tag presented to a SimulatedReader.
+type SimulatedReaderState struct {
+	// Hex-encoded UID of the presented tag, or "" if none is.
+	UID string `json:"uid"`
+
+	// When the tag will be removed, or nil if it stays until removed.
+	Until *time.Time `json:"until"`
+
+	// Number of reads that will fail with injected errors.
+	InjectedErrors int `json:"injected_errors"`
+}
+
+// State returns the presented tag.
+func (r *SimulatedReader) State() SimulatedReaderState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := SimulatedReaderState{InjectedErrors: len(r.injected)}
+	uid := r.presented(r.clock.Now())
+	if uid == nil {
+		return result
+	}
+	result.UID = hex.EncodeToString(uid)
+	if !r.until.IsZero() {
+		until := r.until
+		result.Until = &until
+	}
+	return result
+}
+
+// Idle returns whether no tag is presented and a read waits for one, i.e.
+// the reader's user is done with the tags presented earlier.
+func (r *SimulatedReader) Idle() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.presented(r.clock.Now()) == nil && r.waiting > 0
+}
+
+// notify wakes up blocked reads. Must be called with mu held.
+func (r *SimulatedReader) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// presented returns the UID of the tag presented at now, or nil. Must be
+// called with mu held.
+func (r *SimulatedReader) presented(now time.Time) []byte {
+	if r.uid != nil && !r.until.IsZero() && !now.Before(r.until) {
+		r.uid = nil
+	}
+	return r.uid
+}
+
+// Initialize does nothing.
+func (r *SimulatedReader) Initialize() error {
+	return nil
+}
+
+// Halt does nothing.
+func (r *SimulatedReader) Halt() error {
+	return nil
+}
+
+// ReadUID returns the UID of the presented tag after the configured latency.
+// If no tag is presented, waits for one until the timeout.
+func (r *SimulatedReader) ReadUID(timeout time.Duration) ([]byte, error) {
+	deadline := r.clock.Now().Add(timeout)
+	for {
+		remaining := deadline.Sub(r.clock.Now())
+		if remaining <= 0 {
+			return nil, &Error{Kind: ErrTimeout, Err: errors.New("no tag presented")}
+		}
+
+		r.mu.Lock()
+		uid := r.presented(r.clock.Now())
+		var injected error
+		if len(r.injected) > 0 {
+			injected, r.injected = r.injected[0], r.injected[1:]
+		} else if uid != nil && r.errorRate > 0 && r.rand.Float64() < r.errorRate {
+			injected = ErrTransient
+		}
+		latency := r.latency
+		changed := r.changed
+		if injected == nil && uid == nil {
+			r.waiting++
+		}
+		r.mu.Unlock()
+
+		if injected != nil || uid != nil {
+			if latency > remaining {
+				r.clock.Sleep(remaining)
+				return nil, &Error{Kind: ErrTimeout, Err: errors.New("read took longer than timeout")}
+			}
+			r.clock.Sleep(latency)
+		}
+		if injected != nil {
+			return nil, &Error{Kind: injected, Err: errors.New("simulated error")}
+		}
+		if uid != nil {
+			// A tag removed during the read is missed, as if it had never
+			// been presented.
+			r.mu.Lock()
+			still := bytes.Equal(r.presented(r.clock.Now()), uid)
+			r.mu.Unlock()
+			if still {
+				return append([]byte(nil), uid...), nil
+			}
+			continue
+		}
+
+		timer := r.clock.NewTimer(remaining)
+		select {
+		case <-changed:
+		case <-timer.C():
+		}
+		timer.Stop()
+		r.mu.Lock()
+		r.waiting--
+		r.mu.Unlock()
+	}
+}
+
+// ReadCard returns the UID and type of the presented tag, see ReadUID.
+func (r *SimulatedReader) ReadCard(timeout time.Duration) (*Card, error) {
+	uid, err := r.ReadUID(timeout)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Card{UID: uid, Type: cardType(r.types, hex.EncodeToString(uid))}, nil
+}
+
+// ReadDataBlocks returns the data blocks of a sector of the presented tag.
+func (r *SimulatedReader) ReadDataBlocks(timeout time.Duration, sector int) (data []byte, err error) {
+	memory, layout, err := r.memory()
+	if err != nil {
+		return nil, err
+	}
+	err = layout.CheckSector(sector)
+	if err != nil {
+		return nil, err
+	}
+	return memory[layout.Offset(sector):layout.Offset(sector+1)], nil
+}
+
+// ReadDataBlock returns a data block of the presented tag.
+func (r *SimulatedReader) ReadDataBlock(timeout time.Duration, sector int, block int) (data []byte, err error) {
+	memory, layout, err := r.memory()
+	if err != nil {
+		return nil, err
+	}
+	err = layout.CheckBlock(sector, block)
+	if err != nil {
+		return nil, err
+	}
+	start := layout.Offset(sector) + block*layout.BlockSize
+	return memory[start : start+layout.BlockSize], nil
+}
+
+// ReadAuthBlock returns an AuthBlock with the default keys of a new card.
+func (r *SimulatedReader) ReadAuthBlock(timeout time.Duration, sector int) (authBlock *AuthBlock, err error) {
+	_, layout, err := r.memory()
+	if err != nil {
+		return nil, err
+	}
+	err = layout.CheckTrailer(sector)
+	if err != nil {
+		return nil, err
+	}
+	result := &AuthBlock{
+		KeyA:        mfrc522.Key{},
+		KeyB:        mfrc522.DefaultKey,
+		Permissions: mfrc522.BlocksAccess{},
+	}
+	return result, nil
+}
+
+// memory returns a copy of the memory contents of the presented tag and the
+// layout of its type.
+func (r *SimulatedReader) memory() ([]byte, Layout, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	uid := r.presented(r.clock.Now())
+	if uid == nil {
+		return nil, Layout{}, &Error{Kind: ErrNoCard, Err: errors.New("no tag presented")}
+	}
+	key := hex.EncodeToString(uid)
+	layout := cardType(r.types, key).Layout()
+	memory := make([]byte, layout.Size())
+	copy(memory, r.cards[key])
+	return memory, layout, nil
+}
+
+// String returns a string representation of a SimulatedReader.
+func (r *SimulatedReader) String() string {
+	return "SimulatedReader"
+}
@@ -0,0 +1,190 @@
+package rfid
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/logging"
+)
+
+// errNoMemory is returned when reading a card's memory from a reader that
+// only sends card numbers.
+var errNoMemory = errors.New("reader only sends a card's number")
+
+// streamReader is the part of a Reader shared by readers that send card
+// numbers as messages in a byte stream, such as keyboard wedges and serial
+// readers.
+type streamReader struct {
+	name string
+
+	// Opens the stream.
+	open func() (io.ReadCloser, error)
+
+	// Returns a function returning the next message read from a stream.
+	split func(r io.Reader) func() (string, error)
+
+	// Returns the UID sent as a message.
+	decode func(msg string) ([]byte, error)
+
+	// Tells the time for read timeouts.
+	clock clock.Clock
+
+	// Guards all fields below, which are nil until the reader is
+	// initialized.
+	mu       sync.Mutex
+	stream   io.ReadCloser
+	messages chan string
+
+	// Closed once reading the stream failed, after err is set.
+	done chan struct{}
+	err  error
+}
+
+// initialize opens the stream and starts reading messages from it, unless
+// the reader already does.
+func (r *streamReader) initialize() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stream != nil {
+		select {
+		case <-r.done:
+			logging.Warnf("%s: reopening after read error: %s", r.name, r.err)
+		default:
+			return nil
+		}
+	}
+	r.closeStream()
+
+	stream, err := r.open()
+	if err != nil {
+		logging.Errorf("Failed to open %s: %s", r.name, err)
+		return err
+	}
+	r.stream = stream
+	r.messages = make(chan string, 4)
+	r.done = make(chan struct{})
+	go r.read(r.split(stream), r.messages, r.done)
+	return nil
+}
+
+// read delivers messages returned by next until it fails. Messages that
+// aren't consumed in time are dropped.
+func (r *streamReader) read(next func() (string, error), messages chan<- string, done chan<- struct{}) {
+	for {
+		msg, err := next()
+		if err != nil {
+			r.mu.Lock()
+			r.err = err
+			r.mu.Unlock()
+			close(done)
+			return
+		}
+		select {
+		case messages <- msg:
+		default:
+			logging.Warnf("%s: dropping message %q", r.name, msg)
+		}
+	}
+}
+
+// halt closes the stream, which stops reading it.
+func (r *streamReader) halt() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closeStream()
+}
+
+// closeStream closes the stream if it is open.
+//
+// Must be called with mu held.
+func (r *streamReader) closeStream() error {
+	if r.stream == nil {
+		return nil
+	}
+	err := r.stream.Close()
+	r.stream, r.messages, r.done = nil, nil, nil
+	if err != nil {
+		logging.Errorf("Failed to close %s: %s", r.name, err)
+	}
+	return err
+}
+
+// readUID waits for the next message. Messages that can't be decoded are
+// logged and skipped.
+func (r *streamReader) readUID(timeout time.Duration) ([]byte, error) {
+	r.mu.Lock()
+	messages, done := r.messages, r.done
+	r.mu.Unlock()
+	if messages == nil {
+		return nil, &Error{Kind: ErrTransient, Err: errors.New("reader is not initialized")}
+	}
+
+	timer := r.clock.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C():
+			return nil, &Error{Kind: ErrTimeout, Err: fmt.Errorf("no card within %s", timeout)}
+		case msg := <-messages:
+			uid, err := r.decode(msg)
+			if err != nil {
+				logging.Warnf("%s: ignoring message %q: %s", r.name, msg, err)
+				continue
+			}
+			logging.Debugf("Received card %x.", uid)
+			return uid, nil
+		case <-done:
+			r.mu.Lock()
+			err := r.err
+			r.mu.Unlock()
+			return nil, &Error{Kind: ErrTransient, Err: fmt.Errorf("reading %s: %w", r.name, err)}
+		}
+	}
+}
+
+// decodeCardNumber returns the UID of a card whose number is s, written in
+// encoding: "hex", or "decimal", whose UIDs are the number's big-endian bytes
+// padded to at least 4 bytes, as MFRC522 readers read 4-byte UIDs.
+func decodeCardNumber(encoding string, s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("empty card number")
+	}
+	switch encoding {
+	case "hex":
+		return hex.DecodeString(s)
+	case "decimal":
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		uid := make([]byte, 8)
+		binary.BigEndian.PutUint64(uid, n)
+		i := 0
+		for i < 4 && uid[i] == 0 {
+			i++
+		}
+		return uid[i:], nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
+
+// validateEncoding returns an error unless encoding is supported by
+// decodeCardNumber.
+func validateEncoding(encoding string) error {
+	switch encoding {
+	case "hex", "decimal":
+		return nil
+	default:
+		return fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
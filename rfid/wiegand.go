@@ -0,0 +1,201 @@
+package rfid
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/wiegand"
+	"periph.io/x/periph/conn/gpio"
+)
+
+func init() {
+	config.RegisterValidator(func(cfg *config.Config) error {
+		if cfg.Reader.Type != "wiegand" {
+			return nil
+		}
+		w := cfg.Reader.Wiegand
+		if w.D0Pin == "" || w.D1Pin == "" {
+			return errors.New("reader.wiegand: d0_pin and d1_pin are required")
+		}
+		_, err := parseByteOrder(w.ByteOrder)
+		if err != nil {
+			return fmt.Errorf("reader.wiegand.byte_order: %s", err)
+		}
+		return nil
+	})
+}
+
+// WiegandReader is a Reader receiving Wiegand-26 or Wiegand-34 frames from a
+// reader that reads the cards itself.
+//
+// Its UIDs are the frames' data without parity bits: 3 bytes for Wiegand-26
+// and 4 bytes for Wiegand-34. Readers sending 32-bit UIDs as Wiegand-34 thus
+// yield the same UIDs as an MFRC522, while Wiegand-26 readers only send 24
+// bits of them.
+type WiegandReader struct {
+	d0, d1  gpio.PinIn
+	reverse bool
+	clock   clock.Clock
+
+	// Guards receiver, which is nil until the reader is initialized.
+	mu       sync.Mutex
+	receiver *wiegand.Receiver
+}
+
+// NewWiegandReader returns a reader whose D0 and D1 lines are connected to d0
+// and d1. Read timeouts follow clk, e.g. clock.Real. Call Initialize to start
+// receiving.
+func NewWiegandReader(cfg config.WiegandReaderConfig, d0, d1 gpio.PinIn, clk clock.Clock) (*WiegandReader, error) {
+	reverse, err := parseByteOrder(cfg.ByteOrder)
+	if err != nil {
+		return nil, err
+	}
+	return &WiegandReader{d0: d0, d1: d1, reverse: reverse, clock: clk}, nil
+}
+
+// parseByteOrder returns whether UIDs are sent reversed, see
+// config.WiegandReaderConfig.ByteOrder.
+func parseByteOrder(order string) (bool, error) {
+	switch order {
+	case "msb":
+		return false, nil
+	case "lsb":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown byte order %q", order)
+	}
+}
+
+// Initialize starts receiving frames, unless the reader already does. Wiegand
+// readers don't answer, so there is nothing to check.
+func (r *WiegandReader) Initialize() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.receiver != nil {
+		return nil
+	}
+
+	var err error
+	r.receiver, err = wiegand.NewReceiver(r.String(), r.d0, r.d1)
+	if err != nil {
+		logging.Errorf("Failed to start Wiegand receiver: %s", err)
+		return err
+	}
+	return nil
+}
+
+// Halt stops receiving frames.
+func (r *WiegandReader) Halt() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.receiver == nil {
+		return nil
+	}
+	err := r.receiver.Close()
+	r.receiver = nil
+	return err
+}
+
+// ReadUID waits for the next card frame. Frames with parity errors or of
+// unknown length, e.g. sent by a keypad on the same lines, are logged and
+// skipped.
+func (r *WiegandReader) ReadUID(timeout time.Duration) ([]byte, error) {
+	r.mu.Lock()
+	receiver := r.receiver
+	r.mu.Unlock()
+	if receiver == nil {
+		return nil, &Error{Kind: ErrTransient, Err: errors.New("reader is not initialized")}
+	}
+
+	timer := r.clock.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C():
+			return nil, &Error{Kind: ErrTimeout, Err: fmt.Errorf("no frame within %s", timeout)}
+		case frame := <-receiver.Frames():
+			c, err := wiegand.Decode(frame)
+			if err != nil {
+				logging.Warnf("%s: ignoring frame: %s", r, err)
+				continue
+			}
+			logging.Debugf("Received %s frame with card %s.", c.Format.Name, c)
+			return r.uid(c), nil
+		}
+	}
+}
+
+// uid returns the UID sent as c.
+func (r *WiegandReader) uid(c wiegand.Credential) []byte {
+	n := c.Format.DataBits() / 8
+	uid := make([]byte, n)
+	for i := range uid {
+		uid[i] = byte(c.Data >> uint(8*(n-1-i)))
+	}
+	if r.reverse {
+		reverse(uid)
+	}
+	return uid
+}
+
+// Frame returns the frame a reader configured like r sends for a card whose
+// UID is uid: Wiegand-26 for 3-byte UIDs and Wiegand-34 for 4-byte UIDs. Used
+// to simulate readers.
+func (r *WiegandReader) Frame(uid []byte) ([]bool, error) {
+	var f wiegand.Format
+	switch len(uid) {
+	case 3:
+		f = wiegand.Wiegand26
+	case 4:
+		f = wiegand.Wiegand34
+	default:
+		return nil, fmt.Errorf("%d-byte UIDs can't be sent over Wiegand", len(uid))
+	}
+	sent := append([]byte(nil), uid...)
+	if r.reverse {
+		reverse(sent)
+	}
+	var data uint64
+	for _, b := range sent {
+		data = data<<8 | uint64(b)
+	}
+	return f.Encode(data), nil
+}
+
+// reverse reverses b in place.
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
+// ReadCard reads the UID of the next card. Wiegand frames don't carry the
+// type, so it is unknown.
+func (r *WiegandReader) ReadCard(timeout time.Duration) (*Card, error) {
+	return readUnknownCard(r, timeout)
+}
+
+// ReadDataBlocks returns an error. Wiegand readers don't read card memory.
+func (r *WiegandReader) ReadDataBlocks(timeout time.Duration, sector int) ([]byte, error) {
+	return nil, errNoMemory
+}
+
+// ReadDataBlock returns an error. Wiegand readers don't read card memory.
+func (r *WiegandReader) ReadDataBlock(timeout time.Duration, sector int, block int) ([]byte, error) {
+	return nil, errNoMemory
+}
+
+// ReadAuthBlock returns an error. Wiegand readers don't read card memory.
+func (r *WiegandReader) ReadAuthBlock(timeout time.Duration, sector int) (*AuthBlock, error) {
+	return nil, errNoMemory
+}
+
+// String returns a human-readable string describing this Reader.
+func (r *WiegandReader) String() string {
+	return fmt.Sprintf("Wiegand reader on %s/%s", r.d0, r.d1)
+}
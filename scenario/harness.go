@@ -0,0 +1,362 @@
+// Package scenario runs the complete stack, from the REST API down to the
+// door's GPIO pins, against a temporary database with a simulated reader,
+// door and clock. Scenarios are declared as a list of steps, so that
+// behaviour can be checked without hardware.
+package scenario
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	// Registers the sqlite3 driver.
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/controller"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/gpiosim"
+	"github.com/pakohan/craftdoor/lib"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/model"
+	"github.com/pakohan/craftdoor/node"
+	"github.com/pakohan/craftdoor/rfid"
+	"github.com/pakohan/craftdoor/service"
+)
+
+// DefaultStart is when scenarios start unless they set Scenario.Start: a
+// Monday at noon in the default timezone, while the bolt is unlocked by the
+// default schedule.
+var DefaultStart = time.Date(2026, time.January, 5, 12, 0, 0, 0, mustLoadLocation("Europe/Berlin"))
+
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return location
+}
+
+// Harness is a running stack. The readers, door, service, schedule and nodes
+// all follow Clock, so that time only passes when a step advances it.
+type Harness struct {
+	Clock   *clock.Fake
+	Reader  *rfid.SimulatedReader
+	Door    *door.RPiDoor
+	Sim     *door.Simulator
+	Model   model.Model
+	Service *service.Service
+
+	// Reads cards sent over D0 and D1 instead of Reader if reader.type is
+	// "wiegand". See Swipe.
+	Wiegand *rfid.WiegandReader
+	d0, d1  *gpiosim.Pin
+
+	// Reads card numbers written to a FIFO instead of Reader if reader.type
+	// is "evdev" or "serial". See Scan.
+	Stream rfid.Reader
+	fifo   *os.File
+
+	cfg     config.Config
+	handler http.Handler
+	dir     string
+	db      *sqlx.DB
+
+	// Serves the REST API to door nodes. Started by the first node.
+	server *httptest.Server
+
+	// Non-zero while nodes can't reach the master, see DisconnectMaster.
+	disconnected int32
+
+	// Door nodes started by steps, by ID.
+	nodes map[string]*Node
+
+	// IDs of members created by steps, by name.
+	members map[string]int64
+
+	// IDs of keys created by steps, by UID.
+	keys map[string]int64
+
+	// Response to the last request.
+	last *httptest.ResponseRecorder
+}
+
+// Node is a door node with a simulated reader and door, connected to the
+// harness' master.
+type Node struct {
+	Reader *rfid.SimulatedReader
+	Door   *door.RPiDoor
+	Sim    *door.Simulator
+	Node   *node.Node
+}
+
+// New boots a stack whose database is initialized from schemaFile. configure
+// may change the default config and may be nil.
+//
+// Call Close to stop the stack and remove the database.
+func New(schemaFile string, start time.Time, configure func(cfg *config.Config)) (*Harness, error) {
+	dir, err := ioutil.TempDir("", "craftdoor-scenario")
+	if err != nil {
+		return nil, err
+	}
+	h := &Harness{
+		Clock:   clock.NewFake(start),
+		dir:     dir,
+		members: map[string]int64{},
+		keys:    map[string]int64{},
+		nodes:   map[string]*Node{},
+	}
+
+	cfg := config.Default()
+	cfg.SQLiteFile = filepath.Join(dir, "scenario.db")
+	cfg.SQLiteSchemaFile = schemaFile
+	cfg.StaticAssetsDir = dir
+	cfg.AllowedIPs = []string{"127.0.0.1"}
+	// Reads with a latency would wait for the clock to be advanced.
+	cfg.Reader.Simulated.Latency = config.Duration{}
+	fifo := filepath.Join(dir, "reader")
+	cfg.Reader.Evdev.Device = fifo
+	cfg.Reader.Serial.Device = fifo
+	if configure != nil {
+		configure(&cfg)
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return nil, h.closeAfter(err)
+	}
+
+	h.db, err = lib.OpenDB(&cfg)
+	if err != nil {
+		return nil, h.closeAfter(err)
+	}
+	h.Model = model.New(h.db)
+
+	h.Reader, err = rfid.NewSimulatedReader(cfg.Reader.Simulated, h.Clock)
+	if err != nil {
+		return nil, h.closeAfter(err)
+	}
+	var r rfid.Reader = h.Reader
+	if cfg.Reader.Type == "wiegand" {
+		h.d0 = gpiosim.NewPin(cfg.Reader.Wiegand.D0Pin, -1, nil)
+		h.d1 = gpiosim.NewPin(cfg.Reader.Wiegand.D1Pin, -1, nil)
+		h.Wiegand, err = rfid.NewWiegandReader(cfg.Reader.Wiegand, h.d0, h.d1, h.Clock)
+		if err != nil {
+			return nil, h.closeAfter(err)
+		}
+		err = h.Wiegand.Initialize()
+		if err != nil {
+			return nil, h.closeAfter(err)
+		}
+		r = h.Wiegand
+	}
+	if cfg.Reader.Type == "evdev" || cfg.Reader.Type == "serial" {
+		err = h.openFIFO(cfg.Reader)
+		if err != nil {
+			return nil, h.closeAfter(err)
+		}
+		r = h.Stream
+	}
+
+	cal := door.NewCalendar(start.Location())
+	h.Door, h.Sim, err = door.NewSimulatedDoor(cfg.Door, cal, h.Clock)
+	if err != nil {
+		return nil, h.closeAfter(err)
+	}
+
+	h.cfg = cfg
+	h.Service = service.New(&cfg, h.Model, r, h.Door, cal, h.Clock)
+	rl := config.NewReloader("", &cfg)
+	h.handler = controller.New(&cfg, h.Model, h.Service, h.Reader, h.Sim, rl)
+	return h, nil
+}
+
+// openFIFO creates the FIFO standing in for the device of a keyboard wedge or
+// serial reader, and a reader reading it.
+func (h *Harness) openFIFO(cfg config.ReaderConfig) error {
+	path := filepath.Join(h.dir, "reader")
+	err := syscall.Mkfifo(path, 0600)
+	if err != nil {
+		return err
+	}
+	// Opening the FIFO for writing first keeps the reader's open from
+	// blocking, and its reads from ending while the harness runs.
+	h.fifo, err = os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if cfg.Type == "evdev" {
+		h.Stream = rfid.NewEvdevReader(cfg.Evdev, rfid.OpenEvdev(cfg.Evdev), h.Clock)
+	} else {
+		// serial.Open can't configure a FIFO as a terminal.
+		h.Stream = rfid.NewSerialReader(cfg.Serial, func() (io.ReadCloser, error) {
+			return os.Open(path)
+		}, h.Clock)
+	}
+	return h.Stream.Initialize()
+}
+
+// StartNode starts the door node id, which must be configured in the
+// master's nodes, with a door doorID.
+func (h *Harness) StartNode(id string, doorID string) (*Node, error) {
+	cfg := h.cfg
+	cfg.Door.ID = doorID
+	// Only the master admits nodes.
+	cfg.Nodes = []config.NodeConfig{}
+	cfg.Master = config.MasterConfig{
+		NodeID:             id,
+		HeartbeatInterval:  config.Duration{Duration: 10 * time.Second},
+		Timeout:            config.Duration{Duration: settleTimeout},
+		CacheDir:           filepath.Join(h.dir, "node-"+id),
+		OfflineUnknownTags: h.cfg.Master.OfflineUnknownTags,
+	}
+	for _, n := range h.cfg.Nodes {
+		if n.ID == id {
+			cfg.Master.Secret = n.Secret
+		}
+	}
+	if h.server == nil {
+		h.server = httptest.NewServer(http.HandlerFunc(h.serveNodes))
+	}
+	cfg.Master.URL = h.server.URL
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{}
+	n.Reader, err = rfid.NewSimulatedReader(cfg.Reader.Simulated, h.Clock)
+	if err != nil {
+		return nil, err
+	}
+	cal := door.NewCalendar(h.Clock.Now().Location())
+	n.Door, n.Sim, err = door.NewSimulatedDoor(cfg.Door, cal, h.Clock)
+	if err != nil {
+		return nil, err
+	}
+	n.Node, err = node.New(&cfg, node.NewClient(cfg.Master), n.Reader, n.Door, cal, h.Clock)
+	if err != nil {
+		e := n.Door.Close()
+		if e != nil {
+			logging.Errorf("failed closing node door: %s", e)
+		}
+		return nil, err
+	}
+	h.nodes[id] = n
+	return n, nil
+}
+
+// serveNodes serves the REST API to door nodes, unless they are
+// disconnected from the master.
+func (h *Harness) serveNodes(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&h.disconnected) != 0 {
+		http.Error(w, "master disconnected by scenario", http.StatusServiceUnavailable)
+		return
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// Close stops the stack and removes the temporary database.
+func (h *Harness) Close() error {
+	return h.closeAfter(nil)
+}
+
+// closeAfter stops whatever parts of the stack are running and returns err,
+// or the first error encountered while stopping if err is nil. Loops waiting
+// for a timer, e.g. for a read to time out, are stopped by advancing the
+// clock.
+func (h *Harness) closeAfter(err error) error {
+	closers := []func() error{}
+	for _, n := range h.nodes {
+		n := n
+		closers = append(closers, func() error {
+			return h.Clock.AdvanceWhile(n.Node.Close)
+		}, n.Door.Close)
+	}
+	if h.server != nil {
+		closers = append(closers, func() error {
+			h.server.Close()
+			return nil
+		})
+	}
+	if h.Service != nil {
+		closers = append(closers, func() error {
+			return h.Clock.AdvanceWhile(h.Service.Close)
+		})
+	}
+	if h.Wiegand != nil {
+		closers = append(closers, h.Wiegand.Halt)
+	}
+	if h.Stream != nil {
+		closers = append(closers, h.Stream.Halt)
+	}
+	if h.fifo != nil {
+		closers = append(closers, h.fifo.Close)
+	}
+	if h.Door != nil {
+		closers = append(closers, h.Door.Close)
+	}
+	if h.db != nil {
+		closers = append(closers, h.db.Close)
+	}
+	closers = append(closers, func() error {
+		return os.RemoveAll(h.dir)
+	})
+
+	for _, close := range closers {
+		e := close()
+		if e != nil {
+			logging.Errorf("failed stopping scenario harness: %s", e)
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// Do sends a request to the REST API and returns the response.
+func (h *Harness) Do(method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = "127.0.0.1:1234"
+	resp := httptest.NewRecorder()
+	h.handler.ServeHTTP(resp, req)
+	h.last = resp
+	return resp
+}
+
+// Latch returns the state of the door's latch with the given name.
+func (h *Harness) Latch(name string) (door.LatchState, error) {
+	return latchOf(h.Door, name)
+}
+
+func latchOf(d door.Door, name string) (door.LatchState, error) {
+	for _, latch := range d.Latches() {
+		if latch.Name == name {
+			return latch, nil
+		}
+	}
+	return door.LatchState{}, fmt.Errorf("no latch named %q", name)
+}
+
+// eventually polls check until it succeeds or timeout passes in real time,
+// and returns its last error. The access loop and latches react to tags and
+// the clock asynchronously.
+func eventually(timeout time.Duration, check func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := check()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,48 @@
+package scenario
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pakohan/craftdoor/config"
+)
+
+// Scenario is a sequence of steps run against a fresh stack.
+type Scenario struct {
+	Name string
+
+	// When the clock starts. Default: DefaultStart.
+	Start time.Time
+
+	// Changes the default config. May be nil.
+	Configure func(cfg *config.Config)
+
+	Steps []Step
+}
+
+// Run boots a stack whose database is initialized from schemaFile, runs the
+// scenario's steps in order and stops at the first failing step.
+func Run(s Scenario, schemaFile string) error {
+	start := s.Start
+	if start.IsZero() {
+		start = DefaultStart
+	}
+	h, err := New(schemaFile, start, s.Configure)
+	if err != nil {
+		return fmt.Errorf("booting stack: %s", err)
+	}
+
+	for i, step := range s.Steps {
+		err = step.Run(h)
+		if err != nil {
+			err = fmt.Errorf("step %d (%s): %s", i+1, step.Name, err)
+			break
+		}
+	}
+
+	e := h.Close()
+	if err == nil {
+		err = e
+	}
+	return err
+}
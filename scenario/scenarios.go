@@ -0,0 +1,558 @@
+package scenario
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pakohan/craftdoor/config"
+	"periph.io/x/periph/conn/gpio"
+)
+
+// All are the scenarios covering key registration, access decisions, the
+// bolt's schedule and the REST API.
+var All = []Scenario{
+	{
+		Name: "register key with reader",
+		Steps: []Step{
+			CreateMember("alice"),
+			RegisterKey("04a1b2c3", "alice"),
+			Request(http.MethodGet, "/api/keys/{key:04a1b2c3}", "", http.StatusOK),
+			ExpectBody(`"uuid":"04a1b2c3","member_id":{member:alice}`),
+			Advance(5 * time.Second),
+			Tap("04a1b2c3", true),
+		},
+	},
+	{
+		Name: "member's key unlocks latch until unlock duration passes",
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			ExpectLatch("latch", true),
+			ExpectDoorOpens(false),
+			Tap("04a1b2c3", true),
+			ExpectDoorOpens(true),
+			Advance(2 * time.Second),
+			ExpectLatch("latch", false),
+			Advance(2 * time.Second),
+			ExpectLatch("latch", true),
+			ExpectDoorOpens(false),
+		},
+	},
+	{
+		Name: "unknown and deleted keys are denied",
+		Steps: []Step{
+			Tap("deadbeef", false),
+			ExpectDoorOpens(false),
+			CreateMember("bob"),
+			CreateKey("0badcafe", "bob"),
+			Advance(5 * time.Second),
+			Tap("0badcafe", true),
+			DeleteKey("0badcafe"),
+			Advance(5 * time.Second),
+			Tap("0badcafe", false),
+		},
+	},
+	{
+		Name: "held tag is handled once",
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			PresentTag("04a1b2c3"),
+			ExpectLatch("latch", false),
+			Advance(5 * time.Second),
+			ExpectLatch("latch", true),
+			RemoveTag(),
+		},
+	},
+	{
+		Name: "card errors don't pause the reader",
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			FailReads("auth", 1),
+			Tap("04a1b2c3", true),
+		},
+	},
+	{
+		Name:  "bolt follows schedule",
+		Start: time.Date(2026, time.January, 5, 22, 0, 0, 0, DefaultStart.Location()),
+		Steps: []Step{
+			ExpectLatch("bolt", false),
+			AdvanceTo("23:00"),
+			ExpectLatch("bolt", true),
+			AdvanceTo("04:59"),
+			ExpectLatch("bolt", true),
+			AdvanceTo("05:00"),
+			ExpectLatch("bolt", false),
+		},
+	},
+	{
+		Name: "locks drive their pins according to their wiring",
+		Configure: func(cfg *config.Config) {
+			cfg.Door.LatchFailMode = "safe"
+			cfg.Door.LatchPolarity = "active_high"
+			cfg.Door.BoltPolarity = "active_high"
+		},
+		Steps: []Step{
+			// The fail-safe latch is energized while locked, the fail-secure
+			// bolt while unlocked.
+			ExpectLatch("latch", true),
+			ExpectPin("GPIO22", gpio.High),
+			ExpectLatch("bolt", false),
+			ExpectPin("GPIO27", gpio.High),
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			Tap("04a1b2c3", true),
+			ExpectPin("GPIO22", gpio.Low),
+			ExpectDoorOpens(true),
+			Advance(5 * time.Second),
+			ExpectLatch("latch", true),
+			ExpectPin("GPIO22", gpio.High),
+			AdvanceTo("23:00"),
+			ExpectLatch("bolt", true),
+			ExpectPin("GPIO27", gpio.Low),
+			ExpectDoorOpens(false),
+		},
+	},
+	{
+		Name: "weekly closure and holidays",
+		Configure: func(cfg *config.Config) {
+			cfg.Door.Schedule.Weekly = map[string][]string{"saturday": {}}
+			cfg.Door.Schedule.Holidays = []string{"2026-01-06"}
+		},
+		Steps: []Step{
+			ExpectLatch("bolt", false),
+			AdvanceTo("12:00"),
+			ExpectLatch("bolt", true),
+			AdvanceTo("12:00"),
+			ExpectLatch("bolt", false),
+			Advance(3 * 24 * time.Hour),
+			ExpectLatch("bolt", true),
+		},
+	},
+	{
+		Name: "first keyholder in opens the bolt until the window ends",
+		Configure: func(cfg *config.Config) {
+			cfg.Door.Schedule.FirstIn = true
+		},
+		Steps: []Step{
+			ExpectLatch("bolt", true),
+			CreateMember("bob"),
+			CreateKey("0badcafe", "bob"),
+			CreateKeyholder("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			// Members who aren't keyholders only unlock the door for
+			// themselves.
+			Tap("0badcafe", true),
+			Advance(5 * time.Second),
+			ExpectLatch("bolt", true),
+			Tap("04a1b2c3", true),
+			Advance(5 * time.Second),
+			ExpectLatch("bolt", false),
+			ExpectDoorOpens(true),
+			AdvanceTo("23:00"),
+			ExpectLatch("bolt", true),
+			// The next window waits for a keyholder again.
+			AdvanceTo("05:00"),
+			ExpectLatch("bolt", true),
+			Tap("0badcafe", true),
+			Advance(5 * time.Second),
+			ExpectLatch("bolt", true),
+			Tap("04a1b2c3", true),
+			Advance(5 * time.Second),
+			ExpectLatch("bolt", false),
+		},
+	},
+	{
+		Name: "lockdown admits emergency staff only",
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			CreateEmergencyStaff("eve"),
+			CreateKey("0e0e0e0e", "eve"),
+			Request(http.MethodPut, "/api/doors/main/mode", `{"mode": "lockdown"}`, http.StatusOK),
+			ExpectLatch("bolt", true),
+			Tap("04a1b2c3", false),
+			Advance(5 * time.Second),
+			Tap("0e0e0e0e", true),
+			Request(http.MethodPut, "/api/doors/main/mode", `{"mode": "normal"}`, http.StatusOK),
+			ExpectLatch("bolt", false),
+		},
+	},
+	{
+		Name: "member CRUD",
+		Steps: []Step{
+			Request(http.MethodPost, "/api/members", `{"name": "carol"}`, http.StatusOK),
+			Request(http.MethodPost, "/api/members", `{"name": "carol"}`, http.StatusBadRequest),
+			CreateMember("dave"),
+			Request(http.MethodGet, "/api/members/{member:dave}", "", http.StatusOK),
+			ExpectBody(`"name":"dave"`),
+			Request(http.MethodPut, "/api/members/{member:dave}", `{"name": "david"}`, http.StatusOK),
+			Request(http.MethodGet, "/api/members", "", http.StatusOK),
+			ExpectBody(`"name":"david"`),
+			Request(http.MethodDelete, "/api/members/{member:dave}", "", http.StatusOK),
+			Request(http.MethodGet, "/api/members/{member:dave}", "", http.StatusBadRequest),
+		},
+	},
+	{
+		Name: "key CRUD",
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			Request(http.MethodPost, "/api/keys", `{"uuid": "04a1b2c3"}`, http.StatusBadRequest),
+			Request(http.MethodPut, "/api/keys/{key:04a1b2c3}", `{"uuid": "04d4d4d4", "member_id": {member:alice}}`, http.StatusOK),
+			Request(http.MethodGet, "/api/keys", "", http.StatusOK),
+			ExpectBody(`"uuid":"04d4d4d4"`),
+			Tap("04d4d4d4", true),
+			Request(http.MethodDelete, "/api/keys/{key:04a1b2c3}", "", http.StatusOK),
+			Request(http.MethodGet, "/api/keys/{key:04a1b2c3}", "", http.StatusBadRequest),
+		},
+	},
+	{
+		Name: "door node asks master for access decisions and mode",
+		Configure: func(cfg *config.Config) {
+			cfg.Nodes = []config.NodeConfig{{ID: "workshop", Secret: "scenario-workshop-secret", DoorID: "workshop"}}
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			StartNode("workshop", "workshop"),
+			Request(http.MethodGet, "/api/nodes", "", http.StatusOK),
+			ExpectBody(`"id":"workshop","door_id":"workshop"`),
+			ExpectBody(`"online":true`),
+			ExpectNodeLatch("workshop", "bolt", false),
+			TapNode("workshop", "04a1b2c3", true),
+			Advance(5 * time.Second),
+			TapNode("workshop", "deadbeef", false),
+			ExpectLatch("latch", true),
+			Request(http.MethodPut, "/api/doors/workshop/mode", `{"mode": "lockdown"}`, http.StatusOK),
+			ExpectLatch("bolt", false),
+			Advance(10 * time.Second),
+			ExpectNodeLatch("workshop", "bolt", true),
+			TapNode("workshop", "04a1b2c3", false),
+			Request(http.MethodGet, "/api/doors/workshop", "", http.StatusOK),
+			ExpectBody(`"mode":"lockdown"`),
+			Request(http.MethodGet, "/api/access_log", "", http.StatusOK),
+			ExpectBody(`"node_id":"workshop","key_uuid":"04a1b2c3","member_id":{member:alice},"granted":false,"reason":"lockdown","offline":false`),
+		},
+	},
+	{
+		Name: "door node's mode can be set before the node connects",
+		Configure: func(cfg *config.Config) {
+			cfg.Nodes = []config.NodeConfig{{ID: "workshop", Secret: "scenario-workshop-secret", DoorID: "workshop"}}
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			Request(http.MethodGet, "/api/doors/workshop", "", http.StatusOK),
+			ExpectBody(`"mode":"normal","until":null},"relays":[],"latches":[]`),
+			Request(http.MethodPut, "/api/doors/workshop/mode", `{"mode": "lockdown"}`, http.StatusOK),
+			Request(http.MethodGet, "/api/doors/workshop/mode", "", http.StatusOK),
+			ExpectBody(`"mode":"lockdown"`),
+			Request(http.MethodPut, "/api/doors/garage/mode", `{"mode": "lockdown"}`, http.StatusBadRequest),
+			StartNode("workshop", "workshop"),
+			ExpectNodeLatch("workshop", "bolt", true),
+			TapNode("workshop", "04a1b2c3", false),
+		},
+	},
+	{
+		Name: "door node decides with cached access list while master is unreachable",
+		Configure: func(cfg *config.Config) {
+			cfg.Nodes = []config.NodeConfig{{ID: "workshop", Secret: "scenario-workshop-secret", DoorID: "workshop"}}
+			cfg.AccessListValidity = config.Duration{Duration: time.Hour}
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			StartNode("workshop", "workshop"),
+			DisconnectMaster(),
+			Advance(10 * time.Second),
+			TapNode("workshop", "04a1b2c3", true),
+			Advance(5 * time.Second),
+			TapNode("workshop", "deadbeef", false),
+			ExpectQueuedEvents("workshop", 2),
+			Advance(time.Hour),
+			TapNode("workshop", "04a1b2c3", false),
+			ReconnectMaster(),
+			Advance(10 * time.Second),
+			ExpectQueuedEvents("workshop", 0),
+			Request(http.MethodGet, "/api/access_log", "", http.StatusOK),
+			ExpectBody(`"node_id":"workshop","key_uuid":"04a1b2c3","member_id":{member:alice},"granted":true,"reason":"granted","offline":true`),
+			ExpectBody(`"node_id":"workshop","key_uuid":"deadbeef","member_id":null,"granted":false,"reason":"unknown_tag","offline":true`),
+			TapNode("workshop", "04a1b2c3", true),
+		},
+	},
+	{
+		Name: "door node admits unknown tags while offline if configured",
+		Configure: func(cfg *config.Config) {
+			cfg.Nodes = []config.NodeConfig{{ID: "workshop", Secret: "scenario-workshop-secret", DoorID: "workshop"}}
+			cfg.Master.OfflineUnknownTags = "allow"
+		},
+		Steps: []Step{
+			StartNode("workshop", "workshop"),
+			TapNode("workshop", "deadbeef", false),
+			DisconnectMaster(),
+			Advance(5 * time.Second),
+			TapNode("workshop", "deadbeef", true),
+			ExpectQueuedEvents("workshop", 1),
+			ReconnectMaster(),
+			Request(http.MethodPut, "/api/doors/workshop/mode", `{"mode": "lockdown"}`, http.StatusOK),
+			Advance(10 * time.Second),
+			ExpectNodeLatch("workshop", "bolt", true),
+			ExpectQueuedEvents("workshop", 0),
+			DisconnectMaster(),
+			Advance(5 * time.Second),
+			TapNode("workshop", "deadbeef", false),
+			ExpectQueuedEvents("workshop", 1),
+		},
+	},
+	{
+		Name: "door requiring tag and PIN admits only with the member's PIN",
+		Configure: func(cfg *config.Config) {
+			cfg.Door.Auth = "tag+pin"
+			cfg.Door.Keypad.Type = "matrix"
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			CreateMember("bob"),
+			CreateKey("04d4d4d4", "bob"),
+			SetPIN("alice", "1234"),
+			TapWithKeys("04a1b2c3", "1234#", true),
+			Advance(5 * time.Second),
+			TapWithKeys("04a1b2c3", "4321#", false),
+			Advance(5 * time.Second),
+			TapWithKeys("04d4d4d4", "1234#", false),
+			Advance(5 * time.Second),
+			PresentTag("04a1b2c3"),
+			WaitForKeypad(),
+			RemoveTag(),
+			Advance(10 * time.Second),
+			ExpectLatch("auth_fail", false),
+			ExpectLatch("latch", true),
+			Request(http.MethodGet, "/api/members/{member:alice}", "", http.StatusOK),
+			ExpectBody(`"has_pin":true`),
+			Request(http.MethodGet, "/api/access_log", "", http.StatusOK),
+			ExpectBody(`"key_uuid":"04a1b2c3","member_id":{member:alice},"granted":true,"reason":"granted"`),
+			ExpectBody(`"key_uuid":"04a1b2c3","member_id":{member:alice},"granted":false,"reason":"wrong_pin"`),
+			ExpectBody(`"key_uuid":"04d4d4d4","member_id":{member:bob},"granted":false,"reason":"pin_not_set"`),
+			ExpectBody(`"key_uuid":"04a1b2c3","member_id":{member:alice},"granted":false,"reason":"no_pin"`),
+		},
+	},
+	{
+		Name: "keypad locks after repeated wrong PINs",
+		Configure: func(cfg *config.Config) {
+			cfg.Door.Auth = "tag+pin"
+			cfg.Door.Keypad.Type = "wiegand"
+			cfg.Door.Keypad.MaxAttempts = 2
+			cfg.Door.Keypad.Lockout = config.Duration{Duration: time.Minute}
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			SetPIN("alice", "1234"),
+			TapWithKeys("04a1b2c3", "1111#", false),
+			Advance(5 * time.Second),
+			TapWithKeys("04a1b2c3", "2222#", false),
+			Advance(5 * time.Second),
+			ExpectLatch("auth_fail", true),
+			Tap("04a1b2c3", false),
+			Advance(time.Minute),
+			TapWithKeys("04a1b2c3", "1234#", true),
+			Request(http.MethodGet, "/api/access_log", "", http.StatusOK),
+			ExpectBody(`"granted":false,"reason":"locked_out"`),
+		},
+	},
+	{
+		Name: "door requiring PIN admits member ID and PIN",
+		Configure: func(cfg *config.Config) {
+			cfg.Door.Auth = "pin"
+			cfg.Door.Keypad.Type = "matrix"
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			SetPIN("alice", "4321"),
+			EnterKeys("{member:alice}*4321#", true),
+			Advance(5 * time.Second),
+			EnterKeys("{member:alice}*1111#", false),
+			Advance(5 * time.Second),
+			EnterKeys("999*4321#", false),
+			Advance(5 * time.Second),
+			Request(http.MethodDelete, "/api/members/{member:alice}/pin", "", http.StatusOK),
+			EnterKeys("{member:alice}*4321#", false),
+			Request(http.MethodPut, "/api/members/{member:alice}/pin", `{"pin": "12"}`, http.StatusBadRequest),
+			Request(http.MethodGet, "/api/access_log", "", http.StatusOK),
+			ExpectBody(`"key_uuid":"","member_id":{member:alice},"granted":true,"reason":"granted"`),
+			ExpectBody(`"member_id":{member:alice},"granted":false,"reason":"wrong_pin"`),
+			ExpectBody(`"member_id":null,"granted":false,"reason":"unknown_member"`),
+			ExpectBody(`"member_id":{member:alice},"granted":false,"reason":"pin_not_set"`),
+		},
+	},
+	{
+		Name: "door node requires tag and PIN, also while offline",
+		Configure: func(cfg *config.Config) {
+			cfg.Nodes = []config.NodeConfig{{ID: "workshop", Secret: "scenario-workshop-secret", DoorID: "workshop", Auth: "tag+pin"}}
+			cfg.Door.Auth = "tag+pin"
+			cfg.Door.Keypad.Type = "wiegand"
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			SetPIN("alice", "1234"),
+			StartNode("workshop", "workshop"),
+			TapNodeWithKeys("workshop", "04a1b2c3", "1234#", true),
+			Advance(5 * time.Second),
+			TapNodeWithKeys("workshop", "04a1b2c3", "4321#", false),
+			DisconnectMaster(),
+			Advance(10 * time.Second),
+			TapNodeWithKeys("workshop", "04a1b2c3", "1234#", true),
+			Advance(5 * time.Second),
+			TapNodeWithKeys("workshop", "04a1b2c3", "4321#", false),
+			ExpectQueuedEvents("workshop", 2),
+			ReconnectMaster(),
+			Advance(10 * time.Second),
+			ExpectQueuedEvents("workshop", 0),
+			Request(http.MethodGet, "/api/access_log", "", http.StatusOK),
+			ExpectBody(`"node_id":"workshop","key_uuid":"04a1b2c3","member_id":{member:alice},"granted":false,"reason":"wrong_pin","offline":false`),
+			ExpectBody(`"node_id":"workshop","key_uuid":"04a1b2c3","member_id":{member:alice},"granted":true,"reason":"granted","offline":true`),
+			ExpectBody(`"node_id":"workshop","key_uuid":"04a1b2c3","member_id":{member:alice},"granted":false,"reason":"wrong_pin","offline":true`),
+		},
+	},
+	{
+		Name: "master decides on a node's tags under the policy configured for it",
+		Configure: func(cfg *config.Config) {
+			// The node's door.auth is "tag", but the master requires a PIN.
+			cfg.Nodes = []config.NodeConfig{{ID: "workshop", Secret: "scenario-workshop-secret", DoorID: "workshop", Auth: "tag+pin"}}
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			SetPIN("alice", "1234"),
+			StartNode("workshop", "workshop"),
+			TapNode("workshop", "04a1b2c3", false),
+			Request(http.MethodGet, "/api/access_log", "", http.StatusOK),
+			ExpectBody(`"node_id":"workshop","key_uuid":"04a1b2c3","member_id":{member:alice},"granted":false,"reason":"no_pin","offline":false`),
+		},
+	},
+	{
+		Name: "wiegand reader admits existing keys and ignores garbled frames",
+		Configure: func(cfg *config.Config) {
+			cfg.Reader.Type = "wiegand"
+			cfg.Reader.Wiegand.ByteOrder = "lsb"
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("04a1b2c3", "alice"),
+			CreateMember("bob"),
+			CreateKey("c0ffee", "bob"),
+			SwipeWithParityError("04a1b2c3"),
+			Swipe("04a1b2c3", true),
+			Request(http.MethodGet, "/api/access_log", "", http.StatusOK),
+			ExpectBody(`[{"id":1,`),
+			Advance(5 * time.Second),
+			Swipe("c0ffee", true),
+			Advance(5 * time.Second),
+			Swipe("deadbeef", false),
+		},
+	},
+	{
+		Name: "card types are recorded with keys and determine memory layouts",
+		Configure: func(cfg *config.Config) {
+			cfg.Reader.Simulated.CardTypes = map[string]string{
+				"04a1b2c3d4e5f6": "ultralight",
+				"08123456":       "desfire",
+				"c1c2c3c4":       "mifare_classic_4k",
+			}
+			cfg.Reader.Simulated.Cards = map[string]string{
+				"04a1b2c3d4e5f6": "04a1b2c3d4e5f6000000000000000000" + "0103a00c",
+			}
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			RegisterKey("04a1b2c3d4e5f6", "alice"),
+			RegisterKey("08123456", "alice"),
+			CreateKey("35c17053", "alice"),
+			Request(http.MethodGet, "/api/keys", "", http.StatusOK),
+			ExpectBody(`"uuid":"04a1b2c3d4e5f6","member_id":{member:alice},"card_type":"ultralight"`),
+			ExpectBody(`"uuid":"08123456","member_id":{member:alice},"card_type":"desfire"`),
+			ExpectBody(`"uuid":"35c17053","member_id":{member:alice},"card_type":"unknown"`),
+			Request(http.MethodPost, "/api/keys", `{"uuid": "04d4d4d4", "card_type": "floppy"}`, http.StatusBadRequest),
+			ExpectDump("04a1b2c3d4e5f6",
+				"UID=04a1b2c3d4e5f6 Type=ultralight",
+				"00.0 | 04 a1 b2 c3",
+				"01.0 | 01 03 a0 0c",
+				"03.3 | 00 00 00 00"),
+			ExpectDump("08123456", "UID=08123456 Type=desfire"),
+			ExpectDump("c1c2c3c4",
+				"31.2 | 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00",
+				"39.14 | 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00",
+				"      | KeyA=000000000000 KeyB=ffffffffffff BlocksAccess=(B0: 0, B1: 0, B2: 0, B3: 0)"),
+			Advance(5 * time.Second),
+			Tap("04a1b2c3d4e5f6", true),
+		},
+	},
+	{
+		Name: "keyboard wedge admits decimal card numbers",
+		Configure: func(cfg *config.Config) {
+			cfg.Reader.Type = "evdev"
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("00bc614e", "alice"),
+			ScanGarbled("99999999999999999999"),
+			Scan("0012345678", true),
+			Request(http.MethodGet, "/api/access_log", "", http.StatusOK),
+			ExpectBody(`[{"id":1,`),
+			Advance(5 * time.Second),
+			Scan("0087654321", false),
+		},
+	},
+	{
+		Name: "serial reader checks framing and checksums",
+		Configure: func(cfg *config.Config) {
+			cfg.Reader.Type = "serial"
+			cfg.Reader.Serial.Start = "\x02"
+			cfg.Reader.Serial.End = "\x03"
+			cfg.Reader.Serial.Checksum = "xor"
+		},
+		Steps: []Step{
+			CreateMember("alice"),
+			CreateKey("0a00bc614e", "alice"),
+			ScanGarbled("0A00BC614F99"),
+			Scan("0A00BC614E99", true),
+			Request(http.MethodGet, "/api/access_log", "", http.StatusOK),
+			ExpectBody(`[{"id":1,`),
+			Advance(5 * time.Second),
+			Scan("0A00BC614F98", false),
+		},
+	},
+	{
+		Name: "key UIDs are normalized and printed card numbers accepted",
+		Steps: []Step{
+			CreateMember("alice"),
+			Request(http.MethodPost, "/api/keys", `{"uuid": "04:A1:B2:C3", "member_id": {member:alice}}`, http.StatusOK),
+			ExpectBody(`"uuid":"04a1b2c3"`),
+			Request(http.MethodPost, "/api/keys", `{"uuid": "0x04a1b2c3"}`, http.StatusBadRequest),
+			Request(http.MethodPost, "/api/keys", `{"uuid": "dec:0012345678", "member_id": {member:alice}}`, http.StatusOK),
+			ExpectBody(`"uuid":"00bc614e"`),
+			Request(http.MethodPost, "/api/keys", `{"uuid": "192,65518", "member_id": {member:alice}}`, http.StatusOK),
+			ExpectBody(`"uuid":"c0ffee"`),
+			Request(http.MethodPut, "/api/keys/3", `{"uuid": "C0 FF EE", "member_id": {member:alice}}`, http.StatusOK),
+			ExpectBody(`"uuid":"c0ffee"`),
+			Request(http.MethodPost, "/api/keys", `{"uuid": "0102"}`, http.StatusBadRequest),
+			Request(http.MethodPost, "/api/keys", `{"uuid": "0102030405060708090a0b"}`, http.StatusBadRequest),
+			Request(http.MethodPost, "/api/keys", `{"uuid": "256,1"}`, http.StatusBadRequest),
+			Request(http.MethodPost, "/api/keys", `{"uuid": "dec:12x4"}`, http.StatusBadRequest),
+			Tap("04a1b2c3", true),
+			Advance(5 * time.Second),
+			Tap("00bc614e", true),
+			Advance(5 * time.Second),
+			Tap("c0ffee", true),
+			Advance(5 * time.Second),
+			Tap("00000000000000000000000000000000", false),
+			Request(http.MethodGet, "/api/access_log", "", http.StatusOK),
+			ExpectBody(`"key_uuid":"00000000000000000000000000000000","member_id":null,"granted":false,"reason":"invalid_uid"`),
+			Tap("04a1b2c3", true),
+		},
+	},
+}
@@ -0,0 +1,23 @@
+package scenario
+
+import (
+	"testing"
+
+	"github.com/pakohan/craftdoor/logging"
+)
+
+func TestScenarios(t *testing.T) {
+	if testing.Short() {
+		t.Skip("scenarios boot the complete stack")
+	}
+	logging.SetLevel(logging.ErrorLevel)
+	for _, s := range All {
+		s := s
+		t.Run(s.Name, func(t *testing.T) {
+			err := Run(s, "../assets/schema.sql")
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,753 @@
+package scenario
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/rfid"
+	"github.com/pakohan/craftdoor/wiegand"
+	"periph.io/x/periph/conn/gpio"
+)
+
+// settleTimeout is how long, in real time, expectations wait for the stack to
+// react.
+const settleTimeout = 2 * time.Second
+
+// Step is a single action or expectation of a scenario.
+type Step struct {
+	// Describes the step in failure messages, e.g. "present tag 04a1b2c3".
+	Name string
+
+	// Runs the step. Returns an error if an expectation isn't met.
+	Run func(h *Harness) error
+}
+
+// CreateMember creates a member through the REST API. Later steps refer to
+// the member by name.
+func CreateMember(name string) Step {
+	return createMember(name, fmt.Sprintf("create member %s", name), "")
+}
+
+// CreateKeyholder creates a member with the keyholder role.
+func CreateKeyholder(name string) Step {
+	return createMember(name, fmt.Sprintf("create keyholder %s", name), `, "keyholder": true`)
+}
+
+// CreateEmergencyStaff creates a member who is admitted during lockdowns.
+func CreateEmergencyStaff(name string) Step {
+	return createMember(name, fmt.Sprintf("create emergency staff %s", name), `, "emergency_staff": true`)
+}
+
+func createMember(name, stepName, fields string) Step {
+	return Step{
+		Name: stepName,
+		Run: func(h *Harness) error {
+			body := fmt.Sprintf(`{"name": %q%s}`, name, fields)
+			resp := h.Do(http.MethodPost, "/api/members", body)
+			if resp.Code != http.StatusOK {
+				return fmt.Errorf("status %d: %s", resp.Code, resp.Body)
+			}
+			var member struct {
+				ID int64 `json:"id"`
+			}
+			err := json.Unmarshal(resp.Body.Bytes(), &member)
+			if err != nil {
+				return err
+			}
+			h.members[name] = member.ID
+			return nil
+		},
+	}
+}
+
+// CreateKey creates a key with the given UID for a member created earlier.
+func CreateKey(uid, member string) Step {
+	return Step{
+		Name: fmt.Sprintf("create key %s for %s", uid, member),
+		Run: func(h *Harness) error {
+			id, ok := h.members[member]
+			if !ok {
+				return fmt.Errorf("unknown member %q", member)
+			}
+			body := fmt.Sprintf(`{"uuid": %q, "member_id": %d}`, uid, id)
+			resp := h.Do(http.MethodPost, "/api/keys", body)
+			return h.storeKey(uid, resp.Body.Bytes(), resp.Code)
+		},
+	}
+}
+
+// RegisterKey registers the tag uid for a member created earlier, the way an
+// admin does: by holding the tag in front of the reader while calling
+// /api/keys/new. The tag is removed afterwards.
+func RegisterKey(uid, member string) Step {
+	return Step{
+		Name: fmt.Sprintf("register tag %s for %s", uid, member),
+		Run: func(h *Harness) error {
+			id, ok := h.members[member]
+			if !ok {
+				return fmt.Errorf("unknown member %q", member)
+			}
+			err := present(h, uid)
+			if err != nil {
+				return err
+			}
+			body := fmt.Sprintf(`{"member_id": %d}`, id)
+			resp := h.Do(http.MethodPost, "/api/keys/new", body)
+			err = removeTag(h.Reader)
+			if err != nil {
+				return err
+			}
+			return h.storeKey(uid, resp.Body.Bytes(), resp.Code)
+		},
+	}
+}
+
+func (h *Harness) storeKey(uid string, body []byte, code int) error {
+	if code != http.StatusOK {
+		return fmt.Errorf("status %d: %s", code, body)
+	}
+	var key struct {
+		ID   int64  `json:"id"`
+		UUID string `json:"uuid"`
+	}
+	err := json.Unmarshal(body, &key)
+	if err != nil {
+		return err
+	}
+	if key.UUID != uid {
+		return fmt.Errorf("registered key %q, want %q", key.UUID, uid)
+	}
+	h.keys[uid] = key.ID
+	return nil
+}
+
+// DeleteKey deletes a key created earlier.
+func DeleteKey(uid string) Step {
+	return Step{
+		Name: fmt.Sprintf("delete key %s", uid),
+		Run: func(h *Harness) error {
+			id, ok := h.keys[uid]
+			if !ok {
+				return fmt.Errorf("unknown key %q", uid)
+			}
+			resp := h.Do(http.MethodDelete, fmt.Sprintf("/api/keys/%d", id), "")
+			if resp.Code != http.StatusOK {
+				return fmt.Errorf("status %d: %s", resp.Code, resp.Body)
+			}
+			return nil
+		},
+	}
+}
+
+// PresentTag holds the tag uid in front of the reader until RemoveTag.
+func PresentTag(uid string) Step {
+	return Step{
+		Name: fmt.Sprintf("present tag %s", uid),
+		Run: func(h *Harness) error {
+			return present(h, uid)
+		},
+	}
+}
+
+func present(h *Harness, uid string) error {
+	b, err := hex.DecodeString(uid)
+	if err != nil {
+		return err
+	}
+	h.Reader.Present(b, 0)
+	return nil
+}
+
+// RemoveTag removes the tag from the reader and waits until the reader is
+// read again or the door is waiting for a PIN.
+func RemoveTag() Step {
+	return Step{
+		Name: "remove tag",
+		Run: func(h *Harness) error {
+			h.Reader.Remove()
+			return eventually(settleTimeout, func() error {
+				pad := h.Door.PINPad()
+				if !h.Reader.Idle() && (pad == nil || !pad.Waiting()) {
+					return fmt.Errorf("%s wasn't read again after removing the tag", h.Reader)
+				}
+				return nil
+			})
+		},
+	}
+}
+
+// removeTag removes the tag from r and waits until r is read again, so that
+// reads of the tag are handled before the clock is advanced.
+func removeTag(r *rfid.SimulatedReader) error {
+	r.Remove()
+	return eventually(settleTimeout, func() error {
+		if !r.Idle() {
+			return fmt.Errorf("%s wasn't read again after removing the tag", r)
+		}
+		return nil
+	})
+}
+
+// FailReads makes the next count reads of the reader fail with an error of
+// kind, as accepted by the simulated reader's "error" command, e.g. "auth".
+func FailReads(kind string, count int) Step {
+	return Step{
+		Name: fmt.Sprintf("fail %d reads with %s", count, kind),
+		Run: func(h *Harness) error {
+			return h.Reader.Exec(context.Background(), fmt.Sprintf("error %s %d", kind, count))
+		},
+	}
+}
+
+// ExpectDump holds the tag uid in front of the reader and expects the dump of
+// its contents, as printed by cmd/debug, to contain each of lines. The tag is
+// removed afterwards.
+func ExpectDump(uid string, lines ...string) Step {
+	return Step{
+		Name: fmt.Sprintf("dump tag %s", uid),
+		Run: func(h *Harness) error {
+			err := present(h, uid)
+			if err != nil {
+				return err
+			}
+			dump, err := rfid.FmtCard(h.Reader, time.Second)
+			e := removeTag(h.Reader)
+			if err == nil {
+				err = e
+			}
+			if err != nil {
+				return err
+			}
+			for _, line := range lines {
+				if !strings.Contains(dump, line+"\n") {
+					return fmt.Errorf("dump %q doesn't contain line %q", dump, line)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// SetPIN sets the PIN of a member created earlier through the REST API.
+func SetPIN(member, pin string) Step {
+	return Step{
+		Name: fmt.Sprintf("set PIN of %s", member),
+		Run: func(h *Harness) error {
+			id, ok := h.members[member]
+			if !ok {
+				return fmt.Errorf("unknown member %q", member)
+			}
+			body := fmt.Sprintf(`{"pin": %q}`, pin)
+			resp := h.Do(http.MethodPut, fmt.Sprintf("/api/members/%d/pin", id), body)
+			if resp.Code != http.StatusOK {
+				return fmt.Errorf("status %d: %s", resp.Code, resp.Body)
+			}
+			return nil
+		},
+	}
+}
+
+// Tap presents the tag uid, waits for the door to react and removes it.
+// granted is whether the door should admit the tag.
+func Tap(uid string, granted bool) Step {
+	return Step{
+		Name: fmt.Sprintf("tap tag %s, expect access %s", uid, verdict(granted)),
+		Run: func(h *Harness) error {
+			return tap(h, h.Reader, h.Door, uid, granted)
+		},
+	}
+}
+
+// TapNode is like Tap, for the reader and door of a node started earlier.
+func TapNode(id string, uid string, granted bool) Step {
+	return Step{
+		Name: fmt.Sprintf("tap tag %s at node %s, expect access %s", uid, id, verdict(granted)),
+		Run: func(h *Harness) error {
+			n, ok := h.nodes[id]
+			if !ok {
+				return fmt.Errorf("unknown node %q", id)
+			}
+			return tap(h, n.Reader, n.Door, uid, granted)
+		},
+	}
+}
+
+// Swipe sends the card uid over the Wiegand reader's data lines and waits for
+// the door to react. granted is whether the door should admit the card.
+// Requires reader.type "wiegand".
+func Swipe(uid string, granted bool) Step {
+	return Step{
+		Name: fmt.Sprintf("swipe card %s, expect access %s", uid, verdict(granted)),
+		Run: func(h *Harness) error {
+			err := h.swipe(uid, false)
+			if err != nil {
+				return err
+			}
+			return expectAccess(h, h.Door, granted)
+		},
+	}
+}
+
+// SwipeWithParityError sends the card uid over the Wiegand reader's data
+// lines with a wrong parity bit. Requires reader.type "wiegand".
+func SwipeWithParityError(uid string) Step {
+	return Step{
+		Name: fmt.Sprintf("swipe card %s with parity error", uid),
+		Run: func(h *Harness) error {
+			return h.swipe(uid, true)
+		},
+	}
+}
+
+// swipe sends the frame of the card uid, flipping its last parity bit if
+// corrupt.
+func (h *Harness) swipe(uid string, corrupt bool) error {
+	if h.Wiegand == nil {
+		return fmt.Errorf("reader isn't a Wiegand reader")
+	}
+	b, err := hex.DecodeString(uid)
+	if err != nil {
+		return err
+	}
+	frame, err := h.Wiegand.Frame(b)
+	if err != nil {
+		return err
+	}
+	if corrupt {
+		frame[len(frame)-1] = !frame[len(frame)-1]
+	}
+	return wiegand.Transmit(h.d0, h.d1, frame)
+}
+
+// Scan sends text, a card number, from the keyboard wedge or serial reader
+// and waits for the door to react. granted is whether the door should admit
+// the card. Requires reader.type "evdev" or "serial".
+func Scan(text string, granted bool) Step {
+	return Step{
+		Name: fmt.Sprintf("scan card %q, expect access %s", text, verdict(granted)),
+		Run: func(h *Harness) error {
+			err := h.scan(text)
+			if err != nil {
+				return err
+			}
+			return expectAccess(h, h.Door, granted)
+		},
+	}
+}
+
+// ScanGarbled sends text from the keyboard wedge or serial reader without
+// waiting for the door, for messages the reader should ignore. Requires
+// reader.type "evdev" or "serial".
+func ScanGarbled(text string) Step {
+	return Step{
+		Name: fmt.Sprintf("scan garbled card %q", text),
+		Run: func(h *Harness) error {
+			return h.scan(text)
+		},
+	}
+}
+
+// scan writes text to the reader's FIFO as typed by a keyboard wedge, or
+// framed like a serial reader's messages.
+func (h *Harness) scan(text string) error {
+	if h.fifo == nil {
+		return fmt.Errorf("reader isn't a keyboard wedge or serial reader")
+	}
+	var b []byte
+	if h.cfg.Reader.Type == "evdev" {
+		var err error
+		b, err = rfid.KeyEvents(text)
+		if err != nil {
+			return err
+		}
+	} else {
+		b = []byte(h.cfg.Reader.Serial.Start + text + h.cfg.Reader.Serial.End)
+	}
+	_, err := h.fifo.Write(b)
+	return err
+}
+
+// TapWithKeys presents the tag uid, presses keys on the keypad once the door
+// waits for a PIN, e.g. "1234#", waits for the door to react and removes the
+// tag.
+func TapWithKeys(uid string, keys string, granted bool) Step {
+	return Step{
+		Name: fmt.Sprintf("tap tag %s and enter %q, expect access %s", uid, keys, verdict(granted)),
+		Run: func(h *Harness) error {
+			return tapWithKeys(h, h.Reader, h.Door, h.Sim, uid, keys, granted)
+		},
+	}
+}
+
+// TapNodeWithKeys is like TapWithKeys, for the reader, keypad and door of a
+// node started earlier.
+func TapNodeWithKeys(id string, uid string, keys string, granted bool) Step {
+	return Step{
+		Name: fmt.Sprintf("tap tag %s and enter %q at node %s, expect access %s", uid, keys, id, verdict(granted)),
+		Run: func(h *Harness) error {
+			n, ok := h.nodes[id]
+			if !ok {
+				return fmt.Errorf("unknown node %q", id)
+			}
+			return tapWithKeys(h, n.Reader, n.Door, n.Sim, uid, keys, granted)
+		},
+	}
+}
+
+func tapWithKeys(h *Harness, r *rfid.SimulatedReader, d door.Door, sim *door.Simulator, uid string, keys string, granted bool) error {
+	b, err := hex.DecodeString(uid)
+	if err != nil {
+		return err
+	}
+	r.Present(b, 0)
+	err = enterKeys(d, sim, keys)
+	if err == nil {
+		err = expectAccess(h, d, granted)
+	}
+	e := removeTag(r)
+	if err == nil {
+		err = e
+	}
+	return err
+}
+
+// EnterKeys presses keys on the keypad once the door waits for an entry,
+// e.g. "42*1234#", and waits for the door to react.
+func EnterKeys(keys string, granted bool) Step {
+	return Step{
+		Name: fmt.Sprintf("enter %q, expect access %s", keys, verdict(granted)),
+		Run: func(h *Harness) error {
+			err := enterKeys(h.Door, h.Sim, h.expand(keys))
+			if err != nil {
+				return err
+			}
+			return expectAccess(h, h.Door, granted)
+		},
+	}
+}
+
+// EnterKeysAtNode is like EnterKeys, for the keypad and door of a node
+// started earlier.
+func EnterKeysAtNode(id string, keys string, granted bool) Step {
+	return Step{
+		Name: fmt.Sprintf("enter %q at node %s, expect access %s", keys, id, verdict(granted)),
+		Run: func(h *Harness) error {
+			n, ok := h.nodes[id]
+			if !ok {
+				return fmt.Errorf("unknown node %q", id)
+			}
+			err := enterKeys(n.Door, n.Sim, h.expand(keys))
+			if err != nil {
+				return err
+			}
+			return expectAccess(h, n.Door, granted)
+		},
+	}
+}
+
+// WaitForKeypad waits until the door waits for an entry on its keypad, e.g.
+// for the PIN after a tag.
+func WaitForKeypad() Step {
+	return Step{
+		Name: "wait for keypad",
+		Run: func(h *Harness) error {
+			return waitForKeypad(h.Door)
+		},
+	}
+}
+
+func waitForKeypad(d door.Door) error {
+	pad := d.PINPad()
+	if pad == nil {
+		return fmt.Errorf("door %s has no keypad", d)
+	}
+	return eventually(settleTimeout, func() error {
+		if !pad.Waiting() {
+			return fmt.Errorf("door %s isn't waiting for an entry", d)
+		}
+		return nil
+	})
+}
+
+func enterKeys(d door.Door, sim *door.Simulator, keys string) error {
+	err := waitForKeypad(d)
+	if err != nil {
+		return err
+	}
+	return sim.PressKeys(keys)
+}
+
+func verdict(granted bool) string {
+	if granted {
+		return "granted"
+	}
+	return "denied"
+}
+
+func tap(h *Harness, r *rfid.SimulatedReader, d door.Door, uid string, granted bool) error {
+	b, err := hex.DecodeString(uid)
+	if err != nil {
+		return err
+	}
+	r.Present(b, 0)
+	err = expectAccess(h, d, granted)
+	e := removeTag(r)
+	if err == nil {
+		err = e
+	}
+	return err
+}
+
+// expectAccess waits for the door to be unlocked, or to signal a failed
+// authentication while locked.
+func expectAccess(h *Harness, d door.Door, granted bool) error {
+	if granted {
+		return expectLatch(h, d, "latch", false)
+	}
+	err := expectLatch(h, d, "auth_fail", false)
+	if err != nil {
+		return err
+	}
+	return expectLatch(h, d, "latch", true)
+}
+
+// StartNode starts a door node id with a simulated reader and door doorID
+// and waits for it to register with the master and fetch its access list.
+// The node must be configured in the master's nodes.
+func StartNode(id string, doorID string) Step {
+	return Step{
+		Name: fmt.Sprintf("start node %s with door %s", id, doorID),
+		Run: func(h *Harness) error {
+			n, err := h.StartNode(id, doorID)
+			if err != nil {
+				return err
+			}
+			return eventually(settleTimeout, func() error {
+				status, err := h.Service.Node(id)
+				if err != nil {
+					return err
+				}
+				if status.LastHeartbeat.IsZero() {
+					return fmt.Errorf("node %s hasn't registered", id)
+				}
+				if n.Node.AccessListVersion() == "" {
+					return fmt.Errorf("node %s has no access list", id)
+				}
+				return nil
+			})
+		},
+	}
+}
+
+// DisconnectMaster makes the master unreachable for all nodes.
+func DisconnectMaster() Step {
+	return Step{
+		Name: "disconnect nodes from master",
+		Run: func(h *Harness) error {
+			atomic.StoreInt32(&h.disconnected, 1)
+			return nil
+		},
+	}
+}
+
+// ReconnectMaster makes the master reachable again after DisconnectMaster.
+func ReconnectMaster() Step {
+	return Step{
+		Name: "reconnect nodes to master",
+		Run: func(h *Harness) error {
+			atomic.StoreInt32(&h.disconnected, 0)
+			return nil
+		},
+	}
+}
+
+// ExpectQueuedEvents waits until node id has count access events waiting to
+// be uploaded.
+func ExpectQueuedEvents(id string, count int) Step {
+	return Step{
+		Name: fmt.Sprintf("expect %d queued events at node %s", count, id),
+		Run: func(h *Harness) error {
+			n, ok := h.nodes[id]
+			if !ok {
+				return fmt.Errorf("unknown node %q", id)
+			}
+			return eventually(settleTimeout, func() error {
+				if queued := n.Node.QueuedEvents(); queued != count {
+					return fmt.Errorf("node %s has %d queued events", id, queued)
+				}
+				return nil
+			})
+		},
+	}
+}
+
+// Advance moves the clock forward by d.
+func Advance(d time.Duration) Step {
+	return Step{
+		Name: fmt.Sprintf("advance %s", d),
+		Run: func(h *Harness) error {
+			h.Clock.Advance(d)
+			return nil
+		},
+	}
+}
+
+// AdvanceTo moves the clock forward to the next occurrence of a time of day
+// such as "23:00" in the clock's timezone.
+func AdvanceTo(timeOfDay string) Step {
+	return Step{
+		Name: fmt.Sprintf("advance to %s", timeOfDay),
+		Run: func(h *Harness) error {
+			t, err := time.Parse("15:04", timeOfDay)
+			if err != nil {
+				return err
+			}
+			now := h.Clock.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+			if !next.After(now) {
+				next = time.Date(now.Year(), now.Month(), now.Day()+1, t.Hour(), t.Minute(), 0, 0, now.Location())
+			}
+			h.Clock.Set(next)
+			return nil
+		},
+	}
+}
+
+// ExpectLatch waits for the latch with the given name, e.g. "latch", "bolt"
+// or "auth_fail", to be locked or unlocked.
+func ExpectLatch(name string, locked bool) Step {
+	return Step{
+		Name: fmt.Sprintf("expect %s locked=%t", name, locked),
+		Run: func(h *Harness) error {
+			return expectLatch(h, h.Door, name, locked)
+		},
+	}
+}
+
+// ExpectNodeLatch is like ExpectLatch, for the door of a node started
+// earlier.
+func ExpectNodeLatch(id string, name string, locked bool) Step {
+	return Step{
+		Name: fmt.Sprintf("expect %s of node %s locked=%t", name, id, locked),
+		Run: func(h *Harness) error {
+			n, ok := h.nodes[id]
+			if !ok {
+				return fmt.Errorf("unknown node %q", id)
+			}
+			return expectLatch(h, n.Door, name, locked)
+		},
+	}
+}
+
+func expectLatch(h *Harness, d door.Door, name string, locked bool) error {
+	return eventually(settleTimeout, func() error {
+		latch, err := latchOf(d, name)
+		if err != nil {
+			return err
+		}
+		if latch.Locked != locked {
+			return fmt.Errorf("%s is locked=%t at %s", name, latch.Locked, h.Clock.Now())
+		}
+		return nil
+	})
+}
+
+// ExpectPin waits for the simulated door's pin with the given name, e.g.
+// "GPIO22", to be at level.
+func ExpectPin(name string, level gpio.Level) Step {
+	return Step{
+		Name: fmt.Sprintf("expect pin %s %s", name, level),
+		Run: func(h *Harness) error {
+			return eventually(settleTimeout, func() error {
+				for _, pin := range h.Sim.State().Pins {
+					if pin.Pin != name {
+						continue
+					}
+					if pin.Level != level.String() {
+						return fmt.Errorf("pin %s is %s at %s", name, pin.Level, h.Clock.Now())
+					}
+					return nil
+				}
+				return fmt.Errorf("no pin named %q", name)
+			})
+		},
+	}
+}
+
+// ExpectDoorOpens pushes the door. open is whether it should open, i.e.
+// whether neither the latch nor the bolt hold it shut. The door is closed
+// again afterwards.
+func ExpectDoorOpens(open bool) Step {
+	return Step{
+		Name: fmt.Sprintf("expect door opens=%t", open),
+		Run: func(h *Harness) error {
+			err := h.Sim.Open()
+			if err == nil {
+				err = h.Sim.Close()
+				if err != nil {
+					return err
+				}
+			}
+			if open && err != nil {
+				return err
+			}
+			if !open && err == nil {
+				return fmt.Errorf("door opened at %s", h.Clock.Now())
+			}
+			return nil
+		},
+	}
+}
+
+// Request sends a request to the REST API and expects the given status code.
+// Member and key IDs may be referenced in path and body as {member:name} and
+// {key:uid}.
+func Request(method, path, body string, status int) Step {
+	return Step{
+		Name: fmt.Sprintf("%s %s", method, path),
+		Run: func(h *Harness) error {
+			resp := h.Do(method, h.expand(path), h.expand(body))
+			if resp.Code != status {
+				return fmt.Errorf("status %d, want %d: %s", resp.Code, status, resp.Body)
+			}
+			return nil
+		},
+	}
+}
+
+// ExpectBody expects the response to the last request to contain substr.
+// Member and key IDs may be referenced as {member:name} and {key:uid}.
+func ExpectBody(substr string) Step {
+	return Step{
+		Name: fmt.Sprintf("expect body contains %q", substr),
+		Run: func(h *Harness) error {
+			if h.last == nil {
+				return fmt.Errorf("no request has been sent")
+			}
+			want := h.expand(substr)
+			if !strings.Contains(h.last.Body.String(), want) {
+				return fmt.Errorf("body %q doesn't contain %q", h.last.Body, want)
+			}
+			return nil
+		},
+	}
+}
+
+// expand replaces {member:name} and {key:uid} with the IDs of members and
+// keys created earlier.
+func (h *Harness) expand(s string) string {
+	for name, id := range h.members {
+		s = strings.Replace(s, fmt.Sprintf("{member:%s}", name), fmt.Sprint(id), -1)
+	}
+	for uid, id := range h.keys {
+		s = strings.Replace(s, fmt.Sprintf("{key:%s}", uid), fmt.Sprint(id), -1)
+	}
+	return s
+}
@@ -6,12 +6,13 @@
 set -eux
 
 BINARY="${1:-main}"
+CONFIG="${2:-develop.json}"
 RELEASE_DIR="release/"
 REMOTE_DIR="/home/pi/craftdoor"
 HOSTNAME="raspberrypi"
 
 if [[ "${BINARY}" == "main" ]]; then
-    FLAGS="--config=${REMOTE_DIR}/develop.json"
+    FLAGS="--config=${REMOTE_DIR}/${CONFIG}"
 elif [[ "${BINARY}" == "read" ]]; then
     FLAGS=""
 fi
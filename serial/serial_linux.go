@@ -0,0 +1,65 @@
+// Package serial opens serial ports in raw mode.
+package serial
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// speeds maps supported baud rates to their termios flags.
+var speeds = map[int]uint32{
+	1200:   syscall.B1200,
+	2400:   syscall.B2400,
+	4800:   syscall.B4800,
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+}
+
+// Open opens the serial device path in raw mode at baud, 8N1. Reads honour
+// deadlines set with SetReadDeadline.
+func Open(path string, baud int) (*os.File, error) {
+	speed, ok := speeds[baud]
+	if !ok {
+		return nil, fmt.Errorf("serial: unsupported baud rate %d", baud)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	// Fd would make reads blocking, ignoring deadlines.
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return nil, closeAfter(f, err)
+	}
+	var errno syscall.Errno
+	err = rc.Control(func(fd uintptr) {
+		t := syscall.Termios{
+			Cflag:  syscall.CS8 | syscall.CREAD | syscall.CLOCAL | speed,
+			Ispeed: speed,
+			Ospeed: speed,
+		}
+		t.Cc[syscall.VMIN] = 1
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&t)))
+	})
+	if err == nil && errno != 0 {
+		err = errno
+	}
+	if err != nil {
+		return nil, closeAfter(f, fmt.Errorf("serial: configuring %s: %s", path, err))
+	}
+	return f, nil
+}
+
+// closeAfter closes f and returns err.
+func closeAfter(f *os.File, err error) error {
+	e := f.Close()
+	if e != nil {
+		return fmt.Errorf("%s, and closing %s: %s", err, f.Name(), e)
+	}
+	return err
+}
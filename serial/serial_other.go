@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+// Package serial opens serial ports in raw mode.
+package serial
+
+import (
+	"errors"
+	"os"
+)
+
+// Open returns an error. Serial ports are only supported on Linux.
+func Open(path string, baud int) (*os.File, error) {
+	return nil, errors.New("serial: only supported on Linux")
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/pakohan/craftdoor/access"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/model"
+)
+
+// readPIN waits for a member ID and PIN on the door's keypad, for use under
+// access.PolicyPIN. Returns false if no entry was made within timeout.
+func (s *Service) readPIN(ctx context.Context, log *logging.Logger, timeout time.Duration) (access.Credentials, bool) {
+	creds, err := access.ReadEntry(ctx, s.d.PINPad(), timeout)
+	if err != nil {
+		if err != door.ErrEntryTimeout && ctx.Err() == nil {
+			log.Errorf("Failed to read keypad: %s", err)
+		}
+		return creds, false
+	}
+	return creds, true
+}
+
+// readTagPIN waits for the PIN following tag uid, for use under
+// access.PolicyTagPIN. Returns false if ctx is done.
+func (s *Service) readTagPIN(ctx context.Context, log *logging.Logger, uid string) (access.Credentials, bool) {
+	log.Infof("Waiting for PIN.")
+	creds, err := access.ReadPIN(ctx, s.d.PINPad(), uid)
+	if err != nil {
+		if ctx.Err() != nil {
+			return creds, false
+		}
+		log.Errorf("Failed to read keypad: %s", err)
+	}
+	return creds, true
+}
+
+// decide decides whether creds open a door in the given mode under policy.
+func (s *Service) decide(ctx context.Context, policy access.Policy, mode door.Mode, creds access.Credentials) (access.Result, error) {
+	var member *access.Member
+	var err error
+	switch {
+	case creds.UID != "":
+		member, err = s.m.KeyModel.MemberAccess(ctx, creds.UID)
+	case creds.MemberID != 0:
+		member, err = s.m.MemberModel.MemberAccess(ctx, creds.MemberID)
+	}
+	if err != nil {
+		return access.Result{}, err
+	}
+	return access.Decide(policy, mode == door.ModeLockdown, creds, member), nil
+}
+
+// admit decides whether creds open the master's door, records the decision
+// and signals it to the door.
+func (s *Service) admit(ctx context.Context, log *logging.Logger, policy access.Policy, creds access.Credentials) {
+	s.mu.Lock()
+	mode := s.mode.At(s.clock.Now())
+	s.mu.Unlock()
+
+	res, err := s.decide(ctx, policy, mode, creds)
+	if err != nil {
+		log.Errorf("Failed to decide on access: %s", err)
+		return
+	}
+	s.enforce(ctx, log, policy, creds, res)
+}
+
+// enforce records the decision res on creds and signals it to the door.
+func (s *Service) enforce(ctx context.Context, log *logging.Logger, policy access.Policy, creds access.Credentials, res access.Result) {
+	if pad := s.d.PINPad(); pad != nil && policy.NeedsPIN() && access.CountAttempt(pad, res) {
+		_, until := pad.LockedOut()
+		log.Warnf("Too many wrong PINs. Keypad locked until %s.", until)
+	}
+	s.logAccess(ctx, model.AccessLogEntry{
+		Time:     s.clock.Now(),
+		DoorID:   s.d.ID(),
+		KeyUUID:  creds.UID,
+		MemberID: res.MemberID,
+		Granted:  res.Granted,
+		Reason:   string(res.Reason),
+	})
+
+	var err error
+	if res.Granted {
+		log.Infof("Access granted.")
+		err = s.d.AuthOK()
+		if err == nil && res.Keyholder {
+			err = s.d.KeyholderIn()
+		}
+	} else {
+		log.Infof("Access NOT granted: %s.", res.Reason)
+		err = s.d.AuthFail()
+	}
+	if err != nil {
+		log.Errorf("Failed to signal access decision to door: %s", err)
+	}
+}
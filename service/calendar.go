@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/lib"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/model"
+)
+
+// xKindProperty is an iCalendar extension property overriding the kind of an
+// imported event.
+const xKindProperty = "X-CRAFTDOOR-KIND"
+
+// ImportReport summarizes the result of ImportCalendar.
+type ImportReport struct {
+	// Number of calendar entries created or updated.
+	Imported int `json:"imported"`
+
+	// Reasons for skipping events.
+	Skipped []string `json:"skipped"`
+}
+
+// RefreshCalendar loads all calendar entries into the door's calendar.
+//
+// Invalid entries are logged and skipped.
+func (s *Service) RefreshCalendar(ctx context.Context) error {
+	entries, err := s.m.CalendarModel.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	exceptions := []door.Exception{}
+	for _, entry := range entries {
+		exception, err := toException(entry)
+		if err != nil {
+			logging.Warnf("Skipping invalid calendar entry %d: %s", entry.ID, err)
+			continue
+		}
+		exceptions = append(exceptions, exception)
+	}
+	s.cal.Set(exceptions)
+	logging.Infof("Loaded %d calendar entries.", len(exceptions))
+	return nil
+}
+
+// CreateCalendarEntry validates and stores a new calendar entry.
+func (s *Service) CreateCalendarEntry(ctx context.Context, entry *model.CalendarEntry) error {
+	_, err := toException(*entry)
+	if err != nil {
+		return err
+	}
+	err = s.m.CalendarModel.Create(ctx, entry)
+	if err != nil {
+		return err
+	}
+	return s.RefreshCalendar(ctx)
+}
+
+// UpdateCalendarEntry validates and replaces a calendar entry.
+func (s *Service) UpdateCalendarEntry(ctx context.Context, entry model.CalendarEntry) error {
+	_, err := toException(entry)
+	if err != nil {
+		return err
+	}
+	err = s.m.CalendarModel.Update(ctx, entry)
+	if err != nil {
+		return err
+	}
+	return s.RefreshCalendar(ctx)
+}
+
+// DeleteCalendarEntry deletes a calendar entry.
+func (s *Service) DeleteCalendarEntry(ctx context.Context, id int64) error {
+	err := s.m.CalendarModel.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.RefreshCalendar(ctx)
+}
+
+// ImportCalendar stores the events of an iCalendar file as calendar entries.
+//
+// All-day events close the door on each of their dates. Timed events replace
+// the regular windows on the date they start. The kind can be overridden with
+// a CATEGORIES value or an X-CRAFTDOOR-KIND property of "closed", "custom" or
+// "extended". Events are matched by UID, so re-importing a file updates
+// existing entries. Recurring events are skipped.
+func (s *Service) ImportCalendar(ctx context.Context, r io.Reader) (*ImportReport, error) {
+	events, err := lib.ParseICal(r, s.cal.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{Skipped: []string{}}
+	for _, event := range events {
+		entries, err := calendarEntriesOf(event, s.cal.Location)
+		if err != nil {
+			reason := fmt.Sprintf("%q (%s): %s", event.Summary, event.UID, err)
+			logging.Warnf("Skipping calendar event %s", reason)
+			report.Skipped = append(report.Skipped, reason)
+			continue
+		}
+		for i := range entries {
+			err = s.m.CalendarModel.UpsertByUID(ctx, &entries[i])
+			if err != nil {
+				return nil, err
+			}
+			report.Imported++
+		}
+	}
+
+	err = s.RefreshCalendar(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// toException validates a calendar entry and converts it.
+func toException(entry model.CalendarEntry) (door.Exception, error) {
+	return door.ParseException(entry.Date, entry.Kind, entry.Windows)
+}
+
+// calendarEntriesOf converts an imported event into calendar entries.
+func calendarEntriesOf(event lib.ICalEvent, loc *time.Location) ([]model.CalendarEntry, error) {
+	if event.Recurring {
+		return nil, fmt.Errorf("recurring events are not supported")
+	}
+	if event.UID == "" {
+		return nil, fmt.Errorf("event has no UID")
+	}
+	if !event.End.After(event.Start) {
+		return nil, fmt.Errorf("event ends before it starts")
+	}
+
+	kind := door.Custom
+	if event.AllDay {
+		kind = door.Closed
+	}
+	for _, c := range event.Categories {
+		k, err := door.ParseExceptionKind(strings.ToLower(strings.TrimSpace(c)))
+		if err == nil {
+			kind = k
+		}
+	}
+	if value, ok := event.Extensions[xKindProperty]; ok {
+		k, err := door.ParseExceptionKind(strings.ToLower(value))
+		if err != nil {
+			return nil, err
+		}
+		kind = k
+	}
+
+	if event.AllDay {
+		if kind != door.Closed {
+			return nil, fmt.Errorf("all-day events can only be %s", door.Closed)
+		}
+		entries := []model.CalendarEntry{}
+		start, end := door.DateOf(event.Start), door.DateOf(event.End)
+		for date := start; date != end; date = date.AddDays(1) {
+			uid := event.UID
+			if date != start {
+				uid = fmt.Sprintf("%s/%s", event.UID, date)
+			}
+			entries = append(entries, model.CalendarEntry{
+				Date:    date.String(),
+				Kind:    string(kind),
+				Windows: model.StringList{},
+				Summary: event.Summary,
+				UID:     &uid,
+			})
+		}
+		return entries, nil
+	}
+
+	start, end := event.Start.In(loc), event.End.In(loc)
+	if end.Sub(start) >= 24*time.Hour {
+		return nil, fmt.Errorf("timed events must be shorter than a day")
+	}
+	entry := model.CalendarEntry{
+		Date:    door.DateOf(start).String(),
+		Kind:    string(kind),
+		Windows: model.StringList{},
+		Summary: event.Summary,
+		UID:     &event.UID,
+	}
+	if kind != door.Closed {
+		entry.Windows = model.StringList{fmt.Sprintf("%s-%s", start.Format("15:04"), end.Format("15:04"))}
+	}
+	return []model.CalendarEntry{entry}, nil
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxHeartbeatAge is the longest DoorAccessLoop may go without completing an
+// iteration before it is considered hung.
+const maxHeartbeatAge = 30 * time.Second
+
+// Check is the outcome of a single health check.
+type Check struct {
+	// Name of the component being checked.
+	Name string `json:"name"`
+
+	// True if the component is healthy.
+	OK bool `json:"ok"`
+
+	// Reason the component is unhealthy. Empty if OK.
+	Error string `json:"error,omitempty"`
+}
+
+// HealthReport summarizes the outcome of multiple health checks.
+type HealthReport struct {
+	// True if all checks passed.
+	OK bool `json:"ok"`
+
+	// Individual check results.
+	Checks []Check `json:"checks"`
+}
+
+func (h *HealthReport) add(name string, err error) {
+	check := Check{Name: name, OK: err == nil}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	h.Checks = append(h.Checks, check)
+	h.OK = h.OK && check.OK
+}
+
+// Liveness reports whether the process' background loops are still running.
+//
+// A failed liveness check means the process should be restarted.
+func (s *Service) Liveness() HealthReport {
+	result := HealthReport{OK: true}
+	result.add("door_loop", s.checkHeartbeat())
+	result.add("door", s.d.Health())
+	return result
+}
+
+// Readiness reports whether the service is able to grant access right now.
+//
+// In addition to the liveness checks, the database and RFID reader must be
+// reachable.
+func (s *Service) Readiness(ctx context.Context) HealthReport {
+	result := s.Liveness()
+	result.add("database", s.m.Ping(ctx))
+	result.add("reader", s.checkReader())
+	return result
+}
+
+func (s *Service) checkHeartbeat() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.heartbeat.IsZero() {
+		return fmt.Errorf("DoorAccessLoop has not started")
+	}
+	if age := s.clock.Now().Sub(s.heartbeat); age > maxHeartbeatAge {
+		return fmt.Errorf("DoorAccessLoop last completed an iteration %s ago", age)
+	}
+	return nil
+}
+
+// checkReader returns the error of the reader's last operation, if it
+// failed. A reader that hasn't been read yet is considered healthy.
+func (s *Service) checkReader() error {
+	respondedAt, err := s.reader.Status()
+	if err == nil {
+		return nil
+	}
+	if respondedAt.IsZero() {
+		return fmt.Errorf("reader has not responded yet: %s", err)
+	}
+	return fmt.Errorf("reader has not responded since %s: %s", respondedAt.Format(time.RFC3339), err)
+}
+
+// beat records that DoorAccessLoop completed an iteration.
+func (s *Service) beat() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heartbeat = s.clock.Now()
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/model"
+)
+
+// DoorStatus describes a door's mode, wiring and latches.
+type DoorStatus struct {
+	ID      string            `json:"id"`
+	Mode    *model.DoorMode   `json:"mode"`
+	Relays  []door.RelayInfo  `json:"relays"`
+	Latches []door.LatchState `json:"latches"`
+}
+
+// DoorStatus returns the status of door id, which is either the master's
+// door or a node's. A node's relays and latches are as of its last heartbeat.
+func (s *Service) DoorStatus(ctx context.Context, id string) (*DoorStatus, error) {
+	mode, err := s.DoorMode(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status, ok := s.nodeDoor(id); ok {
+		return &DoorStatus{
+			ID:      id,
+			Mode:    mode,
+			Relays:  status.Relays,
+			Latches: status.Latches,
+		}, nil
+	}
+	return &DoorStatus{
+		ID:      id,
+		Mode:    mode,
+		Relays:  s.d.Relays(),
+		Latches: s.d.Latches(),
+	}, nil
+}
+
+// DoorMode returns the mode currently in effect for door id, which is either
+// the master's door or a node's.
+func (s *Service) DoorMode(ctx context.Context, id string) (*model.DoorMode, error) {
+	if _, ok := s.nodeDoor(id); ok {
+		mode, err := s.m.DoorModel.GetMode(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		state, err := toModeState(*mode)
+		if err != nil {
+			return nil, err
+		}
+		return toDoorMode(id, state, s.clock.Now()), nil
+	}
+	if id != s.d.ID() {
+		return nil, fmt.Errorf("unknown door: %q", id)
+	}
+
+	s.mu.Lock()
+	state := s.mode
+	s.mu.Unlock()
+	return toDoorMode(id, state, s.clock.Now()), nil
+}
+
+// SetDoorMode validates, applies and stores a door's mode. The mode is only
+// stored once the door accepted it, and the door's previous mode is restored
+// if storing fails.
+//
+// A held-open door reverts to normal at mode.Until, which must be in the
+// future. Until is ignored for other modes. A node's door changes its mode
+// with the node's next heartbeat.
+func (s *Service) SetDoorMode(ctx context.Context, mode *model.DoorMode) error {
+	_, isNodeDoor := s.nodeDoor(mode.DoorID)
+	if mode.DoorID != s.d.ID() && !isNodeDoor {
+		return fmt.Errorf("unknown door: %q", mode.DoorID)
+	}
+	state, err := toModeState(*mode)
+	if err != nil {
+		return err
+	}
+	if state.Mode == door.ModeHeldOpen && !state.Until.After(s.clock.Now()) {
+		return errors.New("held_open mode requires an until time in the future")
+	}
+	if state.Mode != door.ModeHeldOpen {
+		mode.Until = nil
+	}
+
+	if isNodeDoor {
+		return s.m.DoorModel.SetMode(ctx, *mode)
+	}
+
+	s.mu.Lock()
+	previous := s.mode
+	s.mu.Unlock()
+	err = s.applyDoorMode(state)
+	if err != nil {
+		return err
+	}
+	err = s.m.DoorModel.SetMode(ctx, *mode)
+	if err != nil {
+		e := s.applyDoorMode(previous)
+		if e != nil {
+			logging.Errorf("Failed to restore mode of door %s: %s", s.d.ID(), e)
+		}
+		return err
+	}
+	return nil
+}
+
+// loadDoorMode applies the door's stored mode.
+func (s *Service) loadDoorMode(ctx context.Context) error {
+	mode, err := s.m.DoorModel.GetMode(ctx, s.d.ID())
+	if err != nil {
+		return err
+	}
+	state, err := toModeState(*mode)
+	if err != nil {
+		return err
+	}
+	return s.applyDoorMode(state)
+}
+
+// applyDoorMode passes the mode to the door and records it for access
+// decisions.
+func (s *Service) applyDoorMode(state door.ModeState) error {
+	err := s.d.SetMode(state)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.mode = state
+	s.mu.Unlock()
+	logging.Infof("Door %s is in %s mode.", s.d.ID(), state.At(s.clock.Now()))
+	return nil
+}
+
+// toDoorMode describes the mode in effect at now for door id.
+func toDoorMode(id string, state door.ModeState, now time.Time) *model.DoorMode {
+	res := &model.DoorMode{
+		DoorID: id,
+		Mode:   string(state.At(now)),
+	}
+	if res.Mode == string(door.ModeHeldOpen) {
+		until := state.Until
+		res.Until = &until
+	}
+	return res
+}
+
+// toModeState converts a stored mode.
+func toModeState(mode model.DoorMode) (door.ModeState, error) {
+	m, err := door.ParseMode(mode.Mode)
+	if err != nil {
+		return door.ModeState{}, err
+	}
+	state := door.ModeState{Mode: m}
+	if m == door.ModeHeldOpen {
+		if mode.Until == nil {
+			return door.ModeState{}, errors.New("held_open mode requires an until time")
+		}
+		state.Until = *mode.Until
+	}
+	return state, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/model"
+	"github.com/pakohan/craftdoor/rfid"
+)
+
+// modeDoor is a door recording the modes it is set to, which fails to change
+// its mode while err is set.
+type modeDoor struct {
+	door.Door
+	err   error
+	modes []door.Mode
+}
+
+func (d *modeDoor) SetMode(mode door.ModeState) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.modes = append(d.modes, mode.Mode)
+	return d.Door.SetMode(mode)
+}
+
+func TestSetDoorMode(t *testing.T) {
+	ctx := context.Background()
+	cfg, db := openTestDB(t)
+	m := model.New(db)
+	clk := clock.NewFake(time.Date(2026, time.January, 5, 12, 0, 0, 0, time.UTC))
+	r, err := rfid.NewSimulatedReader(cfg.Reader.Simulated, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := door.NewCalendar(time.UTC)
+	sim, _, err := door.NewSimulatedDoor(cfg.Door, cal, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	d := &modeDoor{Door: sim}
+	s := New(&cfg, m, r, d, cal, clk)
+	defer clk.AdvanceWhile(s.Close)
+
+	expectMode := func(want door.Mode) {
+		t.Helper()
+		mode, err := s.DoorMode(ctx, d.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode.Mode != string(want) {
+			t.Errorf("door is in %s mode, want %s", mode.Mode, want)
+		}
+		if last := d.modes[len(d.modes)-1]; last != want {
+			t.Errorf("door was last set to %s mode, want %s", last, want)
+		}
+	}
+
+	err = s.SetDoorMode(ctx, &model.DoorMode{DoorID: d.ID(), Mode: string(door.ModeLockdown)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectMode(door.ModeLockdown)
+
+	// The door refuses the mode, which isn't stored.
+	d.err = errors.New("relay stuck")
+	err = s.SetDoorMode(ctx, &model.DoorMode{DoorID: d.ID(), Mode: string(door.ModeNormal)})
+	if err == nil {
+		t.Fatal("SetDoorMode succeeded although the door failed")
+	}
+	d.err = nil
+	stored, err := m.DoorModel.GetMode(ctx, d.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Mode != string(door.ModeLockdown) {
+		t.Errorf("stored %s mode, want %s", stored.Mode, door.ModeLockdown)
+	}
+	expectMode(door.ModeLockdown)
+
+	// Storing the mode fails, which restores the door's previous mode.
+	_, err = db.Exec(`DROP TABLE "door_mode"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetDoorMode(ctx, &model.DoorMode{DoorID: d.ID(), Mode: string(door.ModeNormal)})
+	if err == nil {
+		t.Fatal("SetDoorMode succeeded although storing the mode failed")
+	}
+	expectMode(door.ModeLockdown)
+}
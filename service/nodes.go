@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pakohan/craftdoor/access"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/model"
+	"github.com/pakohan/craftdoor/node"
+)
+
+// missedHeartbeats is how many heartbeats a node may miss before it is
+// reported as offline.
+const missedHeartbeats = 3
+
+// ErrUnknownNode is returned for requests of nodes that aren't configured in
+// nodes.
+var ErrUnknownNode = errors.New("unknown node")
+
+// ErrWrongDoor is returned for heartbeats of nodes that report another door
+// than the one configured for them.
+var ErrWrongDoor = errors.New("node reports the wrong door")
+
+// NodeStatus describes a door node as last reported by its heartbeat.
+type NodeStatus struct {
+	// ID of the node, as configured in nodes.
+	ID string `json:"id"`
+
+	// ID of the node's door.
+	DoorID string `json:"door_id"`
+
+	// Network address the last heartbeat was sent from.
+	Address string `json:"address"`
+
+	// When the node first sent a heartbeat since the master started.
+	RegisteredAt time.Time `json:"registered_at"`
+
+	// When the node last sent a heartbeat.
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+
+	// How often the node sends heartbeats.
+	Interval config.Duration `json:"interval"`
+
+	// True unless the node missed several heartbeats.
+	Online bool `json:"online"`
+
+	// Why the node is unhealthy. Empty if healthy.
+	Error string `json:"error,omitempty"`
+
+	// How the node door's locks are wired.
+	Relays []door.RelayInfo `json:"relays"`
+
+	// State of the node door's latches.
+	Latches []door.LatchState `json:"latches"`
+
+	// Version of the access list the node has cached. Empty if none.
+	AccessListVersion string `json:"access_list_version"`
+
+	// Number of access events the node has yet to upload.
+	QueuedEvents int `json:"queued_events"`
+}
+
+// applyNodes forgets nodes that are no longer configured or whose door
+// changed.
+func (s *Service) applyNodes(nodes []config.NodeConfig) {
+	configured := map[string]config.NodeConfig{}
+	for _, n := range nodes {
+		configured[n.ID] = n
+	}
+
+	s.nodesMu.Lock()
+	defer s.nodesMu.Unlock()
+	for id, status := range s.nodes {
+		if cfg, ok := configured[id]; !ok || cfg.DoorID != status.DoorID {
+			logging.Infof("Node %s is no longer configured.", id)
+			delete(s.nodes, id)
+		}
+	}
+	s.configuredNodes = configured
+}
+
+// NodeHeartbeat records a heartbeat of node id, sent from address, and
+// returns the version of the node's access list. The first heartbeat
+// registers the node.
+func (s *Service) NodeHeartbeat(ctx context.Context, id string, address string, hb node.Heartbeat) (*node.HeartbeatResponse, error) {
+	now := s.clock.Now()
+	s.nodesMu.Lock()
+	cfg, ok := s.configuredNodes[id]
+	if !ok {
+		s.nodesMu.Unlock()
+		return nil, fmt.Errorf("%w: %q", ErrUnknownNode, id)
+	}
+	if hb.DoorID != cfg.DoorID {
+		s.nodesMu.Unlock()
+		return nil, fmt.Errorf("%w: %s reports door %q, but its door is %q", ErrWrongDoor, id, hb.DoorID, cfg.DoorID)
+	}
+	status, ok := s.nodes[id]
+	if !ok {
+		logging.Infof("Node %s registered from %s with door %s.", id, address, hb.DoorID)
+		status = &NodeStatus{ID: id, RegisteredAt: now}
+		s.nodes[id] = status
+	}
+	status.DoorID = hb.DoorID
+	status.Address = address
+	status.LastHeartbeat = now
+	status.Interval = hb.Interval
+	status.Error = hb.Error
+	status.Relays = hb.Relays
+	status.Latches = hb.Latches
+	status.AccessListVersion = hb.AccessListVersion
+	status.QueuedEvents = hb.QueuedEvents
+	s.nodesMu.Unlock()
+
+	policy, err := access.ParsePolicy(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.accessList(ctx, hb.DoorID, policy)
+	if err != nil {
+		return nil, err
+	}
+	return &node.HeartbeatResponse{AccessListVersion: list.Version}, nil
+}
+
+// NodeAccessList returns the access list of node id's door, valid for
+// access_list_validity.
+func (s *Service) NodeAccessList(ctx context.Context, id string) (*node.AccessList, error) {
+	status, err := s.Node(id)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := s.nodePolicy(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.accessList(ctx, status.DoorID, policy)
+}
+
+// NodeEvents records access decisions node id made while the master was
+// unreachable.
+func (s *Service) NodeEvents(ctx context.Context, id string, events []node.AccessEvent) error {
+	status, err := s.Node(id)
+	if err != nil {
+		return err
+	}
+
+	entries := []model.AccessLogEntry{}
+	granted := 0
+	for _, event := range events {
+		entries = append(entries, model.AccessLogEntry{
+			Time:     event.At,
+			DoorID:   status.DoorID,
+			NodeID:   id,
+			KeyUUID:  event.UID,
+			MemberID: event.MemberID,
+			Granted:  event.Granted,
+			Reason:   string(event.Reason),
+			Offline:  true,
+		})
+		if event.Granted {
+			granted++
+		}
+	}
+	err = s.m.AccessLogModel.CreateAll(ctx, entries)
+	if err != nil {
+		return err
+	}
+	logging.With("node", id).Infof("Recorded %d access events made offline, %d granted.", len(events), granted)
+	return nil
+}
+
+// accessList returns the access list of door doorID, whose auth policy is
+// policy. Unless the policy requires a PIN, the list leaves out the hashes
+// of members' PINs.
+func (s *Service) accessList(ctx context.Context, doorID string, policy access.Policy) (*node.AccessList, error) {
+	mode, err := s.DoorMode(ctx, doorID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.m.CalendarModel.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.m.KeyModel.ListAccess(ctx)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.m.MemberModel.ListAccess(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !policy.NeedsPIN() {
+		for i := range members {
+			members[i].PINHash = ""
+		}
+	}
+
+	s.mu.Lock()
+	validity := s.accessListValidity
+	s.mu.Unlock()
+	now := s.clock.Now()
+	list := &node.AccessList{
+		DoorID:      doorID,
+		GeneratedAt: now,
+		ValidUntil:  now.Add(validity),
+		Mode:        door.Mode(mode.Mode),
+		Until:       mode.Until,
+		Calendar:    entries,
+		Keys:        keys,
+		Members:     members,
+	}
+	list.Version, err = list.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// NodeTag decides whether credentials presented at node id's door may open
+// it, under the door's auth policy as configured in nodes. The policy
+// reported by the node is only checked against it.
+func (s *Service) NodeTag(ctx context.Context, id string, event node.TagEvent) (*node.Decision, error) {
+	status, err := s.Node(id)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := s.nodePolicy(id)
+	if err != nil {
+		return nil, err
+	}
+	log := logging.With("node", id).With("key", event.UID)
+	reported, err := access.ParsePolicy(string(event.Policy))
+	if err != nil || reported != policy {
+		log.Warnf("Node reports auth policy %q, deciding under %q as configured.", event.Policy, policy)
+	}
+
+	mode, err := s.DoorMode(ctx, status.DoorID)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.decide(ctx, policy, door.Mode(mode.Mode), event.Credentials())
+	if err != nil {
+		return nil, err
+	}
+	s.logAccess(ctx, model.AccessLogEntry{
+		Time:     event.At,
+		DoorID:   status.DoorID,
+		NodeID:   id,
+		KeyUUID:  event.UID,
+		MemberID: res.MemberID,
+		Granted:  res.Granted,
+		Reason:   string(res.Reason),
+	})
+	if res.Granted {
+		log.Infof("Access granted.")
+	} else {
+		log.Infof("Access NOT granted: %s.", res.Reason)
+	}
+	return &node.Decision{
+		Granted:   res.Granted,
+		Keyholder: res.Keyholder,
+		MemberID:  res.MemberID,
+		Reason:    res.Reason,
+	}, nil
+}
+
+// nodePolicy returns the auth policy configured for node id's door.
+func (s *Service) nodePolicy(id string) (access.Policy, error) {
+	s.nodesMu.Lock()
+	cfg, ok := s.configuredNodes[id]
+	s.nodesMu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownNode, id)
+	}
+	return access.ParsePolicy(cfg.Auth)
+}
+
+// Nodes returns all registered nodes, ordered by ID.
+func (s *Service) Nodes() []NodeStatus {
+	s.nodesMu.Lock()
+	defer s.nodesMu.Unlock()
+	result := []NodeStatus{}
+	for _, status := range s.nodes {
+		result = append(result, s.nodeStatus(status))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Node returns a node configured in nodes. If the node hasn't sent a
+// heartbeat since the master started, its status only has its ID and door.
+func (s *Service) Node(id string) (*NodeStatus, error) {
+	s.nodesMu.Lock()
+	defer s.nodesMu.Unlock()
+	cfg, ok := s.configuredNodes[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownNode, id)
+	}
+	return s.configuredStatus(cfg), nil
+}
+
+// nodeDoor returns the node whose door is doorID, as configured in nodes.
+func (s *Service) nodeDoor(doorID string) (*NodeStatus, bool) {
+	s.nodesMu.Lock()
+	defer s.nodesMu.Unlock()
+	for _, cfg := range s.configuredNodes {
+		if cfg.DoorID == doorID {
+			return s.configuredStatus(cfg), true
+		}
+	}
+	return nil, false
+}
+
+// configuredStatus returns the status of the node configured as cfg. Must be
+// called with nodesMu held.
+func (s *Service) configuredStatus(cfg config.NodeConfig) *NodeStatus {
+	status, ok := s.nodes[cfg.ID]
+	if !ok {
+		return &NodeStatus{ID: cfg.ID, DoorID: cfg.DoorID, Relays: []door.RelayInfo{}, Latches: []door.LatchState{}}
+	}
+	result := s.nodeStatus(status)
+	return &result
+}
+
+// nodeStatus returns a copy of status with Online set. Must be called with
+// nodesMu held.
+func (s *Service) nodeStatus(status *NodeStatus) NodeStatus {
+	result := *status
+	age := s.clock.Now().Sub(status.LastHeartbeat)
+	result.Online = age <= missedHeartbeats*status.Interval.Duration
+	return result
+}
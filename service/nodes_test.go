@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pakohan/craftdoor/access"
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/model"
+	"github.com/pakohan/craftdoor/node"
+	"github.com/pakohan/craftdoor/rfid"
+)
+
+// newNodeTestService returns a service admitting nodes, and its model.
+func newNodeTestService(t *testing.T, nodes []config.NodeConfig) (*Service, model.Model) {
+	cfg, db := openTestDB(t)
+	cfg.Nodes = nodes
+	m := model.New(db)
+	clk := clock.NewFake(time.Date(2026, time.January, 5, 12, 0, 0, 0, time.UTC))
+	r, err := rfid.NewSimulatedReader(cfg.Reader.Simulated, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := door.NewCalendar(time.UTC)
+	d, _, err := door.NewSimulatedDoor(cfg.Door, cal, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	s := New(&cfg, m, r, d, cal, clk)
+	t.Cleanup(func() { clk.AdvanceWhile(s.Close) })
+	return s, m
+}
+
+// TestNodeBeforeHeartbeat checks that a configured node is admitted before
+// its first heartbeat, e.g. right after the master restarted.
+func TestNodeBeforeHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	s, m := newNodeTestService(t, []config.NodeConfig{{ID: "workshop", Secret: "test-secret-0123456789", DoorID: "workshop", Auth: "tag"}})
+	clk := s.clock
+
+	decision, err := s.NodeTag(ctx, "workshop", node.TagEvent{UID: "04a1b2c3", At: clk.Now(), Policy: access.PolicyTag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Granted || decision.Reason != access.ReasonUnknownTag {
+		t.Errorf("NodeTag of an unknown key = %+v, want denied as %s", decision, access.ReasonUnknownTag)
+	}
+
+	err = s.NodeEvents(ctx, "workshop", []node.AccessEvent{{UID: "04a1b2c3", At: clk.Now(), Reason: access.ReasonUnknownTag}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := m.AccessLogModel.List(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].DoorID != "workshop" || entries[1].DoorID != "workshop" {
+		t.Errorf("access log has %+v, want two entries of door workshop", entries)
+	}
+
+	_, err = s.NodeAccessList(ctx, "workshop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.NodeTag(ctx, "garage", node.TagEvent{UID: "04a1b2c3", At: clk.Now(), Policy: access.PolicyTag})
+	if !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("NodeTag of an unconfigured node returned %v, want %s", err, ErrUnknownNode)
+	}
+	_, err = s.NodeHeartbeat(ctx, "workshop", "127.0.0.1", node.Heartbeat{DoorID: "garage"})
+	if !errors.Is(err, ErrWrongDoor) {
+		t.Errorf("NodeHeartbeat with another door returned %v, want %s", err, ErrWrongDoor)
+	}
+}
+
+// TestNodeAccessListPINHashes checks that only access lists of doors that
+// require a PIN include the hashes of members' PINs.
+func TestNodeAccessListPINHashes(t *testing.T) {
+	ctx := context.Background()
+	s, m := newNodeTestService(t, []config.NodeConfig{
+		{ID: "workshop", Secret: "test-secret-0123456789", DoorID: "workshop", Auth: "tag"},
+		{ID: "office", Secret: "test-secret-9876543210", DoorID: "office", Auth: "tag+pin"},
+	})
+	member := &model.Member{Name: "Ada"}
+	err := m.MemberModel.Create(ctx, member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := access.HashPIN("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.MemberModel.SetPINHash(ctx, member.ID, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string]string{"workshop": "", "office": hash} {
+		list, err := s.NodeAccessList(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Members) != 1 || list.Members[0].PINHash != want {
+			t.Errorf("access list of node %s has members %+v, want PIN hash %q", id, list.Members, want)
+		}
+	}
+}
@@ -3,39 +3,125 @@ package service
 import (
 	"context"
 	"encoding/hex"
-	"log"
-	"strings"
+	"errors"
+	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pakohan/craftdoor/access"
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
 	"github.com/pakohan/craftdoor/door"
 	"github.com/pakohan/craftdoor/lib"
+	"github.com/pakohan/craftdoor/logging"
 	"github.com/pakohan/craftdoor/model"
 	"github.com/pakohan/craftdoor/rfid"
 )
 
 // Service contains the business logic
 type Service struct {
-	m model.Model
-	r rfid.Reader
-	d door.Door
+	m     model.Model
+	r     rfid.Reader
+	d     door.Door
+	clock clock.Clock
+
+	// Exceptions to the door's regular opening hours, loaded from the
+	// calendar table.
+	cal *door.Calendar
+
+	// Stops DoorAccessLoop. done is closed once it has returned.
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Serializes access to the RFID reader and recovers from its errors.
+	reader *rfid.Poller
+
+	// Suppresses repeated reads of the same tag in DoorAccessLoop.
+	debounce *rfid.Debouncer
+
+	// Guards the door mode, health state and config below.
+	mu                 sync.Mutex
+	mode               door.ModeState
+	heartbeat          time.Time
+	accessListValidity time.Duration
+	policy             access.Policy
+
+	// Guards the door nodes below.
+	nodesMu sync.Mutex
+
+	// Registered door nodes, by ID.
+	nodes map[string]*NodeStatus
+
+	// Nodes allowed to register, by ID.
+	configuredNodes map[string]config.NodeConfig
 }
 
 // New returns a new service instance
-func New(m model.Model, r rfid.Reader, d door.Door) *Service {
+//
+// The calendar is loaded from the database into cal, which should be the
+// calendar used by d's schedules. Time is told by clk, e.g. clock.Real.
+//
+// Call Close to stop the service's background goroutines. Register the
+// service with a config.Reloader to apply config changes.
+func New(cfg *config.Config, m model.Model, r rfid.Reader, d door.Door, cal *door.Calendar, clk clock.Clock) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
 	s := &Service{
-		m: m,
-		r: r,
-		d: d,
+		m:        m,
+		r:        r,
+		d:        d,
+		clock:    clk,
+		cal:      cal,
+		reader:   rfid.NewPoller(r, clk),
+		debounce: rfid.NewDebouncer(cfg.Door.TagDebounce.Duration),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		nodes:    map[string]*NodeStatus{},
+
+		accessListValidity: cfg.AccessListValidity.Duration,
+		policy:             access.Policy(cfg.Door.Auth),
+	}
+	s.applyNodes(cfg.Nodes)
+
+	err := s.RefreshCalendar(ctx)
+	if err != nil {
+		logging.Errorf("Failed to load calendar: %s", err)
+	}
+	err = s.loadDoorMode(ctx)
+	if err != nil {
+		logging.Errorf("Failed to load door mode: %s", err)
 	}
 
-	// Start infinite loop that unlocks the door.
-	go s.DoorAccessLoop()
+	// Start loop that unlocks the door.
+	go s.DoorAccessLoop(ctx)
 
 	return s
 }
 
-// ReadNextTag reads the next available RFID tag before the timeout.
+// ApplyConfig changes the tag debounce window, the door's auth policy and the
+// validity of access lists, and forgets nodes that are no longer configured.
+func (s *Service) ApplyConfig(cfg *config.Config) error {
+	s.debounce.SetWindow(cfg.Door.TagDebounce.Duration)
+	s.applyNodes(cfg.Nodes)
+	s.mu.Lock()
+	s.accessListValidity = cfg.AccessListValidity.Duration
+	s.policy = access.Policy(cfg.Door.Auth)
+	s.mu.Unlock()
+	return nil
+}
+
+// Close stops DoorAccessLoop and waits for it to return.
+//
+// The reader and door are owned by the caller and are not closed.
+func (s *Service) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// ReadNextTag reads the next available RFID tag before the timeout. The
+// tag's ID is the hex-encoded UID, which may not be a valid credential ID,
+// see rfid.ParseCredentialID.
 //
 // If timeout is reached, a state with an empty TagInfo field is returned.
 func (s *Service) ReadNextTag(timeout time.Duration) (*lib.State, error) {
@@ -44,80 +130,135 @@ func (s *Service) ReadNextTag(timeout time.Duration) (*lib.State, error) {
 		UUID: uuid.UUID{},
 	}
 
-	for {
-		start := time.Now()
-		uid, err := s.r.ReadUID(timeout)
-		if err != nil {
-			// Internal error worthy of a retry.
-			if strings.Contains(err.Error(), "lowlevel: IRQ error") {
-				log.Printf("IRQ error encountered. Re-initializing reader and trying again.")
-				timeout -= time.Since(start)
-				s.r.Initialize()
-				continue
-			}
-
-			// Timeout.
-			if strings.Contains(err.Error(), "lowlevel: timeout waiting for IRQ edge") {
-				result.IsTagAvailable = false
-				result.TagInfo = nil
-				break
-			}
-		}
-
-		if len(uid) == 0 {
-			log.Printf("Encountered empty UID. Retrying.")
-			timeout -= time.Since(start)
-			continue
-		}
+	card, err := s.reader.ReadCard(s.clock.Now().Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+	if card == nil {
+		result.IsTagAvailable = false
+		result.TagInfo = nil
+		return result, nil
+	}
 
-		// Successful read.
-		log.Printf("Successfully read tag: %s", hex.EncodeToString(uid))
-		result.IsTagAvailable = true
-		result.TagInfo = &lib.TagInfo{
-			ID:   hex.EncodeToString(uid),
-			Data: "",
-		}
-		break
+	// Successful read.
+	logging.Debugf("Successfully read %s tag: %s", card.Type, hex.EncodeToString(card.UID))
+	result.IsTagAvailable = true
+	result.TagInfo = &lib.TagInfo{
+		ID:       hex.EncodeToString(card.UID),
+		CardType: string(card.Type),
+		Data:     "",
 	}
 	return result, nil
 }
 
-// DoorAccessLoop is an infinite loop monitoring RFID tags put in front of the door.
+// DoorAccessLoop is a loop monitoring RFID tags put in front of the door. Runs until ctx is done.
 //
 // When a new RFID tag is put in front of the door and the tag is approved for entry, the door is unlocked.
-func (s *Service) DoorAccessLoop() {
-	log.Println("Starting DoorAccessLoop()...")
+// A tag held in front of the reader is only handled once. See config.DoorConfig.TagDebounce.
+//
+// Depending on the door's auth policy, a tag must be followed by a PIN, or
+// PINs are entered on the keypad instead, see access.Policy.
+func (s *Service) DoorAccessLoop(ctx context.Context) {
+	log := logging.With("door", s.d.String())
+	log.Infof("Starting DoorAccessLoop()...")
+	defer close(s.done)
+	defer s.recoverPanic(log)
+	// How long to wait for a tag before checking ctx and health again.
 	timeout := 3 * time.Second
 	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("Stopping DoorAccessLoop().")
+			return
+		default:
+		}
+
+		s.beat()
+
+		s.mu.Lock()
+		policy := s.policy
+		s.mu.Unlock()
+		if policy == access.PolicyPIN {
+			creds, ok := s.readPIN(ctx, log, timeout)
+			if ok {
+				s.admit(ctx, log.With("member", creds.MemberID), policy, creds)
+			}
+			continue
+		}
+
 		// TODO(duckworthd): There is contention for ownership of the tag reader. Find a better way...
 		state, err := s.ReadNextTag(timeout)
 		if err != nil {
-			log.Printf("Error encountered in DoorAccessLoop: %s", err)
+			log.Errorf("Error encountered in DoorAccessLoop: %s", err)
+			// Errors of the card, such as ErrAuth, don't need a pause. The
+			// poller already retried transient errors, so other errors are
+			// permanent and would otherwise make this a busy loop.
+			if !errors.Is(err, rfid.ErrAuth) {
+				s.wait(ctx, rfid.MaxBackoff)
+			}
 			continue
 		}
 
 		if !state.IsTagAvailable {
 			continue
 		}
+		if !s.debounce.Seen(state.TagInfo.ID, s.clock.Now()) {
+			log.Debugf("Ignoring tag %s, which is still in front of the reader.", state.TagInfo.ID)
+			continue
+		}
 
 		// TODO(duckworthd): Add support for >1 doors.
-		accessAllowed, err := s.m.KeyModel.IsAccessAllowed(context.Background(), state.TagInfo.ID)
+		keyLog := log.With("key", state.TagInfo.ID)
+		creds := access.Credentials{UID: state.TagInfo.ID}
+		_, err = rfid.ParseCredentialID(state.TagInfo.ID)
 		if err != nil {
-			log.Printf("Error determining in IsAccessAllowed() for key=%s.", state.TagInfo.ID)
+			keyLog.Warnf("Denying tag: %s", err)
+			s.enforce(ctx, keyLog, policy, creds, access.Result{Reason: access.ReasonInvalidUID})
 			continue
 		}
-
-		if accessAllowed {
-			log.Printf("Access granted for key=%s.", state.TagInfo.ID)
-			s.d.AuthOK()
-		} else {
-			log.Printf("Access NOT granted for key=%s.", state.TagInfo.ID)
-			s.d.AuthFail()
+		if policy == access.PolicyTagPIN {
+			var ok bool
+			creds, ok = s.readTagPIN(ctx, keyLog, state.TagInfo.ID)
+			if !ok {
+				continue
+			}
 		}
+		s.admit(ctx, keyLog, policy, creds)
+	}
+}
+
+// wait waits for d to pass on the service's clock, or for ctx to be done.
+func (s *Service) wait(ctx context.Context, d time.Duration) {
+	timer := s.clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C():
+	}
+}
 
-		// TODO(duckworthd): Figure out how to remove the need for this timeout.
-		// AuthOK and AuthFail both enqueue messages and return instantaneously, which
-		// will cause this loop to cycle very quickly when a tag is available.
-		time.Sleep(timeout)
+// logAccess records an access decision. Failures are logged rather than
+// returned, so that they don't keep anyone out.
+func (s *Service) logAccess(ctx context.Context, entry model.AccessLogEntry) {
+	err := s.m.AccessLogModel.Create(ctx, &entry)
+	if err != nil {
+		logging.With("key", entry.KeyUUID).Errorf("Failed to record access decision: %s", err)
+	}
+}
+
+// recoverPanic stops the door if DoorAccessLoop panics, which drives its
+// latches to their safe state. The panic is logged and not propagated, so
+// Liveness reports the stopped loop.
+//
+// Must be deferred directly by DoorAccessLoop.
+func (s *Service) recoverPanic(log *logging.Logger) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	log.Errorf("DoorAccessLoop panicked: %v\n%s", p, debug.Stack())
+	err := s.d.Close()
+	if err != nil {
+		log.Errorf("Failed to close door: %s", err)
 	}
 }
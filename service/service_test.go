@@ -0,0 +1,95 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pakohan/craftdoor/clock"
+	"github.com/pakohan/craftdoor/config"
+	"github.com/pakohan/craftdoor/door"
+	"github.com/pakohan/craftdoor/lib"
+	"github.com/pakohan/craftdoor/logging"
+	"github.com/pakohan/craftdoor/model"
+	"github.com/pakohan/craftdoor/rfid"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openTestDB returns a valid config for tests and the database it selects,
+// initialized with the schema. Both are removed when the test ends.
+func openTestDB(t *testing.T) (config.Config, *sqlx.DB) {
+	logging.SetLevel(logging.ErrorLevel)
+	dir, err := ioutil.TempDir("", "craftdoor-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cfg := config.Default()
+	cfg.SQLiteFile = filepath.Join(dir, "test.db")
+	cfg.SQLiteSchemaFile = "../assets/schema.sql"
+	cfg.Reader.Simulated.Latency = config.Duration{Duration: time.Millisecond}
+	err = cfg.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := lib.OpenDB(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return cfg, db
+}
+
+// TestStartStop starts and stops the service with its door repeatedly and
+// checks that no goroutines are left behind.
+func TestStartStop(t *testing.T) {
+	cfg, db := openTestDB(t)
+	m := model.New(db)
+
+	startStop := func() {
+		clk := clock.NewFake(time.Date(2026, time.January, 5, 12, 0, 0, 0, time.UTC))
+		r, err := rfid.NewSimulatedReader(cfg.Reader.Simulated, clk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cal := door.NewCalendar(time.UTC)
+		d, _, err := door.NewSimulatedDoor(cfg.Door, cal, clk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := New(&cfg, m, r, d, cal, clk)
+		err = clk.AdvanceWhile(s.Close)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first run starts goroutines that live as long as the process, e.g.
+	// database/sql's connection opener.
+	startStop()
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		startStop()
+	}
+
+	// Goroutines may take a moment to return after being stopped.
+	after := runtime.NumGoroutine()
+	for deadline := time.Now().Add(5 * time.Second); after > before && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		after = runtime.NumGoroutine()
+	}
+	if after > before {
+		buf := make([]byte, 1<<20)
+		t.Errorf("%d goroutines before, %d after 20 starts and stops:\n%s", before, after, buf[:runtime.Stack(buf, true)])
+	}
+}
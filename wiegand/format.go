@@ -0,0 +1,111 @@
+package wiegand
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by Decode.
+var (
+	// ErrParity means a frame's parity bits don't match its data.
+	ErrParity = errors.New("wiegand: parity error")
+
+	// ErrLength means a frame's length matches no known format.
+	ErrLength = errors.New("wiegand: unknown frame length")
+)
+
+// Format describes a card format: a leading even parity bit over the first
+// half of the data, the facility code, the card number, and a trailing odd
+// parity bit over the second half of the data.
+type Format struct {
+	// Name of the format, e.g. "wiegand-26".
+	Name string
+
+	// Number of bits in the facility code and card number.
+	FacilityBits int
+	CardBits     int
+}
+
+// Formats are the card formats Decode accepts.
+var (
+	// Wiegand26 is the standard 26-bit format, H10301: an 8-bit facility code
+	// and a 16-bit card number.
+	Wiegand26 = Format{Name: "wiegand-26", FacilityBits: 8, CardBits: 16}
+
+	// Wiegand34 is the 34-bit format used by most readers of 32-bit UIDs: a
+	// 16-bit facility code and a 16-bit card number.
+	Wiegand34 = Format{Name: "wiegand-34", FacilityBits: 16, CardBits: 16}
+
+	formats = []Format{Wiegand26, Wiegand34}
+)
+
+// DataBits returns the number of bits between the parity bits.
+func (f Format) DataBits() int {
+	return f.FacilityBits + f.CardBits
+}
+
+// Bits returns the length of a frame in this format.
+func (f Format) Bits() int {
+	return f.DataBits() + 2
+}
+
+// Encode returns the frame carrying data, the facility code followed by the
+// card number, with its parity bits. Bits of data beyond DataBits are ignored.
+func (f Format) Encode(data uint64) []bool {
+	bits := append([]bool{false}, Bits(data, f.DataBits())...)
+	bits = append(bits, false)
+	half := f.DataBits() / 2
+	bits[0] = ones(bits[1:1+half])%2 != 0
+	bits[len(bits)-1] = ones(bits[1+half:len(bits)-1])%2 == 0
+	return bits
+}
+
+// Credential is the content of a card frame.
+type Credential struct {
+	// Format of the frame.
+	Format Format
+
+	// The facility code followed by the card number, as sent.
+	Data uint64
+
+	// Facility code and card number, as printed on many cards.
+	Facility uint64
+	Card     uint64
+}
+
+// String returns the facility code and card number, e.g. "12:3456".
+func (c Credential) String() string {
+	return fmt.Sprintf("%d:%d", c.Facility, c.Card)
+}
+
+// Decode checks a card frame's parity and returns its content.
+func Decode(bits []bool) (Credential, error) {
+	for _, f := range formats {
+		if len(bits) != f.Bits() {
+			continue
+		}
+		half := f.DataBits() / 2
+		if ones(bits[:1+half])%2 != 0 || ones(bits[1+half:])%2 != 1 {
+			return Credential{}, fmt.Errorf("%w in %d-bit frame", ErrParity, len(bits))
+		}
+		data := Value(bits[1 : len(bits)-1])
+		return Credential{
+			Format:   f,
+			Data:     data,
+			Facility: data >> uint(f.CardBits),
+			Card:     data & (1<<uint(f.CardBits) - 1),
+		}, nil
+	}
+	return Credential{}, fmt.Errorf("%w: %d bits", ErrLength, len(bits))
+}
+
+// ones returns the number of set bits.
+func ones(bits []bool) int {
+	n := 0
+	for _, bit := range bits {
+		if bit {
+			n++
+		}
+	}
+	return n
+}
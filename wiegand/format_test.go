@@ -0,0 +1,133 @@
+package wiegand
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// frame parses bits written as "0" and "1", ignoring spaces.
+func frame(s string) []bool {
+	bits := []bool{}
+	for _, c := range strings.Replace(s, " ", "", -1) {
+		bits = append(bits, c == '1')
+	}
+	return bits
+}
+
+// bitString returns bits as "0" and "1".
+func bitString(bits []bool) string {
+	var b strings.Builder
+	for _, bit := range bits {
+		if bit {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+// Frames of known facility codes and card numbers: the even parity bit, the
+// facility code, the card number and the odd parity bit.
+var knownFrames = []struct {
+	format   Format
+	facility uint64
+	card     uint64
+	frame    string
+}{
+	{Wiegand26, 1, 1, "1 00000001 0000000000000001 0"},
+	{Wiegand26, 18, 12345, "0 00010010 0011000000111001 1"},
+	{Wiegand26, 188, 24910, "1 10111100 0110000101001110 0"},
+	{Wiegand26, 123, 4567, "1 01111011 0001000111010111 0"},
+	{Wiegand26, 255, 65535, "0 11111111 1111111111111111 1"},
+	{Wiegand26, 0, 0, "0 00000000 0000000000000000 1"},
+	{Wiegand34, 1, 1, "1 0000000000000001 0000000000000001 0"},
+	{Wiegand34, 0x04a1, 0xb2c3, "0 0000010010100001 1011001011000011 1"},
+	{Wiegand34, 1234, 56789, "1 0000010011010010 1101110111010101 0"},
+	{Wiegand34, 65535, 65535, "0 1111111111111111 1111111111111111 1"},
+	{Wiegand34, 0, 0, "0 0000000000000000 0000000000000000 1"},
+}
+
+func TestEncode(t *testing.T) {
+	for _, tt := range knownFrames {
+		data := tt.facility<<uint(tt.format.CardBits) | tt.card
+		got := bitString(tt.format.Encode(data))
+		want := bitString(frame(tt.frame))
+		if got != want {
+			t.Errorf("%s.Encode(%d:%d) = %s, want %s", tt.format.Name, tt.facility, tt.card, got, want)
+		}
+	}
+}
+
+func TestEncodeIgnoresExtraBits(t *testing.T) {
+	got := bitString(Wiegand26.Encode(1<<24 | 1<<16 | 1))
+	want := bitString(frame("1 00000001 0000000000000001 0"))
+	if got != want {
+		t.Errorf("Encode ignoring bit 24 = %s, want %s", got, want)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, tt := range knownFrames {
+		c, err := Decode(frame(tt.frame))
+		if err != nil {
+			t.Errorf("Decode(%s) returned %s", tt.frame, err)
+			continue
+		}
+		if c.Format != tt.format || c.Facility != tt.facility || c.Card != tt.card {
+			t.Errorf("Decode(%s) = %s %s, want %s %d:%d", tt.frame, c.Format.Name, c, tt.format.Name, tt.facility, tt.card)
+		}
+		if c.Data != tt.facility<<uint(tt.format.CardBits)|tt.card {
+			t.Errorf("Decode(%s) has data %x, want the facility code followed by the card number", tt.frame, c.Data)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   string
+		wantErr error
+	}{
+		{"even parity flipped", "0 00000001 0000000000000001 0", ErrParity},
+		{"odd parity flipped", "1 00000001 0000000000000001 1", ErrParity},
+		{"facility bit flipped", "1 00000011 0000000000000001 0", ErrParity},
+		{"card bit in first half flipped", "1 00000001 1000000000000001 0", ErrParity},
+		{"card bit in second half flipped", "1 00000001 0000000000000011 0", ErrParity},
+		{"both parities flipped", "1 00010010 0011000000111001 0", ErrParity},
+		{"34-bit even parity flipped", "1 0000010010100001 1011001011000011 1", ErrParity},
+		{"34-bit odd parity flipped", "0 0000010010100001 1011001011000011 0", ErrParity},
+		{"34-bit data bit flipped", "0 0000010010100001 1011001011000010 1", ErrParity},
+		{"all zeros", "0 00000000 0000000000000000 0", ErrParity},
+		{"all ones", "1 11111111 1111111111111111 1", ErrParity},
+		{"empty", "", ErrLength},
+		{"key press", "0100", ErrLength},
+		{"25 bits", "1 00000001 000000000000001 0", ErrLength},
+		{"27 bits", "1 00000001 00000000000000001 0", ErrLength},
+		{"35 bits", "1 0000000000000001 00000000000000001 0", ErrLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Decode(frame(tt.frame))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decode(%s) = %s, %v, want %s", tt.frame, c, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, f := range []Format{Wiegand26, Wiegand34} {
+		for _, data := range []uint64{0, 1, 0x5a5a5a, 0xa5a5a5, 1<<uint(f.DataBits()) - 1} {
+			c, err := Decode(f.Encode(data))
+			if err != nil {
+				t.Errorf("Decode(%s.Encode(%x)) returned %s", f.Name, data, err)
+				continue
+			}
+			if c.Format != f || c.Data != data {
+				t.Errorf("Decode(%s.Encode(%x)) = %s %x", f.Name, data, c.Format.Name, c.Data)
+			}
+		}
+	}
+}
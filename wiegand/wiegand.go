@@ -0,0 +1,179 @@
+// Package wiegand receives frames over the Wiegand interface used by keypads
+// and card readers.
+//
+// A Wiegand device has two data lines, D0 and D1, pulled high while idle. It
+// sends a 0 bit by pulsing D0 low and a 1 bit by pulsing D1 low, most
+// significant bit first. A frame ends when no pulse follows for FrameGap.
+package wiegand
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pakohan/craftdoor/logging"
+	"periph.io/x/periph/conn/gpio"
+)
+
+const (
+	// FrameGap is how long the data lines must be idle to end a frame.
+	// Devices pause for at least 25ms between frames and pulse every 1-2ms
+	// within a frame.
+	FrameGap = 20 * time.Millisecond
+
+	// pollInterval is how long a line waits for a pulse before checking
+	// whether the receiver was closed.
+	pollInterval = 100 * time.Millisecond
+
+	// Timing used by Transmit.
+	pulseWidth  = 100 * time.Microsecond
+	bitInterval = 2 * time.Millisecond
+)
+
+// Receiver assembles the pulses on a device's data lines into frames.
+type Receiver struct {
+	name   string
+	bits   chan bool
+	frames chan []bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewReceiver starts receiving frames from the device whose D0 and D1 lines
+// are connected to d0 and d1. name identifies the device in log messages.
+//
+// Call Close to stop receiving.
+func NewReceiver(name string, d0, d1 gpio.PinIn) (*Receiver, error) {
+	for _, pin := range []gpio.PinIn{d0, d1} {
+		err := pin.In(gpio.PullUp, gpio.FallingEdge)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", pin, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Receiver{
+		name: name,
+		// Buffered, so that lines don't miss pulses while the frame is
+		// assembled.
+		bits:   make(chan bool, 64),
+		frames: make(chan []bool, 4),
+		cancel: cancel,
+	}
+	r.wg.Add(3)
+	go r.watch(ctx, d0, false)
+	go r.watch(ctx, d1, true)
+	go r.assemble(ctx)
+	return r, nil
+}
+
+// Frames delivers received frames, one bool per bit, most significant bit
+// first. Frames that aren't consumed in time are dropped.
+func (r *Receiver) Frames() <-chan []bool {
+	return r.frames
+}
+
+// Close stops receiving and waits for the receiver's goroutines to return.
+func (r *Receiver) Close() error {
+	r.cancel()
+	r.wg.Wait()
+	return nil
+}
+
+// watch sends bit for each pulse on line until ctx is done.
+func (r *Receiver) watch(ctx context.Context, line gpio.PinIn, bit bool) {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if !line.WaitForEdge(pollInterval) {
+			continue
+		}
+		select {
+		case r.bits <- bit:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// assemble collects bits into frames until ctx is done.
+func (r *Receiver) assemble(ctx context.Context) {
+	defer r.wg.Done()
+	frame := []bool{}
+
+	// Fires FrameGap after the last bit. Nil while no frame is being
+	// received.
+	var gap <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case bit := <-r.bits:
+			frame = append(frame, bit)
+			gap = time.After(FrameGap)
+		case <-gap:
+			select {
+			case r.frames <- frame:
+			default:
+				logging.Warnf("%s: dropping unread %d-bit Wiegand frame.", r.name, len(frame))
+			}
+			frame = []bool{}
+			gap = nil
+		}
+	}
+}
+
+// Line is a data line driven by Transmit, such as a gpiosim.Pin.
+type Line interface {
+	Set(l gpio.Level) error
+}
+
+// Transmit sends bits as a single frame over d0 and d1, like a Wiegand device,
+// and waits until the frame has ended. Used to simulate devices.
+func Transmit(d0, d1 Line, bits []bool) error {
+	for _, bit := range bits {
+		line := d0
+		if bit {
+			line = d1
+		}
+		err := line.Set(gpio.Low)
+		if err != nil {
+			return err
+		}
+		time.Sleep(pulseWidth)
+		err = line.Set(gpio.High)
+		if err != nil {
+			return err
+		}
+		time.Sleep(bitInterval)
+	}
+	time.Sleep(2 * FrameGap)
+	return nil
+}
+
+// Bits returns the n least significant bits of v, most significant first.
+func Bits(v uint64, n int) []bool {
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = v&(1<<uint(n-1-i)) != 0
+	}
+	return bits
+}
+
+// Value returns the number encoded by bits, most significant bit first.
+func Value(bits []bool) uint64 {
+	var v uint64
+	for _, bit := range bits {
+		v <<= 1
+		if bit {
+			v |= 1
+		}
+	}
+	return v
+}